@@ -3,20 +3,56 @@ package main
 import (
 	"context"
 	"discordbot/internal/app"
+	"discordbot/internal/app/config"
+	"discordbot/internal/app/decay"
 	"discordbot/internal/app/discord/api"
 	"discordbot/internal/app/discord/interactions"
 	"discordbot/internal/db"
 	"github.com/aws/aws-lambda-go/lambda"
 	"log"
+	"time"
 )
 
 func HandleRequest(ctx context.Context) (string, error) {
 	conn := db.GetDbConn()
 	discordApi := api.ConcreteDiscordApi{}
+	// Before expiring requests, so players put back in the queue by a failed ready check can be paired again below.
+	readyChecksExpired := interactions.ExpireReadyChecks(conn, discordApi, time.Now())
+	if readyChecksExpired > 0 {
+		log.Printf("Cancelled %d matches whose ready check ran out.", readyChecksExpired)
+	}
+	mapVetoesExpired := interactions.ExpireMapVetoes(conn, discordApi, time.Now())
+	if mapVetoesExpired > 0 {
+		log.Printf("Assigned random maps to %d matches whose map veto ran out.", mapVetoesExpired)
+	}
 	expirySuccess := interactions.ExpireMatchRequests(conn, discordApi)
 	if !expirySuccess {
 		log.Panic("Unable to expire match requests...")
 	}
+	teamEntriesExpired := interactions.ExpireTeamQueueEntries(conn, discordApi, time.Now())
+	if teamEntriesExpired > 0 {
+		log.Printf("Took %d players whose time ran out out of the 2v2 queue.", teamEntriesExpired)
+	}
+	challengesExpired := interactions.ExpireChallenges(conn, discordApi, time.Now())
+	if challengesExpired > 0 {
+		log.Printf("Expired %d unanswered challenges.", challengesExpired)
+	}
+	subscriptionsExpired := db.DeleteExpiredNotifySubscriptions(conn, time.Now())
+	if subscriptionsExpired > 0 {
+		log.Printf("Removed %d expired queue notification subscriptions.", subscriptionsExpired)
+	}
+	matchesStarted := interactions.RunMatchmaker(conn, discordApi, time.Now())
+	if matchesStarted > 0 {
+		log.Printf("Matchmaker started %d matches.", matchesStarted)
+	}
+	teamMatchesStarted := interactions.RunTeamMatchmaker(conn, discordApi, time.Now())
+	if teamMatchesStarted > 0 {
+		log.Printf("Matchmaker started %d 2v2 matches.", teamMatchesStarted)
+	}
+	decayed := decay.ApplyInactivityDecay(conn, time.Now())
+	if len(decayed) > 0 {
+		log.Printf("Decayed %d inactive ratings.", len(decayed))
+	}
 	app.PostMonthlyWinStandings(conn)
 	app.PostEloStandings(conn)
 	return "Success!", nil
@@ -26,5 +62,6 @@ func HandleRequest(ctx context.Context) (string, error) {
 	This is uploaded to a 2nd lambda in prod that is used to run our scheduled jobs.
 */
 func main() {
+	config.ValidateSettings()
 	lambda.Start(HandleRequest)
 }
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"discordbot/internal/app/matchsim"
+	"discordbot/internal/db"
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+type policyFlags []string
+
+func (p *policyFlags) String() string {
+	return strings.Join(*p, " ")
+}
+
+func (p *policyFlags) Set(value string) error {
+	*p = append(*p, value)
+	return nil
+}
+
+// defaultPolicies are compared against the baseline when no -policy is passed.
+var defaultPolicies = []string{"rating-first:rating=0.7,wait=0.3", "even:rating=0.5,wait=0.5", "narrow:range=200", "wide:range=400"}
+
+/*
+	Replays queue arrivals through pairing policies and reports how each would have done. Arrivals either come from
+	match request history, using the same DB_* env vars as cmd/migrate, or are made up from the synthetic flags.
+
+	The baseline is the saved bo1 policy when replaying history and the built in default otherwise. It is always included
+	for comparison, and -policy settings that are left out keep its values.
+*/
+func main() {
+	var policySpecs policyFlags
+	source := flag.String("source", "synthetic", "Where arrivals come from - synthetic or history.")
+	days := flag.Int("days", 30, "How many days of history to replay.")
+	options := matchsim.SyntheticOptions{}
+	flag.IntVar(&options.Arrivals, "arrivals", 500, "How many synthetic arrivals to make up.")
+	flag.IntVar(&options.Players, "players", 60, "How many synthetic players the arrivals are spread over.")
+	flag.Float64Var(&options.ArrivalsPerHour, "per-hour", 12, "How many synthetic arrivals there are an hour on average.")
+	flag.Float64Var(&options.RatingSpread, "rating-spread", 200, "Standard deviation of synthetic player ratings.")
+	flag.Int64Var(&options.Seed, "seed", 1, "Seed for synthetic arrivals.")
+	flag.Var(&policySpecs, "policy", "A policy to compare as name:key=value,... with keys rating, wait, floor, range and window. Can be repeated.")
+	flag.Parse()
+
+	var arrivals []db.QueueArrival
+	baseline := matchsim.DefaultPolicy()
+	switch *source {
+	case "synthetic":
+		if options.Players <= 0 || options.ArrivalsPerHour <= 0 {
+			log.Fatal("-players and -per-hour have to be more than 0.")
+		}
+		arrivals = matchsim.SyntheticArrivals(options, time.Now())
+	case "history":
+		conn := db.GetDbConn()
+		arrivals = db.GetQueueArrivals(conn, time.Now().AddDate(0, 0, -*days))
+		baseline.Matchmaking = db.GetMatchmakingPolicy(conn, db.Bo1)
+		if baseline.Matchmaking.Version > 0 {
+			baseline.Name = fmt.Sprintf("saved-v%d", baseline.Matchmaking.Version)
+		}
+	default:
+		log.Fatalf("Unknown source %q, use synthetic or history.", *source)
+	}
+
+	if len(policySpecs) == 0 {
+		policySpecs = defaultPolicies
+	}
+	policies := []matchsim.Policy{baseline}
+	for _, v := range policySpecs {
+		policy, err := matchsim.ParsePolicy(v, baseline)
+		if err != nil {
+			log.Fatal(err)
+		}
+		policies = append(policies, policy)
+	}
+
+	fmt.Printf("Replaying %d %s arrivals.\n\n", len(arrivals), *source)
+	fmt.Printf("%-16s %8s %8s %10s %10s %10s %8s\n", "policy", "requests", "matches", "avg wait", "p95 wait", "avg gap", "expired")
+	for _, policy := range policies {
+		result := matchsim.Simulate(arrivals, policy)
+		fmt.Printf(
+			"%-16s %8d %8d %10s %10s %10.0f %7.1f%%\n",
+			result.Policy,
+			result.Requests,
+			result.Matches,
+			result.AverageWait.Round(time.Second),
+			result.P95Wait.Round(time.Second),
+			result.AverageRatingGap,
+			100*result.ExpiryRate())
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"discordbot/internal/app/replay"
+	"discordbot/internal/db"
+	"flag"
+	"fmt"
+)
+
+/*
+	Rebuilds ratings from match history. Uses the same DB_* env vars as cmd/migrate and only prints what would change
+	unless -apply is passed.
+*/
+func main() {
+	options := replay.Options{}
+	flag.StringVar(&options.RatingSystem, "rating-system", "", "Rating system to replay with - elo or glicko2. Defaults to RATING_SYSTEM.")
+	flag.Float64Var(&options.K, "k", 0, "Elo K for established players.")
+	flag.Float64Var(&options.ProvisionalK, "provisional-k", 0, "Elo K for provisional players.")
+	flag.IntVar(&options.ProvisionalMatches, "provisional-matches", 0, "How many matches players are provisional for under Elo.")
+	flag.BoolVar(&options.Apply, "apply", false, "Persist the replayed ratings instead of doing a dry run.")
+	flag.Parse()
+
+	report := replay.ReplayRatings(db.GetDbConn(), options)
+
+	fmt.Printf("Replayed %d matches with %s.\n", report.MatchesReplayed, report.RatingSystem)
+	for _, v := range report.Diffs {
+		fmt.Printf("%s (%s): %d -> %d (%+d)\n", v.DiscordUserName, v.GameMode, v.OldRating, v.NewRating, v.NewRating-v.OldRating)
+	}
+	if report.Applied {
+		fmt.Println("Applied replayed ratings.")
+	} else {
+		fmt.Println("Dry run - nothing was changed. Pass -apply to persist.")
+	}
+}
@@ -1,6 +1,7 @@
 package app
 
 import (
+	"discordbot/internal/app/config"
 	"discordbot/internal/app/discord"
 	"github.com/gin-gonic/gin"
 )
@@ -19,11 +20,21 @@ func App() {
 	local HTTP server flows and by lambda startup. Used by cmd/lambda and cmd/api.
 */
 func GetGin() (g *gin.Engine) {
+	config.ValidateSettings()
 	g = gin.Default()
 	g.POST("/commands", installSlashCommandsHandler)
 	g.POST("/maps", setMapsHandler)
 	g.POST("/match-requests/expire", expireMatchRequestsHandler)
 	g.POST("/migrate", migrationHandler)
+	g.POST("/ratings/replay", replayRatingsHandler)
+	g.POST("/ratings/decay", decayRatingsHandler)
+	g.POST("/ratings/decay/revert", revertDecayHandler)
+	g.POST("/seasons/open", openSeasonHandler)
+	g.POST("/seasons/close", closeSeasonHandler)
+	g.GET("/seasons/standings", seasonStandingsHandler)
+	g.GET("/avoids", avoidsHandler)
+	g.GET("/matchmaking/policies", matchmakingPoliciesHandler)
+	g.POST("/matchmaking/policies", saveMatchmakingPolicyHandler)
 	g.POST("/interactions", discord.InteractionsHandler)
 	g.POST("/leaderboard", updateLeaderBoardHandler)
 	return g
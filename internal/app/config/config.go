@@ -1,6 +1,11 @@
 package config
 
-import "os"
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
 
 type AppConfig struct {
 	DiscordBotToken     string
@@ -10,6 +15,140 @@ type AppConfig struct {
 	HomeGuildId         string
 }
 
+/*
+	RatingConfig
+	Rating settings are optional and fall back to defaults so that tests and local dev need no extra env setup.
+*/
+type RatingConfig struct {
+	RatingSystem string
+	// MarginOfVictory makes decisive series results, like a 2-0 in bo3, move ratings further than close ones.
+	MarginOfVictory bool
+	// PlacementMatches is how many matches a player completes on a ladder before they are ranked on it.
+	PlacementMatches int
+}
+
+const (
+	DefaultRatingSystem     = "elo"
+	DefaultPlacementMatches = 5
+)
+
+/*
+	DecayConfig
+	Inactivity decay is off unless RATING_DECAY_DAYS is set. Once a player goes that many days without completing a
+	match on a ladder they lose Points on it, and again every further InactiveDays, but never drop below Floor.
+	HideInactive also leaves them off the ratings board until they play again.
+*/
+type DecayConfig struct {
+	InactiveDays int
+	Points       int
+	Floor        int
+	HideInactive bool
+}
+
+const (
+	DefaultDecayPoints = 25
+	DefaultDecayFloor  = 1200
+)
+
+/*
+	QueueConfig
+	Range expansion is off unless QUEUE_RANGE_EXPANSION_POINTS is set. Once on, a queued player's rating range widens by
+	RangeExpansionPoints for every RangeExpansionMinutes they wait, up to RangeExpansionCap. Players can opt out when
+	they queue.
+
+	The rematch cooldown is off unless either of its settings are. Opponents met within a player's last
+	RematchCooldownMatches matches, or the last RematchCooldownHours, are only paired again while the queue has at most
+	RematchOverrideQueueSize players in it.
+
+	MaxAvoids caps how many players each player can keep on their avoid list.
+
+	Paired players have ReadyCheckMinutes to both accept the match before it is cancelled, 0 skips the ready check.
+
+	Players subscribed to /notify are DMed at most once every NotifyCooldownMinutes.
+*/
+type QueueConfig struct {
+	RangeExpansionPoints     int
+	RangeExpansionMinutes    int
+	RangeExpansionCap        int
+	RematchCooldownMatches   int
+	RematchCooldownHours     int
+	RematchOverrideQueueSize int
+	MaxAvoids                int
+	ReadyCheckMinutes        int
+	NotifyCooldownMinutes    int
+}
+
+const (
+	DefaultRangeExpansionMinutes    = 5
+	DefaultRangeExpansionCap        = 600
+	DefaultRematchOverrideQueueSize = 4
+	DefaultMaxAvoids                = 3
+	DefaultReadyCheckMinutes        = 5
+	DefaultNotifyCooldownMinutes    = 30
+)
+
+func (q QueueConfig) RangeExpansionEnabled() bool {
+	return q.RangeExpansionPoints > 0 && q.RangeExpansionMinutes > 0
+}
+
+/*
+	ChallengeConfig
+	Challenges not accepted within ExpiryMinutes lapse. Two players can play at most PairLimit challenge matches against
+	each other in any PairLimitHours, so rating can't be farmed off one opponent.
+*/
+type ChallengeConfig struct {
+	ExpiryMinutes  int
+	PairLimit      int
+	PairLimitHours int
+}
+
+const (
+	DefaultChallengeExpiryMinutes  = 30
+	DefaultChallengePairLimit      = 2
+	DefaultChallengePairLimitHours = 24
+)
+
+/*
+	DraftConfig
+	Factions are the ones players can pick from in a match's draft, set as a comma separated DRAFT_FACTIONS. Each is a
+	button in a single DM, so there can be at most 25, and a bo3 needs at least 5 so nobody runs out of unplayed picks.
+	Names end up in button ids, so can't contain a colon.
+*/
+type DraftConfig struct {
+	Factions []string
+}
+
+var DefaultDraftFactions = []string{
+	"Beastmen", "Bretonnia", "Chaos Dwarfs", "Daemons of Chaos", "Dark Elves", "Dwarfs", "Empire", "Grand Cathay",
+	"Greenskins", "High Elves", "Khorne", "Kislev", "Lizardmen", "Norsca", "Nurgle", "Ogre Kingdoms", "Skaven",
+	"Slaanesh", "Tomb Kings", "Tzeentch", "Vampire Coast", "Vampire Counts", "Warriors of Chaos", "Wood Elves",
+}
+
+const (
+	MinDraftFactions = 5
+	MaxDraftFactions = 25
+)
+
+/*
+	MapVetoConfig
+	Map veto is off for a game mode unless its MAP_VETO_BANS_<MODE> is set, e.g. MAP_VETO_BANS_BO3=2. Once on, P1 and P2
+	take turns banning that many maps each from the mode's pool before the match's maps are picked from what's left. A
+	player who doesn't ban within TurnMinutes has the rest of the maps assigned at random.
+*/
+type MapVetoConfig struct {
+	BansPerPlayer map[string]int
+	TurnMinutes   int
+}
+
+const DefaultMapVetoTurnMinutes = 5
+
+/*
+	Bans how many maps each player bans in the game mode, 0 if it has no veto.
+*/
+func (m MapVetoConfig) Bans(gameMode string) int {
+	return m.BansPerPlayer[gameMode]
+}
+
 func GetAppConfig() AppConfig {
 	botToken := os.Getenv("DISCORD_BOT_TOKEN")
 	if botToken == "" {
@@ -40,3 +179,107 @@ func GetAppConfig() AppConfig {
 		HomeGuildId:         homeGuildId,
 	}
 }
+
+func GetRatingConfig() RatingConfig {
+	ratingSystem := os.Getenv("RATING_SYSTEM")
+	if ratingSystem == "" {
+		ratingSystem = DefaultRatingSystem
+	}
+	if ratingSystem != "elo" && ratingSystem != "glicko2" {
+		panic("Must provide elo or glicko2 as RATING_SYSTEM, got " + ratingSystem)
+	}
+
+	return RatingConfig{
+		RatingSystem:     ratingSystem,
+		MarginOfVictory:  os.Getenv("RATING_MARGIN_OF_VICTORY") == "true",
+		PlacementMatches: getIntEnv("RATING_PLACEMENT_MATCHES", DefaultPlacementMatches),
+	}
+}
+
+func GetDecayConfig() DecayConfig {
+	return DecayConfig{
+		InactiveDays: getIntEnv("RATING_DECAY_DAYS", 0),
+		Points:       getIntEnv("RATING_DECAY_POINTS", DefaultDecayPoints),
+		Floor:        getIntEnv("RATING_DECAY_FLOOR", DefaultDecayFloor),
+		HideInactive: os.Getenv("RATING_DECAY_HIDE_INACTIVE") == "true",
+	}
+}
+
+func GetQueueConfig() QueueConfig {
+	return QueueConfig{
+		RangeExpansionPoints:     getIntEnv("QUEUE_RANGE_EXPANSION_POINTS", 0),
+		RangeExpansionMinutes:    getIntEnv("QUEUE_RANGE_EXPANSION_MINUTES", DefaultRangeExpansionMinutes),
+		RangeExpansionCap:        getIntEnv("QUEUE_RANGE_EXPANSION_CAP", DefaultRangeExpansionCap),
+		RematchCooldownMatches:   getIntEnv("QUEUE_REMATCH_COOLDOWN_MATCHES", 0),
+		RematchCooldownHours:     getIntEnv("QUEUE_REMATCH_COOLDOWN_HOURS", 0),
+		RematchOverrideQueueSize: getIntEnv("QUEUE_REMATCH_OVERRIDE_SIZE", DefaultRematchOverrideQueueSize),
+		MaxAvoids:                getIntEnv("QUEUE_MAX_AVOIDS", DefaultMaxAvoids),
+		ReadyCheckMinutes:        getIntEnv("QUEUE_READY_CHECK_MINUTES", DefaultReadyCheckMinutes),
+		NotifyCooldownMinutes:    getIntEnv("QUEUE_NOTIFY_COOLDOWN_MINUTES", DefaultNotifyCooldownMinutes),
+	}
+}
+
+func GetChallengeConfig() ChallengeConfig {
+	return ChallengeConfig{
+		ExpiryMinutes:  getIntEnv("CHALLENGE_EXPIRY_MINUTES", DefaultChallengeExpiryMinutes),
+		PairLimit:      getIntEnv("CHALLENGE_PAIR_LIMIT", DefaultChallengePairLimit),
+		PairLimitHours: getIntEnv("CHALLENGE_PAIR_LIMIT_HOURS", DefaultChallengePairLimitHours),
+	}
+}
+
+func GetDraftConfig() DraftConfig {
+	value := os.Getenv("DRAFT_FACTIONS")
+	if value == "" {
+		return DraftConfig{Factions: DefaultDraftFactions}
+	}
+	var factions []string
+	for _, v := range strings.Split(value, ",") {
+		faction := strings.TrimSpace(v)
+		if strings.Contains(faction, ":") {
+			panic("Faction names in DRAFT_FACTIONS can't contain a colon: " + faction)
+		}
+		if faction != "" {
+			factions = append(factions, faction)
+		}
+	}
+	if len(factions) < MinDraftFactions || len(factions) > MaxDraftFactions {
+		panic(fmt.Sprintf("Must provide between %d and %d factions in DRAFT_FACTIONS", MinDraftFactions, MaxDraftFactions))
+	}
+	return DraftConfig{Factions: factions}
+}
+
+func GetMapVetoConfig() MapVetoConfig {
+	bansPerPlayer := map[string]int{}
+	for _, v := range []string{"bo1", "bo3", "2v2"} {
+		bansPerPlayer[v] = getIntEnv("MAP_VETO_BANS_"+strings.ToUpper(v), 0)
+	}
+	return MapVetoConfig{
+		BansPerPlayer: bansPerPlayer,
+		TurnMinutes:   getIntEnv("MAP_VETO_TURN_MINUTES", DefaultMapVetoTurnMinutes),
+	}
+}
+
+/*
+	ValidateSettings reads every optional setting once, so a bad value panics when the app starts rather than part way
+	through handling an interaction, after some of it has already been saved.
+*/
+func ValidateSettings() {
+	GetRatingConfig()
+	GetDecayConfig()
+	GetQueueConfig()
+	GetChallengeConfig()
+	GetDraftConfig()
+	GetMapVetoConfig()
+}
+
+func getIntEnv(name string, defaultValue int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return defaultValue
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		panic("Must provide an integer for env var " + name)
+	}
+	return parsed
+}
@@ -0,0 +1,66 @@
+package decay
+
+import (
+	"discordbot/internal/app/config"
+	"discordbot/internal/app/ratings"
+	"discordbot/internal/db"
+	"gorm.io/gorm"
+	"log"
+	"time"
+)
+
+type DecayedRating struct {
+	UserId    int         `json:"user_id"`
+	GameMode  db.GameMode `json:"game_mode"`
+	OldRating int         `json:"old_rating"`
+	NewRating int         `json:"new_rating"`
+}
+
+/*
+	ApplyInactivityDecay
+	Knocks DecayConfig.Points off every rating whose owner hasn't completed a match on that ladder in
+	DecayConfig.InactiveDays. Each decay counts as activity for the next check so a player is decayed at most once
+	per InactiveDays. Does nothing unless decay is configured.
+*/
+func ApplyInactivityDecay(conn *gorm.DB, now time.Time) (decayed []DecayedRating) {
+	decayConfig := config.GetDecayConfig()
+	if decayConfig.InactiveDays <= 0 || decayConfig.Points <= 0 {
+		return decayed
+	}
+
+	inactiveSince := now.AddDate(0, 0, -decayConfig.InactiveDays)
+	for _, v := range db.FindInactiveRatings(conn, inactiveSince, decayConfig.Floor) {
+		newRating := decayRating(v.Rating, decayConfig.Points, decayConfig.Floor)
+		if !db.DecayUserRating(conn, v.UserId, v.GameMode, newRating, now) {
+			log.Printf("Unable to decay %s rating for user %d", v.GameMode, v.UserId)
+			continue
+		}
+		decayed = append(decayed, DecayedRating{
+			UserId:    v.UserId,
+			GameMode:  v.GameMode,
+			OldRating: v.Rating.Rating,
+			NewRating: newRating.Rating,
+		})
+	}
+	return decayed
+}
+
+/*
+	IsHiddenFromBoard whether a player should be left off the ratings board for being inactive. Players who have never
+	completed a match on the ladder stay visible.
+*/
+func IsHiddenFromBoard(lastMatchAt time.Time, now time.Time) bool {
+	decayConfig := config.GetDecayConfig()
+	if !decayConfig.HideInactive || decayConfig.InactiveDays <= 0 || lastMatchAt.IsZero() {
+		return false
+	}
+	return lastMatchAt.Before(now.AddDate(0, 0, -decayConfig.InactiveDays))
+}
+
+func decayRating(rating ratings.PlayerRating, points int, floor int) ratings.PlayerRating {
+	rating.Rating -= points
+	if rating.Rating < floor {
+		rating.Rating = floor
+	}
+	return rating
+}
@@ -0,0 +1,81 @@
+package decay
+
+import (
+	"discordbot/internal/app/ratings"
+	"discordbot/internal/db"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestDecayRating(t *testing.T) {
+	rating := ratings.PlayerRating{Rating: 1400, Deviation: 80, Volatility: 0.06, GamesPlayed: 30}
+
+	decayed := decayRating(rating, 25, 1200)
+	assert.Equal(t, 1375, decayed.Rating)
+	assert.Equal(t, 80.0, decayed.Deviation)
+	assert.Equal(t, 30, decayed.GamesPlayed)
+
+	// Never decays below the floor.
+	assert.Equal(t, 1200, decayRating(ratings.PlayerRating{Rating: 1210}, 25, 1200).Rating)
+}
+
+func TestIsHiddenFromBoard(t *testing.T) {
+	now := time.Now()
+	longAgo := now.AddDate(0, 0, -60)
+
+	t.Setenv("RATING_DECAY_DAYS", "30")
+	assert.False(t, IsHiddenFromBoard(longAgo, now))
+
+	t.Setenv("RATING_DECAY_HIDE_INACTIVE", "true")
+	assert.True(t, IsHiddenFromBoard(longAgo, now))
+	assert.False(t, IsHiddenFromBoard(now.AddDate(0, 0, -1), now))
+	assert.False(t, IsHiddenFromBoard(time.Time{}, now))
+}
+
+func TestApplyInactivityDecayAfterRevert(t *testing.T) {
+	t.Setenv("RATING_DECAY_DAYS", "30")
+	t.Setenv("RATING_DECAY_POINTS", "25")
+	conn := db.GetGorm(db.GetTestMysSQLConnStr())
+	rand.Seed(time.Now().UnixNano())
+
+	var users []db.User
+	for i := 0; i < 2; i++ {
+		discordId := fmt.Sprintf("somediscordId%d", rand.Intn(1000000))
+		db.CreateUser(conn, db.User{DiscordId: discordId, DiscordUserName: fmt.Sprintf("coolsk8r1990%d", rand.Intn(1000000))})
+		_, user := db.GetUserByDiscordId(conn, discordId)
+		db.UpdateUserRating(conn, user.UserId, db.Bo3, ratings.PlayerRating{Rating: 1500, Deviation: ratings.DefaultDeviation, Volatility: ratings.DefaultVolatility}, -1)
+		users = append(users, user)
+	}
+	longAgo := time.Now().AddDate(0, 0, -60)
+	db.CreateMatch(conn, db.Match{
+		CreatedAt:        longAgo,
+		UpdatedAt:        longAgo,
+		MatchState:       db.Completed,
+		GameMode:         db.Bo3,
+		P1UserId:         users[0].UserId,
+		P2UserId:         users[1].UserId,
+		P1MatchRequestId: -1,
+		P2MatchRequestId: -1,
+		Winner:           db.P1,
+	})
+
+	wasDecayed := func(decayed []DecayedRating) bool {
+		for _, v := range decayed {
+			if v.UserId == users[0].UserId && v.GameMode == db.Bo3 {
+				return true
+			}
+		}
+		return false
+	}
+
+	assert.True(t, wasDecayed(ApplyInactivityDecay(conn, time.Now())))
+	assert.Equal(t, 1475, db.GetUserRating(conn, users[0].UserId, db.Bo3).Rating)
+	assert.True(t, db.RevertLatestDecay(conn, users[0].UserId, db.Bo3))
+
+	// The next job run leaves the reverted player alone.
+	assert.False(t, wasDecayed(ApplyInactivityDecay(conn, time.Now())))
+	assert.Equal(t, 1500, db.GetUserRating(conn, users[0].UserId, db.Bo3).Rating)
+}
@@ -25,7 +25,44 @@ type Message struct {
 }
 
 type MessageToPost struct {
-	Content string `json:"content"`
+	Content    string      `json:"content"`
+	Components []ActionRow `json:"components,omitempty"`
+}
+
+const (
+	ActionRowComponentType = 1
+	ButtonComponentType    = 2
+)
+
+const (
+	PrimaryButtonStyle   = 1
+	SecondaryButtonStyle = 2
+	SuccessButtonStyle   = 3
+	DangerButtonStyle    = 4
+)
+
+/*
+	ActionRow a row of buttons under a message. Pressing one sends the bot an interaction carrying its CustomId.
+*/
+type ActionRow struct {
+	Type       int      `json:"type"`
+	Components []Button `json:"components"`
+}
+
+type Button struct {
+	Type     int    `json:"type"`
+	Style    int    `json:"style"`
+	Label    string `json:"label"`
+	CustomId string `json:"custom_id"`
+	// Disabled buttons are shown greyed out and can't be pressed.
+	Disabled bool `json:"disabled,omitempty"`
+}
+
+func NewActionRow(buttons ...Button) ActionRow {
+	for i := range buttons {
+		buttons[i].Type = ButtonComponentType
+	}
+	return ActionRow{Type: ActionRowComponentType, Components: buttons}
 }
 
 type DiscordUser struct {
@@ -46,10 +83,43 @@ type ObnoxiousDiscordAlternateDMUserData struct {
 	User DiscordUser `json:"user"`
 }
 
+/*
+	OptionData
+	Discord sends integer option values as numbers, boolean options as true or false and everything else, like the ids
+	picked by user options, as strings. Value, BoolValue and StringValue hold each of those. Subcommands have no value,
+	just their own Options.
+*/
 type OptionData struct {
-	Type  int    `json:"type"`
-	Name  string `json:"name"`
-	Value int    `json:"value"`
+	Type        int          `json:"type"`
+	Name        string       `json:"name"`
+	Value       int          `json:"value"`
+	BoolValue   bool         `json:"-"`
+	StringValue string       `json:"-"`
+	Options     []OptionData `json:"options"`
+}
+
+func (o *OptionData) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Type    int             `json:"type"`
+		Name    string          `json:"name"`
+		Value   json.RawMessage `json:"value"`
+		Options []OptionData    `json:"options"`
+	}
+	err := json.Unmarshal(data, &raw)
+	if err != nil {
+		return err
+	}
+	*o = OptionData{Type: raw.Type, Name: raw.Name, Options: raw.Options}
+	if len(raw.Value) == 0 {
+		return nil
+	}
+	if raw.Value[0] == '"' {
+		return json.Unmarshal(raw.Value, &o.StringValue)
+	}
+	if raw.Value[0] == 't' || raw.Value[0] == 'f' {
+		return json.Unmarshal(raw.Value, &o.BoolValue)
+	}
+	return json.Unmarshal(raw.Value, &o.Value)
 }
 
 type InteractionData struct {
@@ -57,6 +127,9 @@ type InteractionData struct {
 	Type    int                  `json:"type"`
 	Name    commands.CommandName `json:"name"`
 	Id      string               `json:"id"`
+	// CustomId and ComponentType are only sent when a button is pressed.
+	CustomId      string `json:"custom_id"`
+	ComponentType int    `json:"component_type"`
 }
 
 type Interaction struct {
@@ -76,6 +149,8 @@ const maxMessageCharsLength = 1800
 type DiscordApi interface {
 	AddRoleToGuildMember(roleName string, userId string) (success bool)
 	RemoveRoleFromGuildMember(roleName string, userId string) (success bool)
+	SendDirectMessage(recipient db.User, message string, components ...ActionRow) (success bool)
+	PostToChannel(channelName string, message string) (success bool)
 }
 
 type ConcreteDiscordApi struct {
@@ -246,9 +321,12 @@ func UpsertDmChannel(recipient db.User) (createdChannel bool, response Channel)
 }
 
 func PostOneMessage(channelId string, content string) (success bool, response Message) {
+	return postMessage(channelId, MessageToPost{Content: content})
+}
+
+func postMessage(channelId string, message MessageToPost) (success bool, response Message) {
 	incrementalUrl := fmt.Sprintf("channels/%s/messages", channelId)
-	postBody := map[string]string{"content": content}
-	body, err := json.Marshal(postBody)
+	body, err := json.Marshal(message)
 	if err != nil {
 		panic(err)
 	}
@@ -368,6 +446,19 @@ func (c ConcreteDiscordApi) RemoveRoleFromGuildMember(roleName string, userId st
 	return true
 }
 
+func (c ConcreteDiscordApi) SendDirectMessage(recipient db.User, message string, components ...ActionRow) (success bool) {
+	foundChannel, channel := UpsertDmChannel(recipient)
+	if !foundChannel {
+		return false
+	}
+	success, _ = postMessage(channel.ChannelId, MessageToPost{Content: message, Components: components})
+	return success
+}
+
+func (c ConcreteDiscordApi) PostToChannel(channelName string, message string) (success bool) {
+	return CrossPostMessageByName(channelName, message)
+}
+
 func callDiscord(incrementalUrl string, method string, serializedBody []byte) (statusCode int, body []byte) {
 	url := fmt.Sprintf("%s/%s", commands.DiscordV10AppBase, incrementalUrl)
 
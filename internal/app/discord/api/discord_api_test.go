@@ -0,0 +1,53 @@
+package api
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestUnmarshalOptionData(t *testing.T) {
+	var data InteractionData
+	err := json.Unmarshal([]byte(`{"name": "odds", "options": [{"type": 4, "name": "mode", "value": 2}, {"type": 6, "name": "opponent", "value": "80351110224678912"}]}`), &data)
+
+	assert.Nil(t, err)
+	assert.Len(t, data.Options, 2)
+	assert.Equal(t, 2, data.Options[0].Value)
+	assert.Equal(t, "", data.Options[0].StringValue)
+	assert.Equal(t, "opponent", data.Options[1].Name)
+	assert.Equal(t, "80351110224678912", data.Options[1].StringValue)
+
+	err = json.Unmarshal([]byte(`{"name": "queue", "options": [{"type": 5, "name": "expand_range", "value": false}, {"type": 5, "name": "other", "value": true}]}`), &data)
+
+	assert.Nil(t, err)
+	assert.False(t, data.Options[0].BoolValue)
+	assert.Equal(t, 0, data.Options[0].Value)
+	assert.True(t, data.Options[1].BoolValue)
+
+	err = json.Unmarshal([]byte(`{"name": "avoid", "options": [{"type": 1, "name": "add", "options": [{"type": 6, "name": "player", "value": "80351110224678912"}]}]}`), &data)
+
+	assert.Nil(t, err)
+	assert.Equal(t, "add", data.Options[0].Name)
+	assert.Len(t, data.Options[0].Options, 1)
+	assert.Equal(t, "80351110224678912", data.Options[0].Options[0].StringValue)
+}
+
+func TestComponentInteraction(t *testing.T) {
+	var interaction Interaction
+	err := json.Unmarshal([]byte(`{"type": 3, "data": {"custom_id": "ready_check:accepted:12", "component_type": 2}}`), &interaction)
+
+	assert.Nil(t, err)
+	assert.Equal(t, 3, interaction.Type)
+	assert.Equal(t, "ready_check:accepted:12", interaction.Data.CustomId)
+	assert.Equal(t, ButtonComponentType, interaction.Data.ComponentType)
+
+	serialized, err := json.Marshal(MessageToPost{Content: "hi", Components: []ActionRow{NewActionRow(Button{Style: SuccessButtonStyle, Label: "Accept", CustomId: "accept"})}})
+
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{"content": "hi", "components": [{"type": 1, "components": [{"type": 2, "style": 3, "label": "Accept", "custom_id": "accept"}]}]}`, string(serialized))
+
+	serialized, err = json.Marshal(MessageToPost{Content: "hi"})
+
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{"content": "hi"}`, string(serialized))
+}
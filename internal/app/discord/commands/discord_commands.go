@@ -32,14 +32,23 @@ type CommandOption struct {
 	Type        int                   `json:"type"`
 	Required    bool                  `json:"required"`
 	Choices     []CommandOptionChoice `json:"choices"`
+	// Options are only set on subcommands (Type 1), for their own options.
+	Options []CommandOption `json:"options,omitempty"`
 }
 
 type CommandName string
 
 const (
-	Queue   CommandName = "queue"
-	Dequeue CommandName = "dequeue"
-	Report  CommandName = "report"
+	Queue       CommandName = "queue"
+	Dequeue     CommandName = "dequeue"
+	Report      CommandName = "report"
+	Odds        CommandName = "odds"
+	Avoid       CommandName = "avoid"
+	Region      CommandName = "region"
+	QueueStatus CommandName = "queue-status"
+	Notify      CommandName = "notify"
+	Challenge   CommandName = "challenge"
+	QueueTeam   CommandName = "queue-2v2"
 )
 
 type ReportOutcome int
@@ -48,6 +57,18 @@ const (
 	Win    ReportOutcome = 0
 	Loss   ReportOutcome = 1
 	Cancel ReportOutcome = 2
+	Draw   ReportOutcome = 3
+)
+
+/*
+	SeriesScore how a bo3 series went, always from the series winner's point of view regardless of who reports it.
+*/
+type SeriesScore int
+
+const (
+	TwoNil               SeriesScore = 0
+	TwoOneLostFirstGame  SeriesScore = 1
+	TwoOneLostSecondGame SeriesScore = 2
 )
 
 /*
@@ -84,41 +105,387 @@ func InstallGlobalCommands(config config.AppConfig) {
 				},
 				{
 					Name:        "range",
-					Description: "How many elo points up and down you want to match into. Defaults to 300.",
+					Description: "How many elo points up and down you want to match into. Usually defaults to 300.",
+					Type:        4,
+					Required:    false,
+				},
+				{
+					Name:        "expand_range",
+					Description: "Whether your range can widen the longer you wait. Defaults to true.",
+					Type:        5,
+					Required:    false,
+				},
+				{
+					Name:        "region",
+					Description: "How far from your home region you will play. Defaults to any.",
+					Type:        4,
+					Required:    false,
+					Choices: []CommandOptionChoice{
+						{
+							Name:  "same region only",
+							Value: db.RegionPreferenceToInt(db.SameRegion),
+						},
+						{
+							Name:  "neighbouring regions",
+							Value: db.RegionPreferenceToInt(db.NeighbouringRegions),
+						},
+						{
+							Name:  "any",
+							Value: db.RegionPreferenceToInt(db.AnyRegion),
+						},
+					},
+				},
+				{
+					Name:        "available_for",
+					Description: "How long you can wait for a match before leaving the queue. Usually defaults to 45 minutes.",
+					Type:        4,
+					Required:    false,
+					Choices: []CommandOptionChoice{
+						{
+							Name:  "15 minutes",
+							Value: 15,
+						},
+						{
+							Name:  "30 minutes",
+							Value: 30,
+						},
+						{
+							Name:  "45 minutes",
+							Value: 45,
+						},
+						{
+							Name:  "1 hour",
+							Value: 60,
+						},
+						{
+							Name:  "2 hours",
+							Value: 120,
+						},
+						{
+							Name:  "3 hours",
+							Value: 180,
+						},
+					},
+				},
+			},
+		},
+		{
+			Name:        QueueTeam,
+			Type:        1,
+			Description: "Enter the 2v2 queue with a partner, or alone to be teamed up with another player.",
+			Options: []CommandOption{
+				{
+					Name:        "partner",
+					Description: "Who you want to play with. They need to queue naming you back.",
+					Type:        6,
+					Required:    false,
+				},
+				{
+					Name:        "available_for",
+					Description: "How long you can wait for a match before leaving the queue. Usually defaults to 45 minutes.",
 					Type:        4,
 					Required:    false,
+					Choices: []CommandOptionChoice{
+						{
+							Name:  "15 minutes",
+							Value: 15,
+						},
+						{
+							Name:  "30 minutes",
+							Value: 30,
+						},
+						{
+							Name:  "45 minutes",
+							Value: 45,
+						},
+						{
+							Name:  "1 hour",
+							Value: 60,
+						},
+						{
+							Name:  "2 hours",
+							Value: 120,
+						},
+						{
+							Name:  "3 hours",
+							Value: 180,
+						},
+					},
 				},
 			},
 		},
 		{
 			Name:        Dequeue,
 			Type:        1,
-			Description: "Leave the matchmaking queue.",
+			Description: "Leave the matchmaking queue, 1v1 or 2v2.",
 		},
 		{
 			Name:        Report,
 			Type:        1,
 			Description: "Report the result of your most recent match.",
-			Options: []CommandOption{{
-				Name:        "outcome",
-				Description: "Win or Loss reports a result, Cancel cancels the match without playing it or changing ratings.",
-				Type:        4,
-				Required:    true,
-				Choices: []CommandOptionChoice{
-					{
-						Name:  "Win",
-						Value: int(Win),
+			Options: []CommandOption{
+				{
+					Name:        "outcome",
+					Description: "Win, Loss or a mutually agreed Draw reports a result, Cancel cancels the match without changing ratings.",
+					Type:        4,
+					Required:    true,
+					Choices: []CommandOptionChoice{
+						{
+							Name:  "Win",
+							Value: int(Win),
+						},
+						{
+							Name:  "Loss",
+							Value: int(Loss),
+						},
+						{
+							Name:  "Cancel",
+							Value: int(Cancel),
+						},
+						{
+							Name:  "Draw",
+							Value: int(Draw),
+						},
+					},
+				},
+				{
+					Name:        "score",
+					Description: "Optional for bo3 - the series score from the winner's side.",
+					Type:        4,
+					Required:    false,
+					Choices: []CommandOptionChoice{
+						{
+							Name:  "2-0",
+							Value: int(TwoNil),
+						},
+						{
+							Name:  "2-1 (winner lost game 1)",
+							Value: int(TwoOneLostFirstGame),
+						},
+						{
+							Name:  "2-1 (winner lost game 2)",
+							Value: int(TwoOneLostSecondGame),
+						},
+					},
+				},
+			},
+		},
+		{
+			Name:        Odds,
+			Type:        1,
+			Description: "Show your odds and what ratings are at stake in your current match, or against any player.",
+			Options: []CommandOption{
+				{
+					Name:        "opponent",
+					Description: "Check the odds against this player instead of your current opponent.",
+					Type:        6,
+					Required:    false,
+				},
+				{
+					Name:        "mode",
+					Description: "Which ladder to check the odds on against a named opponent. Defaults to bo1.",
+					Type:        4,
+					Required:    false,
+					Choices: []CommandOptionChoice{
+						{
+							Name:  "bo1",
+							Value: db.ToInt(db.Bo1),
+						},
+						{
+							Name:  "bo3",
+							Value: db.ToInt(db.Bo3),
+						},
+					},
+				},
+			},
+		},
+		{
+			Name:        Avoid,
+			Type:        1,
+			Description: "Manage the players you never want to be paired with.",
+			Options: []CommandOption{
+				{
+					Name:        "add",
+					Description: "Never be paired with this player.",
+					Type:        1,
+					Options: []CommandOption{
+						{
+							Name:        "player",
+							Description: "The player to avoid.",
+							Type:        6,
+							Required:    true,
+						},
+					},
+				},
+				{
+					Name:        "remove",
+					Description: "Allow pairing with this player again.",
+					Type:        1,
+					Options: []CommandOption{
+						{
+							Name:        "player",
+							Description: "The player to stop avoiding.",
+							Type:        6,
+							Required:    true,
+						},
+					},
+				},
+				{
+					Name:        "list",
+					Description: "Show who you are avoiding.",
+					Type:        1,
+				},
+			},
+		},
+		{
+			Name:        Region,
+			Type:        1,
+			Description: "Set the region you play from.",
+			Options: []CommandOption{
+				{
+					Name:        "home",
+					Description: "Your home region.",
+					Type:        4,
+					Required:    true,
+					Choices: []CommandOptionChoice{
+						{
+							Name:  "EU",
+							Value: db.RegionToInt(db.EU),
+						},
+						{
+							Name:  "NA",
+							Value: db.RegionToInt(db.NA),
+						},
+						{
+							Name:  "OCE",
+							Value: db.RegionToInt(db.OCE),
+						},
 					},
-					{
-						Name:  "Loss",
-						Value: int(Loss),
+				},
+			},
+		},
+		{
+			Name:        QueueStatus,
+			Type:        1,
+			Description: "See how many players are queued and how many are in your range, without names.",
+		},
+		{
+			Name:        Notify,
+			Type:        1,
+			Description: "Get a DM when someone in your range queues, instead of waiting in the queue.",
+			Options: []CommandOption{
+				{
+					Name:        "on",
+					Description: "Start or change your queue notifications.",
+					Type:        1,
+					Options: []CommandOption{
+						{
+							Name:        "mode",
+							Description: "Which game modes to be notified about.",
+							Type:        4,
+							Required:    true,
+							Choices: []CommandOptionChoice{
+								{
+									Name:  "bo1",
+									Value: db.ToInt(db.Bo1),
+								},
+								{
+									Name:  "bo3",
+									Value: db.ToInt(db.Bo3),
+								},
+								{
+									Name:  "all",
+									Value: db.ToInt(db.All),
+								},
+							},
+						},
+						{
+							Name:        "range",
+							Description: "How many elo points up and down to be notified about. Usually defaults to 300.",
+							Type:        4,
+							Required:    false,
+						},
+						{
+							Name:        "from_hour",
+							Description: "Only notify from this hour of the day, 0-23 UTC. Needs to_hour too.",
+							Type:        4,
+							Required:    false,
+						},
+						{
+							Name:        "to_hour",
+							Description: "Stop notifying at this hour of the day, 0-23 UTC.",
+							Type:        4,
+							Required:    false,
+						},
+						{
+							Name:        "hours",
+							Description: "How long to keep notifying you. Defaults to 6 hours.",
+							Type:        4,
+							Required:    false,
+							Choices: []CommandOptionChoice{
+								{
+									Name:  "1 hour",
+									Value: 1,
+								},
+								{
+									Name:  "3 hours",
+									Value: 3,
+								},
+								{
+									Name:  "6 hours",
+									Value: 6,
+								},
+								{
+									Name:  "12 hours",
+									Value: 12,
+								},
+								{
+									Name:  "1 day",
+									Value: 24,
+								},
+								{
+									Name:  "1 week",
+									Value: 168,
+								},
+							},
+						},
 					},
-					{
-						Name:  "Cancel",
-						Value: int(Cancel),
+				},
+				{
+					Name:        "off",
+					Description: "Stop your queue notifications.",
+					Type:        1,
+				},
+			},
+		},
+		{
+			Name:        Challenge,
+			Type:        1,
+			Description: "Challenge a player to a rated match outside the queue.",
+			Options: []CommandOption{
+				{
+					Name:        "player",
+					Description: "The player to challenge.",
+					Type:        6,
+					Required:    true,
+				},
+				{
+					Name:        "mode",
+					Description: "Which ladder to play on. Defaults to bo1.",
+					Type:        4,
+					Required:    false,
+					Choices: []CommandOptionChoice{
+						{
+							Name:  "bo1",
+							Value: db.ToInt(db.Bo1),
+						},
+						{
+							Name:  "bo3",
+							Value: db.ToInt(db.Bo3),
+						},
 					},
 				},
-			}},
+			},
 		},
 	}
 
@@ -23,6 +23,20 @@ type PingResponse struct {
 	Type int `json:"type"`
 }
 
+// EphemeralFlag marks a reply as only visible to the user who sent the command.
+const EphemeralFlag = 64
+
+/*
+	privateCommands reply only to the user who sent them, since the answer is nobody else's business.
+*/
+var privateCommands = map[commands.CommandName]bool{
+	commands.Avoid:       true,
+	commands.Region:      true,
+	commands.QueueStatus: true,
+	commands.Notify:      true,
+	commands.Challenge:   true,
+}
+
 func InteractionsHandler(c *gin.Context) {
 	appConfig := config.GetAppConfig()
 
@@ -54,6 +68,14 @@ func InteractionsHandler(c *gin.Context) {
 				// failures don't get reported.
 				api.CrossPostMessageByName(interactions.LadderFeedChannel, message)
 			}
+			data := gin.H{"content": message}
+			if privateCommands[interaction.Data.Name] {
+				data["flags"] = EphemeralFlag
+			}
+			c.JSON(http.StatusOK, gin.H{"type": 4, "data": data})
+			break
+		case 3:
+			message := handleInteractionComponent(interaction)
 			c.JSON(http.StatusOK, gin.H{"type": 4, "data": gin.H{"content": message}})
 			break
 		default:
@@ -107,13 +129,51 @@ func handleInteractionCommand(interaction api.Interaction) (channelMessage strin
 	case commands.Queue:
 		_, channelMessage, shouldCrossPost = interactions.Queue(conn, discordApi, interaction)
 		break
+	case commands.QueueTeam:
+		_, channelMessage, shouldCrossPost = interactions.QueueTeam(conn, discordApi, interaction)
+		break
 	case commands.Dequeue:
 		_, channelMessage, shouldCrossPost = interactions.Dequeue(conn, discordApi, interaction)
 		break
 	case commands.Report:
 		_, channelMessage, shouldCrossPost = interactions.Report(conn, discordApi, interaction)
+	case commands.Odds:
+		_, channelMessage, shouldCrossPost = interactions.Odds(conn, discordApi, interaction)
+	case commands.Avoid:
+		_, channelMessage, shouldCrossPost = interactions.Avoid(conn, discordApi, interaction)
+	case commands.Region:
+		_, channelMessage, shouldCrossPost = interactions.SetRegion(conn, discordApi, interaction)
+	case commands.QueueStatus:
+		_, channelMessage, shouldCrossPost = interactions.QueueStatus(conn, discordApi, interaction)
+	case commands.Notify:
+		_, channelMessage, shouldCrossPost = interactions.Notify(conn, discordApi, interaction)
+	case commands.Challenge:
+		_, channelMessage, shouldCrossPost = interactions.Challenge(conn, discordApi, interaction)
 	default:
 		panic("Unknown interaction: " + interaction.Data.Name)
 	}
 	return channelMessage, shouldCrossPost
 }
+
+/*
+	handleInteractionComponent handles a press of a button the bot sent. Buttons are told apart by their custom id.
+*/
+func handleInteractionComponent(interaction api.Interaction) (channelMessage string) {
+	conn := db.GetDbConn()
+
+	discordApi := api.ConcreteDiscordApi{}
+
+	switch {
+	case interactions.IsReadyCheckCustomId(interaction.Data.CustomId):
+		_, channelMessage, _ = interactions.ReadyCheck(conn, discordApi, interaction)
+	case interactions.IsChallengeCustomId(interaction.Data.CustomId):
+		_, channelMessage, _ = interactions.RespondToChallenge(conn, discordApi, interaction)
+	case interactions.IsDraftCustomId(interaction.Data.CustomId):
+		_, channelMessage, _ = interactions.Draft(conn, discordApi, interaction)
+	case interactions.IsMapVetoCustomId(interaction.Data.CustomId):
+		_, channelMessage, _ = interactions.MapVeto(conn, discordApi, interaction)
+	default:
+		panic("Unknown component: " + interaction.Data.CustomId)
+	}
+	return channelMessage
+}
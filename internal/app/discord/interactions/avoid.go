@@ -0,0 +1,85 @@
+package interactions
+
+import (
+	"discordbot/internal/app/config"
+	"discordbot/internal/app/discord/api"
+	"discordbot/internal/db"
+	"fmt"
+	"gorm.io/gorm"
+	"strings"
+	"time"
+)
+
+/*
+	Avoid manages the user's avoid list with the add, remove and list subcommands. Players on it are never paired with
+	the user, whichever of them queues first. The list is capped so it can't be used to dodge the top of the ladder.
+*/
+func Avoid(conn *gorm.DB, discordApi api.DiscordApi, interaction api.Interaction) (success bool, channelMessage string, shouldCrossPost bool) {
+	if len(interaction.Data.Options) == 0 {
+		return false, "Choose add, remove or list.", false
+	}
+	subcommand := interaction.Data.Options[0]
+
+	foundUser, user := db.GetUserByDiscordId(conn, interaction.Member.User.Id)
+	if !foundUser {
+		return false, "You aren't on the ladder yet, queue up first.", false
+	}
+
+	if subcommand.Name == "list" {
+		return true, describeAvoids(db.GetUserAvoids(conn, user.UserId)), false
+	}
+
+	playerDiscordId := ""
+	for _, v := range subcommand.Options {
+		if v.Name == "player" {
+			playerDiscordId = v.StringValue
+		}
+	}
+	foundPlayer, player := db.GetUserByDiscordId(conn, playerDiscordId)
+	if !foundPlayer {
+		return false, "That player isn't on the ladder yet.", false
+	}
+
+	switch subcommand.Name {
+	case "add":
+		return addAvoid(conn, user, player)
+	case "remove":
+		if !db.RemoveUserAvoid(conn, user.UserId, player.UserId) {
+			return false, fmt.Sprintf("You weren't avoiding %s.", player.DiscordUserName), false
+		}
+		return true, fmt.Sprintf("You can be paired with %s again.", player.DiscordUserName), false
+	default:
+		return false, "Unknown avoid subcommand: " + subcommand.Name, false
+	}
+}
+
+func addAvoid(conn *gorm.DB, user db.User, player db.User) (success bool, channelMessage string, shouldCrossPost bool) {
+	if player.UserId == user.UserId {
+		return false, "You can't avoid yourself.", false
+	}
+	avoids := db.GetUserAvoids(conn, user.UserId)
+	for _, v := range avoids {
+		if v.AvoidedUserId == player.UserId {
+			return false, fmt.Sprintf("You are already avoiding %s.", player.DiscordUserName), false
+		}
+	}
+	maxAvoids := config.GetQueueConfig().MaxAvoids
+	if len(avoids) >= maxAvoids {
+		return false, fmt.Sprintf("You can avoid at most %d players, remove one before adding another.", maxAvoids), false
+	}
+	if !db.AddUserAvoid(conn, user.UserId, player.UserId, time.Now()) {
+		return false, "Unable to update your avoid list.", false
+	}
+	return true, fmt.Sprintf("You won't be paired with %s.", player.DiscordUserName), false
+}
+
+func describeAvoids(avoids []db.UserAvoid) string {
+	if len(avoids) == 0 {
+		return "You aren't avoiding anyone."
+	}
+	var names []string
+	for _, v := range avoids {
+		names = append(names, v.AvoidedDiscordUserName)
+	}
+	return fmt.Sprintf("You are avoiding (%d/%d): %s.", len(avoids), config.GetQueueConfig().MaxAvoids, strings.Join(names, ", "))
+}
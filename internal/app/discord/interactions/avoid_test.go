@@ -0,0 +1,73 @@
+package interactions
+
+import (
+	"discordbot/internal/app/discord/api"
+	"discordbot/internal/app/discord/commands"
+	"discordbot/internal/db"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func createTestUser(conn *gorm.DB) (user db.User) {
+	discordId := fmt.Sprintf("somediscordId%d", rand.Intn(1000000))
+	db.CreateUser(conn, db.User{DiscordId: discordId, DiscordUserName: fmt.Sprintf("coolsk8r1990%d", rand.Intn(1000000))})
+	_, user = db.GetUserByDiscordId(conn, discordId)
+	return user
+}
+
+func avoidInteraction(user db.User, subcommand string, player db.User) api.Interaction {
+	option := api.OptionData{Type: 1, Name: subcommand}
+	if player.DiscordId != "" {
+		option.Options = []api.OptionData{{Type: 6, Name: "player", StringValue: player.DiscordId}}
+	}
+	return api.Interaction{
+		Member: api.DiscordMemberInfo{User: api.DiscordUser{Id: user.DiscordId, Username: user.DiscordUserName}},
+		Data: api.InteractionData{
+			Name:    commands.Avoid,
+			Options: []api.OptionData{option},
+		}}
+}
+
+func TestAvoid(t *testing.T) {
+	conn := db.GetGorm(db.GetTestMysSQLConnStr())
+	mockApi := MockDiscordApi{}
+	t.Setenv("QUEUE_MAX_AVOIDS", "2")
+
+	rand.Seed(time.Now().UnixNano())
+	user := createTestUser(conn)
+	players := []db.User{createTestUser(conn), createTestUser(conn), createTestUser(conn)}
+
+	success, message, shouldCrossPost := Avoid(conn, mockApi, avoidInteraction(user, "list", db.User{}))
+	assert.True(t, success)
+	assert.False(t, shouldCrossPost)
+	assert.Equal(t, "You aren't avoiding anyone.", message)
+
+	success, _, _ = Avoid(conn, mockApi, avoidInteraction(user, "add", user))
+	assert.False(t, success)
+
+	success, _, _ = Avoid(conn, mockApi, avoidInteraction(user, "add", players[0]))
+	assert.True(t, success)
+	success, _, _ = Avoid(conn, mockApi, avoidInteraction(user, "add", players[0]))
+	assert.False(t, success)
+	success, _, _ = Avoid(conn, mockApi, avoidInteraction(user, "add", players[1]))
+	assert.True(t, success)
+
+	// The list is capped.
+	success, message, _ = Avoid(conn, mockApi, avoidInteraction(user, "add", players[2]))
+	assert.False(t, success)
+	assert.Contains(t, message, "at most 2")
+
+	_, message, _ = Avoid(conn, mockApi, avoidInteraction(user, "list", db.User{}))
+	assert.Contains(t, message, players[0].DiscordUserName)
+	assert.Contains(t, message, players[1].DiscordUserName)
+
+	success, _, _ = Avoid(conn, mockApi, avoidInteraction(user, "remove", players[0]))
+	assert.True(t, success)
+	success, _, _ = Avoid(conn, mockApi, avoidInteraction(user, "add", players[2]))
+	assert.True(t, success)
+	assert.Len(t, db.GetUserAvoids(conn, user.UserId), 2)
+}
@@ -0,0 +1,224 @@
+package interactions
+
+import (
+	"discordbot/internal/app/config"
+	"discordbot/internal/app/discord/api"
+	"discordbot/internal/db"
+	"fmt"
+	"gorm.io/gorm"
+	"time"
+)
+
+const challengeCustomIdPrefix = "challenge"
+
+/*
+	Challenge sends another player a challenge to a rated match outside the queue. They get Accept and Decline buttons
+	in a DM, see RespondToChallenge.
+*/
+func Challenge(conn *gorm.DB, discordApi api.DiscordApi, interaction api.Interaction) (success bool, channelMessage string, shouldCrossPost bool) {
+	playerDiscordId := ""
+	mode := db.Bo1
+	for _, v := range interaction.Data.Options {
+		if v.Name == "player" {
+			playerDiscordId = v.StringValue
+		} else if v.Name == "mode" {
+			mode = db.FromInt(v.Value)
+		}
+	}
+
+	foundUser, user := db.GetUserByDiscordId(conn, interaction.Member.User.Id)
+	if !foundUser {
+		return false, "You aren't on the ladder yet, queue up first.", false
+	}
+	foundPlayer, player := db.GetUserByDiscordId(conn, playerDiscordId)
+	if !foundPlayer {
+		return false, "That player isn't on the ladder yet.", false
+	}
+	return sendChallenge(conn, discordApi, user, player, mode, time.Now())
+}
+
+func sendChallenge(conn *gorm.DB, discordApi api.DiscordApi, user db.User, player db.User, mode db.GameMode, now time.Time) (success bool, channelMessage string, shouldCrossPost bool) {
+	if player.UserId == user.UserId {
+		return false, "You can't challenge yourself.", false
+	}
+	if mode == db.All {
+		return false, "Challenges are for one ladder, pick bo1 or bo3.", false
+	}
+	if avoiding(conn, user.UserId, player.UserId) {
+		return false, fmt.Sprintf("You can't challenge %s.", player.DiscordUserName), false
+	}
+	if foundMatch, _ := db.GetCurrentMatch(conn, user.UserId); foundMatch {
+		return false, "You have a match open - report it before challenging anyone.", false
+	}
+	if foundChallenge, _ := db.GetPendingChallenge(conn, user.UserId, player.UserId); foundChallenge {
+		return false, fmt.Sprintf("There's already an open challenge between you and %s.", player.DiscordUserName), false
+	}
+	if limitReached, message := challengeLimitReached(conn, user, player, now); limitReached {
+		return false, message, false
+	}
+
+	challengeConfig := config.GetChallengeConfig()
+	created, challenge := db.CreateChallenge(conn, db.Challenge{
+		ChallengerUserId: user.UserId,
+		ChallengedUserId: player.UserId,
+		GameMode:         mode,
+		CreatedAt:        now,
+		ExpiresAt:        now.Add(time.Duration(challengeConfig.ExpiryMinutes) * time.Minute),
+	})
+	if !created {
+		return false, "Unable to send your challenge.", false
+	}
+
+	discordApi.SendDirectMessage(
+		player,
+		fmt.Sprintf(
+			"%s (%d) challenged you to a rated %s match. You have %dm to accept.",
+			user.DiscordUserName,
+			db.GetUserRating(conn, user.UserId, mode).Rating,
+			mode,
+			challengeConfig.ExpiryMinutes),
+		acceptDeclineComponents(challengeCustomIdPrefix, challenge.ChallengeId)...)
+	return true, fmt.Sprintf("Challenge sent to %s, they have %dm to accept.", player.DiscordUserName, challengeConfig.ExpiryMinutes), false
+}
+
+/*
+	RespondToChallenge handles the challenged player pressing Accept or Decline. Accepting starts the match straight
+	away, as long as neither player already has one open.
+*/
+func RespondToChallenge(conn *gorm.DB, discordApi api.DiscordApi, interaction api.Interaction) (success bool, channelMessage string, shouldCrossPost bool) {
+	validId, action, challengeId := parseButtonCustomId(interaction.Data.CustomId, challengeCustomIdPrefix)
+	if !validId || (action != acceptAction && action != declineAction) {
+		return false, "Unrecognized challenge button.", false
+	}
+	foundUser, user := db.GetUserByDiscordId(conn, interaction.Member.User.Id)
+	if !foundUser {
+		return false, "Unable to find your user. Contact admin for help.", false
+	}
+	return respondToChallenge(conn, discordApi, user, challengeId, action == acceptAction, time.Now())
+}
+
+func IsChallengeCustomId(customId string) bool {
+	return hasButtonPrefix(customId, challengeCustomIdPrefix)
+}
+
+func respondToChallenge(conn *gorm.DB, discordApi api.DiscordApi, user db.User, challengeId int, accepted bool, now time.Time) (success bool, channelMessage string, shouldCrossPost bool) {
+	foundChallenge, challenge := db.GetChallenge(conn, challengeId)
+	if !foundChallenge || challenge.ChallengedUserId != user.UserId {
+		return false, "That challenge isn't for you.", false
+	}
+	if challenge.ChallengeState != db.ChallengePending {
+		return false, fmt.Sprintf("That challenge was already %s.", challenge.ChallengeState), false
+	}
+	_, challenger := db.GetUserById(conn, challenge.ChallengerUserId)
+	if !now.Before(challenge.ExpiresAt) {
+		expireChallenge(conn, discordApi, challenge, now)
+		return false, "That challenge has expired.", false
+	}
+
+	if !accepted {
+		if db.ResolveChallenge(conn, challengeId, db.ChallengeDeclined, 0, now) {
+			discordApi.SendDirectMessage(challenger, fmt.Sprintf("%s declined your %s challenge.", user.DiscordUserName, challenge.GameMode))
+		}
+		return true, fmt.Sprintf("You declined %s's challenge.", challenger.DiscordUserName), false
+	}
+
+	// The pair can have played out their limit since the challenge was sent, through another challenge.
+	if limitReached, message := challengeLimitReached(conn, challenger, user, now); limitReached {
+		if db.ResolveChallenge(conn, challengeId, db.ChallengeLimited, 0, now) {
+			discordApi.SendDirectMessage(challenger, fmt.Sprintf("%s accepted your %s challenge, but it can't be played. %s", user.DiscordUserName, challenge.GameMode, message))
+		}
+		return false, message, false
+	}
+	match := db.Match{
+		CreatedAt:  now,
+		UpdatedAt:  now,
+		MatchState: db.Matched,
+		GameMode:   challenge.GameMode,
+		P1UserId:   challenger.UserId,
+		P2UserId:   user.UserId,
+		Winner:     db.Undefined,
+		Maps:       mapsAtPairing(conn, challenge.GameMode),
+	}
+	if !db.CreateMatch(conn, match) {
+		return false, "One of you already has a match open. Report it and then accept again.", false
+	}
+	_, match = db.GetCurrentMatch(conn, challenger.UserId)
+	if !db.ResolveChallenge(conn, challengeId, db.ChallengeAccepted, match.MatchId, now) {
+		db.UpdateMatch(conn, match.MatchId, db.Cancelled, db.Undefined)
+		return false, "That challenge is no longer open.", false
+	}
+
+	// Neither player should be paired by either queue while they play this.
+	for _, v := range []db.User{challenger, user} {
+		if foundRequest, _ := db.GetMatchRequest(conn, v.UserId); foundRequest {
+			db.CancelMatchRequest(conn, v.UserId)
+			discordApi.RemoveRoleFromGuildMember(LadderQueueRoleName, v.DiscordId)
+		}
+		if db.DeleteTeamQueueEntry(conn, v.UserId) {
+			discordApi.RemoveRoleFromGuildMember(LadderQueueRoleName, v.DiscordId)
+		}
+	}
+
+	message := describeMatch(match, challenger, user, fmt.Sprintf("<@!%s> (P2) accepted a challenge from <@!%s> (P1).", user.DiscordId, challenger.DiscordId))
+	discordApi.SendDirectMessage(challenger, message)
+	discordApi.PostToChannel(LadderFeedChannel, message)
+	startMatchSetup(conn, discordApi, match, now)
+	return true, message, false
+}
+
+/*
+	ExpireChallenges lapses every challenge that wasn't answered in time. Returns how many were expired.
+*/
+func ExpireChallenges(conn *gorm.DB, discordApi api.DiscordApi, now time.Time) (expired int) {
+	for _, v := range db.FindExpiredChallenges(conn, now) {
+		if expireChallenge(conn, discordApi, v, now) {
+			expired++
+		}
+	}
+	return expired
+}
+
+func expireChallenge(conn *gorm.DB, discordApi api.DiscordApi, challenge db.Challenge, now time.Time) (expired bool) {
+	if !db.ResolveChallenge(conn, challenge.ChallengeId, db.ChallengeExpired, 0, now) {
+		return false
+	}
+	_, challenger := db.GetUserById(conn, challenge.ChallengerUserId)
+	_, challenged := db.GetUserById(conn, challenge.ChallengedUserId)
+	discordApi.SendDirectMessage(challenger, fmt.Sprintf("%s didn't answer your %s challenge in time.", challenged.DiscordUserName, challenge.GameMode))
+	return true
+}
+
+/*
+	challengeLimitReached whether the two have already played as many challenge matches against each other as the
+	configured limit allows.
+*/
+func challengeLimitReached(conn *gorm.DB, user db.User, player db.User, now time.Time) (limitReached bool, message string) {
+	challengeConfig := config.GetChallengeConfig()
+	since := now.Add(-time.Duration(challengeConfig.PairLimitHours) * time.Hour)
+	if db.CountChallengeMatches(conn, user.UserId, player.UserId, since) < challengeConfig.PairLimit {
+		return false, ""
+	}
+	return true, fmt.Sprintf(
+		"%s and %s have already played %d challenge matches in the last %dh, find another opponent or queue up.",
+		user.DiscordUserName,
+		player.DiscordUserName,
+		challengeConfig.PairLimit,
+		challengeConfig.PairLimitHours)
+}
+
+/*
+	avoiding whether either player has the other on their avoid list.
+*/
+func avoiding(conn *gorm.DB, userId int, otherUserId int) bool {
+	for _, v := range db.GetUserAvoids(conn, userId) {
+		if v.AvoidedUserId == otherUserId {
+			return true
+		}
+	}
+	for _, v := range db.GetUserAvoids(conn, otherUserId) {
+		if v.AvoidedUserId == userId {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,88 @@
+package interactions
+
+import (
+	"discordbot/internal/db"
+	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestChallenge(t *testing.T) {
+	conn := db.GetGorm(db.GetTestMysSQLConnStr())
+	mockApi := MockDiscordApi{}
+	t.Setenv("CHALLENGE_PAIR_LIMIT", "1")
+	db.InsertMapSet(conn, []string{"a", "b", "c", "d", "e", "f"}, db.Bo1)
+	rand.Seed(time.Now().UnixNano())
+	challenger, challenged := createTestUser(conn), createTestUser(conn)
+	now := time.Now()
+
+	success, _, _ := sendChallenge(conn, mockApi, challenger, challenger, db.Bo1, now)
+	assert.False(t, success)
+	success, _, _ = sendChallenge(conn, mockApi, challenger, challenged, db.All, now)
+	assert.False(t, success)
+
+	// Declined challenges don't start a match.
+	success, _, _ = sendChallenge(conn, mockApi, challenger, challenged, db.Bo1, now)
+	assert.True(t, success)
+	success, _, _ = sendChallenge(conn, mockApi, challenged, challenger, db.Bo1, now)
+	assert.False(t, success, "only one open challenge per pair")
+	_, challenge := db.GetPendingChallenge(conn, challenger.UserId, challenged.UserId)
+	success, _, _ = respondToChallenge(conn, mockApi, challenger, challenge.ChallengeId, true, now)
+	assert.False(t, success, "only the challenged player can answer")
+	success, _, _ = respondToChallenge(conn, mockApi, challenged, challenge.ChallengeId, false, now)
+	assert.True(t, success)
+	foundMatch, _ := db.GetCurrentMatch(conn, challenger.UserId)
+	assert.False(t, foundMatch)
+
+	// Accepting starts a rated match with the challenger as P1.
+	success, _, _ = sendChallenge(conn, mockApi, challenger, challenged, db.Bo1, now)
+	assert.True(t, success)
+	_, challenge = db.GetPendingChallenge(conn, challenger.UserId, challenged.UserId)
+	success, _, _ = respondToChallenge(conn, mockApi, challenged, challenge.ChallengeId, true, now)
+	assert.True(t, success)
+	foundMatch, match := db.GetCurrentMatch(conn, challenged.UserId)
+	assert.True(t, foundMatch)
+	assert.Equal(t, challenger.UserId, match.P1UserId)
+	assert.Equal(t, db.Bo1, match.GameMode)
+	assert.Len(t, match.Maps, 1)
+	_, challenge = db.GetChallenge(conn, challenge.ChallengeId)
+	assert.Equal(t, db.ChallengeAccepted, challenge.ChallengeState)
+	assert.Equal(t, match.MatchId, challenge.MatchId)
+
+	// The pair has used up their challenge matches.
+	db.UpdateMatch(conn, match.MatchId, db.Cancelled, db.Undefined)
+	success, _, _ = sendChallenge(conn, mockApi, challenged, challenger, db.Bo1, now)
+	assert.False(t, success)
+
+	// A challenge sent before the pair used up their matches can't be accepted after.
+	_, challenge = db.CreateChallenge(conn, db.Challenge{
+		ChallengerUserId: challenged.UserId,
+		ChallengedUserId: challenger.UserId,
+		GameMode:         db.Bo1,
+		CreatedAt:        now,
+		ExpiresAt:        now.Add(time.Hour),
+	})
+	success, _, _ = respondToChallenge(conn, mockApi, challenger, challenge.ChallengeId, true, now)
+	assert.False(t, success)
+	_, challenge = db.GetChallenge(conn, challenge.ChallengeId)
+	assert.Equal(t, db.ChallengeLimited, challenge.ChallengeState)
+}
+
+func TestExpireChallenges(t *testing.T) {
+	conn := db.GetGorm(db.GetTestMysSQLConnStr())
+	mockApi := MockDiscordApi{}
+	rand.Seed(time.Now().UnixNano())
+	challenger, challenged := createTestUser(conn), createTestUser(conn)
+	now := time.Now()
+
+	success, _, _ := sendChallenge(conn, mockApi, challenger, challenged, db.Bo3, now)
+	assert.True(t, success)
+	_, challenge := db.GetPendingChallenge(conn, challenger.UserId, challenged.UserId)
+
+	assert.GreaterOrEqual(t, ExpireChallenges(conn, mockApi, now.Add(time.Hour)), 1)
+	_, challenge = db.GetChallenge(conn, challenge.ChallengeId)
+	assert.Equal(t, db.ChallengeExpired, challenge.ChallengeState)
+	success, _, _ = respondToChallenge(conn, mockApi, challenged, challenge.ChallengeId, true, now)
+	assert.False(t, success)
+}
@@ -0,0 +1,67 @@
+package interactions
+
+import (
+	"discordbot/internal/app/discord/api"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	acceptAction  = "accepted"
+	declineAction = "declined"
+)
+
+const (
+	// buttonsPerRow is the most buttons Discord shows side by side under a message.
+	buttonsPerRow = 5
+	// maxButtons is the most buttons Discord shows under one message, five rows of five.
+	maxButtons = 25
+)
+
+/*
+	acceptDeclineComponents the Accept and Decline buttons for whatever prefix and id point at, see buttonCustomId.
+*/
+func acceptDeclineComponents(prefix string, id int) []api.ActionRow {
+	return []api.ActionRow{api.NewActionRow(
+		api.Button{Style: api.SuccessButtonStyle, Label: "Accept", CustomId: buttonCustomId(prefix, acceptAction, id)},
+		api.Button{Style: api.DangerButtonStyle, Label: "Decline", CustomId: buttonCustomId(prefix, declineAction, id)},
+	)}
+}
+
+/*
+	buttonRows lays buttons out in as few rows as Discord allows.
+*/
+func buttonRows(buttons []api.Button) (rows []api.ActionRow) {
+	for start := 0; start < len(buttons); start += buttonsPerRow {
+		end := start + buttonsPerRow
+		if end > len(buttons) {
+			end = len(buttons)
+		}
+		rows = append(rows, api.NewActionRow(buttons[start:end]...))
+	}
+	return rows
+}
+
+/*
+	buttonCustomId identifies a button as prefix:action:id, where prefix says what kind of thing the button is for.
+*/
+func buttonCustomId(prefix string, action string, id int) string {
+	return fmt.Sprintf("%s:%s:%d", prefix, action, id)
+}
+
+func hasButtonPrefix(customId string, prefix string) bool {
+	return strings.HasPrefix(customId, prefix+":")
+}
+
+func parseButtonCustomId(customId string, prefix string) (valid bool, action string, id int) {
+	parts := strings.Split(customId, ":")
+	if len(parts) != 3 || parts[0] != prefix {
+		return false, "", 0
+	}
+	id, err := strconv.Atoi(parts[2])
+	if err != nil {
+		return false, "", 0
+	}
+	return true, parts[1], id
+}
@@ -17,6 +17,12 @@ func Dequeue(conn *gorm.DB, discordApi api.DiscordApi, interaction api.Interacti
 	}
 
 	discordApi.RemoveRoleFromGuildMember(LadderQueueRoleName, discordUserId)
+	if foundTeamEntry, _ := db.GetTeamQueueEntry(conn, user.UserId); foundTeamEntry {
+		if db.DeleteTeamQueueEntry(conn, user.UserId) {
+			return true, fmt.Sprintf("%s left the 2v2 queue.", user.DiscordUserName), true
+		}
+		return false, "An unidentified technical issue happened while trying to dequeue. Please try again and if the problem persists contact admin and we will hit the TV until it works.", false
+	}
 	foundMatchRequest, _ := db.GetMatchRequest(conn, user.UserId)
 	if !foundMatchRequest {
 		return false, "You are not currently queued - nothing to do!", false
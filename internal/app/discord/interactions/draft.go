@@ -0,0 +1,537 @@
+package interactions
+
+import (
+	"discordbot/internal/app/config"
+	"discordbot/internal/app/discord/api"
+	"discordbot/internal/db"
+	"fmt"
+	"gorm.io/gorm"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const draftCustomIdPrefix = "draft"
+
+const (
+	draftPickAction = "pick"
+	draftBanAction  = "ban"
+	draftWonAction  = "won"
+	draftLostAction = "lost"
+)
+
+// draftUpdateAttempts is how many times a button press is retried when the other player's press lands first.
+const draftUpdateAttempts = 3
+
+/*
+	Draft handles a press of any button in a match's faction draft - a blind pick, a matchup ban or, in a bo3, saying
+	who won the last drafted game so the next one can be drafted.
+*/
+func Draft(conn *gorm.DB, discordApi api.DiscordApi, interaction api.Interaction) (success bool, channelMessage string, shouldCrossPost bool) {
+	validId, action, argument, draftId := parseDraftCustomId(interaction.Data.CustomId)
+	if !validId {
+		return false, "Unrecognized draft button.", false
+	}
+	foundUser, user := db.GetUserByDiscordId(conn, interaction.Member.User.Id)
+	if !foundUser {
+		return false, "Unable to find your user. Contact admin for help.", false
+	}
+	now := time.Now()
+	switch action {
+	case draftPickAction:
+		return draftPick(conn, discordApi, user, draftId, argument, now)
+	case draftBanAction:
+		return draftBan(conn, discordApi, user, draftId, argument, now)
+	default:
+		return draftGameResult(conn, discordApi, user, draftId, action == draftWonAction, now)
+	}
+}
+
+func IsDraftCustomId(customId string) bool {
+	return hasButtonPrefix(customId, draftCustomIdPrefix)
+}
+
+/*
+	startDraft DMs both players the faction pick for the first game once their match is on. 2v2 matches aren't drafted.
+*/
+func startDraft(conn *gorm.DB, discordApi api.DiscordApi, match db.Match, now time.Time) {
+	if match.IsTeamMatch() {
+		return
+	}
+	startGameDraft(conn, discordApi, match, 1, true, now)
+}
+
+func startGameDraft(conn *gorm.DB, discordApi api.DiscordApi, match db.Match, gameNumber int, p1BansFirst bool, now time.Time) {
+	draft := db.MatchDraft{
+		MatchId:     match.MatchId,
+		GameNumber:  gameNumber,
+		P1BansFirst: p1BansFirst,
+		Winner:      db.Undefined,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if !db.CreateMatchDraft(conn, draft) {
+		return
+	}
+	drafts := db.GetMatchDrafts(conn, match.MatchId)
+	draft = drafts[len(drafts)-1]
+
+	for _, isP1 := range []bool{true, false} {
+		_, player := db.GetUserById(conn, playerId(match, isP1))
+		message := fmt.Sprintf(
+			"Draft for game %d: blind pick %d factions you'd like to play. Your opponent won't see them until you've both picked.",
+			gameNumber,
+			db.DraftPicks)
+		played := playedFactions(match, isP1)
+		if len(played) > 0 {
+			message += fmt.Sprintf(" You can't play %s again this series.", strings.Join(played, " or "))
+		}
+		discordApi.SendDirectMessage(player, message, pickComponents(draft.MatchDraftId, played)...)
+	}
+}
+
+func draftPick(conn *gorm.DB, discordApi api.DiscordApi, user db.User, draftId int, faction string, now time.Time) (success bool, channelMessage string, shouldCrossPost bool) {
+	foundDraft, message, match, isP1 := getDraftForPlayer(conn, user, draftId)
+	if !foundDraft {
+		return false, message, false
+	}
+	if !isDraftFaction(faction) {
+		return false, fmt.Sprintf("%s isn't one of the factions in the draft.", faction), false
+	}
+	played := playedFactions(match, isP1)
+
+	updated, draft, message := updateDraft(conn, draftId, now, func(draft *db.MatchDraft) (ok bool, message string) {
+		picks := &draft.P2Picks
+		if isP1 {
+			picks = &draft.P1Picks
+		}
+		if len(*picks) >= db.DraftPicks {
+			return false, fmt.Sprintf("You've already picked %s.", strings.Join(*picks, ", "))
+		}
+		if containsString(*picks, faction) {
+			return false, fmt.Sprintf("You already picked %s.", faction)
+		}
+		if containsString(played, faction) {
+			return false, fmt.Sprintf("You already played %s this series, pick another faction.", faction)
+		}
+		*picks = append(*picks, faction)
+		return true, fmt.Sprintf("Picked %s (%d/%d).", faction, len(*picks), db.DraftPicks)
+	})
+	if !updated {
+		return false, message, false
+	}
+
+	picks := draft.P2Picks
+	if isP1 {
+		picks = draft.P1Picks
+	}
+	switch {
+	case draft.PicksDone():
+		revealPicks(conn, discordApi, match, draft)
+		return true, message + " Both players have picked, on to the bans.", false
+	case len(picks) == db.DraftPicks:
+		return true, message + " Waiting for your opponent to finish picking.", false
+	default:
+		return true, message, false
+	}
+}
+
+func draftBan(conn *gorm.DB, discordApi api.DiscordApi, user db.User, draftId int, argument string, now time.Time) (success bool, channelMessage string, shouldCrossPost bool) {
+	foundDraft, message, match, isP1 := getDraftForPlayer(conn, user, draftId)
+	if !foundDraft {
+		return false, message, false
+	}
+	validBan, p1Index, p2Index := parseBanArgument(argument)
+	if !validBan {
+		return false, "Unrecognized ban button.", false
+	}
+
+	updated, draft, message := updateDraft(conn, draftId, now, func(draft *db.MatchDraft) (ok bool, message string) {
+		if !draft.PicksDone() {
+			return false, "Banning starts once both players have picked."
+		}
+		if draft.IsComplete() {
+			return false, "The draft for this game is already over."
+		}
+		if draft.P1BansNext() != isP1 {
+			return false, "It's your opponent's turn to ban."
+		}
+		matchup := db.Matchup{P1Faction: draft.P1Picks[p1Index], P2Faction: draft.P2Picks[p2Index]}
+		if draft.IsBanned(matchup) {
+			return false, fmt.Sprintf("%s is already banned.", describeMatchup(matchup, isP1))
+		}
+		draft.Bans = append(draft.Bans, matchup)
+		return true, fmt.Sprintf("Banned %s.", describeMatchup(matchup, isP1))
+	})
+	if !updated {
+		return false, message, false
+	}
+
+	switch {
+	case draft.IsComplete():
+		finishDraft(conn, discordApi, match, draft)
+		return true, message, false
+	case draft.P1BansNext() == isP1:
+		return true, message + fmt.Sprintf(" Ban %d more.", draft.BansLeftInTurn()), false
+	default:
+		sendBanTurn(conn, discordApi, match, draft)
+		return true, message + " Waiting for your opponent to ban.", false
+	}
+}
+
+/*
+	draftGameResult records who won a drafted bo3 game, then drafts the next game unless the series is decided. The
+	winner of game 2 bans first in game 3, otherwise P1 always bans first.
+*/
+func draftGameResult(conn *gorm.DB, discordApi api.DiscordApi, user db.User, draftId int, won bool, now time.Time) (success bool, channelMessage string, shouldCrossPost bool) {
+	foundDraft, message, match, isP1 := getDraftForPlayer(conn, user, draftId)
+	if !foundDraft {
+		return false, message, false
+	}
+	if match.GameMode != db.Bo3 {
+		return false, "Only bo3 games are recorded one by one, report your match with `/report`.", false
+	}
+	winner := db.P2
+	if isP1 == won {
+		winner = db.P1
+	}
+
+	updated, draft, message := updateDraft(conn, draftId, now, func(draft *db.MatchDraft) (ok bool, message string) {
+		if !draft.IsComplete() {
+			return false, "Finish the draft for this game first."
+		}
+		if draft.Winner == winner {
+			return false, fmt.Sprintf("Game %d is already recorded.", draft.GameNumber)
+		}
+		if draft.Winner != db.Undefined {
+			return false, fmt.Sprintf("Game %d was already recorded the other way. If that's wrong, contact an admin.", draft.GameNumber)
+		}
+		draft.Winner = winner
+		return true, fmt.Sprintf("Recorded game %d.", draft.GameNumber)
+	})
+	if !updated {
+		return false, message, false
+	}
+
+	p1Wins, p2Wins := 0, 0
+	for _, v := range db.GetMatchDrafts(conn, match.MatchId) {
+		if v.Winner == db.P1 {
+			p1Wins++
+		} else if v.Winner == db.P2 {
+			p2Wins++
+		}
+	}
+	_, p1User := db.GetUserById(conn, match.P1UserId)
+	_, p2User := db.GetUserById(conn, match.P2UserId)
+	if p1Wins == 2 || p2Wins == 2 {
+		seriesWinner, score := p1User, fmt.Sprintf("%d-%d", p1Wins, p2Wins)
+		if p2Wins == 2 {
+			seriesWinner, score = p2User, fmt.Sprintf("%d-%d", p2Wins, p1Wins)
+		}
+		summary := fmt.Sprintf("%s wins the series %s. Report it with `/report` to update ratings, the score is taken from the draft.", seriesWinner.DiscordUserName, score)
+		discordApi.SendDirectMessage(p1User, summary)
+		discordApi.SendDirectMessage(p2User, summary)
+		return true, message, false
+	}
+
+	nextGame := draft.GameNumber + 1
+	startGameDraft(conn, discordApi, match, nextGame, nextGame != 3 || draft.Winner == db.P1, now)
+	return true, message + fmt.Sprintf(" Check your DMs to draft game %d.", nextGame), false
+}
+
+/*
+	draftedGames the bo3 games whose winner the players recorded in the draft, in order, with the maps assigned to them.
+*/
+func draftedGames(conn *gorm.DB, match db.Match) (games []db.MatchGame) {
+	if match.GameMode != db.Bo3 {
+		return nil
+	}
+	for _, v := range db.GetMatchDrafts(conn, match.MatchId) {
+		if v.Winner == db.Undefined {
+			break
+		}
+		game := db.MatchGame{MatchId: match.MatchId, GameNumber: v.GameNumber, Winner: v.Winner}
+		if v.GameNumber <= len(match.Maps) {
+			game.MapName = match.Maps[v.GameNumber-1]
+		}
+		games = append(games, game)
+	}
+	return games
+}
+
+/*
+	checkDraftedGames holds a report to the game results recorded in the draft. A report that contradicts them is
+	refused, and once the draft has decided the series its games are what gets recorded, with or without a score.
+*/
+func checkDraftedGames(drafted []db.MatchGame, winner db.WhoWon, reported []db.MatchGame) (ok bool, message string, games []db.MatchGame) {
+	if len(drafted) == 0 {
+		return true, "", reported
+	}
+	if winner == db.Draw {
+		return false, "Game results were recorded in the draft, so the series can't be reported as a draw.", nil
+	}
+	for i, v := range reported {
+		if i < len(drafted) && v.Winner != drafted[i].Winner {
+			return false, fmt.Sprintf("That score doesn't match game %d as recorded in the draft.", drafted[i].GameNumber), nil
+		}
+	}
+	p1Wins, p2Wins := db.CountGameWins(drafted)
+	if p1Wins < 2 && p2Wins < 2 {
+		return true, "", reported
+	}
+	if (p1Wins == 2) != (winner == db.P1) {
+		winnerGames, loserGames := db.SeriesScoreFor(drafted, p1Wins == 2)
+		return false, fmt.Sprintf("The draft recorded the series %d-%d the other way, report that result.", winnerGames, loserGames), nil
+	}
+	return true, "", drafted
+}
+
+/*
+	updateDraft applies a change to the latest version of the draft and saves it, retrying if the other player changed
+	it in the meantime. The change returns false with a message to refuse it.
+*/
+func updateDraft(conn *gorm.DB, draftId int, now time.Time, change func(draft *db.MatchDraft) (ok bool, message string)) (updated bool, draft db.MatchDraft, message string) {
+	for attempt := 0; attempt < draftUpdateAttempts; attempt++ {
+		_, draft = db.GetMatchDraft(conn, draftId)
+		ok, message := change(&draft)
+		if !ok {
+			return false, draft, message
+		}
+		if db.UpdateMatchDraft(conn, draft, now) {
+			return true, draft, message
+		}
+	}
+	return false, draft, "Your opponent pressed a button at the same moment, try again."
+}
+
+/*
+	getDraftForPlayer the draft and its match, provided the user is playing in it and the match hasn't been reported or
+	cancelled.
+*/
+func getDraftForPlayer(conn *gorm.DB, user db.User, draftId int) (found bool, message string, match db.Match, isP1 bool) {
+	foundDraft, draft := db.GetMatchDraft(conn, draftId)
+	if !foundDraft {
+		return false, "That draft doesn't exist.", match, false
+	}
+	foundMatch, match := db.GetMatchById(conn, draft.MatchId)
+	if !foundMatch || (match.P1UserId != user.UserId && match.P2UserId != user.UserId) {
+		return false, "That draft isn't for one of your matches.", match, false
+	}
+	if match.MatchState != db.Matched {
+		return false, fmt.Sprintf("That match was already %s.", match.MatchState), match, false
+	}
+	return true, "", match, match.P1UserId == user.UserId
+}
+
+/*
+	revealPicks shows both players everyone's picks and hands the first ban to whoever bans first.
+*/
+func revealPicks(conn *gorm.DB, discordApi api.DiscordApi, match db.Match, draft db.MatchDraft) {
+	_, p1User := db.GetUserById(conn, match.P1UserId)
+	_, p2User := db.GetUserById(conn, match.P2UserId)
+	firstBanner := p2User
+	if draft.P1BansFirst {
+		firstBanner = p1User
+	}
+	message := fmt.Sprintf(
+		"Game %d picks are in.\n%s (P1): %s\n%s (P2): %s\nBans go 1-2-2-2-1 starting with %s until one matchup is left.",
+		draft.GameNumber,
+		p1User.DiscordUserName,
+		strings.Join(draft.P1Picks, ", "),
+		p2User.DiscordUserName,
+		strings.Join(draft.P2Picks, ", "),
+		firstBanner.DiscordUserName)
+	discordApi.SendDirectMessage(p1User, message)
+	discordApi.SendDirectMessage(p2User, message)
+	sendBanTurn(conn, discordApi, match, draft)
+}
+
+/*
+	sendBanTurn DMs whoever bans next the matchups that are left, their own picks first.
+*/
+func sendBanTurn(conn *gorm.DB, discordApi api.DiscordApi, match db.Match, draft db.MatchDraft) {
+	isP1 := draft.P1BansNext()
+	_, banner := db.GetUserById(conn, playerId(match, isP1))
+	message := fmt.Sprintf("Your turn to ban %d matchup(s) in game %d.", draft.BansLeftInTurn(), draft.GameNumber)
+	if len(draft.Bans) > 0 {
+		var banned []string
+		for _, v := range draft.Bans {
+			banned = append(banned, describeMatchup(v, isP1))
+		}
+		message += " Banned so far: " + strings.Join(banned, ", ") + "."
+	}
+	discordApi.SendDirectMessage(banner, message, banComponents(draft, isP1)...)
+}
+
+/*
+	finishDraft records the game's matchup on the match and tells both players what they're playing. In a bo3 that
+	isn't decided yet they also get buttons to say who won, which starts the next game's draft.
+*/
+func finishDraft(conn *gorm.DB, discordApi api.DiscordApi, match db.Match, draft db.MatchDraft) {
+	var matchups []db.Matchup
+	for _, v := range db.GetMatchDrafts(conn, match.MatchId) {
+		if v.IsComplete() {
+			matchups = append(matchups, v.RemainingMatchups()[0])
+		}
+	}
+	db.SetMatchMatchups(conn, match.MatchId, matchups)
+
+	matchup := draft.RemainingMatchups()[0]
+	_, p1User := db.GetUserById(conn, match.P1UserId)
+	_, p2User := db.GetUserById(conn, match.P2UserId)
+	message := fmt.Sprintf("Game %d is %s (%s) vs %s (%s)", draft.GameNumber, matchup.P1Faction, p1User.DiscordUserName, matchup.P2Faction, p2User.DiscordUserName)
+	if draft.GameNumber <= len(match.Maps) {
+		message += " on " + match.Maps[draft.GameNumber-1]
+	}
+	message += ". Good luck!"
+
+	if match.GameMode != db.Bo3 {
+		message += " Report the result with `/report` when you're done."
+		discordApi.SendDirectMessage(p1User, message)
+		discordApi.SendDirectMessage(p2User, message)
+		return
+	}
+	message += fmt.Sprintf(" Once it's played, press whether you won to draft game %d.", draft.GameNumber+1)
+	components := gameResultComponents(draft.MatchDraftId)
+	discordApi.SendDirectMessage(p1User, message, components...)
+	discordApi.SendDirectMessage(p2User, message, components...)
+}
+
+/*
+	playedFactions the factions the player has already been drafted into earlier in the match, which they can't pick
+	again.
+*/
+func playedFactions(match db.Match, isP1 bool) (factions []string) {
+	for _, v := range match.Matchups {
+		if isP1 {
+			factions = append(factions, v.P1Faction)
+		} else {
+			factions = append(factions, v.P2Faction)
+		}
+	}
+	return factions
+}
+
+/*
+	describeMatchup a matchup from one player's point of view, their faction first.
+*/
+func describeMatchup(matchup db.Matchup, isP1 bool) string {
+	if isP1 {
+		return matchup.P1Faction + " vs " + matchup.P2Faction
+	}
+	return matchup.P2Faction + " vs " + matchup.P1Faction
+}
+
+func isDraftFaction(faction string) bool {
+	return containsString(config.GetDraftConfig().Factions, faction)
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func playerId(match db.Match, isP1 bool) int {
+	if isP1 {
+		return match.P1UserId
+	}
+	return match.P2UserId
+}
+
+/*
+	pickComponents a button for every faction in the draft, with any the player has already played greyed out.
+*/
+func pickComponents(draftId int, played []string) []api.ActionRow {
+	var buttons []api.Button
+	for _, v := range config.GetDraftConfig().Factions {
+		buttons = append(buttons, api.Button{
+			Style:    api.PrimaryButtonStyle,
+			Label:    v,
+			CustomId: draftCustomId(draftPickAction, v, draftId),
+			Disabled: containsString(played, v),
+		})
+	}
+	return buttonRows(buttons)
+}
+
+/*
+	banComponents a row for each of the player's own picks with a button for each of their opponent's, banned matchups
+	greyed out.
+*/
+func banComponents(draft db.MatchDraft, isP1 bool) (rows []api.ActionRow) {
+	for own := 0; own < db.DraftPicks; own++ {
+		var buttons []api.Button
+		for opponent := 0; opponent < db.DraftPicks; opponent++ {
+			p1Index, p2Index := own, opponent
+			if !isP1 {
+				p1Index, p2Index = opponent, own
+			}
+			matchup := db.Matchup{P1Faction: draft.P1Picks[p1Index], P2Faction: draft.P2Picks[p2Index]}
+			style := api.SecondaryButtonStyle
+			if draft.IsBanned(matchup) {
+				style = api.DangerButtonStyle
+			}
+			buttons = append(buttons, api.Button{
+				Style:    style,
+				Label:    describeMatchup(matchup, isP1),
+				CustomId: draftCustomId(draftBanAction, fmt.Sprintf("%d-%d", p1Index, p2Index), draft.MatchDraftId),
+				Disabled: draft.IsBanned(matchup),
+			})
+		}
+		rows = append(rows, api.NewActionRow(buttons...))
+	}
+	return rows
+}
+
+func gameResultComponents(draftId int) []api.ActionRow {
+	return []api.ActionRow{api.NewActionRow(
+		api.Button{Style: api.SuccessButtonStyle, Label: "I won", CustomId: buttonCustomId(draftCustomIdPrefix, draftWonAction, draftId)},
+		api.Button{Style: api.DangerButtonStyle, Label: "I lost", CustomId: buttonCustomId(draftCustomIdPrefix, draftLostAction, draftId)},
+	)}
+}
+
+/*
+	draftCustomId a draft button that carries what was picked or banned, as draft:action=argument:draftId.
+*/
+func draftCustomId(action string, argument string, draftId int) string {
+	return buttonCustomId(draftCustomIdPrefix, action+"="+argument, draftId)
+}
+
+func parseDraftCustomId(customId string) (valid bool, action string, argument string, draftId int) {
+	valid, action, draftId = parseButtonCustomId(customId, draftCustomIdPrefix)
+	if !valid {
+		return false, "", "", 0
+	}
+	action, argument, _ = strings.Cut(action, "=")
+	switch action {
+	case draftPickAction, draftBanAction:
+		return argument != "", action, argument, draftId
+	case draftWonAction, draftLostAction:
+		return true, action, "", draftId
+	default:
+		return false, "", "", 0
+	}
+}
+
+/*
+	parseBanArgument which of P1's and P2's picks a ban button pairs up, as p1Index-p2Index.
+*/
+func parseBanArgument(argument string) (valid bool, p1Index int, p2Index int) {
+	first, second, found := strings.Cut(argument, "-")
+	if !found {
+		return false, 0, 0
+	}
+	p1Index, err := strconv.Atoi(first)
+	if err != nil || p1Index < 0 || p1Index >= db.DraftPicks {
+		return false, 0, 0
+	}
+	p2Index, err = strconv.Atoi(second)
+	if err != nil || p2Index < 0 || p2Index >= db.DraftPicks {
+		return false, 0, 0
+	}
+	return true, p1Index, p2Index
+}
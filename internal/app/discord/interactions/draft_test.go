@@ -0,0 +1,228 @@
+package interactions
+
+import (
+	"discordbot/internal/app/discord/api"
+	"discordbot/internal/app/discord/commands"
+	"discordbot/internal/db"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestParseDraftCustomId(t *testing.T) {
+	valid, action, argument, draftId := parseDraftCustomId(draftCustomId(draftPickAction, "Vampire Counts", 12))
+	assert.True(t, valid)
+	assert.Equal(t, draftPickAction, action)
+	assert.Equal(t, "Vampire Counts", argument)
+	assert.Equal(t, 12, draftId)
+
+	valid, action, argument, _ = parseDraftCustomId(draftCustomId(draftBanAction, "2-0", 12))
+	assert.True(t, valid)
+	validBan, p1Index, p2Index := parseBanArgument(argument)
+	assert.True(t, validBan)
+	assert.Equal(t, 2, p1Index)
+	assert.Equal(t, 0, p2Index)
+
+	valid, action, _, _ = parseDraftCustomId(gameResultComponents(12)[0].Components[1].CustomId)
+	assert.True(t, valid)
+	assert.Equal(t, draftLostAction, action)
+
+	for _, v := range []string{"draft:pick=:12", "draft:veto=x:12", "ready_check:accepted:12", "draft:ban=1-2"} {
+		valid, _, _, _ = parseDraftCustomId(v)
+		assert.False(t, valid, v)
+	}
+	for _, v := range []string{"3-0", "0", "a-1", "-1-0"} {
+		validBan, _, _ = parseBanArgument(v)
+		assert.False(t, validBan, v)
+	}
+}
+
+func TestDraftBo1(t *testing.T) {
+	conn := db.GetGorm(db.GetTestMysSQLConnStr())
+	mockApi := MockDiscordApi{}
+	rand.Seed(time.Now().UnixNano())
+	user1, user2, match := setUpTestMatch(conn)
+	stranger := createTestUser(conn)
+	now := time.Now()
+
+	startDraft(conn, mockApi, match, now)
+	drafts := db.GetMatchDrafts(conn, match.MatchId)
+	assert.Len(t, drafts, 1)
+	draftId := drafts[0].MatchDraftId
+
+	success, _, _ := draftBan(conn, mockApi, user1, draftId, "0-0", now)
+	assert.False(t, success, "no banning before both have picked")
+	success, _, _ = draftPick(conn, mockApi, stranger, draftId, "Empire", now)
+	assert.False(t, success, "not their match")
+	success, _, _ = draftPick(conn, mockApi, user1, draftId, "Chorfs", now)
+	assert.False(t, success, "not a draft faction")
+
+	pickAll(t, conn, user1, draftId, "Empire", "Skaven", "Kislev")
+	success, _, _ = draftPick(conn, mockApi, user1, draftId, "Skaven", now)
+	assert.False(t, success, "already picked 3")
+	pickAll(t, conn, user2, draftId, "Empire", "Dwarfs", "Norsca")
+
+	// 1-2-2-2-1, starting with P1.
+	success, _, _ = draftBan(conn, mockApi, user2, draftId, "0-0", now)
+	assert.False(t, success, "P1 bans first")
+	success, _, _ = draftBan(conn, mockApi, user1, draftId, "0-0", now)
+	assert.True(t, success)
+	success, _, _ = draftBan(conn, mockApi, user1, draftId, "0-1", now)
+	assert.False(t, success, "P2's turn")
+	success, _, _ = draftBan(conn, mockApi, user2, draftId, "0-0", now)
+	assert.False(t, success, "already banned")
+	for _, v := range []struct {
+		user db.User
+		ban  string
+	}{{user2, "0-1"}, {user2, "0-2"}, {user1, "1-0"}, {user1, "1-1"}, {user2, "1-2"}, {user2, "2-0"}, {user1, "2-1"}} {
+		success, message, _ := draftBan(conn, mockApi, v.user, draftId, v.ban, now)
+		assert.True(t, success, message)
+	}
+
+	_, match = db.GetMatchById(conn, match.MatchId)
+	assert.Equal(t, []db.Matchup{{P1Faction: "Kislev", P2Faction: "Norsca"}}, match.Matchups)
+	success, _, _ = draftGameResult(conn, mockApi, user1, draftId, true, now)
+	assert.False(t, success, "bo1 is reported with /report")
+	success, _, _ = draftBan(conn, mockApi, user1, draftId, "2-2", now)
+	assert.False(t, success, "draft is over")
+}
+
+func TestDraftBo3(t *testing.T) {
+	conn := db.GetGorm(db.GetTestMysSQLConnStr())
+	mockApi := MockDiscordApi{}
+	rand.Seed(time.Now().UnixNano())
+	user1, user2, match := setUpTestMatchForMode(conn, db.Bo3)
+	now := time.Now()
+
+	startDraft(conn, mockApi, match, now)
+	game1 := db.GetMatchDrafts(conn, match.MatchId)[0]
+	pickAll(t, conn, user1, game1.MatchDraftId, "Empire", "Skaven", "Kislev")
+	pickAll(t, conn, user2, game1.MatchDraftId, "Dwarfs", "Norsca", "Khorne")
+	banAll(t, conn, user1, user2, game1.MatchDraftId)
+
+	success, _, _ := draftGameResult(conn, mockApi, user1, game1.MatchDraftId, true, now)
+	assert.True(t, success)
+	success, _, _ = draftGameResult(conn, mockApi, user2, game1.MatchDraftId, true, now)
+	assert.False(t, success, "game 1 was already recorded for P1")
+
+	// Nobody plays the same faction twice, and P1 still bans first in game 2.
+	drafts := db.GetMatchDrafts(conn, match.MatchId)
+	assert.Len(t, drafts, 2)
+	game2 := drafts[1]
+	assert.True(t, game2.P1BansFirst)
+	success, _, _ = draftPick(conn, mockApi, user1, game2.MatchDraftId, "Kislev", now)
+	assert.False(t, success, "P1 played Kislev in game 1")
+	success, _, _ = draftPick(conn, mockApi, user2, game2.MatchDraftId, "Khorne", now)
+	assert.False(t, success, "P2 played Khorne in game 1")
+	pickAll(t, conn, user1, game2.MatchDraftId, "Empire", "Skaven", "Tzeentch")
+	pickAll(t, conn, user2, game2.MatchDraftId, "Dwarfs", "Norsca", "Nurgle")
+	banAll(t, conn, user1, user2, game2.MatchDraftId)
+	success, _, _ = draftGameResult(conn, mockApi, user1, game2.MatchDraftId, false, now)
+	assert.True(t, success)
+
+	// P2 won game 2, so bans first in game 3.
+	drafts = db.GetMatchDrafts(conn, match.MatchId)
+	assert.Len(t, drafts, 3)
+	game3 := drafts[2]
+	assert.False(t, game3.P1BansFirst)
+	pickAll(t, conn, user1, game3.MatchDraftId, "Empire", "Skaven", "Lizardmen")
+	pickAll(t, conn, user2, game3.MatchDraftId, "Dwarfs", "Norsca", "Slaanesh")
+	success, _, _ = draftBan(conn, mockApi, user1, game3.MatchDraftId, "0-0", now)
+	assert.False(t, success, "P2 bans first")
+	banAll(t, conn, user1, user2, game3.MatchDraftId)
+	success, _, _ = draftGameResult(conn, mockApi, user2, game3.MatchDraftId, true, now)
+	assert.True(t, success)
+
+	// The series is over, so there's no game 4.
+	assert.Len(t, db.GetMatchDrafts(conn, match.MatchId), 3)
+	_, match = db.GetMatchById(conn, match.MatchId)
+	assert.Equal(t, []db.Matchup{
+		{P1Faction: "Kislev", P2Faction: "Khorne"},
+		{P1Faction: "Tzeentch", P2Faction: "Nurgle"},
+		{P1Faction: "Lizardmen", P2Faction: "Slaanesh"},
+	}, match.Matchups)
+
+	// The report has to agree with the draft, and the score comes from it.
+	report := func(user db.User, outcome commands.ReportOutcome, options ...api.OptionData) (success bool) {
+		success, _, _ = Report(conn, mockApi, api.Interaction{
+			Member: api.DiscordMemberInfo{User: api.DiscordUser{Id: user.DiscordId, Username: user.DiscordUserName}},
+			Data: api.InteractionData{
+				Name:    commands.Report,
+				Options: append([]api.OptionData{{Type: 3, Name: "outcome", Value: int(outcome)}}, options...),
+			}})
+		return success
+	}
+	assert.False(t, report(user1, commands.Win), "P2 won the series")
+	assert.False(t, report(user2, commands.Win, api.OptionData{Type: 4, Name: "score", Value: int(commands.TwoNil)}), "the series went to 3 games")
+	assert.True(t, report(user2, commands.Win))
+	games := db.GetMatchGames(conn, match.MatchId)
+	assert.Len(t, games, 3)
+	assert.Equal(t, db.P1, games[0].Winner)
+}
+
+func TestCheckDraftedGames(t *testing.T) {
+	drafted := []db.MatchGame{{GameNumber: 1, Winner: db.P1}, {GameNumber: 2, Winner: db.P2}}
+
+	// Nothing drafted leaves the report alone.
+	ok, _, games := checkDraftedGames(nil, db.Draw, nil)
+	assert.True(t, ok)
+	assert.Nil(t, games)
+
+	// An undecided series only has to agree with the games recorded so far.
+	ok, _, games = checkDraftedGames(drafted, db.P2, nil)
+	assert.True(t, ok)
+	assert.Nil(t, games)
+	reported := []db.MatchGame{{GameNumber: 1, Winner: db.P1}, {GameNumber: 2, Winner: db.P2}, {GameNumber: 3, Winner: db.P2}}
+	ok, _, games = checkDraftedGames(drafted, db.P2, reported)
+	assert.True(t, ok)
+	assert.Equal(t, reported, games)
+	ok, _, _ = checkDraftedGames(drafted, db.P2, []db.MatchGame{{GameNumber: 1, Winner: db.P2}, {GameNumber: 2, Winner: db.P2}})
+	assert.False(t, ok)
+	ok, _, _ = checkDraftedGames(drafted, db.Draw, nil)
+	assert.False(t, ok)
+
+	// A decided series is recorded as drafted, and can't be reported the other way.
+	decided := append(drafted, db.MatchGame{GameNumber: 3, Winner: db.P1})
+	ok, _, games = checkDraftedGames(decided, db.P1, nil)
+	assert.True(t, ok)
+	assert.Equal(t, decided, games)
+	ok, _, _ = checkDraftedGames(decided, db.P2, nil)
+	assert.False(t, ok)
+}
+
+func pickAll(t *testing.T, conn *gorm.DB, user db.User, draftId int, factions ...string) {
+	for _, v := range factions {
+		success, message, _ := draftPick(conn, MockDiscordApi{}, user, draftId, v, time.Now())
+		assert.True(t, success, message)
+	}
+}
+
+/*
+	banAll has whoever's turn it is ban the first matchup left until the draft is over.
+*/
+func banAll(t *testing.T, conn *gorm.DB, p1User db.User, p2User db.User, draftId int) {
+	for {
+		_, draft := db.GetMatchDraft(conn, draftId)
+		if draft.IsComplete() {
+			return
+		}
+		next := draft.RemainingMatchups()[0]
+		ban := ""
+		for i, p1Faction := range draft.P1Picks {
+			for j, p2Faction := range draft.P2Picks {
+				if next == (db.Matchup{P1Faction: p1Faction, P2Faction: p2Faction}) {
+					ban = fmt.Sprintf("%d-%d", i, j)
+				}
+			}
+		}
+		banner := p2User
+		if draft.P1BansNext() {
+			banner = p1User
+		}
+		success, message, _ := draftBan(conn, MockDiscordApi{}, banner, draftId, ban, time.Now())
+		assert.True(t, success, message)
+	}
+}
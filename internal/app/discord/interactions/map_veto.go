@@ -0,0 +1,278 @@
+package interactions
+
+import (
+	"discordbot/internal/app/config"
+	"discordbot/internal/app/discord/api"
+	"discordbot/internal/db"
+	"fmt"
+	"gorm.io/gorm"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const mapVetoCustomIdPrefix = "map_veto"
+
+/*
+	MapVeto handles a press of one of the map buttons sent to whoever's turn it is to ban.
+*/
+func MapVeto(conn *gorm.DB, discordApi api.DiscordApi, interaction api.Interaction) (success bool, channelMessage string, shouldCrossPost bool) {
+	validId, action, matchId := parseButtonCustomId(interaction.Data.CustomId, mapVetoCustomIdPrefix)
+	mapIndex, err := strconv.Atoi(action)
+	if !validId || err != nil {
+		return false, "Unrecognized map veto button.", false
+	}
+	foundUser, user := db.GetUserByDiscordId(conn, interaction.Member.User.Id)
+	if !foundUser {
+		return false, "Unable to find your user. Contact admin for help.", false
+	}
+	return banMap(conn, discordApi, user, matchId, mapIndex, time.Now())
+}
+
+func IsMapVetoCustomId(customId string) bool {
+	return hasButtonPrefix(customId, mapVetoCustomIdPrefix)
+}
+
+/*
+	startMatchSetup runs whatever has to happen before a match that's on can be played - the map veto if its mode has
+	one, then the faction draft. A match paired expecting a veto that can't start after all, because the veto settings or
+	map set changed in the meantime or it couldn't be saved, gets its maps at random instead.
+*/
+func startMatchSetup(conn *gorm.DB, discordApi api.DiscordApi, match db.Match, now time.Time) {
+	if startMapVeto(conn, discordApi, match, now) {
+		return
+	}
+	foundVeto, _ := db.GetMapVeto(conn, match.MatchId)
+	foundMaps, _ := db.GetLatestMapSet(conn, match.GameMode)
+	if len(match.Maps) == 0 && !foundVeto && foundMaps {
+		setVetoedMaps(conn, discordApi, match, assignMaps(conn, match.GameMode), "There's no map veto for this match after all, so the maps were assigned at random")
+		return
+	}
+	startDraft(conn, discordApi, match, now)
+}
+
+/*
+	mapVetoPool the maps a match in the game mode bans from and how many each player bans, or no bans if the mode has no
+	veto or its pool can't hold one. Matches without a veto get their maps at random when they're made.
+*/
+func mapVetoPool(conn *gorm.DB, gameMode db.GameMode) (bansPerPlayer int, pool []string) {
+	bansPerPlayer = config.GetMapVetoConfig().Bans(string(gameMode))
+	if bansPerPlayer <= 0 {
+		return 0, nil
+	}
+	foundMaps, mapSet := db.GetLatestMapSet(conn, gameMode)
+	if !foundMaps {
+		return 0, nil
+	}
+	if len(mapSet.Maps) < mapsNeeded(gameMode)+2*bansPerPlayer || len(mapSet.Maps) > maxButtons {
+		log.Printf("Not running a map veto for %s, %d bans each doesn't fit a pool of %d maps.", gameMode, bansPerPlayer, len(mapSet.Maps))
+		return 0, nil
+	}
+	return bansPerPlayer, mapSet.Maps
+}
+
+/*
+	mapsAtPairing the maps a new match is assigned at random, or none if they'll be decided by veto once it's on.
+*/
+func mapsAtPairing(conn *gorm.DB, gameMode db.GameMode) (maps []string) {
+	if bansPerPlayer, _ := mapVetoPool(conn, gameMode); bansPerPlayer > 0 {
+		return nil
+	}
+	return assignMaps(conn, gameMode)
+}
+
+/*
+	startMapVeto DMs P1 the first ban if the match's mode has a veto. In 2v2 P1 and P2 ban for their teams. Returns false
+	if there's no veto to run.
+*/
+func startMapVeto(conn *gorm.DB, discordApi api.DiscordApi, match db.Match, now time.Time) (started bool) {
+	bansPerPlayer, pool := mapVetoPool(conn, match.GameMode)
+	if bansPerPlayer == 0 || len(match.Maps) > 0 {
+		return false
+	}
+	veto := db.MapVeto{
+		MatchId:       match.MatchId,
+		Pool:          pool,
+		MapsNeeded:    mapsNeeded(match.GameMode),
+		BansPerPlayer: bansPerPlayer,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+		ExpiresAt:     now.Add(mapVetoTurnDuration()),
+	}
+	if !db.CreateMapVeto(conn, veto) {
+		return false
+	}
+	_, veto = db.GetMapVeto(conn, match.MatchId)
+
+	_, p1User := db.GetUserById(conn, match.P1UserId)
+	_, p2User := db.GetUserById(conn, match.P2UserId)
+	discordApi.SendDirectMessage(p2User, fmt.Sprintf(
+		"Map veto: you and %s take turns banning %d map(s) each, %s first. You'll be DMed when it's your turn.",
+		p1User.DiscordUserName,
+		bansPerPlayer,
+		p1User.DiscordUserName))
+	sendMapVetoTurn(conn, discordApi, match, veto)
+	return true
+}
+
+func banMap(conn *gorm.DB, discordApi api.DiscordApi, user db.User, matchId int, mapIndex int, now time.Time) (success bool, channelMessage string, shouldCrossPost bool) {
+	foundMatch, match := db.GetMatchById(conn, matchId)
+	if !foundMatch || (match.P1UserId != user.UserId && match.P2UserId != user.UserId) {
+		return false, "That map veto isn't for one of your matches.", false
+	}
+	foundVeto, veto := db.GetMapVeto(conn, matchId)
+	if !foundVeto {
+		return false, "That match doesn't have a map veto.", false
+	}
+	if veto.IsResolved() {
+		return false, "The maps for that match are already decided.", false
+	}
+	if match.MatchState != db.Matched {
+		db.ResolveMapVeto(conn, matchId, now)
+		return false, fmt.Sprintf("That match was already %s.", match.MatchState), false
+	}
+	if !now.Before(veto.ExpiresAt) {
+		assignRemainingMaps(conn, discordApi, match, veto, now)
+		return false, "Too late, the veto ran out of time and the maps were assigned at random.", false
+	}
+	isP1 := match.P1UserId == user.UserId
+	if veto.P1BansNext() != isP1 {
+		return false, "It's your opponent's turn to ban.", false
+	}
+	if mapIndex < 0 || mapIndex >= len(veto.Pool) {
+		return false, "Unrecognized map veto button.", false
+	}
+	banned := veto.Pool[mapIndex]
+	if veto.IsBanned(banned) {
+		return false, fmt.Sprintf("%s is already banned.", banned), false
+	}
+
+	veto.Bans = append(veto.Bans, banned)
+	veto.ExpiresAt = now.Add(mapVetoTurnDuration())
+	if !db.AddMapVetoBan(conn, veto, now) {
+		return false, "That ban didn't go through, press it again.", false
+	}
+	if veto.IsComplete() {
+		finishMapVeto(conn, discordApi, match, veto, now)
+		return true, fmt.Sprintf("Banned %s. That's the veto done.", banned), false
+	}
+	sendMapVetoTurn(conn, discordApi, match, veto)
+	return true, fmt.Sprintf("Banned %s. Waiting for your opponent to ban.", banned), false
+}
+
+/*
+	finishMapVeto plays the match on the maps left after both players' bans, in pool order. If more are left than the
+	match needs, which ones are picked at random.
+*/
+func finishMapVeto(conn *gorm.DB, discordApi api.DiscordApi, match db.Match, veto db.MapVeto, now time.Time) {
+	if !db.ResolveMapVeto(conn, match.MatchId, now) {
+		return
+	}
+	remaining := veto.RemainingMaps()
+	maps := pickRandomMaps(remaining, veto.MapsNeeded)
+	sort.Slice(maps, func(i, j int) bool {
+		return indexOf(remaining, maps[i]) < indexOf(remaining, maps[j])
+	})
+	setVetoedMaps(conn, discordApi, match, maps, "The map veto is done")
+}
+
+/*
+	assignRemainingMaps closes a veto the player whose turn it was let run out, assigning the match's maps at random from
+	those not banned yet. Returns false if the veto was already closed.
+*/
+func assignRemainingMaps(conn *gorm.DB, discordApi api.DiscordApi, match db.Match, veto db.MapVeto, now time.Time) (assigned bool) {
+	if !db.ResolveMapVeto(conn, match.MatchId, now) {
+		return false
+	}
+	// A match reported or cancelled mid veto doesn't need maps any more.
+	if match.MatchState != db.Matched {
+		return true
+	}
+	lateUserId := match.P2UserId
+	if veto.P1BansNext() {
+		lateUserId = match.P1UserId
+	}
+	_, lateUser := db.GetUserById(conn, lateUserId)
+	maps := pickRandomMaps(veto.RemainingMaps(), veto.MapsNeeded)
+	setVetoedMaps(conn, discordApi, match, maps, fmt.Sprintf("%s didn't ban in time, so the maps were assigned at random", lateUser.DiscordUserName))
+	return true
+}
+
+/*
+	ExpireMapVetoes assigns maps at random for every veto where a player ran out of time to ban. Returns how many were
+	assigned.
+*/
+func ExpireMapVetoes(conn *gorm.DB, discordApi api.DiscordApi, now time.Time) (expired int) {
+	for _, v := range db.FindExpiredMapVetoes(conn, now) {
+		foundMatch, match := db.GetMatchById(conn, v.MatchId)
+		if !foundMatch {
+			continue
+		}
+		if assignRemainingMaps(conn, discordApi, match, v, now) {
+			expired++
+		}
+	}
+	return expired
+}
+
+/*
+	setVetoedMaps saves the match's maps once they're settled after pairing, tells everyone in it and moves on to the
+	faction draft.
+*/
+func setVetoedMaps(conn *gorm.DB, discordApi api.DiscordApi, match db.Match, maps []string, headline string) {
+	db.SetMatchMaps(conn, match.MatchId, maps)
+	match.Maps = maps
+	message := fmt.Sprintf("%s. Your map order is:\n %s.", headline, "["+strings.Join(maps, ", ")+"]")
+	for _, v := range match.PlayerIds() {
+		_, player := db.GetUserById(conn, v)
+		discordApi.SendDirectMessage(player, message)
+	}
+	startDraft(conn, discordApi, match, time.Now())
+}
+
+/*
+	sendMapVetoTurn DMs whoever bans next a button for every map, those already banned greyed out.
+*/
+func sendMapVetoTurn(conn *gorm.DB, discordApi api.DiscordApi, match db.Match, veto db.MapVeto) {
+	_, banner := db.GetUserById(conn, playerId(match, veto.P1BansNext()))
+	message := fmt.Sprintf(
+		"Your turn to ban a map, you have %dm. %d ban(s) left between you.",
+		config.GetMapVetoConfig().TurnMinutes,
+		2*veto.BansPerPlayer-len(veto.Bans))
+	if len(veto.Bans) > 0 {
+		message += " Banned so far: " + strings.Join(veto.Bans, ", ") + "."
+	}
+	discordApi.SendDirectMessage(banner, message, mapVetoComponents(veto)...)
+}
+
+func mapVetoComponents(veto db.MapVeto) []api.ActionRow {
+	var buttons []api.Button
+	for i, v := range veto.Pool {
+		style := api.SecondaryButtonStyle
+		if veto.IsBanned(v) {
+			style = api.DangerButtonStyle
+		}
+		buttons = append(buttons, api.Button{
+			Style:    style,
+			Label:    v,
+			CustomId: buttonCustomId(mapVetoCustomIdPrefix, strconv.Itoa(i), veto.MatchId),
+			Disabled: veto.IsBanned(v),
+		})
+	}
+	return buttonRows(buttons)
+}
+
+func mapVetoTurnDuration() time.Duration {
+	return time.Duration(config.GetMapVetoConfig().TurnMinutes) * time.Minute
+}
+
+func indexOf(values []string, value string) int {
+	for i, v := range values {
+		if v == value {
+			return i
+		}
+	}
+	return -1
+}
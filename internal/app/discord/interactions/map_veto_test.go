@@ -0,0 +1,107 @@
+package interactions
+
+import (
+	"discordbot/internal/db"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+/*
+	useTestMapSet makes maps the latest map set for the game mode until the test is over, then takes it out again so the
+	mode goes back to the set it had before.
+*/
+func useTestMapSet(t *testing.T, conn *gorm.DB, maps []string, gameMode db.GameMode) {
+	db.InsertMapSet(conn, maps, gameMode)
+	_, mapSet := db.GetLatestMapSet(conn, gameMode)
+	t.Cleanup(func() {
+		conn.Exec("DELETE FROM map_sets WHERE id = ?", mapSet.MapSetId)
+	})
+}
+
+func TestMapVeto(t *testing.T) {
+	t.Setenv("MAP_VETO_BANS_BO1", "2")
+	conn := db.GetGorm(db.GetTestMysSQLConnStr())
+	mockApi := MockDiscordApi{}
+	rand.Seed(time.Now().UnixNano())
+	useTestMapSet(t, conn, []string{"a", "b", "c", "d", "e"}, db.Bo1)
+	user1, user2, match := setUpTestMatch(conn)
+	now := time.Now()
+
+	assert.Nil(t, mapsAtPairing(conn, db.Bo1))
+	startMatchSetup(conn, mockApi, match, now)
+	// The faction draft waits for the maps.
+	assert.Len(t, db.GetMatchDrafts(conn, match.MatchId), 0)
+
+	success, _, _ := banMap(conn, mockApi, user2, match.MatchId, 0, now)
+	assert.False(t, success, "P1 bans first")
+	success, _, _ = banMap(conn, mockApi, user1, match.MatchId, 4, now)
+	assert.True(t, success)
+	success, _, _ = banMap(conn, mockApi, user1, match.MatchId, 3, now)
+	assert.False(t, success, "P2's turn")
+	success, _, _ = banMap(conn, mockApi, user2, match.MatchId, 4, now)
+	assert.False(t, success, "already banned")
+	success, _, _ = banMap(conn, mockApi, user2, match.MatchId, 5, now)
+	assert.False(t, success, "not in the pool")
+	for _, v := range []struct {
+		user     db.User
+		mapIndex int
+	}{{user2, 0}, {user1, 3}, {user2, 1}} {
+		success, message, _ := banMap(conn, mockApi, v.user, match.MatchId, v.mapIndex, now)
+		assert.True(t, success, message)
+	}
+
+	_, match = db.GetMatchById(conn, match.MatchId)
+	assert.Equal(t, []string{"c"}, match.Maps)
+	assert.Len(t, db.GetMatchDrafts(conn, match.MatchId), 1)
+	success, _, _ = banMap(conn, mockApi, user1, match.MatchId, 2, now)
+	assert.False(t, success, "veto is over")
+}
+
+func TestMapVetoTimeout(t *testing.T) {
+	t.Setenv("MAP_VETO_BANS_BO3", "1")
+	conn := db.GetGorm(db.GetTestMysSQLConnStr())
+	mockApi := MockDiscordApi{}
+	rand.Seed(time.Now().UnixNano())
+	useTestMapSet(t, conn, []string{"a", "b", "c", "d", "e", "f"}, db.Bo3)
+	user1, user2, match := setUpTestMatchForMode(conn, db.Bo3)
+	now := time.Now()
+
+	startMatchSetup(conn, mockApi, match, now)
+	success, _, _ := banMap(conn, mockApi, user1, match.MatchId, 0, now)
+	assert.True(t, success)
+
+	// P2 never bans, so the maps come at random from what P1 left.
+	assert.GreaterOrEqual(t, ExpireMapVetoes(conn, mockApi, now.Add(time.Hour)), 1)
+	_, match = db.GetMatchById(conn, match.MatchId)
+	assert.Len(t, match.Maps, 3)
+	assert.NotContains(t, match.Maps, "a")
+	assert.NotEqual(t, match.Maps[0], match.Maps[1])
+	assert.NotEqual(t, match.Maps[1], match.Maps[2])
+	assert.NotEqual(t, match.Maps[0], match.Maps[2])
+	assert.Len(t, db.GetMatchDrafts(conn, match.MatchId), 1)
+
+	success, _, _ = banMap(conn, mockApi, user2, match.MatchId, 1, now)
+	assert.False(t, success, "too late")
+}
+
+func TestMapVetoFallsBackToRandomMaps(t *testing.T) {
+	t.Setenv("MAP_VETO_BANS_BO1", "2")
+	conn := db.GetGorm(db.GetTestMysSQLConnStr())
+	mockApi := MockDiscordApi{}
+	rand.Seed(time.Now().UnixNano())
+	useTestMapSet(t, conn, []string{"a", "b", "c", "d", "e"}, db.Bo1)
+	_, _, match := setUpTestMatch(conn)
+	assert.Nil(t, mapsAtPairing(conn, db.Bo1))
+
+	// The veto is turned off between pairing and the ready check passing.
+	t.Setenv("MAP_VETO_BANS_BO1", "0")
+	startMatchSetup(conn, mockApi, match, time.Now())
+	foundVeto, _ := db.GetMapVeto(conn, match.MatchId)
+	assert.False(t, foundVeto)
+	_, match = db.GetMatchById(conn, match.MatchId)
+	assert.Len(t, match.Maps, 1)
+	assert.Len(t, db.GetMatchDrafts(conn, match.MatchId), 1)
+}
@@ -0,0 +1,187 @@
+package interactions
+
+import (
+	"discordbot/internal/app/discord/api"
+	"discordbot/internal/db"
+	"fmt"
+	"gorm.io/gorm"
+	"log"
+	"math"
+	"math/bits"
+	"sort"
+	"time"
+)
+
+// MaxExactMatchingSize is the most queued requests we search every pairing of, above it we fall back to greedy.
+const MaxExactMatchingSize = 16
+
+// PairingBaseWeight is added to every possible pairing so the matchmaker prefers seating more players over fewer.
+const PairingBaseWeight = 1.0
+
+// MinPairingWeight keeps a heavily penalised pairing, such as a rematch, worth more than leaving both players waiting.
+const MinPairingWeight = 0.01
+
+/*
+	queuedPairing a legal pairing of two queued requests, indexed into the list of requests the pass is considering.
+*/
+type queuedPairing struct {
+	first    int
+	second   int
+	gameMode db.GameMode
+	weight   float64
+	// policyId is the matchmaking policy the weight was scored with.
+	policyId int
+}
+
+/*
+	RunMatchmaker
+	Looks at every request waiting in the queue at once and starts the set of matches that is best for the queue as a
+	whole, rather than what is best for whichever player joined last. Pairings are scored, and rematches held back, the
+	same way as when queuing, each under the policy for the mode they queued for, taking the keener of the two players.
+	Returns how many matches were started.
+*/
+func RunMatchmaker(conn *gorm.DB, discordApi api.DiscordApi, now time.Time) (matchesStarted int) {
+	requests := db.GetQueuedMatchRequests(conn)
+	if len(requests) < 2 {
+		return 0
+	}
+
+	requestIndexes := map[int]int{}
+	for i, v := range requests {
+		requestIndexes[v.MatchRequestId] = i
+	}
+
+	policies := map[db.GameMode]db.MatchmakingPolicy{}
+	pairingsByKey := map[[2]int]queuedPairing{}
+	for i, request := range requests {
+		policy, loaded := policies[request.RequestedGameMode]
+		if !loaded {
+			policy = db.GetMatchmakingPolicy(conn, request.RequestedGameMode)
+			policies[request.RequestedGameMode] = policy
+		}
+		for _, candidate := range filterRematches(db.FindCandidatePairings(conn, request, now), len(requests)) {
+			j, queued := requestIndexes[candidate.OpponentMatchRequest.MatchRequestId]
+			if !queued {
+				continue
+			}
+			pairing := queuedPairing{
+				first:    i,
+				second:   j,
+				gameMode: db.ResolveGameMode(request.RequestedGameMode, candidate.OpponentMatchRequest.RequestedGameMode),
+				weight:   pairingWeight(policy, candidate, now),
+				policyId: policy.PolicyId,
+			}
+			if j < i {
+				pairing.first, pairing.second = j, i
+			}
+			key := [2]int{pairing.first, pairing.second}
+			if existing, found := pairingsByKey[key]; !found || pairing.weight > existing.weight {
+				pairingsByKey[key] = pairing
+			}
+		}
+	}
+
+	var pairings []queuedPairing
+	for _, v := range pairingsByKey {
+		pairings = append(pairings, v)
+	}
+	sort.Slice(pairings, func(i, j int) bool {
+		if pairings[i].first != pairings[j].first {
+			return pairings[i].first < pairings[j].first
+		}
+		return pairings[i].second < pairings[j].second
+	})
+
+	for _, pairing := range findOptimalPairings(len(requests), pairings) {
+		// The longer waiting player is P1, as they would have been had the other joined the queue after them.
+		p1Request := requests[pairing.first]
+		p1Request.RequestedGameMode = pairing.gameMode
+		p2Request := requests[pairing.second]
+
+		_, p1User := db.GetUserById(conn, p1Request.RequestingUserId)
+		_, p2User := db.GetUserById(conn, p2Request.RequestingUserId)
+		headline := fmt.Sprintf("<@!%s> (P1) and <@!%s> (P2) were paired by the matchmaker.", p1User.DiscordId, p2User.DiscordId)
+		success, message, _ := startMatch(conn, discordApi, p1Request, p2Request, pairing.policyId, headline)
+		if !success {
+			log.Printf("Unable to start match for match requests %d and %d", p1Request.MatchRequestId, p2Request.MatchRequestId)
+			continue
+		}
+		discordApi.PostToChannel(LadderFeedChannel, message)
+		matchesStarted++
+	}
+	return matchesStarted
+}
+
+/*
+	pairingWeight how much the matchmaker wants a pairing, always above nothing so that any legal pairing beats leaving
+	both players unpaired.
+*/
+func pairingWeight(policy db.MatchmakingPolicy, candidate db.CandidatePairing, now time.Time) float64 {
+	return math.Max(PairingBaseWeight+pairingPriority(policy, candidate, now), MinPairingWeight)
+}
+
+/*
+	findOptimalPairings picks the pairings of requestCount requests with the highest total weight such that nobody is
+	in two of them. Small queues are searched exhaustively, larger ones greedily take the heaviest pairing left.
+*/
+func findOptimalPairings(requestCount int, pairings []queuedPairing) (chosen []queuedPairing) {
+	if requestCount > MaxExactMatchingSize {
+		return findGreedyPairings(pairings)
+	}
+
+	pairingsByRequest := make([][]queuedPairing, requestCount)
+	for _, v := range pairings {
+		pairingsByRequest[v.first] = append(pairingsByRequest[v.first], v)
+	}
+
+	// bestWeight[mask] is the heaviest set of pairings among the requests not yet settled in mask.
+	full := 1<<requestCount - 1
+	bestWeight := make([]float64, full+1)
+	bestChoice := make([]int, full+1)
+	for mask := full - 1; mask >= 0; mask-- {
+		first := bits.TrailingZeros(uint(^mask))
+		// Leaving the first unsettled request unpaired.
+		bestWeight[mask] = bestWeight[mask|1<<first]
+		bestChoice[mask] = -1
+		for i, v := range pairingsByRequest[first] {
+			if mask&(1<<v.second) != 0 {
+				continue
+			}
+			weight := v.weight + bestWeight[mask|1<<first|1<<v.second]
+			if weight > bestWeight[mask] {
+				bestWeight[mask] = weight
+				bestChoice[mask] = i
+			}
+		}
+	}
+
+	for mask := 0; mask != full; {
+		first := bits.TrailingZeros(uint(^mask))
+		if bestChoice[mask] == -1 {
+			mask |= 1 << first
+			continue
+		}
+		pairing := pairingsByRequest[first][bestChoice[mask]]
+		chosen = append(chosen, pairing)
+		mask |= 1<<first | 1<<pairing.second
+	}
+	return chosen
+}
+
+func findGreedyPairings(pairings []queuedPairing) (chosen []queuedPairing) {
+	sorted := append([]queuedPairing{}, pairings...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].weight > sorted[j].weight
+	})
+
+	paired := map[int]bool{}
+	for _, v := range sorted {
+		if paired[v.first] || paired[v.second] {
+			continue
+		}
+		paired[v.first] = true
+		paired[v.second] = true
+		chosen = append(chosen, v)
+	}
+	return chosen
+}
@@ -0,0 +1,100 @@
+package interactions
+
+import (
+	"discordbot/internal/db"
+	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestFindOptimalPairingsBeatsGreedy(t *testing.T) {
+	// 0-1 is the single best pairing, but taking it strands 2 and 3 who can only play 0 and 1.
+	pairings := []queuedPairing{
+		{first: 0, second: 1, weight: 1.9},
+		{first: 0, second: 2, weight: 1.5},
+		{first: 1, second: 3, weight: 1.5},
+	}
+
+	chosen := findOptimalPairings(4, pairings)
+	assert.Equal(t, []queuedPairing{pairings[1], pairings[2]}, chosen)
+
+	assert.Equal(t, []queuedPairing{pairings[0]}, findGreedyPairings(pairings))
+}
+
+func TestFindOptimalPairingsLeavesOddPlayerOut(t *testing.T) {
+	pairings := []queuedPairing{
+		{first: 0, second: 1, weight: 1.2},
+		{first: 0, second: 2, weight: 1.8},
+		{first: 1, second: 2, weight: 1.4},
+	}
+
+	chosen := findOptimalPairings(3, pairings)
+	assert.Equal(t, []queuedPairing{pairings[1]}, chosen)
+
+	assert.Empty(t, findOptimalPairings(3, []queuedPairing{}))
+}
+
+func TestFindOptimalPairingsFallsBackToGreedy(t *testing.T) {
+	requestCount := MaxExactMatchingSize + 2
+	var pairings []queuedPairing
+	for i := 0; i < requestCount; i += 2 {
+		pairings = append(pairings, queuedPairing{first: i, second: i + 1, weight: 1.0})
+	}
+
+	chosen := findOptimalPairings(requestCount, pairings)
+	assert.Len(t, chosen, requestCount/2)
+}
+
+func TestPairingWeightStaysPositive(t *testing.T) {
+	now := time.Now()
+	// Far apart, just queued and a rematch, so the priority cancels out the base weight.
+	candidate := db.CandidatePairing{
+		OpponentMatchRequest: db.MatchRequest{CreatedAt: now, ExpiresAt: now.Add(time.Hour)},
+		OpponentRating:       2000,
+		RequesterRating:      1000,
+		RecentOpponent:       true,
+	}
+	weight := pairingWeight(db.DefaultMatchmakingPolicy(db.Bo1), candidate, now)
+	assert.Equal(t, MinPairingWeight, weight)
+
+	pairings := []queuedPairing{{first: 0, second: 1, weight: weight}}
+	assert.Equal(t, pairings, findOptimalPairings(2, pairings))
+}
+
+func TestRunMatchmaker(t *testing.T) {
+	conn := db.GetGorm(db.GetTestMysSQLConnStr())
+	db.InsertMapSet(conn, []string{"a", "b", "c", "d", "e", "f"}, db.Bo1)
+	db.InsertMapSet(conn, []string{"a", "b", "c", "d", "e", "f"}, db.Bo3)
+
+	rand.Seed(time.Now().UnixNano())
+	users := []db.User{createTestUser(conn), createTestUser(conn)}
+
+	// Both players queued without being paired, as happens when neither was in range of the other when they joined.
+	for i, user := range users {
+		db.CreateMatchRequest(conn, db.MatchRequest{
+			RequestingUserId:  user.UserId,
+			CreatedAt:         time.Now().Add(-time.Duration(10-i) * time.Minute),
+			UpdatedAt:         time.Now(),
+			RequestRange:      300,
+			RequestedGameMode: db.Bo1,
+			MatchRequestState: db.MatchRequestStateQueued,
+		})
+	}
+
+	matchesStarted := RunMatchmaker(conn, MockDiscordApi{}, time.Now())
+
+	assert.GreaterOrEqual(t, matchesStarted, 1)
+	foundMatch, match := db.GetCurrentMatch(conn, users[0].UserId)
+	assert.True(t, foundMatch)
+	assert.Equal(t, users[0].UserId, match.P1UserId)
+	assert.Equal(t, users[1].UserId, match.P2UserId)
+	assert.Equal(t, db.Bo1, match.GameMode)
+	assert.Len(t, match.Maps, 1)
+	for _, user := range users {
+		foundRequest, _ := db.GetMatchRequest(conn, user.UserId)
+		assert.False(t, foundRequest)
+	}
+
+	db.UpdateMatch(conn, match.MatchId, db.Cancelled, db.Undefined)
+}
@@ -1,7 +1,9 @@
 package interactions
 
 import (
+	"discordbot/internal/app/config"
 	"discordbot/internal/app/discord/api"
+	"discordbot/internal/app/ratings"
 	"discordbot/internal/db"
 	"fmt"
 	"gorm.io/gorm"
@@ -10,50 +12,86 @@ import (
 	"time"
 )
 
-const RatingDeltaFloor = 600.0
+// SettledOpponentBonus is added to the priority of opponents who are out of placement when the requester is still in it.
+const SettledOpponentBonus = 0.3
+
+// SameRegionBonus is added to the priority of opponents from the requester's home region.
+const SameRegionBonus = 0.1
+
+// RematchPenalty is taken off the priority of recent opponents when the queue is quiet enough for them to be paired.
+const RematchPenalty = 1.0
 
 /**
 Find the optimal match weighting various factors.
 
 Right now we prefer to match requests that have been in the queue for longer and that are closer to the rating of
-the requester.
+the requester on the ladder the match would be played on, weighted by the matchmaking policy for the mode they queued
+for. Players in placement also prefer opponents with settled ratings, since two unplaced players tell us little about
+either of them. cmd/matchsim calls this with other policies to compare them.
 */
-func findBestPairing(matchRequest db.MatchRequest, requesterRating int, candidates []db.CandidatePairing) (bestMatch db.MatchRequest) {
+func FindBestPairing(policy db.MatchmakingPolicy, matchRequest db.MatchRequest, candidates []db.CandidatePairing, now time.Time) (bestMatch db.MatchRequest) {
 	bestPriority := -1.0
 	for _, candidate := range candidates {
-		ratingDelta := requesterRating - candidate.OpponentRating
-		if ratingDelta < 0 { // Golang where's my stdlib abs(i int)
-			ratingDelta = -ratingDelta
-		}
+		priorityScore := pairingPriority(policy, candidate, now)
+		if priorityScore >= bestPriority {
+			bestPriority = priorityScore
 
-		// Assign a value from 1.0 for the same rating to 0.0 for >= 600 pts apart to be used to prefer closer ratings.
-		ratingFraction := 1.0 - (float64(ratingDelta) / RatingDeltaFloor)
-		ratingFraction = math.Max(ratingFraction, 0.0)
+			bestMatch = candidate.OpponentMatchRequest
+			bestMatch.RequestedGameMode = db.ResolveGameMode(matchRequest.RequestedGameMode, bestMatch.RequestedGameMode)
+		}
+	}
+	return bestMatch
+}
 
-		// Assign a value from 1.0 for max queue wait time to 0 for just entering queue to be used to FIFO-ish pairings.
-		secondsInQueue := time.Now().Sub(candidate.OpponentMatchRequest.CreatedAt).Seconds()
-		queueFraction := secondsInQueue / float64(db.MaxSecondsInQueue)
+/*
+	pairingPriority how much the requester wants to be paired with this candidate, from the gap between their ratings,
+	how long the candidate has waited, whether a player in placement would get a settled opponent and whether they share
+	a region.
+*/
+func pairingPriority(policy db.MatchmakingPolicy, candidate db.CandidatePairing, now time.Time) float64 {
+	ratingDelta := candidate.RequesterRating - candidate.OpponentRating
+	if ratingDelta < 0 { // Golang where's my stdlib abs(i int)
+		ratingDelta = -ratingDelta
+	}
 
-		// Weight rating closeness and queue time on a 30-70 basis to produce priority score.
-		priorityScore := .3*ratingFraction + .7*queueFraction
+	// Assign a value from 1.0 for the same rating to 0.0 for >= 600 pts apart, or whatever the policy says, to be used to
+	// prefer closer ratings.
+	ratingFraction := 1.0 - (float64(ratingDelta) / float64(policy.RatingDeltaFloor))
+	ratingFraction = math.Max(ratingFraction, 0.0)
 
-		if priorityScore >= bestPriority {
-			bestPriority = priorityScore
+	// Assign a value from 1.0 for a candidate about to leave the queue to 0 for just entering it to be used to FIFO-ish
+	// pairings. Players only around for a short while get paired sooner than ones happy to wait.
+	secondsInQueue := now.Sub(candidate.OpponentMatchRequest.CreatedAt).Seconds()
+	queueFraction := secondsInQueue / candidate.OpponentMatchRequest.QueueWindow().Seconds()
 
-			bestMatch = candidate.OpponentMatchRequest
+	// Weight rating closeness and queue time, 30-70 by default, to produce priority score.
+	priorityScore := policy.RatingWeight*ratingFraction + policy.WaitWeight*queueFraction
+	if ratings.InPlacement(candidate.RequesterGamesPlayed) && !ratings.InPlacement(candidate.OpponentGamesPlayed) {
+		priorityScore += SettledOpponentBonus
+	}
+	if candidate.RequesterRegion != db.NoRegion && candidate.RequesterRegion == candidate.OpponentRegion {
+		priorityScore += SameRegionBonus
+	}
+	if candidate.RecentOpponent {
+		priorityScore -= RematchPenalty
+	}
+	return priorityScore
+}
 
-			if matchRequest.RequestedGameMode == db.All && bestMatch.RequestedGameMode == db.All {
-				// Set game mode to opponent's preference if we specified all.
-				bestMatch.RequestedGameMode = db.Bo3
-			} else if matchRequest.RequestedGameMode == db.All {
-				// Nothing to do since game mode already correct.
-			} else if bestMatch.RequestedGameMode == db.All {
-				// Set game mode to request if opponent specified all.
-				bestMatch.RequestedGameMode = matchRequest.RequestedGameMode
-			}
+/*
+	filterRematches drops opponents within the rematch cooldown. When the queue is nearly empty they are kept, just
+	behind everyone else, so that two players who keep meeting off-peak aren't left waiting for nobody.
+*/
+func filterRematches(candidates []db.CandidatePairing, queuedCount int) (filtered []db.CandidatePairing) {
+	if queuedCount <= config.GetQueueConfig().RematchOverrideQueueSize {
+		return candidates
+	}
+	for _, v := range candidates {
+		if !v.RecentOpponent {
+			filtered = append(filtered, v)
 		}
 	}
-	return bestMatch
+	return filtered
 }
 
 func ExpireMatchRequests(conn *gorm.DB, discordApi api.DiscordApi) (success bool) {
@@ -65,7 +103,7 @@ func ExpireMatchRequests(conn *gorm.DB, discordApi api.DiscordApi) (success bool
 		if success {
 			_, user := db.GetUserById(conn, v.RequestingUserId)
 			discordApi.RemoveRoleFromGuildMember(LadderQueueRoleName, user.DiscordId)
-			messages = append(messages, fmt.Sprintf("Dequeued match request for user <@!%s> because it was 45m stale. Please requeue if you'd like to keep playing!\n", user.DiscordId))
+			messages = append(messages, fmt.Sprintf("Dequeued match request for user <@!%s> because their time in the queue ran out. Please requeue if you'd like to keep playing!\n", user.DiscordId))
 		}
 	}
 	if len(messages) > 0 {
@@ -90,20 +128,33 @@ func ExpireMatchRequests(conn *gorm.DB, discordApi api.DiscordApi) (success bool
 }
 
 func assignMaps(conn *gorm.DB, gameMode db.GameMode) (maps []string) {
-	howMany := 1
-	if gameMode == db.Bo3 {
-		howMany = 3
-	}
 	foundMaps, mapSet := db.GetLatestMapSet(conn, gameMode)
 
 	if !foundMaps {
+		// 2v2 maps are set on their own and the ladder runs without them, the players agree on one instead.
+		if gameMode == db.Team2v2 {
+			return nil
+		}
 		panic("Unable to find maps.")
 	}
+	return pickRandomMaps(mapSet.Maps, mapsNeeded(gameMode))
+}
+
+/*
+	mapsNeeded how many maps a match in the game mode is played on.
+*/
+func mapsNeeded(gameMode db.GameMode) int {
+	if gameMode == db.Bo3 {
+		return 3
+	}
+	return 1
+}
 
+func pickRandomMaps(pool []string, howMany int) (maps []string) {
 	rand.Seed(time.Now().UnixNano())
 
 	for len(maps) < howMany {
-		selection := mapSet.Maps[rand.Intn(len(mapSet.Maps))]
+		selection := pool[rand.Intn(len(pool))]
 		noCollision := true
 		for _, v := range maps {
 			if selection == v {
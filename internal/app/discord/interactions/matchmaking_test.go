@@ -7,14 +7,19 @@ import (
 	"time"
 )
 
+// findBestPairing pairs under the default policy for the mode requested, as of now.
+func findBestPairing(matchRequest db.MatchRequest, candidates []db.CandidatePairing) db.MatchRequest {
+	return FindBestPairing(db.DefaultMatchmakingPolicy(matchRequest.RequestedGameMode), matchRequest, candidates, time.Now())
+}
+
 func TestFindBestMatchOne(t *testing.T) {
 	bestMatch := findBestPairing(
 		db.MatchRequest{},
-		800,
 		[]db.CandidatePairing{
 			{
 				OpponentMatchRequest: db.MatchRequest{CreatedAt: time.Now()},
 				OpponentRating:       800,
+				RequesterRating:      800,
 			},
 		},
 	)
@@ -26,18 +31,49 @@ func TestFindBestMatchEarlyOption(t *testing.T) {
 
 	twentyMinutesAgo := now.Add(-time.Duration(20) * time.Minute)
 
-	badRatingGoodTime := db.CandidatePairing{OpponentMatchRequest: db.MatchRequest{MatchRequestId: 1, CreatedAt: twentyMinutesAgo}, OpponentRating: 1200}
-	goodRatingBadTime := db.CandidatePairing{OpponentMatchRequest: db.MatchRequest{MatchRequestId: 2, CreatedAt: now}, OpponentRating: 800}
-	badRatingBadTime := db.CandidatePairing{OpponentMatchRequest: db.MatchRequest{MatchRequestId: 3, CreatedAt: now}, OpponentRating: 1200}
+	badRatingGoodTime := db.CandidatePairing{OpponentMatchRequest: db.MatchRequest{MatchRequestId: 1, CreatedAt: twentyMinutesAgo}, OpponentRating: 1200, RequesterRating: 800}
+	goodRatingBadTime := db.CandidatePairing{OpponentMatchRequest: db.MatchRequest{MatchRequestId: 2, CreatedAt: now}, OpponentRating: 800, RequesterRating: 800}
+	badRatingBadTime := db.CandidatePairing{OpponentMatchRequest: db.MatchRequest{MatchRequestId: 3, CreatedAt: now}, OpponentRating: 1200, RequesterRating: 800}
 
 	bestMatch := findBestPairing(
 		db.MatchRequest{},
-		800,
 		[]db.CandidatePairing{badRatingGoodTime, goodRatingBadTime, badRatingBadTime},
 	)
 	assert.Equal(t, bestMatch.MatchRequestId, 1, "Expected best match to be a poor rating match that had been in queue for 20m but it was a different one.")
 }
 
+func TestFindBestMatchResolvesGameMode(t *testing.T) {
+	now := time.Now()
+	candidate := db.CandidatePairing{OpponentMatchRequest: db.MatchRequest{MatchRequestId: 1, CreatedAt: now, RequestedGameMode: db.All}, OpponentRating: 800, RequesterRating: 800}
+
+	bestMatch := findBestPairing(db.MatchRequest{RequestedGameMode: db.All}, []db.CandidatePairing{candidate})
+	assert.Equal(t, db.AllVsAllGameMode, bestMatch.RequestedGameMode)
+
+	bestMatch = findBestPairing(db.MatchRequest{RequestedGameMode: db.Bo1}, []db.CandidatePairing{candidate})
+	assert.Equal(t, db.Bo1, bestMatch.RequestedGameMode)
+
+	candidate.OpponentMatchRequest.RequestedGameMode = db.Bo1
+	bestMatch = findBestPairing(db.MatchRequest{RequestedGameMode: db.All}, []db.CandidatePairing{candidate})
+	assert.Equal(t, db.Bo1, bestMatch.RequestedGameMode)
+}
+
+func TestFindBestMatchPrefersSettledOpponentsDuringPlacement(t *testing.T) {
+	now := time.Now()
+	fiveMinutesAgo := now.Add(-time.Duration(5) * time.Minute)
+
+	unplacedWaitingLonger := db.CandidatePairing{OpponentMatchRequest: db.MatchRequest{MatchRequestId: 1, CreatedAt: fiveMinutesAgo}, OpponentRating: 1200, RequesterRating: 1200, OpponentGamesPlayed: 1}
+	settled := db.CandidatePairing{OpponentMatchRequest: db.MatchRequest{MatchRequestId: 2, CreatedAt: now}, OpponentRating: 1250, RequesterRating: 1200, OpponentGamesPlayed: 40}
+
+	bestMatch := findBestPairing(db.MatchRequest{}, []db.CandidatePairing{unplacedWaitingLonger, settled})
+	assert.Equal(t, 2, bestMatch.MatchRequestId)
+
+	// Settled players have no preference, so queue time wins out.
+	unplacedWaitingLonger.RequesterGamesPlayed = 40
+	settled.RequesterGamesPlayed = 40
+	bestMatch = findBestPairing(db.MatchRequest{}, []db.CandidatePairing{unplacedWaitingLonger, settled})
+	assert.Equal(t, 1, bestMatch.MatchRequestId)
+}
+
 func TestAssignMaps(t *testing.T) {
 	conn := db.GetGorm(db.GetTestMysSQLConnStr())
 	db.InsertMapSet(conn, []string{"a", "b", "c", "d", "e", "f"}, db.Bo3)
@@ -49,3 +85,62 @@ func TestAssignMaps(t *testing.T) {
 	maps2 := assignMaps(conn, db.Bo1)
 	assert.Len(t, maps2, 1)
 }
+
+func TestFilterRematches(t *testing.T) {
+	now := time.Now()
+	rematch := db.CandidatePairing{OpponentMatchRequest: db.MatchRequest{MatchRequestId: 1, CreatedAt: now.Add(-10 * time.Minute)}, OpponentRating: 1200, RequesterRating: 1200, RecentOpponent: true}
+	fresh := db.CandidatePairing{OpponentMatchRequest: db.MatchRequest{MatchRequestId: 2, CreatedAt: now}, OpponentRating: 1400, RequesterRating: 1200}
+
+	// With a busy queue recent opponents are left out entirely.
+	filtered := filterRematches([]db.CandidatePairing{rematch, fresh}, 10)
+	assert.Equal(t, []db.CandidatePairing{fresh}, filtered)
+	assert.Empty(t, filterRematches([]db.CandidatePairing{rematch}, 10))
+
+	// A quiet queue keeps them but still prefers someone new.
+	filtered = filterRematches([]db.CandidatePairing{rematch, fresh}, 3)
+	assert.Len(t, filtered, 2)
+	assert.Equal(t, 2, findBestPairing(db.MatchRequest{}, filtered).MatchRequestId)
+	assert.Equal(t, 1, findBestPairing(db.MatchRequest{}, []db.CandidatePairing{rematch}).MatchRequestId)
+}
+
+func TestFindBestMatchPrefersSameRegion(t *testing.T) {
+	now := time.Now()
+	neighbour := db.CandidatePairing{OpponentMatchRequest: db.MatchRequest{MatchRequestId: 1, CreatedAt: now}, OpponentRating: 1200, RequesterRating: 1200, RequesterRegion: db.EU, OpponentRegion: db.NA}
+	local := db.CandidatePairing{OpponentMatchRequest: db.MatchRequest{MatchRequestId: 2, CreatedAt: now}, OpponentRating: 1250, RequesterRating: 1200, RequesterRegion: db.EU, OpponentRegion: db.EU}
+
+	bestMatch := findBestPairing(db.MatchRequest{}, []db.CandidatePairing{neighbour, local})
+	assert.Equal(t, 2, bestMatch.MatchRequestId)
+
+	// Without a home region there's nothing to prefer.
+	neighbour.RequesterRegion = db.NoRegion
+	local.RequesterRegion = db.NoRegion
+	bestMatch = findBestPairing(db.MatchRequest{}, []db.CandidatePairing{neighbour, local})
+	assert.Equal(t, 1, bestMatch.MatchRequestId)
+}
+
+func TestFindBestMatchUsesEachRequestsWindow(t *testing.T) {
+	now := time.Now()
+	tenMinutesAgo := now.Add(-10 * time.Minute)
+
+	// Both have waited as long, but one is about to leave the queue.
+	patient := db.CandidatePairing{OpponentMatchRequest: db.MatchRequest{MatchRequestId: 1, CreatedAt: tenMinutesAgo, ExpiresAt: tenMinutesAgo.Add(3 * time.Hour)}, OpponentRating: 1200, RequesterRating: 1200}
+	leavingSoon := db.CandidatePairing{OpponentMatchRequest: db.MatchRequest{MatchRequestId: 2, CreatedAt: tenMinutesAgo, ExpiresAt: tenMinutesAgo.Add(15 * time.Minute)}, OpponentRating: 1250, RequesterRating: 1200}
+
+	bestMatch := findBestPairing(db.MatchRequest{}, []db.CandidatePairing{patient, leavingSoon})
+	assert.Equal(t, 2, bestMatch.MatchRequestId)
+}
+
+func TestFindBestMatchFollowsPolicy(t *testing.T) {
+	now := time.Now()
+	twentyMinutesAgo := now.Add(-20 * time.Minute)
+
+	waitedLonger := db.CandidatePairing{OpponentMatchRequest: db.MatchRequest{MatchRequestId: 1, CreatedAt: twentyMinutesAgo}, OpponentRating: 1450, RequesterRating: 1200}
+	closerRating := db.CandidatePairing{OpponentMatchRequest: db.MatchRequest{MatchRequestId: 2, CreatedAt: now}, OpponentRating: 1200, RequesterRating: 1200}
+	candidates := []db.CandidatePairing{waitedLonger, closerRating}
+
+	policy := db.DefaultMatchmakingPolicy(db.Bo1)
+	assert.Equal(t, 1, FindBestPairing(policy, db.MatchRequest{}, candidates, now).MatchRequestId)
+
+	policy.RatingWeight, policy.WaitWeight = .8, .2
+	assert.Equal(t, 2, FindBestPairing(policy, db.MatchRequest{}, candidates, now).MatchRequestId)
+}
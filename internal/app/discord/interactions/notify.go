@@ -0,0 +1,121 @@
+package interactions
+
+import (
+	"discordbot/internal/app/config"
+	"discordbot/internal/app/discord/api"
+	"discordbot/internal/db"
+	"fmt"
+	"gorm.io/gorm"
+	"time"
+)
+
+// DefaultNotifyHours is how long a /notify subscription lasts unless the player picks otherwise.
+const DefaultNotifyHours = 6
+
+/*
+	Notify turns the user's queue notifications on or off. While on, the user is DMed whenever someone who fits their
+	mode and range joins the queue, so they don't have to sit in it themselves.
+*/
+func Notify(conn *gorm.DB, discordApi api.DiscordApi, interaction api.Interaction) (success bool, channelMessage string, shouldCrossPost bool) {
+	if len(interaction.Data.Options) == 0 {
+		return false, "Choose on or off.", false
+	}
+	subcommand := interaction.Data.Options[0]
+
+	foundUser, user := db.GetUserByDiscordId(conn, interaction.Member.User.Id)
+	if !foundUser {
+		return false, "You aren't on the ladder yet, queue up first.", false
+	}
+
+	switch subcommand.Name {
+	case "on":
+		return subscribe(conn, user, subcommand.Options, time.Now())
+	case "off":
+		if !db.DeleteNotifySubscription(conn, user.UserId) {
+			return false, "You weren't getting queue notifications.", false
+		}
+		return true, "You won't get any more queue notifications.", false
+	default:
+		return false, "Unknown notify subcommand: " + subcommand.Name, false
+	}
+}
+
+func subscribe(conn *gorm.DB, user db.User, options []api.OptionData, now time.Time) (success bool, channelMessage string, shouldCrossPost bool) {
+	subscription := db.NotifySubscription{
+		UserId:    user.UserId,
+		GameMode:  db.Bo1,
+		CreatedAt: now,
+	}
+	hours := DefaultNotifyHours
+	hasRange, hasStartHour, hasEndHour := false, false, false
+	for _, v := range options {
+		if v.Name == "mode" {
+			subscription.GameMode = db.FromInt(v.Value)
+		} else if v.Name == "range" {
+			hasRange = true
+			subscription.RatingRange = v.Value
+		} else if v.Name == "from_hour" {
+			hasStartHour = true
+			subscription.WindowStartHour = v.Value
+		} else if v.Name == "to_hour" {
+			hasEndHour = true
+			subscription.WindowEndHour = v.Value
+		} else if v.Name == "hours" {
+			hours = v.Value
+		}
+	}
+
+	if !hasRange {
+		subscription.RatingRange = db.GetMatchmakingPolicy(conn, subscription.GameMode).DefaultRange
+	}
+	if subscription.RatingRange <= 0 {
+		return false, "Your range has to be more than 0.", false
+	}
+	if hasStartHour != hasEndHour {
+		return false, "Set both from_hour and to_hour to only be notified at certain times of day.", false
+	}
+	if subscription.WindowStartHour < 0 || subscription.WindowStartHour > 23 || subscription.WindowEndHour < 0 || subscription.WindowEndHour > 23 {
+		return false, "Hours are from 0 to 23, in UTC.", false
+	}
+	subscription.ExpiresAt = now.Add(time.Duration(hours) * time.Hour)
+
+	if !db.UpsertNotifySubscription(conn, subscription) {
+		return false, "Unable to save your queue notifications.", false
+	}
+	return true, describeNotifySubscription(subscription, hours), false
+}
+
+func describeNotifySubscription(subscription db.NotifySubscription, hours int) string {
+	window := ""
+	if subscription.WindowStartHour != subscription.WindowEndHour {
+		window = fmt.Sprintf(" between %02d:00 and %02d:00 UTC", subscription.WindowStartHour, subscription.WindowEndHour)
+	}
+	return fmt.Sprintf(
+		"For the next %dh you'll be DMed%s when someone within %d of your rating queues for %s, at most once every %dm. Turn this off with `/notify off`.",
+		hours,
+		window,
+		subscription.RatingRange,
+		subscription.GameMode,
+		config.GetQueueConfig().NotifyCooldownMinutes)
+}
+
+/*
+	notifySubscribers DMs every subscriber the newly queued request suits, see db.FindNotifySubscribers, who is in their
+	time of day window and hasn't been notified within the cooldown. Returns how many were DMed.
+*/
+func notifySubscribers(conn *gorm.DB, discordApi api.DiscordApi, request db.MatchRequest, user db.User, now time.Time) (notified int) {
+	cooldown := time.Duration(config.GetQueueConfig().NotifyCooldownMinutes) * time.Minute
+	for _, v := range db.FindNotifySubscribers(conn, request, now, cooldown) {
+		if !v.InWindow(now) || !db.MarkNotified(conn, v.UserId, now, cooldown) {
+			continue
+		}
+		_, subscriber := db.GetUserById(conn, v.UserId)
+		discordApi.SendDirectMessage(subscriber, fmt.Sprintf(
+			"%s just queued for %s within your range and will wait up to %dm. Use `/queue` to join them. Stop these with `/notify off`.",
+			user.DiscordUserName,
+			request.RequestedGameMode,
+			int(request.ExpiresAt.Sub(now).Minutes())))
+		notified++
+	}
+	return notified
+}
@@ -0,0 +1,48 @@
+package interactions
+
+import (
+	"discordbot/internal/app/discord/api"
+	"discordbot/internal/app/discord/commands"
+	"discordbot/internal/db"
+	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func notifyInteraction(user db.User, subcommand string, options ...api.OptionData) api.Interaction {
+	return api.Interaction{
+		Member: api.DiscordMemberInfo{User: api.DiscordUser{Id: user.DiscordId, Username: user.DiscordUserName}},
+		Data: api.InteractionData{
+			Name:    commands.Notify,
+			Options: []api.OptionData{{Type: 1, Name: subcommand, Options: options}},
+		}}
+}
+
+func TestNotify(t *testing.T) {
+	conn := db.GetGorm(db.GetTestMysSQLConnStr())
+	mockApi := MockDiscordApi{}
+	rand.Seed(time.Now().UnixNano())
+	subscriber, requester := createTestUser(conn), createTestUser(conn)
+
+	success, _, _ := Notify(conn, mockApi, notifyInteraction(subscriber, "on", api.OptionData{Type: 4, Name: "mode", Value: db.ToInt(db.Bo1)}, api.OptionData{Type: 4, Name: "from_hour", Value: 18}))
+	assert.False(t, success)
+
+	success, message, _ := Notify(conn, mockApi, notifyInteraction(subscriber, "on", api.OptionData{Type: 4, Name: "mode", Value: db.ToInt(db.Bo1)}))
+	assert.True(t, success)
+	assert.Contains(t, message, "For the next 6h")
+
+	now := time.Now()
+	request := db.MatchRequest{RequestingUserId: requester.UserId, CreatedAt: now, UpdatedAt: now, RequestRange: 300, RequestedGameMode: db.Bo1, MatchRequestState: db.MatchRequestStateQueued, ExpiresAt: now.Add(time.Hour)}
+	db.CreateMatchRequest(conn, request)
+	assert.Equal(t, 1, notifySubscribers(conn, mockApi, request, requester, now))
+	// Rate limited until the cooldown passes.
+	assert.Equal(t, 0, notifySubscribers(conn, mockApi, request, requester, now))
+
+	success, _, _ = Notify(conn, mockApi, notifyInteraction(subscriber, "off"))
+	assert.True(t, success)
+	success, _, _ = Notify(conn, mockApi, notifyInteraction(subscriber, "off"))
+	assert.False(t, success)
+
+	db.CancelMatchRequest(conn, requester.UserId)
+}
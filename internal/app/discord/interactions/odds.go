@@ -0,0 +1,101 @@
+package interactions
+
+import (
+	"discordbot/internal/app/config"
+	"discordbot/internal/app/discord/api"
+	"discordbot/internal/app/ratings"
+	"discordbot/internal/db"
+	"fmt"
+	"gorm.io/gorm"
+	"math"
+)
+
+/*
+	Odds previews a match - the chance of winning and what each result would do to both players' ratings. Uses the
+	user's current match unless they name an opponent.
+*/
+func Odds(conn *gorm.DB, discordApi api.DiscordApi, interaction api.Interaction) (success bool, channelMessage string, shouldCrossPost bool) {
+	foundUser, user := db.GetUserByDiscordId(conn, interaction.Member.User.Id)
+	if !foundUser {
+		return false, "You aren't on the ladder yet, queue up to get a rating first.", false
+	}
+
+	opponentDiscordId := ""
+	mode := db.Bo1
+	for _, v := range interaction.Data.Options {
+		if v.Name == "opponent" {
+			opponentDiscordId = v.StringValue
+		} else if v.Name == "mode" {
+			mode = db.FromInt(v.Value)
+		}
+	}
+
+	var opponent db.User
+	if opponentDiscordId != "" {
+		var foundOpponent bool
+		foundOpponent, opponent = db.GetUserByDiscordId(conn, opponentDiscordId)
+		if !foundOpponent {
+			return false, "That player isn't on the ladder yet.", false
+		}
+		if opponent.UserId == user.UserId {
+			return false, "You can't play yourself.", false
+		}
+	} else {
+		foundMatch, match := db.GetCurrentMatch(conn, user.UserId)
+		if !foundMatch {
+			return false, "You don't have a match in progress, name an opponent to check the odds against them.", false
+		}
+		if match.IsTeamMatch() {
+			return false, "Odds are only shown for 1v1 matches.", false
+		}
+		opponentUserId := match.P2UserId
+		if match.P2UserId == user.UserId {
+			opponentUserId = match.P1UserId
+		}
+		_, opponent = db.GetUserById(conn, opponentUserId)
+		mode = match.GameMode
+	}
+
+	return true, describeOdds(
+		ratings.GetConfiguredRatingSystem(),
+		mode,
+		user,
+		db.GetUserRating(conn, user.UserId, mode),
+		opponent,
+		db.GetUserRating(conn, opponent.UserId, mode)), false
+}
+
+/*
+	describeOdds runs every possible result through the rating system exactly as reporting them would, so the stakes
+	shown are the ones that will be applied.
+*/
+func describeOdds(ratingSystem ratings.RatingSystem, mode db.GameMode, user db.User, userRating ratings.PlayerRating, opponent db.User, opponentRating ratings.PlayerRating) string {
+	expectedScore := ratingSystem.ExpectedScore(userRating, opponentRating)
+	userWin, opponentLoss := ratingSystem.ComputeNewRatings(userRating, opponentRating, ratings.WinScore, 1.0)
+	userLoss, opponentWin := ratingSystem.ComputeNewRatings(userRating, opponentRating, ratings.LossScore, 1.0)
+	userDraw, opponentDraw := ratingSystem.ComputeNewRatings(userRating, opponentRating, ratings.DrawScore, 1.0)
+
+	message := fmt.Sprintf(
+		"%s (%d) vs %s (%d) on the %s ladder: %s has a %d%% chance to win.\n"+
+			"If %s wins: %s %s, %s %s.\n"+
+			"If %s wins: %s %s, %s %s.\n"+
+			"If it's a draw: %s %s, %s %s.",
+		user.DiscordUserName, userRating.Rating, opponent.DiscordUserName, opponentRating.Rating, mode,
+		user.DiscordUserName, int(math.Round(expectedScore*100)),
+		user.DiscordUserName,
+		user.DiscordUserName, describeRatingChange(userRating, userWin),
+		opponent.DiscordUserName, describeRatingChange(opponentRating, opponentLoss),
+		opponent.DiscordUserName,
+		user.DiscordUserName, describeRatingChange(userRating, userLoss),
+		opponent.DiscordUserName, describeRatingChange(opponentRating, opponentWin),
+		user.DiscordUserName, describeRatingChange(userRating, userDraw),
+		opponent.DiscordUserName, describeRatingChange(opponentRating, opponentDraw))
+	if mode == db.Bo3 && config.GetRatingConfig().MarginOfVictory {
+		message += "\nA 2-0 reported with its score moves ratings further."
+	}
+	return message
+}
+
+func describeRatingChange(before ratings.PlayerRating, after ratings.PlayerRating) string {
+	return fmt.Sprintf("%d -> %d (%+d)", before.Rating, after.Rating, after.Rating-before.Rating)
+}
@@ -0,0 +1,62 @@
+package interactions
+
+import (
+	"discordbot/internal/app/discord/api"
+	"discordbot/internal/app/discord/commands"
+	"discordbot/internal/app/ratings"
+	"discordbot/internal/db"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestDescribeOdds(t *testing.T) {
+	elo := ratings.NewElo()
+	user := db.User{DiscordUserName: "anand"}
+	opponent := db.User{DiscordUserName: "boris"}
+	userRating := ratings.PlayerRating{Rating: 1200, GamesPlayed: 0}
+	opponentRating := ratings.PlayerRating{Rating: 1200, GamesPlayed: ratings.ProvisionalMatches}
+
+	message := describeOdds(elo, db.Bo1, user, userRating, opponent, opponentRating)
+
+	// The preview uses the same provisional K as reporting would.
+	assert.Contains(t, message, "anand (1200) vs boris (1200) on the bo1 ladder: anand has a 50% chance to win.")
+	assert.Contains(t, message, "If anand wins: anand 1200 -> 1232 (+32), boris 1200 -> 1184 (-16).")
+	assert.Contains(t, message, "If boris wins: anand 1200 -> 1168 (-32), boris 1200 -> 1216 (+16).")
+	assert.Contains(t, message, "If it's a draw: anand 1200 -> 1200 (+0), boris 1200 -> 1200 (+0).")
+	assert.NotContains(t, message, "2-0")
+
+	t.Setenv("RATING_MARGIN_OF_VICTORY", "true")
+	assert.Contains(t, describeOdds(elo, db.Bo3, user, userRating, opponent, opponentRating), "2-0")
+}
+
+func TestOddsForCurrentMatch(t *testing.T) {
+	conn := db.GetGorm(db.GetTestMysSQLConnStr())
+	rand.Seed(time.Now().UnixNano())
+	user1, user2, _ := setUpTestMatch(conn)
+
+	success, message, shouldCrossPost := Odds(conn, MockDiscordApi{}, api.Interaction{
+		Member: api.DiscordMemberInfo{User: api.DiscordUser{Id: user2.DiscordId, Username: user2.DiscordUserName}},
+		Data:   api.InteractionData{Name: commands.Odds},
+	})
+
+	assert.True(t, success)
+	assert.False(t, shouldCrossPost)
+	assert.Contains(t, message, fmt.Sprintf("%s (1200) vs %s (1200) on the bo1 ladder", user2.DiscordUserName, user1.DiscordUserName))
+
+	// Naming an opponent works without a match.
+	success, message, _ = Odds(conn, MockDiscordApi{}, api.Interaction{
+		Member: api.DiscordMemberInfo{User: api.DiscordUser{Id: user1.DiscordId, Username: user1.DiscordUserName}},
+		Data: api.InteractionData{
+			Name: commands.Odds,
+			Options: []api.OptionData{
+				{Type: 6, Name: "opponent", StringValue: user2.DiscordId},
+				{Type: 4, Name: "mode", Value: db.ToInt(db.Bo3)},
+			},
+		},
+	})
+	assert.True(t, success)
+	assert.Contains(t, message, "on the bo3 ladder")
+}
@@ -2,6 +2,8 @@ package interactions
 
 import (
 	"discordbot/internal/app/discord/api"
+	"discordbot/internal/app/config"
+	"discordbot/internal/app/ratings"
 	"discordbot/internal/db"
 	"fmt"
 	"gorm.io/gorm"
@@ -11,32 +13,42 @@ import (
 
 func Queue(conn *gorm.DB, discordApi api.DiscordApi, interaction api.Interaction) (success bool, channelMessage string, shouldCrossPost bool) {
 	requestedGameMode := db.Bo1
-	ratingRange := 300
+	ratingRange := 0
+	fixedRange := false
+	regionPreference := db.AnyRegion
+	availableMinutes := 0
 
 	for _, v := range interaction.Data.Options {
 		if v.Name == "range" {
 			ratingRange = v.Value
 		} else if v.Name == "mode" {
 			requestedGameMode = db.FromInt(v.Value)
+		} else if v.Name == "expand_range" {
+			fixedRange = !v.BoolValue
+		} else if v.Name == "region" {
+			regionPreference = db.RegionPreferenceFromInt(v.Value)
+		} else if v.Name == "available_for" {
+			availableMinutes = v.Value
 		}
 	}
 
-	discordUserId := interaction.Member.User.Id
-	discordUserName := interaction.Member.User.Username
+	if requestedGameMode == db.Team2v2 {
+		return false, "Use `/queue-2v2` to queue for 2v2.", false
+	}
+
+	// Players who don't pick a range or how long they're around get what the mode's matchmaking policy says.
+	policy := db.GetMatchmakingPolicy(conn, requestedGameMode)
+	if ratingRange == 0 {
+		ratingRange = policy.DefaultRange
+	}
+	if availableMinutes == 0 {
+		availableMinutes = policy.QueueWindowMinutes
+	}
+
+	user := registerUser(conn, interaction)
 
-	// Check to see if the user exists, if not create them.
-	// We do this to avoid users ever having a register step - this takes advantage of Discord's Authn
-	// and bot token validation flows.
-	foundUser, user := db.GetUserByDiscordId(conn, discordUserId)
-	if !foundUser {
-		db.CreateUser(
-			conn,
-			db.User{
-				DiscordId:       discordUserId,
-				DiscordUserName: discordUserName,
-				CurrentRating:   db.DEFAULT_RATING,
-			})
-		_, user = db.GetUserByDiscordId(conn, discordUserId)
+	if regionPreference != db.AnyRegion && user.Region == db.NoRegion {
+		return false, "Set your home region with `/region` before queuing with a region preference.", false
 	}
 
 	discordApi.AddRoleToGuildMember(LadderQueueRoleName, interaction.Member.User.Id)
@@ -45,55 +57,159 @@ func Queue(conn *gorm.DB, discordApi api.DiscordApi, interaction api.Interaction
 		return false, "Found existing queued match request - if you want to change your elo range dequeue and requeue at the new range, otherwise stand by and you will be paired when a matching player joins!", false
 	}
 
+	if foundTeamEntry, _ := db.GetTeamQueueEntry(conn, user.UserId); foundTeamEntry {
+		return false, "You're in the 2v2 queue - `/dequeue` before joining the 1v1 queue.", false
+	}
+
 	foundActiveMatch, _ := db.GetCurrentMatch(conn, user.UserId)
 	if foundActiveMatch {
 		return false, "You appear to have a still open match - please report results for that before queuing again.", false
 	}
 
 	// Now with assurances of a registered user and no existing entry - try to queue their entry
+	now := time.Now()
 	newMatchRequest := db.MatchRequest{
 		RequestingUserId:  user.UserId,
-		CreatedAt:         time.Now(),
-		UpdatedAt:         time.Now(),
+		CreatedAt:         now,
+		UpdatedAt:         now,
 		RequestRange:      ratingRange,
 		RequestedGameMode: requestedGameMode,
 		MatchRequestState: db.MatchRequestStateQueued,
+		FixedRange:        fixedRange,
+		RegionPreference:  regionPreference,
+		ExpiresAt:         now.Add(time.Duration(availableMinutes) * time.Minute),
 	}
 	didQueueMatch := db.CreateMatchRequest(conn, newMatchRequest)
 
-	candidatePairings := db.FindCandidatePairings(conn, newMatchRequest)
-	if len(candidatePairings) == 0 {
-		return didQueueMatch, fmt.Sprintf("%s has successfully joined the matchmaking queue for mode %s with a range of %d elo points and current elo %d.", user.DiscordUserName, requestedGameMode, ratingRange, user.CurrentRating), true
-	} else {
-		bestPairing := findBestPairing(newMatchRequest, user.CurrentRating, candidatePairings)
-
-		_, currentPersistedMatchRequest := db.GetMatchRequest(conn, user.UserId)
+	candidatePairings := filterRematches(db.FindCandidatePairings(conn, newMatchRequest, now), db.CountQueuedMatchRequests(conn))
+	// Someone queuing at the same moment can take our best opponent first, in which case we try the next best.
+	for len(candidatePairings) > 0 {
+		bestPairing := FindBestPairing(policy, newMatchRequest, candidatePairings, now)
 
-		db.CreateMatchFromRequests(conn, bestPairing, currentPersistedMatchRequest)
+		foundOwnRequest, currentPersistedMatchRequest := db.GetMatchRequest(conn, user.UserId)
+		if !foundOwnRequest {
+			// Whoever queued at the same moment paired with us instead, and has already told both players.
+			return true, fmt.Sprintf("%s joined the queue and was paired straight away, check your DMs.", user.DiscordUserName), false
+		}
 
 		_, opponent := db.GetUserById(conn, bestPairing.RequestingUserId)
 
-		maps := assignMaps(conn, bestPairing.RequestedGameMode)
-
-		mapStr := "[" + strings.Join(maps, ", ") + "]"
+		headline := fmt.Sprintf("<@!%s> (P1) joined the queue and was paired against <@!%s> (P2).", user.DiscordId, opponent.DiscordId)
+		success, message, shouldCrossPost := startMatch(conn, discordApi, bestPairing, currentPersistedMatchRequest, policy.PolicyId, headline)
+		if success {
+			return success, message, shouldCrossPost
+		}
+		candidatePairings = removeCandidate(candidatePairings, bestPairing.MatchRequestId)
+	}
 
-		message := fmt.Sprintf(
-			"<@!%s> (P1) joined the queue and was paired against <@!%s> (P2).\nPlease play a %s match and report the results when done.\n\nYour randomly assigned map order is:\n %s.",
-			user.DiscordId,
-			opponent.DiscordId,
-			bestPairing.RequestedGameMode,
-			mapStr)
+	notifySubscribers(conn, discordApi, newMatchRequest, user, now)
+	return didQueueMatch, fmt.Sprintf("%s has successfully joined the matchmaking queue for mode %s with a range of %d elo points%s and current elo %s. They're available for %dm.", user.DiscordUserName, requestedGameMode, ratingRange, describeRangeExpansion(newMatchRequest), describeRatings(conn, user.UserId, requestedGameMode), availableMinutes), true
+}
 
-		success1, p1Channel := api.UpsertDmChannel(user)
-		if success1 {
-			api.PostOneMessage(p1Channel.ChannelId, message)
+func removeCandidate(candidates []db.CandidatePairing, matchRequestId int) (remaining []db.CandidatePairing) {
+	for _, v := range candidates {
+		if v.OpponentMatchRequest.MatchRequestId != matchRequestId {
+			remaining = append(remaining, v)
 		}
+	}
+	return remaining
+}
 
-		success2, p2Channel := api.UpsertDmChannel(opponent)
-		if success2 {
-			api.PostOneMessage(p2Channel.ChannelId, message)
-		}
+/*
+	startMatch turns two queued requests into a match paired under the given matchmaking policy, assigns its maps and DMs
+	both players. The returned message is also what gets posted to the ladder feed.
+*/
+func startMatch(conn *gorm.DB, discordApi api.DiscordApi, p1Request db.MatchRequest, p2Request db.MatchRequest, matchmakingPolicyId int, headline string) (success bool, message string, shouldCrossPost bool) {
+	if !db.CreateMatchFromRequests(conn, p1Request, p2Request, matchmakingPolicyId) {
+		return false, "Unable to create match, please requeue.", false
+	}
+
+	_, match := db.GetCurrentMatch(conn, p2Request.RequestingUserId)
+	match.Maps = mapsAtPairing(conn, match.GameMode)
+	db.SetMatchMaps(conn, match.MatchId, match.Maps)
+
+	_, p1User := db.GetUserById(conn, match.P1UserId)
+	_, p2User := db.GetUserById(conn, match.P2UserId)
 
+	message = describeMatch(match, p1User, p2User, headline)
+
+	readyCheckMinutes := config.GetQueueConfig().ReadyCheckMinutes
+	now := time.Now()
+	if readyCheckMinutes <= 0 {
+		discordApi.SendDirectMessage(p1User, message)
+		discordApi.SendDirectMessage(p2User, message)
+		startMatchSetup(conn, discordApi, match, now)
 		return true, message, true
 	}
+
+	db.CreateReadyCheck(conn, db.ReadyCheck{
+		MatchId:   match.MatchId,
+		CreatedAt: now,
+		ExpiresAt: now.Add(time.Duration(readyCheckMinutes) * time.Minute),
+	})
+	message += fmt.Sprintf("\n\nBoth players must accept within %dm or the match is cancelled.", readyCheckMinutes)
+	discordApi.SendDirectMessage(p1User, message, readyCheckComponents(match.MatchId)...)
+	discordApi.SendDirectMessage(p2User, message, readyCheckComponents(match.MatchId)...)
+
+	return true, message, true
+}
+
+/*
+	describeMatch what both players are told when a match starts - who they're playing, where from, and on which maps.
+*/
+func describeMatch(match db.Match, p1User db.User, p2User db.User, headline string) string {
+	mapsDescription := "Your maps are decided by veto in your DMs once the match is on."
+	if len(match.Maps) > 0 {
+		mapsDescription = fmt.Sprintf("Your randomly assigned map order is:\n %s.", "["+strings.Join(match.Maps, ", ")+"]")
+	}
+	return fmt.Sprintf(
+		"%s\n%s and %s.\nPlease play a %s match and report the results when done.\n\n%s",
+		headline,
+		describeRegion(p1User),
+		describeRegion(p2User),
+		match.GameMode,
+		mapsDescription)
+}
+
+func describeRegion(user db.User) string {
+	if user.Region == db.NoRegion {
+		return fmt.Sprintf("<@!%s> hasn't set a region", user.DiscordId)
+	}
+	return fmt.Sprintf("<@!%s> is in %s", user.DiscordId, user.Region)
+}
+
+/*
+	describeRangeExpansion notes how far a request's range will widen while it waits, or nothing if it won't.
+*/
+func describeRangeExpansion(request db.MatchRequest) string {
+	queueConfig := config.GetQueueConfig()
+	if request.FixedRange || !queueConfig.RangeExpansionEnabled() || request.RequestRange >= queueConfig.RangeExpansionCap {
+		return ""
+	}
+	return fmt.Sprintf(
+		" (widening by %d every %dm waited, up to %d)",
+		queueConfig.RangeExpansionPoints,
+		queueConfig.RangeExpansionMinutes,
+		queueConfig.RangeExpansionCap)
+}
+
+/*
+	describeRatings the user's rating on the ladder they queued for, or on every ladder if they queued for all.
+*/
+func describeRatings(conn *gorm.DB, userId int, mode db.GameMode) string {
+	if mode != db.All {
+		return describeRating(db.GetUserRating(conn, userId, mode))
+	}
+	var descriptions []string
+	for _, v := range db.SoloGameModes {
+		descriptions = append(descriptions, fmt.Sprintf("%s (%s)", describeRating(db.GetUserRating(conn, userId, v)), v))
+	}
+	return strings.Join(descriptions, " / ")
+}
+
+func describeRating(rating ratings.PlayerRating) string {
+	if ratings.InPlacement(rating.GamesPlayed) {
+		return fmt.Sprintf("unranked - placement %d/%d", rating.GamesPlayed, config.GetRatingConfig().PlacementMatches)
+	}
+	return fmt.Sprintf("%d", rating.Rating)
 }
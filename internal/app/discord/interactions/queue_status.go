@@ -0,0 +1,138 @@
+package interactions
+
+import (
+	"discordbot/internal/app/discord/api"
+	"discordbot/internal/db"
+	"fmt"
+	"gorm.io/gorm"
+	"sort"
+	"strings"
+	"time"
+)
+
+// QueueStatusBandSize is how wide the rating bands shown by /queue-status are, so no one player's rating is given away.
+const QueueStatusBandSize = 200
+
+/*
+	queuedPlayer what /queue-status reveals about one player waiting in the queue, without saying who they are.
+*/
+type queuedPlayer struct {
+	mode   db.GameMode
+	rating int
+	waited time.Duration
+	// inRange is set when the player is within the caller's range on the ladder the two would play.
+	inRange bool
+}
+
+/*
+	QueueStatus shows how many players are waiting in each game mode, roughly how highly rated they are, how long the
+	longest has waited and how many are within the user's range, without naming anyone.
+*/
+func QueueStatus(conn *gorm.DB, discordApi api.DiscordApi, interaction api.Interaction) (success bool, channelMessage string, shouldCrossPost bool) {
+	now := time.Now()
+	foundUser, user := db.GetUserByDiscordId(conn, interaction.Member.User.Id)
+
+	// Players who aren't queued are counted as if they queued for all with the default range.
+	callerQueued := false
+	callerRequest := db.MatchRequest{RequestedGameMode: db.All, RequestRange: db.GetMatchmakingPolicy(conn, db.All).DefaultRange, FixedRange: true}
+	if foundUser {
+		foundRequest, request := db.GetMatchRequest(conn, user.UserId)
+		if foundRequest {
+			callerQueued = true
+			callerRequest = request
+		}
+	}
+	callerRange := db.EffectiveRange(callerRequest, now)
+
+	var players []queuedPlayer
+	for _, v := range db.GetQueuedMatchRequests(conn) {
+		if foundUser && v.RequestingUserId == user.UserId {
+			continue
+		}
+		player := queuedPlayer{
+			mode:   v.RequestedGameMode,
+			rating: db.GetUserRating(conn, v.RequestingUserId, db.ResolveGameMode(v.RequestedGameMode, v.RequestedGameMode)).Rating,
+			waited: now.Sub(v.CreatedAt),
+		}
+		if gameModesCompatible(callerRequest.RequestedGameMode, v.RequestedGameMode) {
+			mode := db.ResolveGameMode(callerRequest.RequestedGameMode, v.RequestedGameMode)
+			callerRating := db.DefaultPlayerRating().Rating
+			if foundUser {
+				callerRating = db.GetUserRating(conn, user.UserId, mode).Rating
+			}
+			difference := db.GetUserRating(conn, v.RequestingUserId, mode).Rating - callerRating
+			player.inRange = difference <= callerRange && -difference <= callerRange
+		}
+		players = append(players, player)
+	}
+
+	message := describeQueueStatus(players, callerRange)
+	if callerQueued {
+		message += fmt.Sprintf("\nYou've been queued for %s for %dm.", callerRequest.RequestedGameMode, int(now.Sub(callerRequest.CreatedAt).Minutes()))
+	}
+	return true, message, false
+}
+
+func gameModesCompatible(requested db.GameMode, opponentRequested db.GameMode) bool {
+	return requested == db.All || opponentRequested == db.All || requested == opponentRequested
+}
+
+func describeQueueStatus(players []queuedPlayer, callerRange int) string {
+	if len(players) == 0 {
+		return "Nobody else is in the queue right now."
+	}
+
+	modeCounts := map[db.GameMode]int{}
+	bandCounts := map[int]int{}
+	var longestWait time.Duration
+	inRange := 0
+	for _, v := range players {
+		modeCounts[v.mode]++
+		bandCounts[ratingBand(v.rating)]++
+		if v.waited > longestWait {
+			longestWait = v.waited
+		}
+		if v.inRange {
+			inRange++
+		}
+	}
+
+	var modes []string
+	for _, v := range []db.GameMode{db.Bo1, db.Bo3, db.All} {
+		if modeCounts[v] > 0 {
+			modes = append(modes, fmt.Sprintf("%d %s", modeCounts[v], v))
+		}
+	}
+
+	var bandStarts []int
+	for k := range bandCounts {
+		bandStarts = append(bandStarts, k)
+	}
+	sort.Ints(bandStarts)
+	var bands []string
+	for _, v := range bandStarts {
+		bands = append(bands, fmt.Sprintf("%d-%d: %d", v, v+QueueStatusBandSize-1, bandCounts[v]))
+	}
+
+	return fmt.Sprintf(
+		"%d %s in the queue (%s).\nRatings: %s.\nLongest wait: %dm.\n%d of them %s within your range of %d.",
+		len(players),
+		pluralize(len(players), "player", "players"),
+		strings.Join(modes, ", "),
+		strings.Join(bands, ", "),
+		int(longestWait.Minutes()),
+		inRange,
+		pluralize(inRange, "is", "are"),
+		callerRange)
+}
+
+func ratingBand(rating int) int {
+	return rating / QueueStatusBandSize * QueueStatusBandSize
+}
+
+func pluralize(count int, singular string, plural string) string {
+	if count == 1 {
+		return singular
+	}
+	return plural
+}
@@ -0,0 +1,60 @@
+package interactions
+
+import (
+	"discordbot/internal/app/discord/api"
+	"discordbot/internal/db"
+	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestDescribeQueueStatus(t *testing.T) {
+	assert.Equal(t, "Nobody else is in the queue right now.", describeQueueStatus(nil, 300))
+
+	players := []queuedPlayer{
+		{mode: db.Bo1, rating: 1250, waited: 12 * time.Minute, inRange: true},
+		{mode: db.All, rating: 1399, waited: 3 * time.Minute},
+		{mode: db.Bo1, rating: 980, waited: 30 * time.Second},
+	}
+	assert.Equal(t,
+		"3 players in the queue (2 bo1, 1 all).\nRatings: 800-999: 1, 1200-1399: 2.\nLongest wait: 12m.\n1 of them is within your range of 300.",
+		describeQueueStatus(players, 300))
+}
+
+func TestQueueStatus(t *testing.T) {
+	conn := db.GetGorm(db.GetTestMysSQLConnStr())
+	rand.Seed(time.Now().UnixNano())
+	caller, bo1Player, bo3Player := createTestUser(conn), createTestUser(conn), createTestUser(conn)
+
+	for _, v := range []struct {
+		user db.User
+		mode db.GameMode
+	}{{caller, db.Bo1}, {bo1Player, db.Bo1}, {bo3Player, db.Bo3}} {
+		db.CreateMatchRequest(conn, db.MatchRequest{
+			RequestingUserId:  v.user.UserId,
+			CreatedAt:         time.Now().Add(-5 * time.Minute),
+			UpdatedAt:         time.Now(),
+			RequestRange:      300,
+			RequestedGameMode: v.mode,
+			MatchRequestState: db.MatchRequestStateQueued,
+			FixedRange:        true,
+		})
+	}
+
+	success, message, shouldCrossPost := QueueStatus(conn, MockDiscordApi{}, api.Interaction{
+		Member: api.DiscordMemberInfo{User: api.DiscordUser{Id: caller.DiscordId}},
+	})
+
+	assert.True(t, success)
+	assert.False(t, shouldCrossPost)
+	// The caller isn't counted, and the bo3 player can't be paired with their bo1 request.
+	assert.Contains(t, message, "2 players in the queue (1 bo1, 1 bo3).")
+	assert.Contains(t, message, "1 of them is within your range of 300.")
+	assert.Contains(t, message, "You've been queued for bo1 for 5m.")
+	assert.NotContains(t, message, bo1Player.DiscordUserName)
+
+	for _, v := range []db.User{caller, bo1Player, bo3Player} {
+		db.CancelMatchRequest(conn, v.UserId)
+	}
+}
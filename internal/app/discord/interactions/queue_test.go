@@ -0,0 +1,73 @@
+package interactions
+
+import (
+	"discordbot/internal/app/discord/api"
+	"discordbot/internal/db"
+	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestQueueConcurrently(t *testing.T) {
+	conn := db.GetGorm(db.GetTestMysSQLConnStr())
+	db.InsertMapSet(conn, []string{"a", "b", "c", "d", "e", "f"}, db.Bo1)
+
+	rand.Seed(time.Now().UnixNano())
+	var users []db.User
+	for i := 0; i < 12; i++ {
+		users = append(users, createTestUser(conn))
+	}
+
+	// Everyone is in range of everyone else, so every call is racing for the same few waiting requests.
+	var wg sync.WaitGroup
+	for _, user := range users {
+		wg.Add(1)
+		go func(user db.User) {
+			defer wg.Done()
+			Queue(conn, MockDiscordApi{}, api.Interaction{
+				Member: api.DiscordMemberInfo{User: api.DiscordUser{Id: user.DiscordId, Username: user.DiscordUserName}},
+				Data: api.InteractionData{
+					Options: []api.OptionData{{Type: 4, Name: "mode", Value: db.ToInt(db.Bo1)}},
+				}})
+		}(user)
+	}
+	wg.Wait()
+
+	matches := map[int]db.Match{}
+	for _, user := range users {
+		foundMatch, match := db.GetCurrentMatch(conn, user.UserId)
+		foundRequest, _ := db.GetMatchRequest(conn, user.UserId)
+		// Every player is either still waiting or in exactly one match, never both and never neither.
+		assert.NotEqual(t, foundMatch, foundRequest, "user %d", user.UserId)
+		if foundMatch {
+			matches[match.MatchId] = match
+		}
+	}
+	assert.NotEmpty(t, matches)
+
+	usedRequests := map[int]int{}
+	matchesPerUser := map[int]int{}
+	policy := db.GetMatchmakingPolicy(conn, db.Bo1)
+	for _, match := range matches {
+		assert.Equal(t, policy.PolicyId, match.MatchmakingPolicyId, "match %d", match.MatchId)
+		usedRequests[match.P1MatchRequestId]++
+		usedRequests[match.P2MatchRequestId]++
+		matchesPerUser[match.P1UserId]++
+		matchesPerUser[match.P2UserId]++
+	}
+	for requestId, uses := range usedRequests {
+		assert.Equal(t, 1, uses, "match request %d", requestId)
+	}
+	for userId, count := range matchesPerUser {
+		assert.Equal(t, 1, count, "user %d", userId)
+	}
+
+	for _, user := range users {
+		db.CancelMatchRequest(conn, user.UserId)
+	}
+	for _, match := range matches {
+		db.UpdateMatch(conn, match.MatchId, db.Cancelled, db.Undefined)
+	}
+}
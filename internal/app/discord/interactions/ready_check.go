@@ -0,0 +1,200 @@
+package interactions
+
+import (
+	"discordbot/internal/app/discord/api"
+	"discordbot/internal/db"
+	"fmt"
+	"gorm.io/gorm"
+	"time"
+)
+
+const readyCheckCustomIdPrefix = "ready_check"
+
+/*
+	ReadyCheck handles a press of the Accept or Decline button sent with a pairing. Once both players accept the match
+	is on. A decline cancels it straight away, see failReadyCheck.
+*/
+func ReadyCheck(conn *gorm.DB, discordApi api.DiscordApi, interaction api.Interaction) (success bool, channelMessage string, shouldCrossPost bool) {
+	validId, matchId, response := parseReadyCheckCustomId(interaction.Data.CustomId)
+	if !validId {
+		return false, "Unrecognized ready check button.", false
+	}
+	foundUser, user := db.GetUserByDiscordId(conn, interaction.Member.User.Id)
+	if !foundUser {
+		return false, "Unable to find your user. Contact admin for help.", false
+	}
+	return respondToReadyCheck(conn, discordApi, user, matchId, response, time.Now())
+}
+
+func respondToReadyCheck(conn *gorm.DB, discordApi api.DiscordApi, user db.User, matchId int, response db.ReadyResponse, now time.Time) (success bool, channelMessage string, shouldCrossPost bool) {
+	foundMatch, match := db.GetMatchById(conn, matchId)
+	if !foundMatch || (match.P1UserId != user.UserId && match.P2UserId != user.UserId) {
+		return false, "That ready check isn't for one of your matches.", false
+	}
+	foundCheck, check := db.GetReadyCheck(conn, matchId)
+	if !foundCheck {
+		return false, "That match doesn't have a ready check.", false
+	}
+	if check.IsResolved() {
+		_, message := resolvedReadyCheckMessage(conn, check)
+		return false, message, false
+	}
+	if !now.Before(check.ExpiresAt) {
+		failReadyCheck(conn, discordApi, match, now)
+		return false, "Too late, the ready check ran out and the match was cancelled.", false
+	}
+
+	isP1 := match.P1UserId == user.UserId
+	if !db.SetReadyResponse(conn, matchId, isP1, response, now) {
+		// The check may have been resolved or run out since it was read above.
+		_, check = db.GetReadyCheck(conn, matchId)
+		if check.IsResolved() {
+			_, message := resolvedReadyCheckMessage(conn, check)
+			return false, message, false
+		}
+		return false, "You already answered this ready check.", false
+	}
+	_, check = db.GetReadyCheck(conn, matchId)
+
+	opponentUserId := match.P2UserId
+	if !isP1 {
+		opponentUserId = match.P1UserId
+	}
+	_, opponent := db.GetUserById(conn, opponentUserId)
+
+	if response == db.ReadyDeclined {
+		failReadyCheck(conn, discordApi, match, now)
+		return true, "You declined the match, so it has been cancelled.", false
+	}
+	if check.BothAccepted() {
+		if !db.ResolveReadyCheck(conn, matchId, now) {
+			// Either the opponent's accept resolved it first, or the expiry job cancelled the match.
+			_, check = db.GetReadyCheck(conn, matchId)
+			matchOn, message := resolvedReadyCheckMessage(conn, check)
+			return matchOn, message, false
+		}
+		discordApi.SendDirectMessage(opponent, "Your opponent accepted too, the match is on. Good luck!")
+		startMatchSetup(conn, discordApi, match, now)
+		return true, "Both players accepted, the match is on. Check your DMs for the map veto or faction draft.", false
+	}
+	return true, "You're ready. Waiting for your opponent to accept.", false
+}
+
+/*
+	ExpireReadyChecks cancels every match whose ready check ran out before both players accepted. Returns how many were
+	cancelled.
+*/
+func ExpireReadyChecks(conn *gorm.DB, discordApi api.DiscordApi, now time.Time) (expired int) {
+	for _, check := range db.FindExpiredReadyChecks(conn, now) {
+		foundMatch, match := db.GetMatchById(conn, check.MatchId)
+		if !foundMatch {
+			continue
+		}
+		if failReadyCheck(conn, discordApi, match, now) {
+			expired++
+		}
+	}
+	return expired
+}
+
+/*
+	failReadyCheck cancels the match. A player who accepted, or who was still deciding when their opponent declined, goes
+	back into the queue where they were. A player who let the check run out gets a strike and stays out of the queue.
+	Returns false if the check was already resolved by someone else.
+*/
+func failReadyCheck(conn *gorm.DB, discordApi api.DiscordApi, match db.Match, now time.Time) (failed bool) {
+	if !db.ResolveReadyCheck(conn, match.MatchId, now) {
+		return false
+	}
+	// Read the responses once the check is closed, so an accept that landed just before counts.
+	_, check := db.GetReadyCheck(conn, match.MatchId)
+	db.UpdateMatch(conn, match.MatchId, db.Cancelled, db.Undefined)
+
+	_, p1User := db.GetUserById(conn, match.P1UserId)
+	_, p2User := db.GetUserById(conn, match.P2UserId)
+	players := []struct {
+		user           db.User
+		matchRequestId int
+		response       db.ReadyResponse
+	}{
+		{p1User, match.P1MatchRequestId, check.P1Response},
+		{p2User, match.P2MatchRequestId, check.P2Response},
+	}
+
+	reason := "the ready check ran out"
+	if check.AnyDeclined() {
+		reason = "a player declined"
+	}
+	for _, v := range players {
+		switch {
+		case v.response == db.ReadyDeclined:
+			discordApi.RemoveRoleFromGuildMember(LadderQueueRoleName, v.user.DiscordId)
+		case v.response == db.ReadyPending && !check.AnyDeclined():
+			db.AddUserStrike(conn, v.user.UserId, match.MatchId, db.StrikeMissedReadyCheck, now)
+			discordApi.RemoveRoleFromGuildMember(LadderQueueRoleName, v.user.DiscordId)
+			discordApi.SendDirectMessage(v.user, fmt.Sprintf(
+				"You didn't accept your match in time, so it was cancelled and you were taken out of the queue. You now have %d strike(s).",
+				db.CountUserStrikes(conn, v.user.UserId)))
+		default:
+			message := fmt.Sprintf("Your match was cancelled because %s.", reason)
+			if db.RestoreMatchRequest(conn, v.matchRequestId, now) {
+				message += " You're back in the queue in the same place."
+			} else {
+				discordApi.RemoveRoleFromGuildMember(LadderQueueRoleName, v.user.DiscordId)
+				message += " Queue up again to find another match."
+			}
+			discordApi.SendDirectMessage(v.user, message)
+		}
+	}
+	discordApi.PostToChannel(LadderFeedChannel, fmt.Sprintf(
+		"The match between <@!%s> and <@!%s> was cancelled because %s.", p1User.DiscordId, p2User.DiscordId, reason))
+	return true
+}
+
+/*
+	resolvedReadyCheckMessage tells a player pressing a button on a closed ready check how it ended.
+*/
+func resolvedReadyCheckMessage(conn *gorm.DB, check db.ReadyCheck) (matchOn bool, message string) {
+	_, match := db.GetMatchById(conn, check.MatchId)
+	if check.BothAccepted() && match.MatchState != db.Cancelled {
+		return true, "Both players accepted, the match is on."
+	}
+	return false, "That match was already cancelled."
+}
+
+/*
+	readyCheckPending whether the match is still waiting on either player to accept.
+*/
+func readyCheckPending(conn *gorm.DB, matchId int) bool {
+	foundCheck, check := db.GetReadyCheck(conn, matchId)
+	return foundCheck && !check.IsResolved()
+}
+
+/*
+	readyCheckFailed whether the match was cancelled by its ready check, in which case it was never played.
+*/
+func readyCheckFailed(conn *gorm.DB, matchId int) bool {
+	foundCheck, check := db.GetReadyCheck(conn, matchId)
+	return foundCheck && check.IsResolved() && !check.BothAccepted()
+}
+
+func readyCheckComponents(matchId int) []api.ActionRow {
+	return acceptDeclineComponents(readyCheckCustomIdPrefix, matchId)
+}
+
+func readyCheckCustomId(matchId int, response db.ReadyResponse) string {
+	return buttonCustomId(readyCheckCustomIdPrefix, string(response), matchId)
+}
+
+func IsReadyCheckCustomId(customId string) bool {
+	return hasButtonPrefix(customId, readyCheckCustomIdPrefix)
+}
+
+func parseReadyCheckCustomId(customId string) (valid bool, matchId int, response db.ReadyResponse) {
+	valid, action, matchId := parseButtonCustomId(customId, readyCheckCustomIdPrefix)
+	response = db.ReadyResponse(action)
+	if !valid || (response != db.ReadyAccepted && response != db.ReadyDeclined) {
+		return false, 0, db.ReadyPending
+	}
+	return true, matchId, response
+}
@@ -0,0 +1,100 @@
+package interactions
+
+import (
+	"discordbot/internal/db"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestParseReadyCheckCustomId(t *testing.T) {
+	valid, matchId, response := parseReadyCheckCustomId(readyCheckCustomId(42, db.ReadyDeclined))
+	assert.True(t, valid)
+	assert.Equal(t, 42, matchId)
+	assert.Equal(t, db.ReadyDeclined, response)
+	assert.True(t, IsReadyCheckCustomId(readyCheckCustomId(42, db.ReadyAccepted)))
+
+	for _, v := range []string{"", "ready_check:accepted", "ready_check:maybe:42", "ready_check:accepted:x", "other:accepted:42"} {
+		valid, _, _ = parseReadyCheckCustomId(v)
+		assert.False(t, valid, v)
+	}
+}
+
+/*
+	startReadyCheckedMatch queues two fresh players, the first a few minutes before the second, and pairs them.
+*/
+func startReadyCheckedMatch(t *testing.T, conn *gorm.DB) (p1User db.User, p2User db.User, match db.Match) {
+	t.Setenv("QUEUE_READY_CHECK_MINUTES", "5")
+	db.InsertMapSet(conn, []string{"a", "b", "c", "d", "e", "f"}, db.Bo1)
+	rand.Seed(time.Now().UnixNano())
+	p1User, p2User = createTestUser(conn), createTestUser(conn)
+
+	for i, user := range []db.User{p1User, p2User} {
+		db.CreateMatchRequest(conn, db.MatchRequest{
+			RequestingUserId:  user.UserId,
+			CreatedAt:         time.Now().Add(-time.Duration(10-i) * time.Minute),
+			UpdatedAt:         time.Now(),
+			RequestRange:      300,
+			RequestedGameMode: db.Bo1,
+			MatchRequestState: db.MatchRequestStateQueued,
+		})
+	}
+	_, p1Request := db.GetMatchRequest(conn, p1User.UserId)
+	_, p2Request := db.GetMatchRequest(conn, p2User.UserId)
+	success, _, _ := startMatch(conn, MockDiscordApi{}, p1Request, p2Request, 0, "test")
+	assert.True(t, success)
+	_, match = db.GetCurrentMatch(conn, p1User.UserId)
+	return p1User, p2User, match
+}
+
+func TestReadyCheckDeclineRestoresOpponent(t *testing.T) {
+	conn := db.GetGorm(db.GetTestMysSQLConnStr())
+	p1User, p2User, match := startReadyCheckedMatch(t, conn)
+	now := time.Now()
+
+	success, _, _ := respondToReadyCheck(conn, MockDiscordApi{}, p1User, match.MatchId, db.ReadyAccepted, now)
+	assert.True(t, success)
+	success, _, _ = respondToReadyCheck(conn, MockDiscordApi{}, p1User, match.MatchId, db.ReadyDeclined, now)
+	assert.False(t, success)
+
+	success, _, _ = respondToReadyCheck(conn, MockDiscordApi{}, p2User, match.MatchId, db.ReadyDeclined, now)
+	assert.True(t, success)
+
+	_, cancelled := db.GetMatchById(conn, match.MatchId)
+	assert.Equal(t, db.Cancelled, cancelled.MatchState)
+	foundRequest, restored := db.GetMatchRequest(conn, p1User.UserId)
+	assert.True(t, foundRequest)
+	assert.Equal(t, match.P1MatchRequestId, restored.MatchRequestId)
+	foundRequest, _ = db.GetMatchRequest(conn, p2User.UserId)
+	assert.False(t, foundRequest)
+	assert.Equal(t, 0, db.CountUserStrikes(conn, p2User.UserId))
+
+	db.CancelMatchRequest(conn, p1User.UserId)
+}
+
+func TestExpireReadyChecks(t *testing.T) {
+	conn := db.GetGorm(db.GetTestMysSQLConnStr())
+	p1User, p2User, match := startReadyCheckedMatch(t, conn)
+
+	success, _, _ := respondToReadyCheck(conn, MockDiscordApi{}, p2User, match.MatchId, db.ReadyAccepted, time.Now())
+	assert.True(t, success)
+	assert.True(t, readyCheckPending(conn, match.MatchId))
+	assert.Equal(t, 0, ExpireReadyChecks(conn, MockDiscordApi{}, time.Now()))
+
+	assert.Equal(t, 1, ExpireReadyChecks(conn, MockDiscordApi{}, time.Now().Add(6*time.Minute)))
+	assert.True(t, readyCheckFailed(conn, match.MatchId))
+	assert.Equal(t, 1, db.CountUserStrikes(conn, p1User.UserId))
+	assert.Equal(t, 0, db.CountUserStrikes(conn, p2User.UserId))
+	foundRequest, _ := db.GetMatchRequest(conn, p1User.UserId)
+	assert.False(t, foundRequest)
+	foundRequest, restored := db.GetMatchRequest(conn, p2User.UserId)
+	assert.True(t, foundRequest)
+	assert.Equal(t, match.P2MatchRequestId, restored.MatchRequestId)
+
+	success, _, _ = respondToReadyCheck(conn, MockDiscordApi{}, p1User, match.MatchId, db.ReadyAccepted, time.Now())
+	assert.False(t, success)
+
+	db.CancelMatchRequest(conn, p2User.UserId)
+}
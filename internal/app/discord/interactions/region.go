@@ -0,0 +1,32 @@
+package interactions
+
+import (
+	"discordbot/internal/app/discord/api"
+	"discordbot/internal/db"
+	"fmt"
+	"gorm.io/gorm"
+)
+
+/*
+	SetRegion stores the user's home region, which `/queue` region preferences are measured from.
+*/
+func SetRegion(conn *gorm.DB, discordApi api.DiscordApi, interaction api.Interaction) (success bool, channelMessage string, shouldCrossPost bool) {
+	region := db.NoRegion
+	for _, v := range interaction.Data.Options {
+		if v.Name == "home" {
+			region = db.RegionFromInt(v.Value)
+		}
+	}
+	if region == db.NoRegion {
+		return false, "Choose a home region.", false
+	}
+
+	foundUser, user := db.GetUserByDiscordId(conn, interaction.Member.User.Id)
+	if !foundUser {
+		return false, "You aren't on the ladder yet, queue up first.", false
+	}
+	if !db.SetUserRegion(conn, user.UserId, region) {
+		return false, "Unable to set your region.", false
+	}
+	return true, fmt.Sprintf("Your home region is now %s.", region), false
+}
@@ -1,22 +1,34 @@
 package interactions
 
 import (
+	"discordbot/internal/app/config"
 	"discordbot/internal/app/discord/api"
 	"discordbot/internal/app/discord/commands"
 	"discordbot/internal/app/ratings"
 	"discordbot/internal/db"
 	"fmt"
 	"gorm.io/gorm"
+	"strings"
+	"time"
 )
 
 func Report(conn *gorm.DB, discordApi api.DiscordApi, interaction api.Interaction) (success bool, channelMessage string, shouldCrossPost bool) {
-	outcome := commands.ReportOutcome(interaction.Data.Options[0].Value)
+	var outcome commands.ReportOutcome
+	hasScore := false
+	var score commands.SeriesScore
+
+	for _, v := range interaction.Data.Options {
+		if v.Name == "outcome" {
+			outcome = commands.ReportOutcome(v.Value)
+		} else if v.Name == "score" {
+			hasScore = true
+			score = commands.SeriesScore(v.Value)
+		}
+	}
 
 	switch outcome {
-	case commands.Win:
-		return handlePlayedMatch(conn, discordApi, interaction, true)
-	case commands.Loss:
-		return handlePlayedMatch(conn, discordApi, interaction, false)
+	case commands.Win, commands.Loss, commands.Draw:
+		return handlePlayedMatch(conn, discordApi, interaction, outcome, hasScore, score)
 	case commands.Cancel:
 		return handleCancel(conn, interaction)
 	default:
@@ -24,7 +36,7 @@ func Report(conn *gorm.DB, discordApi api.DiscordApi, interaction api.Interactio
 	}
 }
 
-func handlePlayedMatch(conn *gorm.DB, discordApi api.DiscordApi, interaction api.Interaction, isWin bool) (success bool, channelMessage string, shouldCrossPost bool) {
+func handlePlayedMatch(conn *gorm.DB, discordApi api.DiscordApi, interaction api.Interaction, outcome commands.ReportOutcome, hasScore bool, score commands.SeriesScore) (success bool, channelMessage string, shouldCrossPost bool) {
 	foundUser, user := db.GetUserByDiscordId(conn, interaction.Member.User.Id)
 
 	if !foundUser {
@@ -37,81 +49,268 @@ func handlePlayedMatch(conn *gorm.DB, discordApi api.DiscordApi, interaction api
 		return false, "You do not currently have a most recent match. To report a win you must first queue up and get paired.", false
 	}
 
-	interactionUserIsP1 := mostRecentMatch.P1UserId == user.UserId
+	interactionUserIsP1 := mostRecentMatch.OnP1Side(user.UserId)
 
-	var p1Won bool
+	var winner db.WhoWon
 
-	if (interactionUserIsP1 && isWin) || (!interactionUserIsP1 && !isWin) {
-		p1Won = true
+	if outcome == commands.Draw {
+		winner = db.Draw
+	} else if (interactionUserIsP1 && outcome == commands.Win) || (!interactionUserIsP1 && outcome == commands.Loss) {
+		winner = db.P1
 	} else {
-		p1Won = false
+		winner = db.P2
 	}
 
-	player1UserId := mostRecentMatch.P1UserId
-	player2UserId := mostRecentMatch.P2UserId
+	var games []db.MatchGame
+	if hasScore {
+		if mostRecentMatch.GameMode != db.Bo3 {
+			return false, "Series scores can only be reported for bo3 matches.", false
+		}
+		if winner == db.Draw {
+			return false, "Draws don't have a series score, report the draw without one.", false
+		}
+		games = buildSeriesGames(mostRecentMatch, winner == db.P1, score)
+	}
+	draftOk, draftMessage, games := checkDraftedGames(draftedGames(conn, mostRecentMatch), winner, games)
+	if !draftOk {
+		return false, draftMessage, false
+	}
 
-	_, p1User := db.GetUserById(conn, player1UserId)
-	_, p2User := db.GetUserById(conn, player2UserId)
+	players := getMatchPlayers(conn, mostRecentMatch)
 
 	switch mostRecentMatch.MatchState {
 	case db.Matched:
+		if readyCheckPending(conn, mostRecentMatch.MatchId) {
+			return false, "Both players need to accept the match before it can be reported.", false
+		}
 		// Matched state will be hit once - no state leak
-		discordApi.RemoveRoleFromGuildMember(LadderQueueRoleName, p1User.DiscordId)
-		discordApi.RemoveRoleFromGuildMember(LadderQueueRoleName, p2User.DiscordId)
-		// Get current ratings, compute new ratings, update ratings for both players, then update match state to complete.
-		return recordMatchWinner(conn, p1User, p2User, mostRecentMatch, p1Won)
+		removeQueueRoles(discordApi, players)
+		// Get current ratings, compute new ratings, update ratings for every player, then update match state to complete.
+		return recordResult(conn, players, mostRecentMatch, winner, games)
 	case db.Completed:
-		// Get last rating, recompute ratings, tombstone old rating entry, add new rating entry, update both player ratings
-		// Problem - if the other player has played a match since - make sure their rating is correct or do something reasonable
-		_, mostRecentMatchP2 := db.GetMostRecentMatch(conn, player2UserId)
-		if mostRecentMatchP2.MatchId != mostRecentMatch.MatchId {
+		// Get last rating, recompute ratings, tombstone old rating entry, add new rating entry, update every player's rating
+		// Problem - if another player has played a match since - make sure their rating is correct or do something reasonable
+		if playedSince(conn, mostRecentMatch) {
 			return false, "Your last match was reported and your opponent already logged their next match, which means we cannot update scores. Next time if you need to make a change to a match result you'll need to work with your opponent to do that before either of you play again.", false
 		}
-		db.RevertUserRating(conn, player1UserId)
-		db.RevertUserRating(conn, player2UserId)
-		_, p1User := db.GetUserById(conn, player1UserId)
-		_, p2User := db.GetUserById(conn, player2UserId)
-		discordApi.RemoveRoleFromGuildMember(LadderQueueRoleName, p1User.DiscordId)
-		discordApi.RemoveRoleFromGuildMember(LadderQueueRoleName, p2User.DiscordId)
-		return recordMatchWinner(conn, p1User, p2User, mostRecentMatch, p1Won)
+		if !revertMatchRatings(conn, mostRecentMatch, players) {
+			return false, ratingChangedSinceMessage, false
+		}
+		removeQueueRoles(discordApi, players)
+		return recordResult(conn, players, mostRecentMatch, winner, games)
 	case db.Cancelled:
-		// Get current ratings, compute new ratings, update ratings for both players, then update match state to complete.
-		discordApi.RemoveRoleFromGuildMember(LadderQueueRoleName, p1User.DiscordId)
-		discordApi.RemoveRoleFromGuildMember(LadderQueueRoleName, p2User.DiscordId)
-		return recordMatchWinner(conn, p1User, p2User, mostRecentMatch, p1Won)
+		if readyCheckFailed(conn, mostRecentMatch.MatchId) {
+			return false, "That match was cancelled because it wasn't accepted by both players, so it can't be reported.", false
+		}
+		// Get current ratings, compute new ratings, update ratings for every player, then update match state to complete.
+		removeQueueRoles(discordApi, players)
+		return recordResult(conn, players, mostRecentMatch, winner, games)
 	default:
 		return false, fmt.Sprintf("Unknown prior match state %s contact admins for help.", mostRecentMatch.MatchState), false
 	}
 }
 
-func recordMatchWinner(conn *gorm.DB, p1User db.User, p2User db.User, mostRecentMatch db.Match, p1Won bool) (success bool, channnelMessage string, shouldCrossPost bool) {
-	// Get current ratings, compute new ratings, update ratings for both players, then update match state to complete.
-	p1K := db.GetPlayerKValue(conn, p1User.UserId, mostRecentMatch.GameMode)
-	p2K := db.GetPlayerKValue(conn, p2User.UserId, mostRecentMatch.GameMode)
+/*
+	getMatchPlayers everyone in the match in the order of Match.PlayerIds, so P1 and P2 in a 1v1 match.
+*/
+func getMatchPlayers(conn *gorm.DB, match db.Match) (players []db.User) {
+	for _, v := range match.PlayerIds() {
+		_, player := db.GetUserById(conn, v)
+		players = append(players, player)
+	}
+	return players
+}
+
+func removeQueueRoles(discordApi api.DiscordApi, players []db.User) {
+	for _, v := range players {
+		discordApi.RemoveRoleFromGuildMember(LadderQueueRoleName, v.DiscordId)
+	}
+}
+
+/*
+	playedSince whether anyone in the match has been paired again since, in which case its result can no longer be
+	changed without their later ratings going wrong.
+*/
+func playedSince(conn *gorm.DB, match db.Match) bool {
+	for _, v := range match.PlayerIds() {
+		_, mostRecentMatch := db.GetMostRecentMatch(conn, v)
+		if mostRecentMatch.MatchId != match.MatchId {
+			return true
+		}
+	}
+	return false
+}
 
-	newP1Rating, newP2Rating := ratings.ComputeNewElos(p1User.CurrentRating, p2User.CurrentRating, p1Won, p1K, p2K)
+const ratingChangedSinceMessage = "A rating decay or new season has changed ratings since that match was reported, so it can't be changed any more. Contact an admin for help."
 
-	var winnerValue db.WhoWon
-	var winnerName string
+/*
+	revertMatchRatings undoes the rating changes the match made for everyone in it. Nobody is reverted unless everyone's
+	latest rating change is still the match's.
+*/
+func revertMatchRatings(conn *gorm.DB, match db.Match, players []db.User) (success bool) {
+	for _, v := range players {
+		if !db.IsLatestMatchRating(conn, v.UserId, match.GameMode, match.MatchId) {
+			return false
+		}
+	}
+	for _, v := range players {
+		db.RevertMatchRating(conn, v.UserId, match.GameMode, match.MatchId)
+	}
+	return true
+}
 
+/*
+	describeSides the names of whoever played on each side, partners joined with "&".
+*/
+func describeSides(match db.Match, players []db.User) (p1Side string, p2Side string) {
+	if !match.IsTeamMatch() {
+		return players[0].DiscordUserName, players[1].DiscordUserName
+	}
+	return fmt.Sprintf("%s & %s", players[0].DiscordUserName, players[1].DiscordUserName),
+		fmt.Sprintf("%s & %s", players[2].DiscordUserName, players[3].DiscordUserName)
+}
+
+func recordResult(conn *gorm.DB, players []db.User, match db.Match, winner db.WhoWon, games []db.MatchGame) (success bool, channnelMessage string, shouldCrossPost bool) {
+	if match.IsTeamMatch() {
+		return recordTeamMatchResult(conn, players, match, winner)
+	}
+	return recordMatchResult(conn, players[0], players[1], match, winner, games)
+}
+
+/*
+	buildSeriesGames turns a reported bo3 score into per game results, attaching the maps assigned when the match was made.
+*/
+func buildSeriesGames(match db.Match, p1Won bool, score commands.SeriesScore) (games []db.MatchGame) {
+	winner, loser := db.P2, db.P1
 	if p1Won {
-		winnerName = p1User.DiscordUserName
-		winnerValue = db.P1
-	} else {
-		winnerName = p2User.DiscordUserName
-		winnerValue = db.P2
+		winner, loser = db.P1, db.P2
+	}
+
+	var winners []db.WhoWon
+	switch score {
+	case commands.TwoOneLostFirstGame:
+		winners = []db.WhoWon{loser, winner, winner}
+	case commands.TwoOneLostSecondGame:
+		winners = []db.WhoWon{winner, loser, winner}
+	default:
+		winners = []db.WhoWon{winner, winner}
+	}
+
+	for i, v := range winners {
+		game := db.MatchGame{MatchId: match.MatchId, GameNumber: i + 1, Winner: v}
+		if i < len(match.Maps) {
+			game.MapName = match.Maps[i]
+		}
+		games = append(games, game)
+	}
+	return games
+}
+
+func recordMatchResult(conn *gorm.DB, p1User db.User, p2User db.User, mostRecentMatch db.Match, winner db.WhoWon, games []db.MatchGame) (success bool, channnelMessage string, shouldCrossPost bool) {
+	// Get current ratings, compute new ratings, update ratings for both players, then update match state to complete.
+	winnerGames, loserGames := db.SeriesScoreFor(games, winner == db.P1)
+	weight := ratings.SeriesWeight(winnerGames, loserGames)
+	scoreStr := ""
+	if len(games) > 0 {
+		scoreStr = fmt.Sprintf(" (%d-%d)", winnerGames, loserGames)
+	}
+
+	ratingSystem := ratings.GetConfiguredRatingSystem()
+	newP1Rating, newP2Rating := ratingSystem.ComputeNewRatings(
+		db.GetUserRating(conn, p1User.UserId, mostRecentMatch.GameMode),
+		db.GetUserRating(conn, p2User.UserId, mostRecentMatch.GameMode),
+		db.P1Score(winner),
+		weight)
+
+	var resultDescription string
+
+	switch winner {
+	case db.P1:
+		resultDescription = fmt.Sprintf("Win for %s recorded%s.", p1User.DiscordUserName, scoreStr)
+	case db.P2:
+		resultDescription = fmt.Sprintf("Win for %s recorded%s.", p2User.DiscordUserName, scoreStr)
+	default:
+		resultDescription = fmt.Sprintf("Draw between %s and %s recorded.", p1User.DiscordUserName, p2User.DiscordUserName)
+	}
+
+	db.UpdateUserRating(conn, p1User.UserId, mostRecentMatch.GameMode, newP1Rating, mostRecentMatch.MatchId)
+	db.UpdateUserRating(conn, p2User.UserId, mostRecentMatch.GameMode, newP2Rating, mostRecentMatch.MatchId)
+	db.UpdateMatch(conn, mostRecentMatch.MatchId, db.Completed, winner)
+	// Re-reports replace the old games, and a report without a score clears any previously reported ones.
+	db.ReplaceMatchGames(conn, mostRecentMatch.MatchId, games)
+
+	placementMessage := ""
+	// Only the first report of a match can finish someone's placement, re-reports just change the result.
+	if mostRecentMatch.MatchState != db.Completed {
+		placementMessage += describePlacementFinished(conn, p1User, mostRecentMatch.GameMode, newP1Rating)
+		placementMessage += describePlacementFinished(conn, p2User, mostRecentMatch.GameMode, newP2Rating)
 	}
 
-	db.UpdateUserRating(conn, p1User.UserId, newP1Rating, mostRecentMatch.MatchId)
-	db.UpdateUserRating(conn, p2User.UserId, newP2Rating, mostRecentMatch.MatchId)
-	db.UpdateMatch(conn, mostRecentMatch.MatchId, db.Completed, winnerValue)
 	// TODO messaging improvements - maybe some nice art and a conditional congrats based on elo buckets.
 	return true, fmt.Sprintf(
-			"Win for %s recorded. Updated %s to rating %d and %s to rating %d.",
-			winnerName, p1User.DiscordUserName, newP1Rating, p2User.DiscordUserName, newP2Rating),
+			"%s Updated %s to %s rating %d and %s to %s rating %d.%s",
+			resultDescription,
+			p1User.DiscordUserName, mostRecentMatch.GameMode, newP1Rating.Rating,
+			p2User.DiscordUserName, mostRecentMatch.GameMode, newP2Rating.Rating,
+			placementMessage),
 		true
 }
 
+/*
+	recordTeamMatchResult rates a 2v2 match with ratings.ComputeNewTeamRatings and completes it. Team matches have no
+	series score, so every result moves ratings at full weight.
+*/
+func recordTeamMatchResult(conn *gorm.DB, players []db.User, match db.Match, winner db.WhoWon) (success bool, channnelMessage string, shouldCrossPost bool) {
+	// Players are P1's side first, see getMatchPlayers.
+	var currentRatings []ratings.PlayerRating
+	for _, v := range players {
+		currentRatings = append(currentRatings, db.GetUserRating(conn, v.UserId, match.GameMode))
+	}
+	p1Side, p2Side := currentRatings[:2], currentRatings[2:]
+	newP1Side, newP2Side := ratings.ComputeNewTeamRatings(ratings.GetConfiguredRatingSystem(), p1Side, p2Side, db.P1Score(winner), 1.0)
+	newRatings := append(newP1Side, newP2Side...)
+
+	p1SideNames, p2SideNames := describeSides(match, players)
+	var resultDescription string
+	switch winner {
+	case db.P1:
+		resultDescription = fmt.Sprintf("Win for %s recorded.", p1SideNames)
+	case db.P2:
+		resultDescription = fmt.Sprintf("Win for %s recorded.", p2SideNames)
+	default:
+		resultDescription = fmt.Sprintf("Draw between %s and %s recorded.", p1SideNames, p2SideNames)
+	}
+
+	var updates []string
+	for i, v := range players {
+		db.UpdateUserRating(conn, v.UserId, match.GameMode, newRatings[i], match.MatchId)
+		updates = append(updates, fmt.Sprintf("%s to %s rating %d", v.DiscordUserName, match.GameMode, newRatings[i].Rating))
+	}
+	db.UpdateMatch(conn, match.MatchId, db.Completed, winner)
+
+	placementMessage := ""
+	// Only the first report of a match can finish someone's placement, re-reports just change the result.
+	if match.MatchState != db.Completed {
+		for i, v := range players {
+			placementMessage += describePlacementFinished(conn, v, match.GameMode, newRatings[i])
+		}
+	}
+
+	return true, fmt.Sprintf("%s Updated %s.%s", resultDescription, strings.Join(updates, ", "), placementMessage), true
+}
+
+/*
+	describePlacementFinished announces a player's first rating on a ladder if the match just recorded was their last
+	placement match there.
+*/
+func describePlacementFinished(conn *gorm.DB, user db.User, mode db.GameMode, newRating ratings.PlayerRating) string {
+	gamesPlayed := db.GetCompletedMatchCount(conn, user.UserId, mode)
+	if gamesPlayed != config.GetRatingConfig().PlacementMatches {
+		return ""
+	}
+	return fmt.Sprintf("\n%s finished placement and enters the %s ladder with a rating of %d!", user.DiscordUserName, mode, newRating.Rating)
+}
+
 func handleCancel(conn *gorm.DB, interaction api.Interaction) (success bool, channelMessage string, shouldCrossPost bool) {
 	foundUser, user := db.GetUserByDiscordId(conn, interaction.Member.User.Id)
 
@@ -125,14 +324,10 @@ func handleCancel(conn *gorm.DB, interaction api.Interaction) (success bool, cha
 		return false, "You do not currently have a most recent match. To report a win you must first queue up and get paired.", false
 	}
 
-	player1UserId := mostRecentMatch.P1UserId
-	player2UserId := mostRecentMatch.P2UserId
-
-	_, p1User := db.GetUserById(conn, player1UserId)
-	_, p2User := db.GetUserById(conn, player2UserId)
+	players := getMatchPlayers(conn, mostRecentMatch)
+	p1Side, p2Side := describeSides(mostRecentMatch, players)
 
-	_, mostRecentMatchP2 := db.GetMostRecentMatch(conn, player2UserId)
-	if mostRecentMatchP2.MatchId != mostRecentMatch.MatchId {
+	if playedSince(conn, mostRecentMatch) {
 		return false, "Your last match was reported and your opponent already logged their next match, which means we cannot cancel scores. Next time if you need to make a change to a match result you'll need to work with your opponent to do that before either of you play again.", false
 	}
 
@@ -141,16 +336,22 @@ func handleCancel(conn *gorm.DB, interaction api.Interaction) (success bool, cha
 		return true, "The most recent match was already cancelled so nothing to do! Feel free to requeue.", false
 	case db.Matched:
 		db.UpdateMatch(conn, mostRecentMatch.MatchId, db.Cancelled, db.Undefined)
-		return true, fmt.Sprintf("Match between %s and %s cancelled by %s. No ratings changes will occur, feel free to requeue when convienient.", p1User.DiscordUserName, p2User.DiscordUserName, user.DiscordUserName), true
+		// Close any ready check still open so it doesn't later count against whoever hadn't accepted yet.
+		db.ResolveReadyCheck(conn, mostRecentMatch.MatchId, time.Now())
+		return true, fmt.Sprintf("Match between %s and %s cancelled by %s. No ratings changes will occur, feel free to requeue when convienient.", p1Side, p2Side, user.DiscordUserName), true
 	case db.Completed:
-		db.RevertUserRating(conn, player1UserId)
-		db.RevertUserRating(conn, player2UserId)
+		if !revertMatchRatings(conn, mostRecentMatch, players) {
+			return false, ratingChangedSinceMessage, false
+		}
 		db.UpdateMatch(conn, mostRecentMatch.MatchId, db.Cancelled, db.Undefined)
+		db.ReplaceMatchGames(conn, mostRecentMatch.MatchId, []db.MatchGame{})
 
-		_, p1User = db.GetUserById(conn, player1UserId)
-		_, p2User = db.GetUserById(conn, player2UserId)
+		var reverts []string
+		for _, v := range players {
+			reverts = append(reverts, fmt.Sprintf("%s to %s rating %d", v.DiscordUserName, mostRecentMatch.GameMode, db.GetUserRating(conn, v.UserId, mostRecentMatch.GameMode).Rating))
+		}
 
-		return true, fmt.Sprintf("%s cancelled the most recent match between %s and %s. Reverted %s to rating %d and %s to rating %d and marked the match not played.", user.DiscordUserName, p1User.DiscordUserName, p2User.DiscordUserName, p1User.DiscordUserName, p1User.CurrentRating, p2User.DiscordUserName, p2User.CurrentRating), true
+		return true, fmt.Sprintf("%s cancelled the most recent match between %s and %s. Reverted %s and %s and marked the match not played.", user.DiscordUserName, p1Side, p2Side, strings.Join(reverts[:len(reverts)-1], ", "), reverts[len(reverts)-1]), true
 	default:
 		return false, fmt.Sprintf("Unknown prior match state %s contact admins for help.", mostRecentMatch.MatchState), false
 	}
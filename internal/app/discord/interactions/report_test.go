@@ -3,6 +3,7 @@ package interactions
 import (
 	"discordbot/internal/app/discord/api"
 	"discordbot/internal/app/discord/commands"
+	"discordbot/internal/app/ratings"
 	"discordbot/internal/db"
 	"fmt"
 	"github.com/stretchr/testify/assert"
@@ -23,15 +24,27 @@ func (c MockDiscordApi) RemoveRoleFromGuildMember(roleName string, discordId str
 	return true
 }
 
+func (c MockDiscordApi) SendDirectMessage(recipient db.User, message string, components ...api.ActionRow) (success bool) {
+	return true
+}
+
+func (c MockDiscordApi) PostToChannel(channelName string, message string) (success bool) {
+	return true
+}
+
 func setUpTestMatch(conn *gorm.DB) (user1 db.User, user2 db.User, match db.Match) {
+	return setUpTestMatchForMode(conn, db.Bo1)
+}
+
+func setUpTestMatchForMode(conn *gorm.DB, mode db.GameMode) (user1 db.User, user2 db.User, match db.Match) {
 	testDiscordUsername1 := fmt.Sprintf("coolsk8r1990%d", rand.Intn(1000000))
 	testDiscordId1 := fmt.Sprintf("somediscordId%d", rand.Intn(1000000))
 
 	testDiscordUsername2 := fmt.Sprintf("coolsk8r1990%d", rand.Intn(1000000))
 	testDiscordId2 := fmt.Sprintf("somediscordId%d", rand.Intn(1000000))
 
-	db.CreateUser(conn, db.User{DiscordId: testDiscordId1, DiscordUserName: testDiscordUsername1, CurrentRating: db.DEFAULT_RATING})
-	db.CreateUser(conn, db.User{DiscordId: testDiscordId2, DiscordUserName: testDiscordUsername2, CurrentRating: db.DEFAULT_RATING})
+	db.CreateUser(conn, db.User{DiscordId: testDiscordId1, DiscordUserName: testDiscordUsername1})
+	db.CreateUser(conn, db.User{DiscordId: testDiscordId2, DiscordUserName: testDiscordUsername2})
 
 	_, user1 = db.GetUserByDiscordId(conn, testDiscordId1)
 	_, user2 = db.GetUserByDiscordId(conn, testDiscordId2)
@@ -41,7 +54,7 @@ func setUpTestMatch(conn *gorm.DB) (user1 db.User, user2 db.User, match db.Match
 		CreatedAt:         time.Now(),
 		UpdatedAt:         time.Now(),
 		RequestRange:      100,
-		RequestedGameMode: db.Bo1,
+		RequestedGameMode: mode,
 		MatchRequestState: db.MatchRequestStateQueued,
 	}
 
@@ -50,7 +63,7 @@ func setUpTestMatch(conn *gorm.DB) (user1 db.User, user2 db.User, match db.Match
 		CreatedAt:         time.Now(),
 		UpdatedAt:         time.Now(),
 		RequestRange:      100,
-		RequestedGameMode: db.Bo1,
+		RequestedGameMode: mode,
 		MatchRequestState: db.MatchRequestStateQueued,
 	}
 
@@ -60,7 +73,7 @@ func setUpTestMatch(conn *gorm.DB) (user1 db.User, user2 db.User, match db.Match
 	_, r1 := db.GetMatchRequest(conn, user1.UserId)
 	_, r2 := db.GetMatchRequest(conn, user2.UserId)
 
-	db.CreateMatchFromRequests(conn, r1, r2)
+	db.CreateMatchFromRequests(conn, r1, r2, 0)
 
 	_, match = db.GetMostRecentMatch(conn, user1.UserId)
 
@@ -75,27 +88,187 @@ func TestReportWin(t *testing.T) {
 	user1, user2, match := setUpTestMatch(conn)
 
 	Report(conn, mockApi, api.Interaction{
-		Member: api.DiscordMemberInfo{api.DiscordUser{Id: user1.DiscordId, Username: user1.DiscordUserName}},
+		Member: api.DiscordMemberInfo{User: api.DiscordUser{Id: user1.DiscordId, Username: user1.DiscordUserName}},
 		Data: api.InteractionData{
 			Name: commands.Report,
 			Options: []api.OptionData{
 				{
 					Type:  3,
-					Name:  "Win",
+					Name:  "outcome",
 					Value: int(commands.Win),
 				},
 			},
 		}})
 
 	_, updatedMatch := db.GetMostRecentMatch(conn, user2.UserId)
-	_, updatedP1User := db.GetUserById(conn, user1.UserId)
-	_, updatedP2User := db.GetUserById(conn, user2.UserId)
+	updatedP1Rating := db.GetUserRating(conn, user1.UserId, match.GameMode)
+	updatedP2Rating := db.GetUserRating(conn, user2.UserId, match.GameMode)
 
 	assert.Equal(t, match.MatchId, updatedMatch.MatchId)
 	assert.Equal(t, db.Completed, updatedMatch.MatchState)
 
-	assert.Equal(t, 1216, updatedP1User.CurrentRating)
-	assert.Equal(t, 1184, updatedP2User.CurrentRating)
+	assert.Equal(t, 1232, updatedP1Rating.Rating)
+	assert.Equal(t, 1168, updatedP2Rating.Rating)
+
+	// The match was bo1 so the bo3 ladder is untouched.
+	assert.Equal(t, db.DEFAULT_RATING, db.GetUserRating(conn, user1.UserId, db.Bo3).Rating)
+	assert.Equal(t, db.DEFAULT_RATING, db.GetUserRating(conn, user2.UserId, db.Bo3).Rating)
+}
+
+func TestReportSeriesScore(t *testing.T) {
+	t.Setenv("RATING_MARGIN_OF_VICTORY", "true")
+	conn := db.GetGorm(db.GetTestMysSQLConnStr())
+	mockApi := MockDiscordApi{}
+
+	rand.Seed(time.Now().UnixNano())
+	user1, user2, match := setUpTestMatchForMode(conn, db.Bo3)
+	db.SetMatchMaps(conn, match.MatchId, []string{"Arnheim", "Itza", "Black Ark"})
+
+	interaction := api.Interaction{
+		Member: api.DiscordMemberInfo{User: api.DiscordUser{Id: user1.DiscordId, Username: user1.DiscordUserName}},
+		Data: api.InteractionData{
+			Name: commands.Report,
+			Options: []api.OptionData{
+				{
+					Type:  4,
+					Name:  "score",
+					Value: int(commands.TwoOneLostSecondGame),
+				},
+				{
+					Type:  4,
+					Name:  "outcome",
+					Value: int(commands.Win),
+				},
+			},
+		}}
+
+	_, message, _ := Report(conn, mockApi, interaction)
+	assert.Contains(t, message, "(2-1)")
+
+	games := db.GetMatchGames(conn, match.MatchId)
+	assert.Len(t, games, 3)
+	assert.Equal(t, "Itza", games[1].MapName)
+	winnerGames, loserGames := db.SeriesScoreFor(games, match.P1UserId == user1.UserId)
+	assert.Equal(t, 2, winnerGames)
+	assert.Equal(t, 1, loserGames)
+
+	// A narrow win moves ratings the normal amount.
+	assert.Equal(t, 1232, db.GetUserRating(conn, user1.UserId, db.Bo3).Rating)
+	assert.Equal(t, 1168, db.GetUserRating(conn, user2.UserId, db.Bo3).Rating)
+
+	// Re-reporting as a sweep replaces the games and is worth more.
+	interaction.Data.Options[0].Value = int(commands.TwoNil)
+	Report(conn, mockApi, interaction)
+
+	assert.Len(t, db.GetMatchGames(conn, match.MatchId), 2)
+	assert.Equal(t, 1240, db.GetUserRating(conn, user1.UserId, db.Bo3).Rating)
+	assert.Equal(t, 1160, db.GetUserRating(conn, user2.UserId, db.Bo3).Rating)
+
+	// Cancelling clears the games.
+	interaction.Data.Options = interaction.Data.Options[1:]
+	interaction.Data.Options[0].Value = int(commands.Cancel)
+	Report(conn, mockApi, interaction)
+	assert.Len(t, db.GetMatchGames(conn, match.MatchId), 0)
+}
+
+func TestReportScoreOnBo1Rejected(t *testing.T) {
+	conn := db.GetGorm(db.GetTestMysSQLConnStr())
+	mockApi := MockDiscordApi{}
+
+	rand.Seed(time.Now().UnixNano())
+	user1, _, match := setUpTestMatch(conn)
+
+	success, _, _ := Report(conn, mockApi, api.Interaction{
+		Member: api.DiscordMemberInfo{User: api.DiscordUser{Id: user1.DiscordId, Username: user1.DiscordUserName}},
+		Data: api.InteractionData{
+			Name: commands.Report,
+			Options: []api.OptionData{
+				{
+					Type:  4,
+					Name:  "outcome",
+					Value: int(commands.Win),
+				},
+				{
+					Type:  4,
+					Name:  "score",
+					Value: int(commands.TwoNil),
+				},
+			},
+		}})
+
+	assert.False(t, success)
+	_, updatedMatch := db.GetMostRecentMatch(conn, user1.UserId)
+	assert.Equal(t, match.MatchId, updatedMatch.MatchId)
+	assert.Equal(t, db.Matched, updatedMatch.MatchState)
+}
+
+func TestReportAnnouncesPlacement(t *testing.T) {
+	t.Setenv("RATING_PLACEMENT_MATCHES", "1")
+	conn := db.GetGorm(db.GetTestMysSQLConnStr())
+	mockApi := MockDiscordApi{}
+
+	rand.Seed(time.Now().UnixNano())
+	user1, user2, _ := setUpTestMatch(conn)
+
+	interaction := api.Interaction{
+		Member: api.DiscordMemberInfo{User: api.DiscordUser{Id: user1.DiscordId, Username: user1.DiscordUserName}},
+		Data: api.InteractionData{
+			Name: commands.Report,
+			Options: []api.OptionData{
+				{
+					Type:  4,
+					Name:  "outcome",
+					Value: int(commands.Win),
+				},
+			},
+		}}
+
+	_, message, _ := Report(conn, mockApi, interaction)
+	assert.Contains(t, message, fmt.Sprintf("%s finished placement and enters the bo1 ladder with a rating of 1232!", user1.DiscordUserName))
+	assert.Contains(t, message, fmt.Sprintf("%s finished placement", user2.DiscordUserName))
+
+	// Re-reporting doesn't announce again.
+	interaction.Data.Options[0].Value = int(commands.Loss)
+	_, message, _ = Report(conn, mockApi, interaction)
+	assert.NotContains(t, message, "finished placement")
+}
+
+func TestReportDraw(t *testing.T) {
+	conn := db.GetGorm(db.GetTestMysSQLConnStr())
+	mockApi := MockDiscordApi{}
+
+	rand.Seed(time.Now().UnixNano())
+	user1, user2, match := setUpTestMatch(conn)
+	// Make user1 the favourite so the draw moves ratings.
+	db.UpdateUserRating(conn, user1.UserId, match.GameMode, ratings.PlayerRating{Rating: 1400, Deviation: ratings.DefaultDeviation, Volatility: ratings.DefaultVolatility}, -1)
+
+	interaction := api.Interaction{
+		Member: api.DiscordMemberInfo{User: api.DiscordUser{Id: user2.DiscordId, Username: user2.DiscordUserName}},
+		Data: api.InteractionData{
+			Name: commands.Report,
+			Options: []api.OptionData{
+				{
+					Type:  4,
+					Name:  "outcome",
+					Value: int(commands.Draw),
+				},
+			},
+		}}
+
+	success, message, _ := Report(conn, mockApi, interaction)
+
+	assert.True(t, success)
+	assert.Contains(t, message, "Draw between")
+	_, updatedMatch := db.GetMostRecentMatch(conn, user1.UserId)
+	assert.Equal(t, db.Completed, updatedMatch.MatchState)
+	assert.Equal(t, db.Draw, updatedMatch.Winner)
+	assert.Equal(t, 1383, db.GetUserRating(conn, user1.UserId, match.GameMode).Rating)
+	assert.Equal(t, 1216, db.GetUserRating(conn, user2.UserId, match.GameMode).Rating)
+
+	// Draws can't come with a series score.
+	interaction.Data.Options = append(interaction.Data.Options, api.OptionData{Type: 4, Name: "score", Value: int(commands.TwoNil)})
+	success, _, _ = Report(conn, mockApi, interaction)
+	assert.False(t, success)
 }
 
 func TestReportLoss(t *testing.T) {
@@ -106,27 +279,27 @@ func TestReportLoss(t *testing.T) {
 	user1, user2, match := setUpTestMatch(conn)
 
 	Report(conn, mockApi, api.Interaction{
-		Member: api.DiscordMemberInfo{api.DiscordUser{Id: user1.DiscordId, Username: user1.DiscordUserName}},
+		Member: api.DiscordMemberInfo{User: api.DiscordUser{Id: user1.DiscordId, Username: user1.DiscordUserName}},
 		Data: api.InteractionData{
 			Name: commands.Report,
 			Options: []api.OptionData{
 				{
 					Type:  3,
-					Name:  "Win",
+					Name:  "outcome",
 					Value: int(commands.Loss),
 				},
 			},
 		}})
 
 	_, updatedMatch := db.GetMostRecentMatch(conn, user2.UserId)
-	_, updatedP1User := db.GetUserById(conn, user1.UserId)
-	_, updatedP2User := db.GetUserById(conn, user2.UserId)
+	updatedP1Rating := db.GetUserRating(conn, user1.UserId, match.GameMode)
+	updatedP2Rating := db.GetUserRating(conn, user2.UserId, match.GameMode)
 
 	assert.Equal(t, match.MatchId, updatedMatch.MatchId)
 	assert.Equal(t, db.Completed, updatedMatch.MatchState)
 
-	assert.Equal(t, 1184, updatedP1User.CurrentRating)
-	assert.Equal(t, 1216, updatedP2User.CurrentRating)
+	assert.Equal(t, 1168, updatedP1Rating.Rating)
+	assert.Equal(t, 1232, updatedP2Rating.Rating)
 }
 
 func TestReportCancel(t *testing.T) {
@@ -137,27 +310,27 @@ func TestReportCancel(t *testing.T) {
 	user1, user2, match := setUpTestMatch(conn)
 
 	Report(conn, mockApi, api.Interaction{
-		Member: api.DiscordMemberInfo{api.DiscordUser{Id: user1.DiscordId, Username: user1.DiscordUserName}},
+		Member: api.DiscordMemberInfo{User: api.DiscordUser{Id: user1.DiscordId, Username: user1.DiscordUserName}},
 		Data: api.InteractionData{
 			Name: commands.Report,
 			Options: []api.OptionData{
 				{
 					Type:  3,
-					Name:  "Win",
+					Name:  "outcome",
 					Value: int(commands.Cancel),
 				},
 			},
 		}})
 
 	_, updatedMatch := db.GetMostRecentMatch(conn, user2.UserId)
-	_, updatedP1User := db.GetUserById(conn, user1.UserId)
-	_, updatedP2User := db.GetUserById(conn, user2.UserId)
+	updatedP1Rating := db.GetUserRating(conn, user1.UserId, match.GameMode)
+	updatedP2Rating := db.GetUserRating(conn, user2.UserId, match.GameMode)
 
 	assert.Equal(t, match.MatchId, updatedMatch.MatchId)
 	assert.Equal(t, db.Cancelled, updatedMatch.MatchState)
 
-	assert.Equal(t, 1200, updatedP1User.CurrentRating)
-	assert.Equal(t, 1200, updatedP2User.CurrentRating)
+	assert.Equal(t, 1200, updatedP1Rating.Rating)
+	assert.Equal(t, 1200, updatedP2Rating.Rating)
 }
 
 func TestReportCircularClusterOfNonsense(t *testing.T) {
@@ -168,13 +341,13 @@ func TestReportCircularClusterOfNonsense(t *testing.T) {
 	user1, user2, match := setUpTestMatch(conn)
 
 	interaction := api.Interaction{
-		Member: api.DiscordMemberInfo{api.DiscordUser{Id: user1.DiscordId, Username: user1.DiscordUserName}},
+		Member: api.DiscordMemberInfo{User: api.DiscordUser{Id: user1.DiscordId, Username: user1.DiscordUserName}},
 		Data: api.InteractionData{
 			Name: commands.Report,
 			Options: []api.OptionData{
 				{
 					Type:  3,
-					Name:  "Win",
+					Name:  "outcome",
 					Value: int(commands.Win),
 				},
 			},
@@ -184,14 +357,14 @@ func TestReportCircularClusterOfNonsense(t *testing.T) {
 	Report(conn, mockApi, interaction)
 
 	_, updatedMatch := db.GetMostRecentMatch(conn, user2.UserId)
-	_, updatedP1User := db.GetUserById(conn, user1.UserId)
-	_, updatedP2User := db.GetUserById(conn, user2.UserId)
+	updatedP1Rating := db.GetUserRating(conn, user1.UserId, match.GameMode)
+	updatedP2Rating := db.GetUserRating(conn, user2.UserId, match.GameMode)
 
 	assert.Equal(t, match.MatchId, updatedMatch.MatchId)
 	assert.Equal(t, db.Completed, updatedMatch.MatchState)
 
-	assert.Equal(t, 1216, updatedP1User.CurrentRating)
-	assert.Equal(t, 1184, updatedP2User.CurrentRating)
+	assert.Equal(t, 1232, updatedP1Rating.Rating)
+	assert.Equal(t, 1168, updatedP2Rating.Rating)
 
 	// Cancel the win
 	interaction.Data.Options[0].Value = int(commands.Cancel)
@@ -199,40 +372,40 @@ func TestReportCircularClusterOfNonsense(t *testing.T) {
 
 	// #TODO - why is p2 not getting reset to 1200 - look at history and think about our stack data structure approach.
 	_, updatedMatch = db.GetMostRecentMatch(conn, user2.UserId)
-	_, updatedP1User = db.GetUserById(conn, user1.UserId)
-	_, updatedP2User = db.GetUserById(conn, user2.UserId)
+	updatedP1Rating = db.GetUserRating(conn, user1.UserId, match.GameMode)
+	updatedP2Rating = db.GetUserRating(conn, user2.UserId, match.GameMode)
 
 	assert.Equal(t, match.MatchId, updatedMatch.MatchId)
 	assert.Equal(t, db.Cancelled, updatedMatch.MatchState)
 
-	assert.Equal(t, 1200, updatedP1User.CurrentRating)
-	assert.Equal(t, 1200, updatedP2User.CurrentRating)
+	assert.Equal(t, 1200, updatedP1Rating.Rating)
+	assert.Equal(t, 1200, updatedP2Rating.Rating)
 
 	// Report a loss instead
 	interaction.Data.Options[0].Value = int(commands.Loss)
 	Report(conn, mockApi, interaction)
 
 	_, updatedMatch = db.GetMostRecentMatch(conn, user2.UserId)
-	_, updatedP1User = db.GetUserById(conn, user1.UserId)
-	_, updatedP2User = db.GetUserById(conn, user2.UserId)
+	updatedP1Rating = db.GetUserRating(conn, user1.UserId, match.GameMode)
+	updatedP2Rating = db.GetUserRating(conn, user2.UserId, match.GameMode)
 
 	assert.Equal(t, match.MatchId, updatedMatch.MatchId)
 	assert.Equal(t, db.Completed, updatedMatch.MatchState)
 
-	assert.Equal(t, 1184, updatedP1User.CurrentRating)
-	assert.Equal(t, 1216, updatedP2User.CurrentRating)
+	assert.Equal(t, 1168, updatedP1Rating.Rating)
+	assert.Equal(t, 1232, updatedP2Rating.Rating)
 
 	// Report the same loss again
 	interaction.Data.Options[0].Value = int(commands.Loss)
 	Report(conn, mockApi, interaction)
 
 	_, updatedMatch = db.GetMostRecentMatch(conn, user2.UserId)
-	_, updatedP1User = db.GetUserById(conn, user1.UserId)
-	_, updatedP2User = db.GetUserById(conn, user2.UserId)
+	updatedP1Rating = db.GetUserRating(conn, user1.UserId, match.GameMode)
+	updatedP2Rating = db.GetUserRating(conn, user2.UserId, match.GameMode)
 
 	assert.Equal(t, match.MatchId, updatedMatch.MatchId)
 	assert.Equal(t, db.Completed, updatedMatch.MatchState)
 
-	assert.Equal(t, 1184, updatedP1User.CurrentRating)
-	assert.Equal(t, 1216, updatedP2User.CurrentRating)
+	assert.Equal(t, 1168, updatedP1Rating.Rating)
+	assert.Equal(t, 1232, updatedP2Rating.Rating)
 }
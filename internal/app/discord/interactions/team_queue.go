@@ -0,0 +1,398 @@
+package interactions
+
+import (
+	"discordbot/internal/app/discord/api"
+	"discordbot/internal/app/ratings"
+	"discordbot/internal/db"
+	"fmt"
+	"gorm.io/gorm"
+	"sort"
+	"strings"
+	"time"
+)
+
+/*
+	QueueTeam joins the 2v2 queue, either with a partner or alone to be teamed up with another solo player. Naming a
+	partner DMs them to queue naming you back, and the two of you only count as a team once they have.
+*/
+func QueueTeam(conn *gorm.DB, discordApi api.DiscordApi, interaction api.Interaction) (success bool, channelMessage string, shouldCrossPost bool) {
+	partnerDiscordId := ""
+	availableMinutes := 0
+	for _, v := range interaction.Data.Options {
+		if v.Name == "partner" {
+			partnerDiscordId = v.StringValue
+		} else if v.Name == "available_for" {
+			availableMinutes = v.Value
+		}
+	}
+
+	user := registerUser(conn, interaction)
+	partner := db.User{}
+	if partnerDiscordId != "" {
+		foundPartner, persistedPartner := db.GetUserByDiscordId(conn, partnerDiscordId)
+		if !foundPartner {
+			return false, "That player isn't on the ladder yet, they need to queue once before you can team up.", false
+		}
+		partner = persistedPartner
+	}
+	return queueTeam(conn, discordApi, user, partner, availableMinutes, time.Now())
+}
+
+func queueTeam(conn *gorm.DB, discordApi api.DiscordApi, user db.User, partner db.User, availableMinutes int, now time.Time) (success bool, channelMessage string, shouldCrossPost bool) {
+	hasPartner := partner.UserId != 0
+	if partner.UserId == user.UserId {
+		return false, "You can't team up with yourself.", false
+	}
+	if hasPartner && avoiding(conn, user.UserId, partner.UserId) {
+		return false, fmt.Sprintf("You can't team up with %s.", partner.DiscordUserName), false
+	}
+	if foundRequest, _ := db.GetMatchRequest(conn, user.UserId); foundRequest {
+		return false, "You're in the 1v1 queue - `/dequeue` before joining the 2v2 queue.", false
+	}
+	if foundEntry, _ := db.GetTeamQueueEntry(conn, user.UserId); foundEntry {
+		return false, "You're already in the 2v2 queue - `/dequeue` and queue again if you want to change partner.", false
+	}
+	if foundMatch, _ := db.GetCurrentMatch(conn, user.UserId); foundMatch {
+		return false, "You appear to have a still open match - please report results for that before queuing again.", false
+	}
+
+	policy := db.GetMatchmakingPolicy(conn, db.Team2v2)
+	if availableMinutes == 0 {
+		availableMinutes = policy.QueueWindowMinutes
+	}
+	queued := db.CreateTeamQueueEntry(conn, db.TeamQueueEntry{
+		UserId:        user.UserId,
+		PartnerUserId: partner.UserId,
+		CreatedAt:     now,
+		ExpiresAt:     now.Add(time.Duration(availableMinutes) * time.Minute),
+	})
+	if !queued {
+		return false, "Unable to join the 2v2 queue, please try again.", false
+	}
+	discordApi.AddRoleToGuildMember(LadderQueueRoleName, user.DiscordId)
+
+	teamDescription := "looking for a partner"
+	if hasPartner {
+		foundPartnerEntry, partnerEntry := db.GetTeamQueueEntry(conn, partner.UserId)
+		if foundPartnerEntry && partnerEntry.PartnerUserId == user.UserId {
+			teamDescription = fmt.Sprintf("with %s", partner.DiscordUserName)
+		} else {
+			teamDescription = fmt.Sprintf("waiting for %s to team up", partner.DiscordUserName)
+			discordApi.SendDirectMessage(
+				partner,
+				fmt.Sprintf(
+					"%s wants to play 2v2 with you. Use `/queue-2v2 partner: @%s` within %dm to team up.",
+					user.DiscordUserName,
+					user.DiscordUserName,
+					availableMinutes))
+		}
+	}
+
+	if messages := pairTeams(conn, discordApi, policy, now); len(messages) > 0 {
+		return true, strings.Join(messages, "\n\n"), true
+	}
+	return true, fmt.Sprintf("%s joined the 2v2 queue %s with 2v2 elo %s. They're available for %dm.", user.DiscordUserName, teamDescription, describeRating(db.GetUserRating(conn, user.UserId, db.Team2v2)), availableMinutes), true
+}
+
+/*
+	registerUser gets the user sending the interaction, creating them if it's their first time. We do this to avoid users
+	ever having a register step - this takes advantage of Discord's Authn and bot token validation flows.
+*/
+func registerUser(conn *gorm.DB, interaction api.Interaction) (user db.User) {
+	discordUserId := interaction.Member.User.Id
+	foundUser, user := db.GetUserByDiscordId(conn, discordUserId)
+	if !foundUser {
+		db.CreateUser(
+			conn,
+			db.User{
+				DiscordId:       discordUserId,
+				DiscordUserName: interaction.Member.User.Username,
+			})
+		_, user = db.GetUserByDiscordId(conn, discordUserId)
+	}
+	return user
+}
+
+/*
+	queuedTeam
+	Two players in the 2v2 queue who will play together, either a premade duo or two solo players teamed up by rating.
+*/
+type queuedTeam struct {
+	players []db.TeamQueueEntry
+	rating  ratings.PlayerRating
+	// request stands in for a match request from the whole team, queued when the first of them queued and leaving when
+	// the first of them leaves, so teams are paired the same way 1v1 requests are.
+	request db.MatchRequest
+}
+
+func newQueuedTeam(policy db.MatchmakingPolicy, players []db.TeamQueueEntry, playerRatings map[int]ratings.PlayerRating) (team queuedTeam) {
+	team.players = players
+	var teamRatings []ratings.PlayerRating
+	for _, v := range players {
+		teamRatings = append(teamRatings, playerRatings[v.UserId])
+	}
+	team.rating = ratings.TeamRating(teamRatings)
+
+	first := players[0]
+	team.request = db.MatchRequest{
+		MatchRequestId:    first.TeamQueueEntryId,
+		RequestingUserId:  first.UserId,
+		CreatedAt:         first.CreatedAt,
+		UpdatedAt:         first.CreatedAt,
+		RequestRange:      policy.DefaultRange,
+		RequestedGameMode: db.Team2v2,
+		MatchRequestState: db.MatchRequestStateQueued,
+		RegionPreference:  db.AnyRegion,
+		ExpiresAt:         first.ExpiresAt,
+	}
+	for _, v := range players[1:] {
+		if v.CreatedAt.Before(team.request.CreatedAt) {
+			team.request.CreatedAt = v.CreatedAt
+		}
+		if v.ExpiresAt.Before(team.request.ExpiresAt) {
+			team.request.ExpiresAt = v.ExpiresAt
+		}
+	}
+	return team
+}
+
+/*
+	avoidSet who has who on their avoid list, checked both ways.
+*/
+type avoidSet map[int]map[int]bool
+
+func (a avoidSet) add(userId int, avoidedUserId int) {
+	if a[userId] == nil {
+		a[userId] = map[int]bool{}
+	}
+	a[userId][avoidedUserId] = true
+}
+
+func (a avoidSet) between(userId int, otherUserId int) bool {
+	return a[userId][otherUserId] || a[otherUserId][userId]
+}
+
+func (a avoidSet) betweenTeams(team queuedTeam, otherTeam queuedTeam) bool {
+	for _, v := range team.players {
+		for _, other := range otherTeam.players {
+			if a.between(v.UserId, other.UserId) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+/*
+	formTeams
+	Puts everyone in the 2v2 queue into teams. Players who named each other are a team, and solo players are teamed up
+	with whoever is closest to their rating that neither of them avoids. Anyone left over waits for the next player to
+	queue. Teams come back longest waiting first.
+*/
+func formTeams(policy db.MatchmakingPolicy, entries []db.TeamQueueEntry, playerRatings map[int]ratings.PlayerRating, avoids avoidSet) (teams []queuedTeam) {
+	entriesByUser := map[int]db.TeamQueueEntry{}
+	for _, v := range entries {
+		entriesByUser[v.UserId] = v
+	}
+
+	var solos []db.TeamQueueEntry
+	for _, v := range entries {
+		if v.PartnerUserId == 0 {
+			solos = append(solos, v)
+			continue
+		}
+		partnerEntry, partnerQueued := entriesByUser[v.PartnerUserId]
+		// Each duo is seen from both partners, only add it once.
+		if partnerQueued && partnerEntry.PartnerUserId == v.UserId && v.UserId < partnerEntry.UserId {
+			teams = append(teams, newQueuedTeam(policy, []db.TeamQueueEntry{v, partnerEntry}, playerRatings))
+		}
+	}
+
+	sort.SliceStable(solos, func(i, j int) bool {
+		return playerRatings[solos[i].UserId].Rating < playerRatings[solos[j].UserId].Rating
+	})
+	teamed := map[int]bool{}
+	for i, v := range solos {
+		if teamed[i] {
+			continue
+		}
+		// Solos are sorted by rating, so the first one left that can play with them is the closest above.
+		for j := i + 1; j < len(solos); j++ {
+			if !teamed[j] && !avoids.between(v.UserId, solos[j].UserId) {
+				teamed[i], teamed[j] = true, true
+				teams = append(teams, newQueuedTeam(policy, []db.TeamQueueEntry{v, solos[j]}, playerRatings))
+				break
+			}
+		}
+	}
+
+	sort.SliceStable(teams, func(i, j int) bool {
+		return teams[i].request.CreatedAt.Before(teams[j].request.CreatedAt)
+	})
+	return teams
+}
+
+/*
+	findTeamPairing
+	The longest waiting team that can be paired gets the opponents FindBestPairing picks for them under the 2v2 policy,
+	from the teams within both teams' range of their average rating that no one on either side avoids.
+*/
+func findTeamPairing(policy db.MatchmakingPolicy, teams []queuedTeam, avoids avoidSet, now time.Time) (found bool, team1 queuedTeam, team2 queuedTeam) {
+	for i, team := range teams {
+		var candidates []db.CandidatePairing
+		for j, other := range teams {
+			if i == j || avoids.betweenTeams(team, other) {
+				continue
+			}
+			gap := abs(team.rating.Rating - other.rating.Rating)
+			if gap > db.EffectiveRange(team.request, now) || gap > db.EffectiveRange(other.request, now) {
+				continue
+			}
+			candidates = append(candidates, db.CandidatePairing{
+				OpponentMatchRequest: other.request,
+				OpponentRating:       other.rating.Rating,
+				RequesterRating:      team.rating.Rating,
+				OpponentGamesPlayed:  other.rating.GamesPlayed,
+				RequesterGamesPlayed: team.rating.GamesPlayed,
+			})
+		}
+		if len(candidates) == 0 {
+			continue
+		}
+		best := FindBestPairing(policy, team.request, candidates, now)
+		for _, other := range teams {
+			if other.request.MatchRequestId == best.MatchRequestId {
+				return true, team, other
+			}
+		}
+	}
+	return false, queuedTeam{}, queuedTeam{}
+}
+
+func abs(i int) int {
+	if i < 0 {
+		return -i
+	}
+	return i
+}
+
+/*
+	RunTeamMatchmaker pairs every team in the 2v2 queue that can be paired, so teams whose range has grown while they
+	waited get a match without waiting for someone else to queue. Returns how many matches were started.
+*/
+func RunTeamMatchmaker(conn *gorm.DB, discordApi api.DiscordApi, now time.Time) (matchesStarted int) {
+	for _, message := range pairTeams(conn, discordApi, db.GetMatchmakingPolicy(conn, db.Team2v2), now) {
+		discordApi.PostToChannel(LadderFeedChannel, message)
+		matchesStarted++
+	}
+	return matchesStarted
+}
+
+/*
+	pairTeams starts 2v2 matches for as long as the queue has two teams that can play each other, longest waiting team
+	first. Returns what each match's players were told.
+*/
+func pairTeams(conn *gorm.DB, discordApi api.DiscordApi, policy db.MatchmakingPolicy, now time.Time) (messages []string) {
+	for {
+		entries := db.GetQueuedTeamEntries(conn, now)
+		playerRatings := map[int]ratings.PlayerRating{}
+		avoids := avoidSet{}
+		for _, v := range entries {
+			playerRatings[v.UserId] = db.GetUserRating(conn, v.UserId, db.Team2v2)
+			for _, avoid := range db.GetUserAvoids(conn, v.UserId) {
+				avoids.add(v.UserId, avoid.AvoidedUserId)
+			}
+		}
+
+		found, team1, team2 := findTeamPairing(policy, formTeams(policy, entries, playerRatings, avoids), avoids, now)
+		if !found {
+			return messages
+		}
+		started, message := startTeamMatch(conn, discordApi, team1, team2, policy.PolicyId)
+		if !started {
+			// Someone left the queue while we were pairing them, try again next pass rather than on the same teams.
+			return messages
+		}
+		messages = append(messages, message)
+	}
+}
+
+/*
+	startTeamMatch takes both teams out of the queue into a 2v2 match, assigns its maps and DMs all four players. There's
+	no ready check, everyone in the 2v2 queue is expected to be around for as long as they said.
+*/
+func startTeamMatch(conn *gorm.DB, discordApi api.DiscordApi, team1 queuedTeam, team2 queuedTeam, matchmakingPolicyId int) (success bool, message string) {
+	now := time.Now()
+	match := db.Match{
+		CreatedAt:           now,
+		UpdatedAt:           now,
+		MatchState:          db.Matched,
+		GameMode:            db.Team2v2,
+		P1UserId:            team1.players[0].UserId,
+		P1PartnerUserId:     team1.players[1].UserId,
+		P2UserId:            team2.players[0].UserId,
+		P2PartnerUserId:     team2.players[1].UserId,
+		Winner:              db.Undefined,
+		Maps:                mapsAtPairing(conn, db.Team2v2),
+		MatchmakingPolicyId: matchmakingPolicyId,
+	}
+	if !db.CreateTeamMatchFromEntries(conn, match) {
+		return false, ""
+	}
+	_, match = db.GetCurrentMatch(conn, match.P1UserId)
+
+	var players []db.User
+	for _, v := range match.PlayerIds() {
+		_, player := db.GetUserById(conn, v)
+		players = append(players, player)
+	}
+	bansPerPlayer, _ := mapVetoPool(conn, db.Team2v2)
+	message = describeTeamMatch(match, players, bansPerPlayer > 0)
+	for _, v := range players {
+		discordApi.SendDirectMessage(v, message)
+	}
+	startMatchSetup(conn, discordApi, match, now)
+	return true, message
+}
+
+/*
+	describeTeamMatch what all four players are told when a 2v2 match starts, players being P1's side first. With a map
+	veto P1 and P2 ban maps for their teams.
+*/
+func describeTeamMatch(match db.Match, players []db.User, mapVeto bool) string {
+	var regions []string
+	for _, v := range players {
+		regions = append(regions, describeRegion(v))
+	}
+	mapsDescription := "Agree on a 2v2 map between you."
+	if mapVeto {
+		mapsDescription = fmt.Sprintf("<@!%s> and <@!%s> will be DMed to veto maps for their teams.", players[0].DiscordId, players[2].DiscordId)
+	}
+	if len(match.Maps) > 0 {
+		mapsDescription = fmt.Sprintf("Your randomly assigned map is:\n %s.", "["+strings.Join(match.Maps, ", ")+"]")
+	}
+	return fmt.Sprintf(
+		"<@!%s> and <@!%s> (P1) were paired against <@!%s> and <@!%s> (P2) in the 2v2 queue.\n%s.\nPlease play a 2v2 match and report the results when done, any of you can report.\n\n%s",
+		players[0].DiscordId,
+		players[1].DiscordId,
+		players[2].DiscordId,
+		players[3].DiscordId,
+		strings.Join(regions, ", "),
+		mapsDescription)
+}
+
+/*
+	ExpireTeamQueueEntries takes everyone whose time in the 2v2 queue ran out out of it. Returns how many left.
+*/
+func ExpireTeamQueueEntries(conn *gorm.DB, discordApi api.DiscordApi, now time.Time) (expired int) {
+	for _, v := range db.FindExpiredTeamQueueEntries(conn, now) {
+		if !db.DeleteTeamQueueEntry(conn, v.UserId) {
+			continue
+		}
+		_, user := db.GetUserById(conn, v.UserId)
+		discordApi.RemoveRoleFromGuildMember(LadderQueueRoleName, user.DiscordId)
+		discordApi.SendDirectMessage(user, "Your time in the 2v2 queue ran out. Please requeue if you'd like to keep playing!")
+		expired++
+	}
+	return expired
+}
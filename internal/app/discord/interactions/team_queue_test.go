@@ -0,0 +1,187 @@
+package interactions
+
+import (
+	"discordbot/internal/app/discord/api"
+	"discordbot/internal/app/discord/commands"
+	"discordbot/internal/app/ratings"
+	"discordbot/internal/db"
+	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func teamEntry(userId int, partnerUserId int, createdAt time.Time) db.TeamQueueEntry {
+	return db.TeamQueueEntry{
+		TeamQueueEntryId: userId,
+		UserId:           userId,
+		PartnerUserId:    partnerUserId,
+		CreatedAt:        createdAt,
+		ExpiresAt:        createdAt.Add(time.Hour),
+	}
+}
+
+func TestFormTeams(t *testing.T) {
+	policy := db.DefaultMatchmakingPolicy(db.Team2v2)
+	now := time.Now()
+	entries := []db.TeamQueueEntry{
+		teamEntry(1, 2, now.Add(-10*time.Minute)),
+		teamEntry(3, 0, now.Add(-9*time.Minute)),
+		teamEntry(4, 0, now.Add(-8*time.Minute)),
+		teamEntry(2, 1, now.Add(-7*time.Minute)),
+		teamEntry(5, 0, now.Add(-6*time.Minute)),
+		// 6 named someone who hasn't queued, so waits rather than being teamed up with a solo player.
+		teamEntry(6, 7, now.Add(-5*time.Minute)),
+	}
+	playerRatings := map[int]ratings.PlayerRating{
+		1: {Rating: 1200}, 2: {Rating: 1200}, 3: {Rating: 1000}, 4: {Rating: 1400}, 5: {Rating: 1050}, 6: {Rating: 1200},
+	}
+	avoids := avoidSet{}
+	avoids.add(5, 3)
+
+	teams := formTeams(policy, entries, playerRatings, avoids)
+
+	// 3 is closest to 5, who avoids them, so goes with 4 instead and 5 waits for someone else.
+	assert.Len(t, teams, 2)
+	assert.Equal(t, 1, teams[0].players[0].UserId)
+	assert.Equal(t, 2, teams[0].players[1].UserId)
+	assert.Equal(t, 1200, teams[0].rating.Rating)
+	assert.Equal(t, 3, teams[1].players[0].UserId)
+	assert.Equal(t, 4, teams[1].players[1].UserId)
+	assert.Equal(t, 1200, teams[1].rating.Rating)
+	// A team is as old as whoever in it queued first, and leaves with whoever leaves first.
+	assert.Equal(t, entries[0].CreatedAt, teams[0].request.CreatedAt)
+	assert.Equal(t, entries[0].ExpiresAt, teams[0].request.ExpiresAt)
+}
+
+func TestFindTeamPairing(t *testing.T) {
+	t.Setenv("QUEUE_RANGE_EXPANSION_POINTS", "0")
+	policy := db.DefaultMatchmakingPolicy(db.Team2v2)
+	now := time.Now()
+	playerRatings := map[int]ratings.PlayerRating{
+		1: {Rating: 1000}, 2: {Rating: 1000},
+		3: {Rating: 1700}, 4: {Rating: 1700},
+		5: {Rating: 1100}, 6: {Rating: 1100},
+		7: {Rating: 1650}, 8: {Rating: 1650},
+	}
+	teams := []queuedTeam{
+		newQueuedTeam(policy, []db.TeamQueueEntry{teamEntry(1, 2, now.Add(-20*time.Minute)), teamEntry(2, 1, now.Add(-20*time.Minute))}, playerRatings),
+		newQueuedTeam(policy, []db.TeamQueueEntry{teamEntry(3, 4, now.Add(-15*time.Minute)), teamEntry(4, 3, now.Add(-15*time.Minute))}, playerRatings),
+		newQueuedTeam(policy, []db.TeamQueueEntry{teamEntry(5, 6, now.Add(-10*time.Minute)), teamEntry(6, 5, now.Add(-10*time.Minute))}, playerRatings),
+		newQueuedTeam(policy, []db.TeamQueueEntry{teamEntry(7, 8, now.Add(-5*time.Minute)), teamEntry(8, 7, now.Add(-5*time.Minute))}, playerRatings),
+	}
+
+	// The longest waiting team gets the only team in range of them.
+	found, team1, team2 := findTeamPairing(policy, teams, avoidSet{}, now)
+	assert.True(t, found)
+	assert.Equal(t, 1, team1.players[0].UserId)
+	assert.Equal(t, 5, team2.players[0].UserId)
+
+	// If anyone on either side avoids someone on the other, the next team in line goes first.
+	avoids := avoidSet{}
+	avoids.add(6, 1)
+	found, team1, team2 = findTeamPairing(policy, teams, avoids, now)
+	assert.True(t, found)
+	assert.Equal(t, 3, team1.players[0].UserId)
+	assert.Equal(t, 7, team2.players[0].UserId)
+
+	found, _, _ = findTeamPairing(policy, teams[:2], avoidSet{}, now)
+	assert.False(t, found)
+}
+
+func TestQueueTeam(t *testing.T) {
+	conn := db.GetGorm(db.GetTestMysSQLConnStr())
+	mockApi := MockDiscordApi{}
+	rand.Seed(time.Now().UnixNano())
+	for _, v := range db.GetQueuedTeamEntries(conn, time.Time{}) {
+		db.DeleteTeamQueueEntry(conn, v.UserId)
+	}
+	user1, user2, user3, user4 := createTestUser(conn), createTestUser(conn), createTestUser(conn), createTestUser(conn)
+	now := time.Now()
+
+	success, _, _ := queueTeam(conn, mockApi, user1, user1, 0, now)
+	assert.False(t, success, "can't team up with yourself")
+
+	// A duo only counts once both have named each other.
+	success, _, _ = queueTeam(conn, mockApi, user1, user2, 0, now)
+	assert.True(t, success)
+	success, _, _ = queueTeam(conn, mockApi, user1, user2, 0, now)
+	assert.False(t, success, "already queued")
+	success, _, _ = queueTeam(conn, mockApi, user2, user1, 0, now)
+	assert.True(t, success)
+	success, _, _ = queueTeam(conn, mockApi, user3, db.User{}, 0, now)
+	assert.True(t, success)
+	foundMatch, _ := db.GetCurrentMatch(conn, user1.UserId)
+	assert.False(t, foundMatch)
+
+	// The fourth player makes two teams.
+	success, _, _ = queueTeam(conn, mockApi, user4, db.User{}, 0, now)
+	assert.True(t, success)
+	foundMatch, match := db.GetCurrentMatch(conn, user4.UserId)
+	assert.True(t, foundMatch)
+	assert.True(t, match.IsTeamMatch())
+	assert.Equal(t, db.Team2v2, match.GameMode)
+	assert.Equal(t, []int{user1.UserId, user2.UserId, user3.UserId, user4.UserId}, match.PlayerIds())
+	assert.Equal(t, db.GetMatchmakingPolicy(conn, db.Team2v2).PolicyId, match.MatchmakingPolicyId)
+	for _, v := range []db.User{user1, user2, user3, user4} {
+		foundEntry, _ := db.GetTeamQueueEntry(conn, v.UserId)
+		assert.False(t, foundEntry)
+	}
+
+	// Any of the four can report, and partners move together on the 2v2 ladder only.
+	Report(conn, mockApi, api.Interaction{
+		Member: api.DiscordMemberInfo{User: api.DiscordUser{Id: user4.DiscordId, Username: user4.DiscordUserName}},
+		Data: api.InteractionData{
+			Name:    commands.Report,
+			Options: []api.OptionData{{Type: 3, Name: "outcome", Value: int(commands.Win)}},
+		}})
+	_, match = db.GetMostRecentMatch(conn, user1.UserId)
+	assert.Equal(t, db.Completed, match.MatchState)
+	assert.Equal(t, db.P2, match.Winner)
+	assert.Equal(t, 1168, db.GetUserRating(conn, user1.UserId, db.Team2v2).Rating)
+	assert.Equal(t, 1168, db.GetUserRating(conn, user2.UserId, db.Team2v2).Rating)
+	assert.Equal(t, 1232, db.GetUserRating(conn, user3.UserId, db.Team2v2).Rating)
+	assert.Equal(t, 1232, db.GetUserRating(conn, user4.UserId, db.Team2v2).Rating)
+	assert.Equal(t, 1, db.GetUserRating(conn, user2.UserId, db.Team2v2).GamesPlayed)
+	assert.Equal(t, db.DEFAULT_RATING, db.GetUserRating(conn, user1.UserId, db.Bo1).Rating)
+
+	// Cancelling reverts everyone.
+	Report(conn, mockApi, api.Interaction{
+		Member: api.DiscordMemberInfo{User: api.DiscordUser{Id: user1.DiscordId, Username: user1.DiscordUserName}},
+		Data: api.InteractionData{
+			Name:    commands.Report,
+			Options: []api.OptionData{{Type: 3, Name: "outcome", Value: int(commands.Cancel)}},
+		}})
+	for _, v := range []db.User{user1, user2, user3, user4} {
+		assert.Equal(t, db.DEFAULT_RATING, db.GetUserRating(conn, v.UserId, db.Team2v2).Rating)
+	}
+}
+
+func TestRunTeamMatchmaker(t *testing.T) {
+	conn := db.GetGorm(db.GetTestMysSQLConnStr())
+	now := time.Now()
+	var users []db.User
+	for i := 0; i < 8; i++ {
+		users = append(users, createTestUser(conn))
+	}
+	// Four duos that were queued without being paired, as if they'd only come into range of each other since.
+	for i := 0; i < len(users); i += 2 {
+		for _, v := range [][2]db.User{{users[i], users[i+1]}, {users[i+1], users[i]}} {
+			assert.True(t, db.CreateTeamQueueEntry(conn, db.TeamQueueEntry{
+				UserId:        v[0].UserId,
+				PartnerUserId: v[1].UserId,
+				CreatedAt:     now.Add(-10 * time.Minute),
+				ExpiresAt:     now.Add(time.Hour),
+			}))
+		}
+	}
+
+	assert.GreaterOrEqual(t, RunTeamMatchmaker(conn, MockDiscordApi{}, now), 2)
+	for _, v := range users {
+		foundMatch, match := db.GetCurrentMatch(conn, v.UserId)
+		assert.True(t, foundMatch)
+		assert.True(t, match.IsTeamMatch())
+		foundEntry, _ := db.GetTeamQueueEntry(conn, v.UserId)
+		assert.False(t, foundEntry)
+	}
+}
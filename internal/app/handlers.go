@@ -2,9 +2,13 @@ package app
 
 import (
 	"discordbot/internal/app/config"
+	"discordbot/internal/app/decay"
 	"discordbot/internal/app/discord/api"
 	"discordbot/internal/app/discord/commands"
 	"discordbot/internal/app/discord/interactions"
+	"discordbot/internal/app/ratings"
+	"discordbot/internal/app/replay"
+	"discordbot/internal/app/seasons"
 	"discordbot/internal/db"
 	"encoding/json"
 	"fmt"
@@ -12,6 +16,9 @@ import (
 	"gorm.io/gorm"
 	"io"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 )
 
 func AuthorizeAdminAction(c *gin.Context) (authorized bool) {
@@ -50,6 +57,261 @@ func migrationHandler(c *gin.Context) {
 	c.JSON(http.StatusOK, "Successfully migrated to latest version!")
 }
 
+/*
+	Replays every completed match to rebuild ratings. Dry run by default, pass apply=true to persist the result.
+	Optional rating_system, k, provisional_k and provisional_matches query params pick the rating configuration.
+*/
+func replayRatingsHandler(c *gin.Context) {
+	authorized := AuthorizeAdminAction(c)
+	if !authorized {
+		return
+	}
+
+	options := replay.Options{RatingSystem: c.Query("rating_system")}
+	var err error
+	if k, found := c.GetQuery("k"); found {
+		options.K, err = strconv.ParseFloat(k, 64)
+	}
+	if provisionalK, found := c.GetQuery("provisional_k"); found && err == nil {
+		options.ProvisionalK, err = strconv.ParseFloat(provisionalK, 64)
+	}
+	if provisionalMatches, found := c.GetQuery("provisional_matches"); found && err == nil {
+		options.ProvisionalMatches, err = strconv.Atoi(provisionalMatches)
+	}
+	if apply, found := c.GetQuery("apply"); found && err == nil {
+		options.Apply, err = strconv.ParseBool(apply)
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, fmt.Sprintf("Invalid replay options: %v", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, replay.ReplayRatings(db.GetDbConn(), options))
+}
+
+func decayRatingsHandler(c *gin.Context) {
+	authorized := AuthorizeAdminAction(c)
+	if !authorized {
+		return
+	}
+
+	c.JSON(http.StatusOK, decay.ApplyInactivityDecay(db.GetDbConn(), time.Now()))
+}
+
+/*
+	Reverts a player's latest inactivity decay on one ladder, takes user_id and mode query params.
+*/
+func revertDecayHandler(c *gin.Context) {
+	authorized := AuthorizeAdminAction(c)
+	if !authorized {
+		return
+	}
+
+	userId, err := strconv.Atoi(c.Query("user_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, "Must supply an integer user_id.")
+		return
+	}
+	mode := db.GameMode(c.Query("mode"))
+	if !db.IsRatedGameMode(mode) {
+		c.JSON(http.StatusBadRequest, "Must supply a rated mode.")
+		return
+	}
+
+	if !db.RevertLatestDecay(db.GetDbConn(), userId, mode) {
+		c.JSON(http.StatusBadRequest, "The latest rating change for that user and mode was not a decay.")
+		return
+	}
+	c.JSON(http.StatusOK, "Decay reverted.")
+}
+
+/*
+	Opens a new season named by the name query param. reset_factor optionally sets how far ratings are pulled back
+	toward the default, from 0 for not at all to 1 for a full reset.
+*/
+func openSeasonHandler(c *gin.Context) {
+	authorized := AuthorizeAdminAction(c)
+	if !authorized {
+		return
+	}
+
+	name, foundName := c.GetQuery("name")
+	if !foundName || name == "" {
+		c.JSON(http.StatusBadRequest, "Must supply a season name.")
+		return
+	}
+	resetFactor := seasons.DefaultSoftResetFactor
+	if factor, found := c.GetQuery("reset_factor"); found {
+		var err error
+		resetFactor, err = strconv.ParseFloat(factor, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, "Must supply a numeric reset_factor.")
+			return
+		}
+	}
+
+	success, message := seasons.OpenSeason(db.GetDbConn(), name, resetFactor, time.Now())
+	if !success {
+		c.JSON(http.StatusBadRequest, message)
+		return
+	}
+	c.JSON(http.StatusOK, message)
+}
+
+func closeSeasonHandler(c *gin.Context) {
+	authorized := AuthorizeAdminAction(c)
+	if !authorized {
+		return
+	}
+
+	success, message := seasons.CloseSeason(db.GetDbConn(), time.Now())
+	if !success {
+		c.JSON(http.StatusBadRequest, message)
+		return
+	}
+	c.JSON(http.StatusOK, message)
+}
+
+/*
+	avoidsHandler lets admins review avoid lists, for everyone or just the player given by user_id.
+*/
+func avoidsHandler(c *gin.Context) {
+	authorized := AuthorizeAdminAction(c)
+	if !authorized {
+		return
+	}
+
+	conn := db.GetDbConn()
+	userIdParam, foundUserId := c.GetQuery("user_id")
+	if !foundUserId {
+		c.JSON(http.StatusOK, db.GetAllUserAvoids(conn))
+		return
+	}
+	userId, err := strconv.Atoi(userIdParam)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, "Must supply an integer user_id.")
+		return
+	}
+	c.JSON(http.StatusOK, db.GetUserAvoids(conn, userId))
+}
+
+/*
+	The matchmaking policy in use for every mode, or every version of the one for the mode query param.
+*/
+func matchmakingPoliciesHandler(c *gin.Context) {
+	authorized := AuthorizeAdminAction(c)
+	if !authorized {
+		return
+	}
+
+	conn := db.GetDbConn()
+	if mode, foundMode := c.GetQuery("mode"); foundMode {
+		c.JSON(http.StatusOK, db.GetMatchmakingPolicyHistory(conn, db.GameMode(mode)))
+		return
+	}
+	var policies []db.MatchmakingPolicy
+	for _, v := range []db.GameMode{db.Bo1, db.Bo3, db.All, db.Team2v2} {
+		policies = append(policies, db.GetMatchmakingPolicy(conn, v))
+	}
+	c.JSON(http.StatusOK, policies)
+}
+
+/*
+	Saves a new version of the matchmaking policy for the mode query param, which is used for every request from then
+	on. rating_weight, wait_weight, rating_delta_floor, default_range and queue_window_minutes query params change those
+	settings, anything left out is kept from the version in use.
+*/
+func saveMatchmakingPolicyHandler(c *gin.Context) {
+	authorized := AuthorizeAdminAction(c)
+	if !authorized {
+		return
+	}
+
+	conn := db.GetDbConn()
+	policy := db.GetMatchmakingPolicy(conn, db.GameMode(c.Query("mode")))
+	var err error
+	if ratingWeight, found := c.GetQuery("rating_weight"); found {
+		policy.RatingWeight, err = strconv.ParseFloat(ratingWeight, 64)
+	}
+	if waitWeight, found := c.GetQuery("wait_weight"); found && err == nil {
+		policy.WaitWeight, err = strconv.ParseFloat(waitWeight, 64)
+	}
+	if ratingDeltaFloor, found := c.GetQuery("rating_delta_floor"); found && err == nil {
+		policy.RatingDeltaFloor, err = strconv.Atoi(ratingDeltaFloor)
+	}
+	if defaultRange, found := c.GetQuery("default_range"); found && err == nil {
+		policy.DefaultRange, err = strconv.Atoi(defaultRange)
+	}
+	if queueWindowMinutes, found := c.GetQuery("queue_window_minutes"); found && err == nil {
+		policy.QueueWindowMinutes, err = strconv.Atoi(queueWindowMinutes)
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, fmt.Sprintf("Invalid matchmaking policy: %v", err))
+		return
+	}
+	if valid, message := policy.Validate(); !valid {
+		c.JSON(http.StatusBadRequest, message)
+		return
+	}
+
+	policy.CreatedAt = time.Now()
+	success, persisted := db.CreateMatchmakingPolicy(conn, policy)
+	if !success {
+		c.JSON(http.StatusInternalServerError, "Unable to save the matchmaking policy.")
+		return
+	}
+	c.JSON(http.StatusOK, persisted)
+}
+
+/*
+	Standings for one ladder in a season, takes season_id and mode query params. Closed seasons return their archived
+	final standings and the open season returns live ones.
+*/
+func seasonStandingsHandler(c *gin.Context) {
+	authorized := AuthorizeAdminAction(c)
+	if !authorized {
+		return
+	}
+
+	seasonId, err := strconv.Atoi(c.Query("season_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, "Must supply an integer season_id.")
+		return
+	}
+	mode := db.GameMode(c.Query("mode"))
+	if !db.IsRatedGameMode(mode) {
+		c.JSON(http.StatusBadRequest, "Must supply a rated mode.")
+		return
+	}
+
+	conn := db.GetDbConn()
+	foundSeason, season := db.GetSeason(conn, seasonId)
+	if !foundSeason {
+		c.JSON(http.StatusNotFound, "No such season.")
+		return
+	}
+	if !season.IsOpen() {
+		c.JSON(http.StatusOK, db.GetSeasonStandings(conn, season.SeasonId, mode))
+		return
+	}
+
+	var standings []db.SeasonStanding
+	for i, v := range db.GetEloLeaderboard(conn, mode, season) {
+		standings = append(standings, db.SeasonStanding{
+			SeasonId:        season.SeasonId,
+			UserId:          v.User.UserId,
+			DiscordUserName: v.User.DiscordUserName,
+			GameMode:        mode,
+			FinalRank:       i + 1,
+			Rating:          v.Rating,
+			Wins:            v.Wins,
+			Losses:          v.Losses,
+			Draws:           v.Draws,
+		})
+	}
+	c.JSON(http.StatusOK, standings)
+}
+
 func setMapsHandler(c *gin.Context) {
 	authorized := AuthorizeAdminAction(c)
 	if !authorized {
@@ -68,6 +330,16 @@ func setMapsHandler(c *gin.Context) {
 		panic(err)
 	}
 
+	// 2v2 has its own pool, set with ?mode=2v2, which doesn't change the rules copy.
+	if c.Query("mode") == string(db.Team2v2) {
+		if !db.InsertMapSet(db.GetDbConn(), maps, db.Team2v2) {
+			c.JSON(http.StatusInternalServerError, nil)
+			return
+		}
+		c.JSON(http.StatusOK, "2v2 maps updated.")
+		return
+	}
+
 	// We're not bifurcating yet.
 	firstPersisted := db.InsertMapSet(db.GetDbConn(), maps, db.Bo3)
 
@@ -83,6 +355,16 @@ func setMapsHandler(c *gin.Context) {
 		return
 	}
 
+	mapVetoConfig := config.GetMapVetoConfig()
+	bo1MapsRule := "A random map will be assigned and you may begin the game.\n"
+	if bans := mapVetoConfig.Bans(string(db.Bo1)); bans > 0 {
+		bo1MapsRule = fmt.Sprintf("Before the draft you take turns banning %d map(s) each from the pool, starting with P1, and play on what's left. The bot DMs you the maps whenever it's your turn - if you don't ban within %d minutes the map is assigned at random.\n", bans, mapVetoConfig.TurnMinutes)
+	}
+	bo3MapsRule := "Your 3 maps are assigned at random when you're paired."
+	if bans := mapVetoConfig.Bans(string(db.Bo3)); bans > 0 {
+		bo3MapsRule = fmt.Sprintf("Your 3 maps are decided by veto before the first draft, with %d ban(s) each, and played in the order they're listed in the pool.", bans)
+	}
+
 	rulesAndMapsCopy := []string{
 		"**Welcome to the Warhammer Community Ladder!**",
 		"The goal of the WCL is to create a welcoming environment for both new players and hardened veterans to sharpen their skills. At the end of the day, this is about growing the WH3 multiplayer community and getting more people involved in the competitive scene. If you’re thinking about making the leap from quick battles/campaign into the competitive scene, this is a great place to start!\n",
@@ -94,12 +376,22 @@ func setMapsHandler(c *gin.Context) {
 
 		"**How to play:**",
 		"1. Type the command ‘/queue’ in the #find-matches channel. You will have the option of choosing from gametypes Bo1, Bo3, or All. This will queue you up and attempt to match you against a player of a similar ELO rating. Wait in the queue until paired with an opponent (matchmaking duration may vary).",
-		"a. If you’d like to restrict your opponents to a specific ELO range you can do so with the command ‘/queue elo’. For example, if your current ELO rating is 1000 and you enter the command ‘/queue 400`, you will be matched with players with ratings between 600-1400.",
+		"a. If you’d like to restrict your opponents to a specific ELO range you can do so with the command ‘/queue elo’. For example, if your current ELO rating is 1000 and you enter the command ‘/queue 400`, you will be matched with players with ratings between 600-1400. Your range may widen the longer you wait, add `expand_range: false` to keep it fixed.",
 		"b. If you want to dequeue from matchmaking, type the command ‘/dequeue`.",
+		"c. Set your home region once with `/region`. You can then add `region: same region only` or `region: neighbouring regions` to `/queue` to avoid laggy cross-region matches.",
+		fmt.Sprintf("d. You stay in the queue for %d minutes unless you say otherwise with `available_for`, from 15 minutes up to 3 hours.", db.GetMatchmakingPolicy(db.GetDbConn(), db.Bo1).QueueWindowMinutes),
+		"e. Use `/queue-status` to see how many players are queued, roughly how they're rated and how many are in your range before you join.",
+		"f. Rather than waiting in the queue, use `/notify on` to be DMed when someone in your range queues, optionally only at certain hours. `/notify off` stops it.",
+		"g. For 2v2, use `/queue-2v2` with `partner` set to your teammate, who then does the same naming you. Queue without a partner to be teamed up with another solo player close to your 2v2 rating. `/dequeue` leaves either queue.",
 		"2. Once you match with an opponent, contact them via Discord, and play your match using the format provided.",
-		"a. If after matching with an opponent, you want to cancel the match without playing, use the command `/report cancel`. This is not intended for avoiding specific players.",
-		"b. If you cancel the match after Picks & Bans have started, your opponent may choose to report the match as a win.",
-		"3. When the match is completed, report the results with the commands `/report win` or `/report loss`. Only one player needs to report the results. After reporting, your ratings and records will be automatically updated and you can immediately queue again for further matches.",
+		"a. When you're paired the bot DMs you Accept and Decline buttons. If either player declines, or doesn't accept within a few minutes, the match is cancelled and whoever was ready goes back into the queue where they were. Missing the ready check earns you a strike.",
+		"b. If after matching with an opponent, you want to cancel the match without playing, use the command `/report cancel`. This is not intended for avoiding specific players.",
+		"c. If you cancel the match after Picks & Bans have started, your opponent may choose to report the match as a win.",
+		"d. Use `/odds` to see your chance of winning and the rating at stake in your current match, or name a player to check the odds against them.",
+		"e. To play a friend or rival directly, use `/challenge` and they'll get a DM to accept or decline. Challenge matches are rated like any other, but you can only play the same opponent a couple of times a day this way.",
+		"f. If you need to never be matched with a specific player, for example after a conduct issue, use `/avoid add`. Only you can see your list, which you can check with `/avoid list`, and you can avoid a few players at most.",
+		"3. When the match is completed, report the results with the commands `/report win` or `/report loss`. Only one player needs to report the results, in 2v2 any of the four can. After reporting, your ratings and records will be automatically updated and you can immediately queue again for further matches.",
+		"a. If a game ends with no clear winner and both players agree, report it with `/report draw`. A draw moves ratings towards whoever was the underdog, by however far their expected score was from an even 50%.",
 		"4. If you or your opponent enters the wrong match results simply input the ‘/report win' or `/report loss` command again and it will overwrite the previous match results and ratings.\n",
 
 		"**Leaderboard:**",
@@ -107,28 +399,32 @@ func setMapsHandler(c *gin.Context) {
 		"Player ELO ratings are also being tracked for optimized matchmaking. These can be found in the #elo-ratings channel.\n",
 
 		"**Bo1 Format:**",
-		"Use the following process to select a fair matchup:",
-		"Using this tool (https://aoe2cm.net/preset/lfVGf), in the first stage when prompted you should blind pick 3 factions you like to play.",
-		"With 3 factions selected by each player, one player should type up a list of the 9 potential matchups.",
-		"For example. If P1 selected WE, BR, and DE and P2 selected NRS, BRT, and TK, the list of 9 potential matchups will look like this: ",
+		"Once your match is on the bot runs the draft for a fair matchup in your DMs:",
+		"First, press the buttons for 3 factions you like to play. It's a blind pick - neither player sees the other's factions until you've both picked.",
+		"With 3 factions selected by each player, there are 9 potential matchups.",
+		"For example. If P1 selected WE, BR, and DE and P2 selected NRS, BRT, and TK, the 9 potential matchups look like this: ",
 		"----- WE  Bret  DE",
 		"NRS    o    o    o",
 		"Bret   o    o    o",
 		"TK     o    o    o",
-		"Take turns banning 8 potential matchups until only one remains.  That remaining matchup is what you will play.  Ban matchups in this sequence starting with P1: 1-2-2-2-1.",
-		"A random map will be assigned and you may begin the game.\n",
+		"Take turns banning 8 potential matchups until only one remains.  That remaining matchup is what you will play.  Ban matchups in this sequence starting with P1: 1-2-2-2-1. The bot DMs you the matchups left whenever it's your turn.",
+		bo1MapsRule,
 
 		"**Bo3 Format:**",
-		"Repeat the bo1 format 3 times",
-		"Each player may not play the same faction twice in the match",
+		"Repeat the bo1 format 3 times. After each game press whether you won in the bot's DM to draft the next game.",
+		"Each player may not play the same faction twice in the match - the bot won't let you pick a faction you've already played.",
 		"Winner of game 2 bans first in g3",
+		bo3MapsRule,
 
 		"**Ratings:**",
 		"We use a standard Elo rating system to provide better matchmaking. You can see current ratings in #elo-ratings.",
-		"Starting Elo is 1200. K for bo3 games is 32 which means the most your rating can change up or down is 32 points.",
+		"bo1, bo3 and 2v2 are separate ladders - you have one rating for each and a result only moves the rating for the mode you played. If you queue for all you are matched on the rating of the mode you end up playing.",
+		"In 2v2 each team plays at its average rating, and both partners gain or lose what that result is worth from their own rating. 2v2 ratings are in #2v2-ratings and 2v2 wins don't count towards the monthly leaderboard.",
+		"Starting Elo is 1200. K is 32 which means the most your rating can change up or down is 32 points.",
 		"Your rating will move more when you beat a much higher rated player or lose to a much lower rated player.",
-		"New players have a provisional K value of 64 for their first 10 games to converge to an accurate rating faster.",
-		"bo1 games have their K values halved to reflect the shorter time commitment and less competitive nature of bo1.",
+		"New players have a provisional K value of 64 for their first 10 games in each mode to converge to an accurate rating faster.",
+		fmt.Sprintf("You are unranked in each mode until you finish %d placement matches in it. While in placement you are preferentially paired with players who have settled ratings.", config.GetRatingConfig().PlacementMatches),
+		"When a new season starts everyone's ratings are pulled part of the way back toward 1200 and the final standings of the old season are archived.",
 		"Treat ratings as a useful matchmaking tool and that's it. We compete to win season score, not to be the highest rated player.\n",
 
 		"**Crashes/Disconnects:**",
@@ -177,18 +473,60 @@ func PostMonthlyWinStandings(conn *gorm.DB) {
 	usersWithStats := db.GetMonthlyWinLeaderboard(conn)
 	leaderBoardLines := []string{"Total wins this month: \n"}
 	for i, v := range usersWithStats {
-		line := fmt.Sprintf("%d - %s - %dW / %dL", i+1, v.User.DiscordUserName, v.Wins, v.Losses)
+		line := fmt.Sprintf("%d - %s - %dW / %dL / %dD", i+1, v.User.DiscordUserName, v.Wins, v.Losses, v.Draws)
 		leaderBoardLines = append(leaderBoardLines, line)
 	}
+
+	foundSeason, season := db.GetCurrentSeason(conn)
+	if foundSeason {
+		leaderBoardLines = append(leaderBoardLines, "", fmt.Sprintf("Total wins in %s: \n", season.Name))
+		for i, v := range db.GetSeasonWinLeaderboard(conn, season) {
+			line := fmt.Sprintf("%d - %s - %dW / %dL / %dD", i+1, v.User.DiscordUserName, v.Wins, v.Losses, v.Draws)
+			leaderBoardLines = append(leaderBoardLines, line)
+		}
+	}
 	api.ReplaceChannelContents(config.GetAppConfig().HomeGuildId, "leaderboard", leaderBoardLines)
 }
 
 func PostEloStandings(conn *gorm.DB) {
-	usersWithStats := db.GetEloLeaderboard(conn)
-	leaderBoardLines := []string{"All time top Elo Ratings: \n"}
-	for i, v := range usersWithStats {
-		line := fmt.Sprintf("%d - %s - Elo %d - %dW / %dL", i+1, v.User.DiscordUserName, v.User.CurrentRating, v.Wins, v.Losses)
-		leaderBoardLines = append(leaderBoardLines, line)
+	now := time.Now()
+	// Ratings carry across seasons, but records on the board only count the current season if one is running.
+	season := db.AllTime
+	foundSeason, currentSeason := db.GetCurrentSeason(conn)
+	if foundSeason {
+		season = currentSeason
+	}
+	var leaderBoardLines []string
+	for _, mode := range db.SoloGameModes {
+		leaderBoardLines = append(leaderBoardLines, eloStandingsLines(conn, mode, season, now)...)
 	}
 	api.ReplaceChannelContents(config.GetAppConfig().HomeGuildId, "elo-ratings", leaderBoardLines)
+	// 2v2 is its own scene, so it gets its own board.
+	api.ReplaceChannelContents(config.GetAppConfig().HomeGuildId, "2v2-ratings", eloStandingsLines(conn, db.Team2v2, season, now))
+}
+
+func eloStandingsLines(conn *gorm.DB, mode db.GameMode, season db.Season, now time.Time) (leaderBoardLines []string) {
+	usersWithStats := db.GetEloLeaderboard(conn, mode, season)
+	leaderBoardLines = append(leaderBoardLines, fmt.Sprintf("%s top %s Elo Ratings: \n", season.Name, mode))
+	rank := 0
+	var unranked []string
+	for _, v := range usersWithStats {
+		if ratings.InPlacement(v.GamesPlayed) {
+			// Players who haven't started placement yet aren't worth listing at all.
+			if v.GamesPlayed > 0 {
+				unranked = append(unranked, fmt.Sprintf("%s (%d/%d)", v.User.DiscordUserName, v.GamesPlayed, config.GetRatingConfig().PlacementMatches))
+			}
+			continue
+		}
+		if decay.IsHiddenFromBoard(v.LastMatchAt, now) {
+			continue
+		}
+		rank++
+		line := fmt.Sprintf("%d - %s - Elo %d - %dW / %dL / %dD", rank, v.User.DiscordUserName, v.Rating, v.Wins, v.Losses, v.Draws)
+		leaderBoardLines = append(leaderBoardLines, line)
+	}
+	if len(unranked) > 0 {
+		leaderBoardLines = append(leaderBoardLines, fmt.Sprintf("Unranked, still in placement: %s", strings.Join(unranked, ", ")))
+	}
+	return append(leaderBoardLines, "")
 }
@@ -0,0 +1,291 @@
+package matchsim
+
+import (
+	"discordbot/internal/app/discord/interactions"
+	"discordbot/internal/db"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MaxCandidates mirrors the limit db.FindCandidatePairings puts on how many waiting requests are considered.
+const MaxCandidates = 100
+
+/*
+	Policy
+	One matchmaking policy to compare, applied to requests for every mode.
+*/
+type Policy struct {
+	Name        string
+	Matchmaking db.MatchmakingPolicy
+}
+
+/*
+	DefaultPolicy the policy every mode is paired with until one is saved for it.
+*/
+func DefaultPolicy() Policy {
+	return Policy{Name: "default", Matchmaking: db.DefaultMatchmakingPolicy(db.Bo1)}
+}
+
+/*
+	ParsePolicy reads a policy from name:key=value,... where the keys are rating, wait, floor, range and window. Anything
+	left out keeps its value from base, so "wide:range=400" is base with a wider default range.
+*/
+func ParsePolicy(spec string, base Policy) (policy Policy, err error) {
+	policy = base
+	name, settings, hasSettings := strings.Cut(spec, ":")
+	if name == "" {
+		return policy, fmt.Errorf("policy %q has no name", spec)
+	}
+	policy.Name = name
+	if !hasSettings {
+		return policy, nil
+	}
+	for _, setting := range strings.Split(settings, ",") {
+		key, value, found := strings.Cut(setting, "=")
+		if !found {
+			return policy, fmt.Errorf("policy %q: expected key=value but got %q", spec, setting)
+		}
+		number, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return policy, fmt.Errorf("policy %q: %s is not a number", spec, value)
+		}
+		switch key {
+		case "rating":
+			policy.Matchmaking.RatingWeight = number
+		case "wait":
+			policy.Matchmaking.WaitWeight = number
+		case "floor":
+			policy.Matchmaking.RatingDeltaFloor = int(number)
+		case "range":
+			policy.Matchmaking.DefaultRange = int(number)
+		case "window":
+			policy.Matchmaking.QueueWindowMinutes = int(number)
+		default:
+			return policy, fmt.Errorf("policy %q: unknown setting %q", spec, key)
+		}
+	}
+	if valid, message := policy.Matchmaking.Validate(); !valid {
+		return policy, fmt.Errorf("policy %q: %s", spec, message)
+	}
+	return policy, nil
+}
+
+type Result struct {
+	Policy string `json:"policy"`
+	// Requests counts arrivals that joined the queue, arrivals from players already in it are turned away.
+	Requests int `json:"requests"`
+	Matches  int `json:"matches"`
+	Expired  int `json:"expired"`
+	// AverageWait and P95Wait are over paired requests only, a player paired as they join waited for nothing.
+	AverageWait      time.Duration `json:"average_wait"`
+	P95Wait          time.Duration `json:"p95_wait"`
+	AverageRatingGap float64       `json:"average_rating_gap"`
+}
+
+func (r Result) ExpiryRate() float64 {
+	if r.Requests == 0 {
+		return 0
+	}
+	return float64(r.Expired) / float64(r.Requests)
+}
+
+type queuedArrival struct {
+	request db.MatchRequest
+	ratings map[db.GameMode]int
+}
+
+/*
+	Simulate
+	Replays arrivals, oldest first, through the queue as /queue would handle them under the policy: requests past their
+	deadline drop out, then the newcomer is paired with whoever interactions.FindBestPairing picks from the waiting
+	requests in range of them, or waits in turn. Anyone still waiting once the arrivals run out expires.
+
+	Avoids, regions and rematches aren't known offline, and the scheduled matchmaker pass isn't run, so every pairing
+	happens the moment someone joins.
+*/
+func Simulate(arrivals []db.QueueArrival, policy Policy) (result Result) {
+	result.Policy = policy.Name
+	var queue []queuedArrival
+	var waits []time.Duration
+	totalGap := 0
+
+	for i, arrival := range arrivals {
+		now := arrival.Request.CreatedAt
+		var expired int
+		queue, expired = expire(queue, now)
+		result.Expired += expired
+
+		if isQueued(queue, arrival.Request.RequestingUserId) {
+			continue
+		}
+		result.Requests++
+
+		request := arrival.Request
+		request.MatchRequestId = i + 1
+		request.MatchRequestState = db.MatchRequestStateQueued
+		request.ExpiresAt = now.Add(arrival.Request.QueueWindow())
+		// Players who didn't pick a range or how long they're around get the policy's instead of the built in default.
+		if request.RequestRange == db.DefaultRatingRange {
+			request.RequestRange = policy.Matchmaking.DefaultRange
+		}
+		if arrival.Request.QueueWindow() == db.ExpiryTimeMinutes*time.Minute {
+			request.ExpiresAt = now.Add(time.Duration(policy.Matchmaking.QueueWindowMinutes) * time.Minute)
+		}
+
+		candidates := findCandidates(queue, request, arrival.Ratings, now)
+		if len(candidates) == 0 {
+			queue = append(queue, queuedArrival{request: request, ratings: arrival.Ratings})
+			continue
+		}
+
+		best := interactions.FindBestPairing(policy.Matchmaking, request, candidates, now)
+		for j, v := range queue {
+			if v.request.MatchRequestId != best.MatchRequestId {
+				continue
+			}
+			mode := db.ResolveGameMode(request.RequestedGameMode, v.request.RequestedGameMode)
+			waits = append(waits, now.Sub(v.request.CreatedAt), 0)
+			totalGap += abs(v.ratings[mode] - arrival.Ratings[mode])
+			queue = append(queue[:j], queue[j+1:]...)
+			break
+		}
+		result.Matches++
+	}
+	result.Expired += len(queue)
+
+	if result.Matches > 0 {
+		result.AverageRatingGap = float64(totalGap) / float64(result.Matches)
+	}
+	result.AverageWait, result.P95Wait = summarizeWaits(waits)
+	return result
+}
+
+func expire(queue []queuedArrival, now time.Time) (remaining []queuedArrival, expired int) {
+	for _, v := range queue {
+		if !v.request.ExpiresAt.After(now) {
+			expired++
+			continue
+		}
+		remaining = append(remaining, v)
+	}
+	return remaining, expired
+}
+
+func isQueued(queue []queuedArrival, userId int) bool {
+	for _, v := range queue {
+		if v.request.RequestingUserId == userId {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+	findCandidates the waiting requests the newcomer could be paired with, applying the mode and range rules of
+	db.FindCandidatePairings. Ratings are compared on the ladder the pair would play on. The queue is kept oldest first,
+	the same order the query returns.
+*/
+func findCandidates(queue []queuedArrival, request db.MatchRequest, ratings map[db.GameMode]int, now time.Time) (candidates []db.CandidatePairing) {
+	requestRange := db.EffectiveRange(request, now)
+	for _, v := range queue {
+		if len(candidates) == MaxCandidates {
+			break
+		}
+		opponent := v.request
+		if !modesCompatible(request.RequestedGameMode, opponent.RequestedGameMode) {
+			continue
+		}
+		mode := db.ResolveGameMode(request.RequestedGameMode, opponent.RequestedGameMode)
+		gap := abs(ratings[mode] - v.ratings[mode])
+		if gap > requestRange || gap > db.EffectiveRange(opponent, now) {
+			continue
+		}
+		candidates = append(candidates, db.CandidatePairing{
+			OpponentMatchRequest: opponent,
+			OpponentRating:       v.ratings[mode],
+			RequesterRating:      ratings[mode],
+		})
+	}
+	return candidates
+}
+
+func modesCompatible(requested db.GameMode, opponentRequested db.GameMode) bool {
+	return requested == db.All || opponentRequested == db.All || requested == opponentRequested
+}
+
+func summarizeWaits(waits []time.Duration) (average time.Duration, p95 time.Duration) {
+	if len(waits) == 0 {
+		return 0, 0
+	}
+	sorted := append([]time.Duration{}, waits...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i] < sorted[j]
+	})
+	var total time.Duration
+	for _, v := range sorted {
+		total += v
+	}
+	// Nearest rank, so the p95 is a wait someone actually had.
+	rank := int(math.Ceil(0.95*float64(len(sorted)))) - 1
+	return total / time.Duration(len(sorted)), sorted[rank]
+}
+
+func abs(i int) int {
+	if i < 0 {
+		return -i
+	}
+	return i
+}
+
+/*
+	SyntheticOptions
+	The shape of a made-up evening of queuing. Players get ratings spread normally around the default rating and join
+	at random times, ArrivalsPerHour of them an hour on average.
+*/
+type SyntheticOptions struct {
+	Arrivals        int
+	Players         int
+	ArrivalsPerHour float64
+	RatingSpread    float64
+	Seed            int64
+}
+
+/*
+	SyntheticArrivals makes up arrivals from start. Most players queue for bo1 with the default range and availability,
+	the rest are split between bo3 and all and between staying a shorter and a longer while.
+*/
+func SyntheticArrivals(options SyntheticOptions, start time.Time) (arrivals []db.QueueArrival) {
+	random := rand.New(rand.NewSource(options.Seed))
+	playerRatings := make([]int, options.Players)
+	for i := range playerRatings {
+		playerRatings[i] = db.DEFAULT_RATING + int(random.NormFloat64()*options.RatingSpread)
+	}
+
+	modes := []db.GameMode{db.Bo1, db.Bo1, db.Bo1, db.Bo3, db.All}
+	availableMinutes := []int{db.ExpiryTimeMinutes, db.ExpiryTimeMinutes, db.ExpiryTimeMinutes, 20, 90}
+	now := start
+	for i := 0; i < options.Arrivals; i++ {
+		now = now.Add(time.Duration(random.ExpFloat64() / options.ArrivalsPerHour * float64(time.Hour)))
+		player := random.Intn(options.Players)
+		arrivals = append(arrivals, db.QueueArrival{
+			Request: db.MatchRequest{
+				MatchRequestId:    i + 1,
+				RequestingUserId:  player + 1,
+				CreatedAt:         now,
+				UpdatedAt:         now,
+				RequestRange:      db.DefaultRatingRange,
+				RequestedGameMode: modes[random.Intn(len(modes))],
+				MatchRequestState: db.MatchRequestStateQueued,
+				RegionPreference:  db.AnyRegion,
+				ExpiresAt:         now.Add(time.Duration(availableMinutes[random.Intn(len(availableMinutes))]) * time.Minute),
+			},
+			Ratings: map[db.GameMode]int{db.Bo1: playerRatings[player], db.Bo3: playerRatings[player]},
+		})
+	}
+	return arrivals
+}
@@ -0,0 +1,148 @@
+package matchsim
+
+import (
+	"discordbot/internal/db"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func arrival(userId int, rating int, mode db.GameMode, at time.Time, availableMinutes int) db.QueueArrival {
+	return db.QueueArrival{
+		Request: db.MatchRequest{
+			RequestingUserId:  userId,
+			CreatedAt:         at,
+			UpdatedAt:         at,
+			RequestRange:      db.DefaultRatingRange,
+			RequestedGameMode: mode,
+			FixedRange:        true,
+			ExpiresAt:         at.Add(time.Duration(availableMinutes) * time.Minute),
+		},
+		Ratings: map[db.GameMode]int{db.Bo1: rating, db.Bo3: rating},
+	}
+}
+
+func TestSimulate(t *testing.T) {
+	start := time.Now()
+	arrivals := []db.QueueArrival{
+		arrival(1, 1200, db.Bo1, start, 45),
+		// Out of range of the first player, so they wait.
+		arrival(2, 1600, db.Bo1, start.Add(5*time.Minute), 45),
+		// Queuing again while still waiting is turned away.
+		arrival(1, 1200, db.Bo1, start.Add(6*time.Minute), 45),
+		arrival(3, 1300, db.All, start.Add(10*time.Minute), 45),
+		// The second player has given up by now.
+		arrival(4, 1500, db.Bo1, start.Add(60*time.Minute), 45),
+	}
+
+	result := Simulate(arrivals, DefaultPolicy())
+	assert.Equal(t, "default", result.Policy)
+	assert.Equal(t, 4, result.Requests)
+	assert.Equal(t, 1, result.Matches)
+	assert.Equal(t, 2, result.Expired)
+	assert.Equal(t, 0.5, result.ExpiryRate())
+	assert.Equal(t, 100.0, result.AverageRatingGap)
+	assert.Equal(t, 5*time.Minute, result.AverageWait)
+	assert.Equal(t, 10*time.Minute, result.P95Wait)
+
+	// A wider default range pairs the first two straight away, which frees the first player to queue again and meet the
+	// third. Only the last player is left waiting.
+	wide, err := ParsePolicy("wide:range=400", DefaultPolicy())
+	assert.Nil(t, err)
+	result = Simulate(arrivals, wide)
+	assert.Equal(t, 5, result.Requests)
+	assert.Equal(t, 2, result.Matches)
+	assert.Equal(t, 1, result.Expired)
+}
+
+func TestSimulatePolicyWeights(t *testing.T) {
+	start := time.Now()
+	// The first two can't play each other, so both are waiting when the third player, who suits either, joins.
+	arrivals := []db.QueueArrival{
+		arrival(1, 1000, db.Bo1, start, 45),
+		arrival(2, 1300, db.Bo3, start.Add(20*time.Minute), 45),
+		arrival(3, 1250, db.All, start.Add(21*time.Minute), 45),
+	}
+
+	// The default favours whoever has waited longest, even when they're further away.
+	assert.Equal(t, 250.0, Simulate(arrivals, DefaultPolicy()).AverageRatingGap)
+
+	ratingOnly, err := ParsePolicy("rating-only:rating=1,wait=0", DefaultPolicy())
+	assert.Nil(t, err)
+	assert.Equal(t, 50.0, Simulate(arrivals, ratingOnly).AverageRatingGap)
+}
+
+func TestSimulateResolvedLadder(t *testing.T) {
+	start := time.Now()
+	allVsAll := []db.QueueArrival{
+		arrival(1, 1200, db.All, start, 45),
+		arrival(2, 1200, db.All, start.Add(time.Minute), 45),
+	}
+	allVsAll[1].Ratings[db.Bo3] = 1300
+
+	// Two players happy with anything play, and are rated, on the bo3 ladder.
+	assert.Equal(t, 100.0, Simulate(allVsAll, DefaultPolicy()).AverageRatingGap)
+
+	allVsBo1 := []db.QueueArrival{allVsAll[1], arrival(1, 1200, db.Bo1, start.Add(2*time.Minute), 45)}
+	result := Simulate(allVsBo1, DefaultPolicy())
+	assert.Equal(t, 1, result.Matches)
+	assert.Equal(t, 0.0, result.AverageRatingGap)
+}
+
+func TestParsePolicy(t *testing.T) {
+	policy, err := ParsePolicy("tuned:rating=0.4,wait=0.6,floor=500,range=250,window=30", DefaultPolicy())
+	assert.Nil(t, err)
+	assert.Equal(t, "tuned", policy.Name)
+	assert.Equal(t, 0.4, policy.Matchmaking.RatingWeight)
+	assert.Equal(t, 0.6, policy.Matchmaking.WaitWeight)
+	assert.Equal(t, 500, policy.Matchmaking.RatingDeltaFloor)
+	assert.Equal(t, 250, policy.Matchmaking.DefaultRange)
+	assert.Equal(t, 30, policy.Matchmaking.QueueWindowMinutes)
+
+	// Settings left out come from the base policy.
+	policy, err = ParsePolicy("wider:range=500", policy)
+	assert.Nil(t, err)
+	assert.Equal(t, 0.4, policy.Matchmaking.RatingWeight)
+	assert.Equal(t, 500, policy.Matchmaking.DefaultRange)
+
+	policy, err = ParsePolicy("same", DefaultPolicy())
+	assert.Nil(t, err)
+	assert.Equal(t, db.DefaultMatchmakingPolicy(db.Bo1), policy.Matchmaking)
+
+	for _, v := range []string{":range=200", "bad:range", "bad:range=wide", "bad:speed=1", "bad:range=0", "bad:rating=0,wait=0"} {
+		_, err = ParsePolicy(v, DefaultPolicy())
+		assert.NotNil(t, err, v)
+	}
+}
+
+func TestSimulateQueueWindow(t *testing.T) {
+	start := time.Now()
+	arrivals := []db.QueueArrival{
+		arrival(1, 1200, db.Bo1, start, db.ExpiryTimeMinutes),
+		arrival(2, 1200, db.Bo1, start.Add(30*time.Minute), db.ExpiryTimeMinutes),
+	}
+	assert.Equal(t, 1, Simulate(arrivals, DefaultPolicy()).Matches)
+
+	// Players who kept the default availability leave before the second player shows up under a shorter window.
+	short, err := ParsePolicy("short:window=20", DefaultPolicy())
+	assert.Nil(t, err)
+	result := Simulate(arrivals, short)
+	assert.Equal(t, 0, result.Matches)
+	assert.Equal(t, 2, result.Expired)
+}
+
+func TestSyntheticArrivals(t *testing.T) {
+	options := SyntheticOptions{Arrivals: 50, Players: 10, ArrivalsPerHour: 10, RatingSpread: 200, Seed: 7}
+	start := time.Now()
+	arrivals := SyntheticArrivals(options, start)
+	assert.Len(t, arrivals, 50)
+	assert.Equal(t, arrivals, SyntheticArrivals(options, start), "The same seed should make the same arrivals.")
+
+	for i, v := range arrivals {
+		assert.True(t, v.Request.CreatedAt.After(start))
+		if i > 0 {
+			assert.False(t, v.Request.CreatedAt.Before(arrivals[i-1].Request.CreatedAt), "Arrivals should be oldest first.")
+		}
+		assert.True(t, v.Request.RequestingUserId >= 1 && v.Request.RequestingUserId <= 10)
+	}
+}
@@ -0,0 +1,135 @@
+package ratings
+
+import "math"
+
+const DefaultDeviation = 350.0
+const DefaultVolatility = 0.06
+
+// Glicko-2 works on its own scale centred on 1500, these convert to and from it.
+const glickoBaseRating = 1500.0
+const glickoScale = 173.7178
+
+const defaultTau = 0.5
+const volatilityConvergence = 0.000001
+
+/*
+	Glicko2
+	Implements http://www.glicko.net/glicko/glicko2.pdf treating every match as its own rating period, so ratings move
+	immediately after each reported result just like they do under Elo.
+*/
+type Glicko2 struct {
+	// Tau constrains how quickly volatility can change, Glickman suggests 0.3 - 1.2.
+	Tau float64
+}
+
+type glickoResult struct {
+	opponent PlayerRating
+	score    float64
+}
+
+func NewGlicko2() Glicko2 {
+	return Glicko2{Tau: defaultTau}
+}
+
+func (g Glicko2) Name() string {
+	return Glicko2SystemName
+}
+
+/*
+	ExpectedScore folds both players' deviations into the expectation, so uncertain ratings give odds closer to even.
+*/
+func (g Glicko2) ExpectedScore(p1 PlayerRating, p2 PlayerRating) float64 {
+	p1Mu, p1Phi := toGlickoScale(p1)
+	p2Mu, p2Phi := toGlickoScale(p2)
+	return glickoE(p1Mu, p2Mu, glickoG(math.Sqrt(p1Phi*p1Phi+p2Phi*p2Phi)))
+}
+
+func (g Glicko2) ComputeNewRatings(p1 PlayerRating, p2 PlayerRating, p1Score float64, weight float64) (newP1 PlayerRating, newP2 PlayerRating) {
+	newP1 = g.update(p1, []glickoResult{{opponent: p2, score: p1Score}})
+	newP2 = g.update(p2, []glickoResult{{opponent: p1, score: 1.0 - p1Score}})
+
+	// Weight only scales the rating movement, confidence in the rating still grows by a full game.
+	newP1.Rating = p1.Rating + int(math.Round(weight*float64(newP1.Rating-p1.Rating)))
+	newP2.Rating = p2.Rating + int(math.Round(weight*float64(newP2.Rating-p2.Rating)))
+	return newP1, newP2
+}
+
+func (g Glicko2) update(player PlayerRating, results []glickoResult) (updated PlayerRating) {
+	mu, phi := toGlickoScale(player)
+	sigma := player.Volatility
+
+	vInverse := 0.0
+	deltaSum := 0.0
+	for _, v := range results {
+		opponentMu, opponentPhi := toGlickoScale(v.opponent)
+		gPhi := glickoG(opponentPhi)
+		expected := glickoE(mu, opponentMu, gPhi)
+		vInverse += gPhi * gPhi * expected * (1 - expected)
+		deltaSum += gPhi * (v.score - expected)
+	}
+	variance := 1.0 / vInverse
+	delta := variance * deltaSum
+
+	newSigma := g.computeVolatility(phi, sigma, variance, delta)
+	phiStar := math.Sqrt(phi*phi + newSigma*newSigma)
+	newPhi := 1.0 / math.Sqrt(1.0/(phiStar*phiStar)+1.0/variance)
+	newMu := mu + newPhi*newPhi*deltaSum
+
+	updated = player
+	updated.Rating = int(math.Round(newMu*glickoScale + glickoBaseRating))
+	updated.Deviation = newPhi * glickoScale
+	updated.Volatility = newSigma
+	updated.GamesPlayed += len(results)
+	return updated
+}
+
+// Step 5 of the paper - find the new volatility with the Illinois algorithm.
+func (g Glicko2) computeVolatility(phi float64, sigma float64, variance float64, delta float64) float64 {
+	a := math.Log(sigma * sigma)
+	f := func(x float64) float64 {
+		ex := math.Exp(x)
+		numerator := ex * (delta*delta - phi*phi - variance - ex)
+		denominator := 2 * math.Pow(phi*phi+variance+ex, 2)
+		return numerator/denominator - (x-a)/(g.Tau*g.Tau)
+	}
+
+	upper := a
+	var lower float64
+	if delta*delta > phi*phi+variance {
+		lower = math.Log(delta*delta - phi*phi - variance)
+	} else {
+		k := 1.0
+		for f(a-k*g.Tau) < 0 {
+			k++
+		}
+		lower = a - k*g.Tau
+	}
+
+	fUpper := f(upper)
+	fLower := f(lower)
+	for math.Abs(lower-upper) > volatilityConvergence {
+		next := upper + (upper-lower)*fUpper/(fLower-fUpper)
+		fNext := f(next)
+		if fNext*fLower <= 0 {
+			upper = lower
+			fUpper = fLower
+		} else {
+			fUpper = fUpper / 2
+		}
+		lower = next
+		fLower = fNext
+	}
+	return math.Exp(upper / 2)
+}
+
+func toGlickoScale(player PlayerRating) (mu float64, phi float64) {
+	return (float64(player.Rating) - glickoBaseRating) / glickoScale, player.Deviation / glickoScale
+}
+
+func glickoG(phi float64) float64 {
+	return 1.0 / math.Sqrt(1.0+3.0*phi*phi/(math.Pi*math.Pi))
+}
+
+func glickoE(mu float64, opponentMu float64, gPhi float64) float64 {
+	return 1.0 / (1.0 + math.Exp(-gPhi*(mu-opponentMu)))
+}
@@ -0,0 +1,68 @@
+package ratings
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestGlicko2PaperExample(t *testing.T) {
+	// Worked example from section 3 of http://www.glicko.net/glicko/glicko2.pdf
+	player := PlayerRating{Rating: 1500, Deviation: 200, Volatility: DefaultVolatility}
+
+	updated := NewGlicko2().update(player, []glickoResult{
+		{opponent: PlayerRating{Rating: 1400, Deviation: 30}, score: 1.0},
+		{opponent: PlayerRating{Rating: 1550, Deviation: 100}, score: 0.0},
+		{opponent: PlayerRating{Rating: 1700, Deviation: 300}, score: 0.0},
+	})
+
+	assert.Equal(t, 1464, updated.Rating)
+	assert.InDelta(t, 151.52, updated.Deviation, 0.01)
+	assert.InDelta(t, 0.05999, updated.Volatility, 0.00001)
+	assert.Equal(t, 3, updated.GamesPlayed)
+}
+
+func TestGlicko2ComputeNewRatings(t *testing.T) {
+	glicko := NewGlicko2()
+	p1 := PlayerRating{Rating: 1200, Deviation: DefaultDeviation, Volatility: DefaultVolatility}
+	p2 := PlayerRating{Rating: 1200, Deviation: DefaultDeviation, Volatility: DefaultVolatility}
+
+	newP1, newP2 := glicko.ComputeNewRatings(p1, p2, WinScore, 1.0)
+
+	assert.Greater(t, newP1.Rating, p1.Rating)
+	assert.Less(t, newP2.Rating, p2.Rating)
+	assert.Equal(t, newP1.Rating-p1.Rating, p2.Rating-newP2.Rating)
+	assert.Less(t, newP1.Deviation, p1.Deviation)
+	assert.Less(t, newP2.Deviation, p2.Deviation)
+
+	halfP1, halfP2 := glicko.ComputeNewRatings(p1, p2, WinScore, 0.5)
+	assert.InDelta(t, (newP1.Rating-p1.Rating)/2, halfP1.Rating-p1.Rating, 1)
+	assert.InDelta(t, (p2.Rating-newP2.Rating)/2, p2.Rating-halfP2.Rating, 1)
+	assert.Equal(t, newP1.Deviation, halfP1.Deviation)
+}
+
+func TestGlicko2ExpectedScore(t *testing.T) {
+	glicko := NewGlicko2()
+	strong := PlayerRating{Rating: 1600, Deviation: 50}
+	weak := PlayerRating{Rating: 1200, Deviation: 50}
+
+	assert.Equal(t, 0.5, glicko.ExpectedScore(weak, weak))
+	confident := glicko.ExpectedScore(strong, weak)
+	assert.InDelta(t, 1.0, confident+glicko.ExpectedScore(weak, strong), 0.0001)
+
+	// The same gap between uncertain ratings is closer to a coin flip.
+	strong.Deviation = DefaultDeviation
+	weak.Deviation = DefaultDeviation
+	assert.Less(t, glicko.ExpectedScore(strong, weak), confident)
+	assert.Greater(t, glicko.ExpectedScore(strong, weak), 0.5)
+}
+
+func TestGlicko2Draw(t *testing.T) {
+	glicko := NewGlicko2()
+	favourite := PlayerRating{Rating: 1400, Deviation: 100, Volatility: DefaultVolatility}
+	underdog := PlayerRating{Rating: 1200, Deviation: 100, Volatility: DefaultVolatility}
+
+	newFavourite, newUnderdog := glicko.ComputeNewRatings(favourite, underdog, DrawScore, 1.0)
+	assert.Less(t, newFavourite.Rating, favourite.Rating)
+	assert.Greater(t, newUnderdog.Rating, underdog.Rating)
+	assert.Less(t, newFavourite.Deviation, favourite.Deviation)
+}
@@ -0,0 +1,29 @@
+package ratings
+
+import "discordbot/internal/app/config"
+
+// MarginOfVictoryBonus is how much extra weight each game of margin beyond the narrowest possible win is worth.
+const MarginOfVictoryBonus = 0.25
+
+/*
+	MarginOfVictoryWeight
+	Weight for a series result based on the game score. A narrow win (or no reported score) is worth a normal result
+	and each extra game of margin adds MarginOfVictoryBonus, so a bo3 2-0 moves ratings 25% further than a 2-1.
+*/
+func MarginOfVictoryWeight(winnerGames int, loserGames int) float64 {
+	margin := winnerGames - loserGames
+	if margin <= 1 {
+		return 1.0
+	}
+	return 1.0 + MarginOfVictoryBonus*float64(margin-1)
+}
+
+/*
+	SeriesWeight the weight to rate a series with, honouring whether margin of victory scaling is switched on.
+*/
+func SeriesWeight(winnerGames int, loserGames int) float64 {
+	if !config.GetRatingConfig().MarginOfVictory {
+		return 1.0
+	}
+	return MarginOfVictoryWeight(winnerGames, loserGames)
+}
@@ -0,0 +1,22 @@
+package ratings
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestMarginOfVictoryWeight(t *testing.T) {
+	assert.Equal(t, 1.0, MarginOfVictoryWeight(0, 0))
+	assert.Equal(t, 1.0, MarginOfVictoryWeight(1, 0))
+	assert.Equal(t, 1.0, MarginOfVictoryWeight(2, 1))
+	assert.Equal(t, 1.25, MarginOfVictoryWeight(2, 0))
+	assert.Equal(t, 1.5, MarginOfVictoryWeight(3, 0))
+}
+
+func TestSeriesWeight(t *testing.T) {
+	t.Setenv("RATING_MARGIN_OF_VICTORY", "")
+	assert.Equal(t, 1.0, SeriesWeight(2, 0))
+
+	t.Setenv("RATING_MARGIN_OF_VICTORY", "true")
+	assert.Equal(t, 1.25, SeriesWeight(2, 0))
+}
@@ -0,0 +1,11 @@
+package ratings
+
+import "discordbot/internal/app/config"
+
+/*
+	InPlacement whether a player with this many completed matches on a ladder is still playing placement matches there.
+	Players in placement are unranked, their rating is still moving too fast to mean much.
+*/
+func InPlacement(gamesPlayed int) bool {
+	return gamesPlayed < config.GetRatingConfig().PlacementMatches
+}
@@ -0,0 +1,15 @@
+package ratings
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestInPlacement(t *testing.T) {
+	assert.True(t, InPlacement(0))
+	assert.True(t, InPlacement(4))
+	assert.False(t, InPlacement(5))
+
+	t.Setenv("RATING_PLACEMENT_MATCHES", "0")
+	assert.False(t, InPlacement(0))
+}
@@ -1,25 +1,126 @@
 package ratings
 
-import "math"
+import (
+	"discordbot/internal/app/config"
+	"fmt"
+	"math"
+)
 
 const ProvisionalK = 64.0
 const K = 32.0
 
-const Bo1DiscountFactor = 2.0
+// ProvisionalMatches is how many completed matches a player plays at ProvisionalK before settling to K.
+const ProvisionalMatches = 10
 
-func ComputeNewElos(p1Rating int, p2Rating int, p1Won bool, p1K float64, p2K float64) (newP1Rating int, newP2Rating int) {
-	expectedScore1 := 1.0 / (1.0 + math.Pow(10, (float64(p2Rating)-float64(p1Rating))/400))
-	expectedScore2 := 1.0 / (1.0 + math.Pow(10, (float64(p1Rating)-float64(p2Rating))/400))
+const (
+	EloSystemName     = "elo"
+	Glicko2SystemName = "glicko2"
+)
 
-	p1Score := 0.0
-	p2Score := 0.0
+/*
+	PlayerRating
+	Everything a rating system needs to know about one player going into a match. Elo only uses Rating and
+	GamesPlayed, Glicko-2 also tracks Deviation and Volatility.
+*/
+type PlayerRating struct {
+	Rating      int
+	Deviation   float64
+	Volatility  float64
+	GamesPlayed int
+}
+
+// Scores for a match result from p1's point of view.
+const (
+	WinScore  = 1.0
+	DrawScore = 0.5
+	LossScore = 0.0
+)
+
+/*
+	RatingSystem
+	Computes both players' new ratings after a match where p1Score is WinScore, DrawScore or LossScore. Weight scales how
+	far ratings move, 1.0 being a full strength result. ExpectedScore is p1's chance of beating p2, between 0 and 1.
+*/
+type RatingSystem interface {
+	Name() string
+	ExpectedScore(p1 PlayerRating, p2 PlayerRating) float64
+	ComputeNewRatings(p1 PlayerRating, p2 PlayerRating, p1Score float64, weight float64) (newP1 PlayerRating, newP2 PlayerRating)
+}
+
+func GetRatingSystem(name string) RatingSystem {
+	switch name {
+	case EloSystemName:
+		return NewElo()
+	case Glicko2SystemName:
+		return NewGlicko2()
+	default:
+		panic(fmt.Sprintf("Unrecognized rating system: %s", name))
+	}
+}
+
+/*
+	GetConfiguredRatingSystem returns the rating system selected by the RATING_SYSTEM env var, defaulting to Elo.
+*/
+func GetConfiguredRatingSystem() RatingSystem {
+	return GetRatingSystem(config.GetRatingConfig().RatingSystem)
+}
+
+type Elo struct {
+	K                  float64
+	ProvisionalK       float64
+	ProvisionalMatches int
+}
+
+func NewElo() Elo {
+	return Elo{
+		K:                  K,
+		ProvisionalK:       ProvisionalK,
+		ProvisionalMatches: ProvisionalMatches,
+	}
+}
+
+func (e Elo) Name() string {
+	return EloSystemName
+}
 
-	if p1Won {
-		p1Score = 1.0
-	} else {
-		p2Score = 1.0
+func (e Elo) KValue(gamesPlayed int) float64 {
+	if gamesPlayed < e.ProvisionalMatches {
+		return e.ProvisionalK
 	}
+	return e.K
+}
+
+func (e Elo) ExpectedScore(p1 PlayerRating, p2 PlayerRating) float64 {
+	return ExpectedEloScore(p1.Rating, p2.Rating)
+}
+
+func (e Elo) ComputeNewRatings(p1 PlayerRating, p2 PlayerRating, p1Score float64, weight float64) (newP1 PlayerRating, newP2 PlayerRating) {
+	newP1, newP2 = p1, p2
+	newP1.Rating, newP2.Rating = ComputeNewElos(
+		p1.Rating,
+		p2.Rating,
+		p1Score,
+		weight*e.KValue(p1.GamesPlayed),
+		weight*e.KValue(p2.GamesPlayed))
+	newP1.GamesPlayed++
+	newP2.GamesPlayed++
+	return newP1, newP2
+}
+
+func ComputeNewElos(p1Rating int, p2Rating int, p1Score float64, p1K float64, p2K float64) (newP1Rating int, newP2Rating int) {
+	expectedScore1 := ExpectedEloScore(p1Rating, p2Rating)
+	expectedScore2 := ExpectedEloScore(p2Rating, p1Rating)
+
+	p2Score := 1.0 - p1Score
+
 	newP1Rating = int(float64(p1Rating) + p1K*(p1Score-expectedScore1))
 	newP2Rating = int(float64(p2Rating) + p2K*(p2Score-expectedScore2))
 	return newP1Rating, newP2Rating
 }
+
+/*
+	ExpectedEloScore the standard Elo expectation of p1 beating p2.
+*/
+func ExpectedEloScore(p1Rating int, p2Rating int) float64 {
+	return 1.0 / (1.0 + math.Pow(10, (float64(p2Rating)-float64(p1Rating))/400))
+}
@@ -9,12 +9,57 @@ func TestComputeNewElos(t *testing.T) {
 	anandRating := 2600
 	borisRating := 2300
 
-	newAnandRating, newBorisRating := ComputeNewElos(anandRating, borisRating, true, K, K)
+	newAnandRating, newBorisRating := ComputeNewElos(anandRating, borisRating, WinScore, K, K)
 
 	assert.Equal(t, 2604, newAnandRating)
 	assert.Equal(t, 2295, newBorisRating)
 
-	newAnandRating2, newBorisRating2 := ComputeNewElos(anandRating, borisRating, false, K, K)
+	newAnandRating2, newBorisRating2 := ComputeNewElos(anandRating, borisRating, LossScore, K, K)
 	assert.Equal(t, 2572, newAnandRating2)
 	assert.Equal(t, 2327, newBorisRating2)
 }
+
+func TestEloComputeNewRatings(t *testing.T) {
+	elo := NewElo()
+	newcomer := PlayerRating{Rating: 1200, GamesPlayed: 0}
+	veteran := PlayerRating{Rating: 1200, GamesPlayed: ProvisionalMatches}
+
+	newNewcomer, newVeteran := elo.ComputeNewRatings(newcomer, veteran, WinScore, 1.0)
+	assert.Equal(t, 1232, newNewcomer.Rating)
+	assert.Equal(t, 1184, newVeteran.Rating)
+	assert.Equal(t, 1, newNewcomer.GamesPlayed)
+
+	halfWeightNewcomer, halfWeightVeteran := elo.ComputeNewRatings(newcomer, veteran, WinScore, 0.5)
+	assert.Equal(t, 1216, halfWeightNewcomer.Rating)
+	assert.Equal(t, 1192, halfWeightVeteran.Rating)
+}
+
+func TestGetRatingSystem(t *testing.T) {
+	assert.Equal(t, EloSystemName, GetRatingSystem(EloSystemName).Name())
+	assert.Equal(t, Glicko2SystemName, GetRatingSystem(Glicko2SystemName).Name())
+	assert.Panics(t, func() { GetRatingSystem("trueskill") })
+}
+
+func TestEloExpectedScore(t *testing.T) {
+	elo := NewElo()
+	assert.Equal(t, 0.5, elo.ExpectedScore(PlayerRating{Rating: 1200}, PlayerRating{Rating: 1200}))
+	// 400 points is 10:1 odds.
+	assert.InDelta(t, 10.0/11.0, elo.ExpectedScore(PlayerRating{Rating: 1600}, PlayerRating{Rating: 1200}), 0.0001)
+	assert.InDelta(t, 1.0/11.0, elo.ExpectedScore(PlayerRating{Rating: 1200}, PlayerRating{Rating: 1600}), 0.0001)
+}
+
+func TestEloDraw(t *testing.T) {
+	elo := NewElo()
+	favourite := PlayerRating{Rating: 1400, GamesPlayed: ProvisionalMatches}
+	underdog := PlayerRating{Rating: 1200, GamesPlayed: ProvisionalMatches}
+
+	// A draw against a weaker player costs the favourite rating and the underdog gains the same.
+	newFavourite, newUnderdog := elo.ComputeNewRatings(favourite, underdog, DrawScore, 1.0)
+	assert.Equal(t, 1391, newFavourite.Rating)
+	assert.Equal(t, 1208, newUnderdog.Rating)
+
+	evenP1, evenP2 := elo.ComputeNewRatings(underdog, underdog, DrawScore, 1.0)
+	assert.Equal(t, 1200, evenP1.Rating)
+	assert.Equal(t, 1200, evenP2.Rating)
+	assert.Equal(t, ProvisionalMatches+1, evenP1.GamesPlayed)
+}
@@ -0,0 +1,56 @@
+package ratings
+
+import "math"
+
+/*
+	TeamRating
+	Stands a team in for a single player - the average of its players' ratings, with their deviations combined as a root
+	mean square so one unsettled player makes the whole team less certain.
+*/
+func TeamRating(players []PlayerRating) (team PlayerRating) {
+	if len(players) == 0 {
+		return team
+	}
+	totalRating := 0
+	totalVariance := 0.0
+	totalVolatility := 0.0
+	team.GamesPlayed = players[0].GamesPlayed
+	for _, v := range players {
+		totalRating += v.Rating
+		totalVariance += v.Deviation * v.Deviation
+		totalVolatility += v.Volatility
+		if v.GamesPlayed < team.GamesPlayed {
+			team.GamesPlayed = v.GamesPlayed
+		}
+	}
+	team.Rating = int(math.Round(float64(totalRating) / float64(len(players))))
+	team.Deviation = math.Sqrt(totalVariance / float64(len(players)))
+	team.Volatility = totalVolatility / float64(len(players))
+	return team
+}
+
+/*
+	ComputeNewTeamRatings
+	New ratings for every player after a team match where team1Score is WinScore, DrawScore or LossScore for team1.
+	Each player is rated as if they were at their team's average rating against the other team, and the change that
+	gives is applied to their own rating. Everything else, such as how far a player in placement moves, still comes from
+	their own rating.
+*/
+func ComputeNewTeamRatings(ratingSystem RatingSystem, team1 []PlayerRating, team2 []PlayerRating, team1Score float64, weight float64) (newTeam1 []PlayerRating, newTeam2 []PlayerRating) {
+	newTeam1 = computeTeamSide(ratingSystem, team1, TeamRating(team2), team1Score, weight)
+	newTeam2 = computeTeamSide(ratingSystem, team2, TeamRating(team1), 1.0-team1Score, weight)
+	return newTeam1, newTeam2
+}
+
+func computeTeamSide(ratingSystem RatingSystem, team []PlayerRating, opponents PlayerRating, score float64, weight float64) (newTeam []PlayerRating) {
+	teamRating := TeamRating(team).Rating
+	for _, v := range team {
+		standIn := v
+		standIn.Rating = teamRating
+		newStandIn, _ := ratingSystem.ComputeNewRatings(standIn, opponents, score, weight)
+		updated := newStandIn
+		updated.Rating = v.Rating + newStandIn.Rating - teamRating
+		newTeam = append(newTeam, updated)
+	}
+	return newTeam
+}
@@ -0,0 +1,68 @@
+package ratings
+
+import (
+	"github.com/stretchr/testify/assert"
+	"math"
+	"testing"
+)
+
+func TestTeamRating(t *testing.T) {
+	team := TeamRating([]PlayerRating{
+		{Rating: 1300, Deviation: 50, Volatility: 0.06, GamesPlayed: 20},
+		{Rating: 1101, Deviation: 150, Volatility: 0.04, GamesPlayed: 3},
+	})
+
+	assert.Equal(t, 1201, team.Rating)
+	assert.InDelta(t, math.Sqrt((50*50+150*150)/2.0), team.Deviation, 0.0001)
+	assert.InDelta(t, 0.05, team.Volatility, 0.0001)
+	assert.Equal(t, 3, team.GamesPlayed)
+}
+
+func TestEloComputeNewTeamRatings(t *testing.T) {
+	elo := NewElo()
+	carry := PlayerRating{Rating: 1300, GamesPlayed: ProvisionalMatches}
+	newcomer := PlayerRating{Rating: 1100, GamesPlayed: 0}
+	opponent1 := PlayerRating{Rating: 1200, GamesPlayed: ProvisionalMatches}
+	opponent2 := PlayerRating{Rating: 1200, GamesPlayed: ProvisionalMatches}
+
+	newTeam1, newTeam2 := ComputeNewTeamRatings(elo, []PlayerRating{carry, newcomer}, []PlayerRating{opponent1, opponent2}, WinScore, 1.0)
+
+	// Both teams average 1200, so everyone moves as far as an even 1v1 would move them, from their own rating.
+	assert.Equal(t, 1316, newTeam1[0].Rating)
+	assert.Equal(t, 1132, newTeam1[1].Rating)
+	assert.Equal(t, 1184, newTeam2[0].Rating)
+	assert.Equal(t, 1184, newTeam2[1].Rating)
+	assert.Equal(t, 1, newTeam1[1].GamesPlayed)
+	assert.Equal(t, ProvisionalMatches+1, newTeam2[0].GamesPlayed)
+}
+
+func TestEloComputeNewTeamRatingsUnderdogs(t *testing.T) {
+	elo := NewElo()
+	underdogs := []PlayerRating{{Rating: 1100, GamesPlayed: ProvisionalMatches}, {Rating: 1100, GamesPlayed: ProvisionalMatches}}
+	favourites := []PlayerRating{{Rating: 1500, GamesPlayed: ProvisionalMatches}, {Rating: 1300, GamesPlayed: ProvisionalMatches}}
+
+	newUnderdogs, newFavourites := ComputeNewTeamRatings(elo, underdogs, favourites, WinScore, 1.0)
+	_, newFavouritesDraw := ComputeNewTeamRatings(elo, underdogs, favourites, DrawScore, 1.0)
+
+	// The team average of 1400 is what the underdogs were up against, so they gain as much as beating a 1400 player.
+	oneOnOne, _ := elo.ComputeNewRatings(underdogs[0], PlayerRating{Rating: 1400}, WinScore, 1.0)
+	assert.Equal(t, oneOnOne.Rating, newUnderdogs[0].Rating)
+	assert.Equal(t, oneOnOne.Rating, newUnderdogs[1].Rating)
+	assert.Equal(t, newFavourites[0].Rating-1500, newFavourites[1].Rating-1300)
+	assert.Less(t, newFavouritesDraw[0].Rating, 1500)
+}
+
+func TestGlicko2ComputeNewTeamRatings(t *testing.T) {
+	glicko := NewGlicko2()
+	settled := PlayerRating{Rating: 1200, Deviation: 60, Volatility: DefaultVolatility}
+	unsettled := PlayerRating{Rating: 1200, Deviation: DefaultDeviation, Volatility: DefaultVolatility}
+
+	newTeam1, newTeam2 := ComputeNewTeamRatings(glicko, []PlayerRating{settled, unsettled}, []PlayerRating{unsettled, unsettled}, WinScore, 1.0)
+
+	assert.Greater(t, newTeam1[0].Rating, settled.Rating)
+	// The less certain partner moves further and gets more certain.
+	assert.Greater(t, newTeam1[1].Rating, newTeam1[0].Rating)
+	assert.Less(t, newTeam1[1].Deviation, unsettled.Deviation)
+	assert.Less(t, newTeam2[0].Rating, unsettled.Rating)
+	assert.Equal(t, newTeam2[0], newTeam2[1])
+}
@@ -0,0 +1,256 @@
+package replay
+
+import (
+	"discordbot/internal/app/config"
+	"discordbot/internal/app/ratings"
+	"discordbot/internal/app/seasons"
+	"discordbot/internal/db"
+	"gorm.io/gorm"
+	"log"
+	"sort"
+	"time"
+)
+
+/*
+	Options
+	Which rating configuration to replay history with. Zero values fall back to the configured rating system and its
+	default K values so a bare replay reproduces what the ladder would look like today with no bad data.
+*/
+type Options struct {
+	RatingSystem       string
+	K                  float64
+	ProvisionalK       float64
+	ProvisionalMatches int
+	// Apply persists the replayed ratings, otherwise the replay is a dry run that only reports what would change.
+	Apply bool
+}
+
+type RatingDiff struct {
+	UserId          int         `json:"user_id"`
+	DiscordUserName string      `json:"discord_username"`
+	GameMode        db.GameMode `json:"game_mode"`
+	OldRating       int         `json:"old_rating"`
+	NewRating       int         `json:"new_rating"`
+}
+
+type Report struct {
+	RatingSystem    string       `json:"rating_system"`
+	MatchesReplayed int          `json:"matches_replayed"`
+	DecaysReplayed  int          `json:"decays_replayed"`
+	Applied         bool         `json:"applied"`
+	Diffs           []RatingDiff `json:"diffs"`
+}
+
+type ratingKey struct {
+	userId int
+	mode   db.GameMode
+}
+
+// ratingEvent is one row of rebuilt rating history.
+type ratingEvent struct {
+	key     ratingKey
+	rating  ratings.PlayerRating
+	matchId int
+	// reason is db.RatingChangeMatch unless the event is a new season's soft reset or an inactivity decay.
+	reason db.RatingChangeReason
+	// decayedAt is when a decay event first happened, so its history entry keeps counting as activity from then.
+	decayedAt time.Time
+}
+
+func (o Options) ratingSystem() ratings.RatingSystem {
+	if o.RatingSystem == "" {
+		o.RatingSystem = ratings.GetConfiguredRatingSystem().Name()
+	}
+	ratingSystem := ratings.GetRatingSystem(o.RatingSystem)
+	elo, isElo := ratingSystem.(ratings.Elo)
+	if !isElo {
+		return ratingSystem
+	}
+	if o.K > 0 {
+		elo.K = o.K
+	}
+	if o.ProvisionalK > 0 {
+		elo.ProvisionalK = o.ProvisionalK
+	}
+	if o.ProvisionalMatches > 0 {
+		elo.ProvisionalMatches = o.ProvisionalMatches
+	}
+	return elo
+}
+
+/*
+	ReplayRatings
+	Rebuilds every user's rating on every ladder by walking completed matches in the order they were played, starting
+	everyone from the default rating and soft resetting ratings whenever a season opened. Inactivity decays that weren't
+	reverted are taken off again when they happened, by as many points as they took at the time. When applying, all
+	existing rating history is tombstoned and replaced with the replayed history in one transaction.
+*/
+func ReplayRatings(conn *gorm.DB, options Options) (report Report) {
+	ratingSystem := options.ratingSystem()
+	users := db.GetAllUsers(conn)
+	matches := db.GetCompletedMatches(conn)
+	gamesByMatch := db.GetAllMatchGames(conn)
+
+	finalRatings, events := replayMatches(ratingSystem, users, matches, gamesByMatch, db.GetSeasons(conn), db.GetRatingDecays(conn))
+
+	report.RatingSystem = ratingSystem.Name()
+	report.MatchesReplayed = len(matches)
+	for _, v := range events {
+		if v.reason == db.RatingChangeDecay {
+			report.DecaysReplayed++
+		}
+	}
+	for _, user := range users {
+		for _, mode := range db.RatedGameModes {
+			oldRating := db.GetUserRating(conn, user.UserId, mode)
+			newRating := finalRatings[ratingKey{userId: user.UserId, mode: mode}]
+			if oldRating.Rating != newRating.Rating {
+				report.Diffs = append(report.Diffs, RatingDiff{
+					UserId:          user.UserId,
+					DiscordUserName: user.DiscordUserName,
+					GameMode:        mode,
+					OldRating:       oldRating.Rating,
+					NewRating:       newRating.Rating,
+				})
+			}
+		}
+	}
+	sort.SliceStable(report.Diffs, func(i, j int) bool {
+		return absInt(report.Diffs[i].NewRating-report.Diffs[i].OldRating) > absInt(report.Diffs[j].NewRating-report.Diffs[j].OldRating)
+	})
+
+	if !options.Apply {
+		return report
+	}
+
+	err := conn.Transaction(func(tx *gorm.DB) error {
+		db.TombstoneAllUserRatings(tx)
+		for _, user := range users {
+			for _, mode := range db.RatedGameModes {
+				db.UpdateUserRating(tx, user.UserId, mode, db.DefaultPlayerRating(), -1)
+			}
+		}
+		for _, v := range events {
+			switch v.reason {
+			case db.RatingChangeSeasonReset:
+				db.ResetUserRating(tx, v.key.userId, v.key.mode, v.rating)
+			case db.RatingChangeDecay:
+				db.DecayUserRating(tx, v.key.userId, v.key.mode, v.rating, v.decayedAt)
+			default:
+				db.UpdateUserRating(tx, v.key.userId, v.key.mode, v.rating, v.matchId)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("Unable to apply replayed ratings: %v", err)
+		return report
+	}
+	report.Applied = true
+	return report
+}
+
+func replayMatches(ratingSystem ratings.RatingSystem, users []db.User, matches []db.Match, gamesByMatch map[int][]db.MatchGame, allSeasons []db.Season, decays []db.RatingDecay) (finalRatings map[ratingKey]ratings.PlayerRating, events []ratingEvent) {
+	finalRatings = map[ratingKey]ratings.PlayerRating{}
+	for _, user := range users {
+		for _, mode := range db.RatedGameModes {
+			finalRatings[ratingKey{userId: user.UserId, mode: mode}] = db.DefaultPlayerRating()
+		}
+	}
+
+	softReset := func(season db.Season) {
+		for _, user := range users {
+			for _, mode := range db.RatedGameModes {
+				key := ratingKey{userId: user.UserId, mode: mode}
+				resetRating := seasons.SoftReset(finalRatings[key], season.SoftResetFactor)
+				if resetRating != finalRatings[key] {
+					finalRatings[key] = resetRating
+					events = append(events, ratingEvent{key: key, rating: resetRating, matchId: -1, reason: db.RatingChangeSeasonReset})
+				}
+			}
+		}
+	}
+
+	// Decays only ever took ratings down to the floor, and never touched ratings already at it.
+	decayFloor := config.GetDecayConfig().Floor
+	decay := func(v db.RatingDecay) {
+		key := ratingKey{userId: v.UserId, mode: v.GameMode}
+		decayedRating, found := finalRatings[key]
+		if !found || v.Points <= 0 || decayedRating.Rating <= decayFloor {
+			return
+		}
+		decayedRating.Rating -= v.Points
+		if decayedRating.Rating < decayFloor {
+			decayedRating.Rating = decayFloor
+		}
+		finalRatings[key] = decayedRating
+		events = append(events, ratingEvent{key: key, rating: decayedRating, matchId: -1, reason: db.RatingChangeDecay, decayedAt: v.DecayedAt})
+	}
+
+	// catchUp applies the season resets and decays up to until, or all that are left, in the order they happened.
+	nextSeason, nextDecay := 0, 0
+	catchUp := func(until time.Time, all bool) {
+		for {
+			seasonDue := nextSeason < len(allSeasons) && (all || !allSeasons[nextSeason].StartedAt.After(until))
+			decayDue := nextDecay < len(decays) && (all || !decays[nextDecay].DecayedAt.After(until))
+			if seasonDue && (!decayDue || !allSeasons[nextSeason].StartedAt.After(decays[nextDecay].DecayedAt)) {
+				softReset(allSeasons[nextSeason])
+				nextSeason++
+			} else if decayDue {
+				decay(decays[nextDecay])
+				nextDecay++
+			} else {
+				return
+			}
+		}
+	}
+
+	for _, match := range matches {
+		catchUp(match.CreatedAt, false)
+		if match.IsTeamMatch() {
+			events = append(events, replayTeamMatch(ratingSystem, finalRatings, match)...)
+			continue
+		}
+		p1Key := ratingKey{userId: match.P1UserId, mode: match.GameMode}
+		p2Key := ratingKey{userId: match.P2UserId, mode: match.GameMode}
+		newP1Rating, newP2Rating := ratingSystem.ComputeNewRatings(
+			finalRatings[p1Key],
+			finalRatings[p2Key],
+			db.P1Score(match.Winner),
+			ratings.SeriesWeight(db.SeriesScoreFor(gamesByMatch[match.MatchId], match.Winner == db.P1)))
+		finalRatings[p1Key] = newP1Rating
+		finalRatings[p2Key] = newP2Rating
+		events = append(events,
+			ratingEvent{key: p1Key, rating: newP1Rating, matchId: match.MatchId, reason: db.RatingChangeMatch},
+			ratingEvent{key: p2Key, rating: newP2Rating, matchId: match.MatchId, reason: db.RatingChangeMatch})
+	}
+	catchUp(time.Time{}, true)
+	return finalRatings, events
+}
+
+/*
+	replayTeamMatch rates a 2v2 match the same way reporting it did, see ratings.ComputeNewTeamRatings.
+*/
+func replayTeamMatch(ratingSystem ratings.RatingSystem, finalRatings map[ratingKey]ratings.PlayerRating, match db.Match) (events []ratingEvent) {
+	var keys []ratingKey
+	var currentRatings []ratings.PlayerRating
+	// PlayerIds is P1's side first.
+	for _, v := range match.PlayerIds() {
+		key := ratingKey{userId: v, mode: match.GameMode}
+		keys = append(keys, key)
+		currentRatings = append(currentRatings, finalRatings[key])
+	}
+	newP1Side, newP2Side := ratings.ComputeNewTeamRatings(ratingSystem, currentRatings[:2], currentRatings[2:], db.P1Score(match.Winner), 1.0)
+	for i, v := range append(newP1Side, newP2Side...) {
+		finalRatings[keys[i]] = v
+		events = append(events, ratingEvent{key: keys[i], rating: v, matchId: match.MatchId, reason: db.RatingChangeMatch})
+	}
+	return events
+}
+
+func absInt(i int) int {
+	if i < 0 {
+		return -i
+	}
+	return i
+}
@@ -0,0 +1,148 @@
+package replay
+
+import (
+	"discordbot/internal/app/ratings"
+	"discordbot/internal/db"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestReplayMatches(t *testing.T) {
+	users := []db.User{{UserId: 1}, {UserId: 2}, {UserId: 3}}
+	now := time.Now()
+	matches := []db.Match{
+		{MatchId: 10, CreatedAt: now, GameMode: db.Bo3, P1UserId: 1, P2UserId: 2, Winner: db.P1},
+		{MatchId: 11, CreatedAt: now, GameMode: db.Bo3, P1UserId: 3, P2UserId: 1, Winner: db.P2},
+		{MatchId: 12, CreatedAt: now, GameMode: db.Bo1, P1UserId: 2, P2UserId: 3, Winner: db.P1},
+	}
+
+	finalRatings, events := replayMatches(ratings.NewElo(), users, matches, map[int][]db.MatchGame{}, []db.Season{}, nil)
+
+	// Everyone is provisional so each result is worth 32 points between equals and a bit less once ratings diverge.
+	assert.Equal(t, 1261, finalRatings[ratingKey{userId: 1, mode: db.Bo3}].Rating)
+	assert.Equal(t, 1168, finalRatings[ratingKey{userId: 2, mode: db.Bo3}].Rating)
+	assert.Equal(t, 1170, finalRatings[ratingKey{userId: 3, mode: db.Bo3}].Rating)
+	assert.Equal(t, 1232, finalRatings[ratingKey{userId: 2, mode: db.Bo1}].Rating)
+	assert.Equal(t, 1168, finalRatings[ratingKey{userId: 3, mode: db.Bo1}].Rating)
+	assert.Equal(t, db.DEFAULT_RATING, finalRatings[ratingKey{userId: 1, mode: db.Bo1}].Rating)
+	assert.Equal(t, 2, finalRatings[ratingKey{userId: 1, mode: db.Bo3}].GamesPlayed)
+
+	assert.Len(t, events, 6)
+	assert.Equal(t, 10, events[0].matchId)
+	assert.Equal(t, 12, events[5].matchId)
+}
+
+func TestReplayMatchesMarginOfVictory(t *testing.T) {
+	t.Setenv("RATING_MARGIN_OF_VICTORY", "true")
+	users := []db.User{{UserId: 1}, {UserId: 2}}
+	matches := []db.Match{
+		{MatchId: 10, CreatedAt: time.Now(), GameMode: db.Bo3, P1UserId: 1, P2UserId: 2, Winner: db.P2},
+	}
+	gamesByMatch := map[int][]db.MatchGame{
+		10: {{MatchId: 10, GameNumber: 1, Winner: db.P2}, {MatchId: 10, GameNumber: 2, Winner: db.P2}},
+	}
+
+	finalRatings, _ := replayMatches(ratings.NewElo(), users, matches, gamesByMatch, []db.Season{}, nil)
+
+	// A 2-0 sweep is worth 25% more than the usual 32 points.
+	assert.Equal(t, 1160, finalRatings[ratingKey{userId: 1, mode: db.Bo3}].Rating)
+	assert.Equal(t, 1240, finalRatings[ratingKey{userId: 2, mode: db.Bo3}].Rating)
+}
+
+func TestReplayMatchesSeasonReset(t *testing.T) {
+	users := []db.User{{UserId: 1}, {UserId: 2}}
+	now := time.Now()
+	matches := []db.Match{
+		{MatchId: 10, CreatedAt: now.AddDate(0, 0, -2), GameMode: db.Bo3, P1UserId: 1, P2UserId: 2, Winner: db.P1},
+		{MatchId: 11, CreatedAt: now, GameMode: db.Bo3, P1UserId: 1, P2UserId: 2, Winner: db.P1},
+	}
+	allSeasons := []db.Season{{SeasonId: 1, StartedAt: now.AddDate(0, 0, -1), SoftResetFactor: 0.5}}
+
+	finalRatings, events := replayMatches(ratings.NewElo(), users, matches, map[int][]db.MatchGame{}, allSeasons, nil)
+
+	// 1232/1168 after the first match, halved back to 1216/1184 by the season start, then the second match.
+	assert.Len(t, events, 6)
+	assert.Equal(t, db.RatingChangeSeasonReset, events[2].reason)
+	assert.Equal(t, 1216, events[2].rating.Rating)
+	assert.Equal(t, 1184, events[3].rating.Rating)
+	assert.Equal(t, 11, events[4].matchId)
+	assert.Equal(t, 1245, finalRatings[ratingKey{userId: 1, mode: db.Bo3}].Rating)
+	assert.Equal(t, 1154, finalRatings[ratingKey{userId: 2, mode: db.Bo3}].Rating)
+	assert.Equal(t, db.DEFAULT_RATING, finalRatings[ratingKey{userId: 1, mode: db.Bo1}].Rating)
+}
+
+func TestReplayMatchesDecay(t *testing.T) {
+	users := []db.User{{UserId: 1}, {UserId: 2}}
+	now := time.Now()
+	matches := []db.Match{
+		{MatchId: 10, CreatedAt: now.AddDate(0, 0, -90), GameMode: db.Bo3, P1UserId: 1, P2UserId: 2, Winner: db.P1},
+		{MatchId: 11, CreatedAt: now, GameMode: db.Bo3, P1UserId: 1, P2UserId: 2, Winner: db.P1},
+	}
+	allSeasons := []db.Season{{SeasonId: 1, StartedAt: now.AddDate(0, 0, -30), SoftResetFactor: 0.5}}
+	decays := []db.RatingDecay{
+		{UserId: 1, GameMode: db.Bo3, Points: 25, DecayedAt: now.AddDate(0, 0, -60)},
+		// The loser is already below the floor, so was never really decayed.
+		{UserId: 2, GameMode: db.Bo3, Points: 25, DecayedAt: now.AddDate(0, 0, -60)},
+		// Only down to the floor once the season reset has landed.
+		{UserId: 1, GameMode: db.Bo3, Points: 25, DecayedAt: now.AddDate(0, 0, -1)},
+	}
+
+	finalRatings, events := replayMatches(ratings.NewElo(), users, matches, map[int][]db.MatchGame{}, allSeasons, decays)
+
+	// 1232 after the first match, 1207 after the decay, halved back to 1203 by the season start and then floored.
+	assert.Len(t, events, 8)
+	assert.Equal(t, db.RatingChangeDecay, events[2].reason)
+	assert.Equal(t, 1207, events[2].rating.Rating)
+	assert.Equal(t, decays[0].DecayedAt, events[2].decayedAt)
+	assert.Equal(t, db.RatingChangeSeasonReset, events[3].reason)
+	assert.Equal(t, 1203, events[3].rating.Rating)
+	assert.Equal(t, 1184, events[4].rating.Rating)
+	assert.Equal(t, db.RatingChangeDecay, events[5].reason)
+	assert.Equal(t, 1200, events[5].rating.Rating)
+	assert.Equal(t, 11, events[6].matchId)
+	assert.Equal(t, 1230, finalRatings[ratingKey{userId: 1, mode: db.Bo3}].Rating)
+}
+
+func TestReplayMatchesDraw(t *testing.T) {
+	users := []db.User{{UserId: 1}, {UserId: 2}}
+	now := time.Now()
+	matches := []db.Match{
+		{MatchId: 10, CreatedAt: now, GameMode: db.Bo1, P1UserId: 1, P2UserId: 2, Winner: db.P1},
+		{MatchId: 11, CreatedAt: now, GameMode: db.Bo1, P1UserId: 1, P2UserId: 2, Winner: db.Draw},
+	}
+
+	finalRatings, _ := replayMatches(ratings.NewElo(), users, matches, map[int][]db.MatchGame{}, []db.Season{}, nil)
+
+	// 1232/1168 after the win, then the favourite gives back some of it in the draw.
+	assert.Equal(t, 1226, finalRatings[ratingKey{userId: 1, mode: db.Bo1}].Rating)
+	assert.Equal(t, 1173, finalRatings[ratingKey{userId: 2, mode: db.Bo1}].Rating)
+}
+
+func TestReplayMatchesTeam(t *testing.T) {
+	users := []db.User{{UserId: 1}, {UserId: 2}, {UserId: 3}, {UserId: 4}}
+	matches := []db.Match{
+		{MatchId: 10, CreatedAt: time.Now(), GameMode: db.Team2v2, P1UserId: 1, P1PartnerUserId: 2, P2UserId: 3, P2PartnerUserId: 4, Winner: db.P2},
+	}
+
+	finalRatings, events := replayMatches(ratings.NewElo(), users, matches, map[int][]db.MatchGame{}, []db.Season{}, nil)
+
+	// Partners move together and the 1v1 ladders are untouched.
+	assert.Equal(t, 1168, finalRatings[ratingKey{userId: 1, mode: db.Team2v2}].Rating)
+	assert.Equal(t, 1168, finalRatings[ratingKey{userId: 2, mode: db.Team2v2}].Rating)
+	assert.Equal(t, 1232, finalRatings[ratingKey{userId: 3, mode: db.Team2v2}].Rating)
+	assert.Equal(t, 1232, finalRatings[ratingKey{userId: 4, mode: db.Team2v2}].Rating)
+	assert.Equal(t, db.DEFAULT_RATING, finalRatings[ratingKey{userId: 1, mode: db.Bo1}].Rating)
+	assert.Len(t, events, 4)
+}
+
+func TestOptionsRatingSystem(t *testing.T) {
+	elo := Options{RatingSystem: ratings.EloSystemName, K: 20}.ratingSystem().(ratings.Elo)
+	assert.Equal(t, 20.0, elo.K)
+	assert.Equal(t, ratings.ProvisionalK, elo.ProvisionalK)
+
+	glicko := Options{RatingSystem: ratings.Glicko2SystemName, K: 20}.ratingSystem()
+	assert.Equal(t, ratings.Glicko2SystemName, glicko.Name())
+
+	assert.Equal(t, ratings.EloSystemName, Options{}.ratingSystem().Name())
+}
@@ -0,0 +1,102 @@
+package seasons
+
+import (
+	"discordbot/internal/app/ratings"
+	"discordbot/internal/db"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"time"
+)
+
+// DefaultSoftResetFactor pulls every rating halfway back to the default when a season opens.
+const DefaultSoftResetFactor = 0.5
+
+/*
+	OpenSeason
+	Starts a new season and soft resets every rating on every ladder toward the default by resetFactor, where 0 leaves
+	ratings alone and 1 puts everyone back to the default. Only one season can be open at a time.
+*/
+func OpenSeason(conn *gorm.DB, name string, resetFactor float64, now time.Time) (success bool, message string) {
+	if resetFactor < 0 || resetFactor > 1 {
+		return false, "Soft reset factor must be between 0 and 1."
+	}
+
+	err := conn.Transaction(func(tx *gorm.DB) error {
+		// Checked under lock, so two admins opening a season at once can't both see none open.
+		foundSeason, currentSeason := db.LockCurrentSeason(tx)
+		if foundSeason {
+			message = fmt.Sprintf("Season %s is still open, close it before opening a new one.", currentSeason.Name)
+			return nil
+		}
+		success = db.CreateSeason(tx, db.Season{Name: name, StartedAt: now, SoftResetFactor: resetFactor})
+		if !success {
+			return errors.New("unable to create season")
+		}
+		if resetFactor == 0 {
+			return nil
+		}
+		for _, user := range db.GetAllUsers(tx) {
+			for _, mode := range db.RatedGameModes {
+				currentRating := db.GetUserRating(tx, user.UserId, mode)
+				resetRating := SoftReset(currentRating, resetFactor)
+				if resetRating != currentRating {
+					db.ResetUserRating(tx, user.UserId, mode, resetRating)
+				}
+			}
+		}
+		return nil
+	})
+	if message != "" {
+		return false, message
+	}
+	if err != nil || !success {
+		return false, "Unable to open season."
+	}
+	return true, fmt.Sprintf("Season %s opened.", name)
+}
+
+/*
+	CloseSeason ends the open season and archives its final standings for every ladder.
+*/
+func CloseSeason(conn *gorm.DB, now time.Time) (success bool, message string) {
+	foundSeason, currentSeason := db.GetCurrentSeason(conn)
+	if !foundSeason {
+		return false, "There is no open season to close."
+	}
+
+	var standings []db.SeasonStanding
+	for _, mode := range db.RatedGameModes {
+		for i, v := range db.GetEloLeaderboard(conn, mode, currentSeason) {
+			standings = append(standings, db.SeasonStanding{
+				SeasonId:  currentSeason.SeasonId,
+				UserId:    v.User.UserId,
+				GameMode:  mode,
+				FinalRank: i + 1,
+				Rating:    v.Rating,
+				Wins:      v.Wins,
+				Losses:    v.Losses,
+				Draws:     v.Draws,
+			})
+		}
+	}
+
+	err := conn.Transaction(func(tx *gorm.DB) error {
+		success = db.ArchiveSeasonStandings(tx, currentSeason.SeasonId, standings) &&
+			db.EndSeason(tx, currentSeason.SeasonId, now)
+		return nil
+	})
+	if err != nil || !success {
+		return false, "Unable to close season."
+	}
+	return true, fmt.Sprintf("Season %s closed and standings archived.", currentSeason.Name)
+}
+
+/*
+	SoftReset moves a rating, and its Glicko-2 deviation, resetFactor of the way back to the defaults.
+*/
+func SoftReset(rating ratings.PlayerRating, resetFactor float64) ratings.PlayerRating {
+	rating.Rating = db.DEFAULT_RATING + int(float64(rating.Rating-db.DEFAULT_RATING)*(1-resetFactor))
+	rating.Deviation = rating.Deviation + (ratings.DefaultDeviation-rating.Deviation)*resetFactor
+	return rating
+}
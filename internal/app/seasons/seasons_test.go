@@ -0,0 +1,24 @@
+package seasons
+
+import (
+	"discordbot/internal/app/ratings"
+	"discordbot/internal/db"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestSoftReset(t *testing.T) {
+	rating := ratings.PlayerRating{Rating: 1600, Deviation: 50, Volatility: 0.06, GamesPlayed: 40}
+
+	halfway := SoftReset(rating, 0.5)
+	assert.Equal(t, 1400, halfway.Rating)
+	assert.Equal(t, 200.0, halfway.Deviation)
+	assert.Equal(t, 40, halfway.GamesPlayed)
+
+	assert.Equal(t, rating, SoftReset(rating, 0))
+	assert.Equal(t, db.DEFAULT_RATING, SoftReset(rating, 1).Rating)
+	assert.Equal(t, ratings.DefaultDeviation, SoftReset(rating, 1).Deviation)
+
+	// Ratings below the default are pulled up.
+	assert.Equal(t, 1100, SoftReset(ratings.PlayerRating{Rating: 1000}, 0.5).Rating)
+}
@@ -0,0 +1,182 @@
+package db
+
+import (
+	"database/sql"
+	"gorm.io/gorm"
+	"log"
+	"time"
+)
+
+type ChallengeState string
+
+const (
+	ChallengePending  ChallengeState = "pending"
+	ChallengeAccepted ChallengeState = "accepted"
+	ChallengeDeclined ChallengeState = "declined"
+	ChallengeExpired  ChallengeState = "expired"
+	// ChallengeLimited challenges were accepted after the pair had used up their challenge matches some other way.
+	ChallengeLimited ChallengeState = "limited"
+)
+
+/*
+	Challenge one player asking another for a rated match directly, rather than through the queue.
+*/
+type Challenge struct {
+	ChallengeId      int
+	ChallengerUserId int
+	ChallengedUserId int
+	GameMode         GameMode
+	ChallengeState   ChallengeState
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+	ExpiresAt        time.Time
+	// MatchId is 0 unless the challenge was accepted.
+	MatchId int
+}
+
+/*
+	CreateChallenge persists a pending challenge and returns it with its id.
+*/
+func CreateChallenge(conn *gorm.DB, challenge Challenge) (success bool, persisted Challenge) {
+	err := conn.Transaction(func(tx *gorm.DB) error {
+		tx.Exec(
+			"INSERT INTO challenges (challenger_user_id, challenged_user_id, game_mode, challenge_state, created_at, updated_at, expires_at) values (?, ?, ?, ?, ?, ?, ?)",
+			challenge.ChallengerUserId,
+			challenge.ChallengedUserId,
+			challenge.GameMode,
+			ChallengePending,
+			challenge.CreatedAt,
+			challenge.CreatedAt,
+			challenge.ExpiresAt)
+		if tx.Error != nil {
+			log.Println(tx.Error)
+			success = false
+			return nil
+		}
+		success, persisted = GetPendingChallenge(tx, challenge.ChallengerUserId, challenge.ChallengedUserId)
+		return nil
+	})
+	if err != nil {
+		log.Println(err)
+		return false, Challenge{}
+	}
+	return success, persisted
+}
+
+func GetChallenge(conn *gorm.DB, challengeId int) (foundChallenge bool, challenge Challenge) {
+	challenges := getChallenges(conn, "WHERE id = ?", challengeId)
+	if len(challenges) == 0 {
+		return false, challenge
+	}
+	return true, challenges[0]
+}
+
+/*
+	GetPendingChallenge the open challenge between the two players, whichever of them sent it.
+*/
+func GetPendingChallenge(conn *gorm.DB, userId int, otherUserId int) (foundChallenge bool, challenge Challenge) {
+	challenges := getChallenges(
+		conn,
+		"WHERE challenge_state = ? AND ((challenger_user_id = ? AND challenged_user_id = ?) OR (challenger_user_id = ? AND challenged_user_id = ?)) ORDER BY id DESC LIMIT 1",
+		ChallengePending,
+		userId,
+		otherUserId,
+		otherUserId,
+		userId)
+	if len(challenges) == 0 {
+		return false, challenge
+	}
+	return true, challenges[0]
+}
+
+/*
+	ResolveChallenge moves a pending challenge to its final state. Returns false if it was no longer pending, so only one
+	caller acts on it.
+*/
+func ResolveChallenge(conn *gorm.DB, challengeId int, state ChallengeState, matchId int, now time.Time) (resolved bool) {
+	var persistedMatchId interface{}
+	if matchId != 0 {
+		persistedMatchId = matchId
+	}
+	result := conn.Exec(
+		"UPDATE challenges SET challenge_state = ?, match_id = ?, updated_at = ? WHERE id = ? AND challenge_state = ?",
+		state,
+		persistedMatchId,
+		now,
+		challengeId,
+		ChallengePending)
+	if result.Error != nil {
+		log.Println(result.Error)
+		return false
+	}
+	return result.RowsAffected > 0
+}
+
+func FindExpiredChallenges(conn *gorm.DB, now time.Time) (challenges []Challenge) {
+	return getChallenges(conn, "WHERE challenge_state = ? AND expires_at <= ? ORDER BY expires_at ASC", ChallengePending, now)
+}
+
+/*
+	CountChallengeMatches how many accepted challenges the two players have had since, whichever of them sent them.
+*/
+func CountChallengeMatches(conn *gorm.DB, userId int, otherUserId int, since time.Time) (count int) {
+	conn.Raw(`
+		SELECT COUNT(*) FROM challenges
+		WHERE
+			challenge_state = ? AND
+			((challenger_user_id = ? AND challenged_user_id = ?) OR (challenger_user_id = ? AND challenged_user_id = ?)) AND
+			updated_at >= ?`,
+		ChallengeAccepted,
+		userId,
+		otherUserId,
+		otherUserId,
+		userId,
+		since).Scan(&count)
+	if conn.Error != nil {
+		panic(conn.Error)
+	}
+	return count
+}
+
+func getChallenges(conn *gorm.DB, clauses string, args ...interface{}) (challenges []Challenge) {
+	rows, err := conn.Raw(`
+		SELECT
+			id,
+			challenger_user_id,
+			challenged_user_id,
+			game_mode,
+			challenge_state,
+			created_at,
+			updated_at,
+			expires_at,
+			match_id
+		FROM challenges `+clauses, args...).Rows()
+	if err != nil {
+		panic(err)
+	}
+
+	if conn.Error != nil {
+		panic(conn.Error)
+	}
+
+	for rows.Next() {
+		challenge := Challenge{}
+		var matchId sql.NullInt64
+		err := rows.Scan(
+			&challenge.ChallengeId,
+			&challenge.ChallengerUserId,
+			&challenge.ChallengedUserId,
+			&challenge.GameMode,
+			&challenge.ChallengeState,
+			&challenge.CreatedAt,
+			&challenge.UpdatedAt,
+			&challenge.ExpiresAt,
+			&matchId)
+		if err != nil {
+			panic(err)
+		}
+		challenge.MatchId = int(matchId.Int64)
+		challenges = append(challenges, challenge)
+	}
+	return challenges
+}
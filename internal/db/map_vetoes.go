@@ -0,0 +1,185 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"gorm.io/gorm"
+	"log"
+	"time"
+)
+
+/*
+	MapVeto
+	P1 and P2 taking turns to ban maps from their game mode's pool, P1 first, until each has banned BansPerPlayer. The
+	match is then played on MapsNeeded of the maps left, in pool order.
+*/
+type MapVeto struct {
+	MapVetoId     int
+	MatchId       int
+	Pool          []string
+	MapsNeeded    int
+	BansPerPlayer int
+	// Bans are in the order they were made.
+	Bans      []string
+	Version   int
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	// ExpiresAt is when the player whose turn it is runs out of time to ban.
+	ExpiresAt time.Time
+	// ResolvedAt is zero until the maps are decided.
+	ResolvedAt time.Time
+}
+
+func (v MapVeto) IsResolved() bool {
+	return !v.ResolvedAt.IsZero()
+}
+
+/*
+	IsComplete whether both players have made all their bans.
+*/
+func (v MapVeto) IsComplete() bool {
+	return len(v.Bans) >= 2*v.BansPerPlayer
+}
+
+func (v MapVeto) P1BansNext() bool {
+	return len(v.Bans)%2 == 0
+}
+
+/*
+	RemainingMaps the pool without the maps banned so far, in pool order.
+*/
+func (v MapVeto) RemainingMaps() (maps []string) {
+	for _, pooled := range v.Pool {
+		if !v.IsBanned(pooled) {
+			maps = append(maps, pooled)
+		}
+	}
+	return maps
+}
+
+func (v MapVeto) IsBanned(mapName string) bool {
+	for _, banned := range v.Bans {
+		if banned == mapName {
+			return true
+		}
+	}
+	return false
+}
+
+func CreateMapVeto(conn *gorm.DB, veto MapVeto) (success bool) {
+	result := conn.Exec(
+		"INSERT INTO map_vetoes (match_id, pool, maps_needed, bans_per_player, bans, created_at, updated_at, expires_at) values (?, ?, ?, ?, ?, ?, ?, ?)",
+		veto.MatchId,
+		serializeList(veto.Pool),
+		veto.MapsNeeded,
+		veto.BansPerPlayer,
+		serializeList(veto.Bans),
+		veto.CreatedAt,
+		veto.UpdatedAt,
+		veto.ExpiresAt)
+	if result.Error != nil {
+		log.Println(result.Error)
+		return false
+	}
+	return true
+}
+
+func GetMapVeto(conn *gorm.DB, matchId int) (foundVeto bool, veto MapVeto) {
+	vetoes := getMapVetoes(conn, "WHERE match_id = ?", matchId)
+	if len(vetoes) == 0 {
+		return false, veto
+	}
+	return true, vetoes[0]
+}
+
+/*
+	AddMapVetoBan saves the veto's bans and the next player's deadline, provided nobody else has banned since it was
+	read and it's still open.
+*/
+func AddMapVetoBan(conn *gorm.DB, veto MapVeto, now time.Time) (updated bool) {
+	result := conn.Exec(
+		"UPDATE map_vetoes SET bans = ?, expires_at = ?, version = version + 1, updated_at = ? WHERE id = ? AND version = ? AND resolved_at IS NULL",
+		serializeList(veto.Bans),
+		veto.ExpiresAt,
+		now,
+		veto.MapVetoId,
+		veto.Version)
+	if result.Error != nil {
+		log.Println(result.Error)
+		return false
+	}
+	return result.RowsAffected > 0
+}
+
+/*
+	ResolveMapVeto closes the veto. Returns false if it was already closed, so only one caller assigns the maps.
+*/
+func ResolveMapVeto(conn *gorm.DB, matchId int, resolvedAt time.Time) (resolved bool) {
+	result := conn.Exec("UPDATE map_vetoes SET resolved_at = ? WHERE match_id = ? AND resolved_at IS NULL", resolvedAt, matchId)
+	if result.Error != nil {
+		log.Println(result.Error)
+		return false
+	}
+	return result.RowsAffected > 0
+}
+
+/*
+	FindExpiredMapVetoes open vetoes where the player whose turn it is ran out of time.
+*/
+func FindExpiredMapVetoes(conn *gorm.DB, now time.Time) (vetoes []MapVeto) {
+	return getMapVetoes(conn, "WHERE resolved_at IS NULL AND expires_at <= ? ORDER BY expires_at ASC", now)
+}
+
+func getMapVetoes(conn *gorm.DB, clauses string, args ...interface{}) (vetoes []MapVeto) {
+	rows, err := conn.Raw(`
+		SELECT
+			id,
+			match_id,
+			pool,
+			maps_needed,
+			bans_per_player,
+			bans,
+			version,
+			created_at,
+			updated_at,
+			expires_at,
+			resolved_at
+		FROM map_vetoes `+clauses, args...).Rows()
+	if err != nil {
+		panic(err)
+	}
+
+	if conn.Error != nil {
+		panic(conn.Error)
+	}
+
+	for rows.Next() {
+		veto := MapVeto{}
+		var pool, bans []byte
+		var resolvedAt sql.NullTime
+		err := rows.Scan(
+			&veto.MapVetoId,
+			&veto.MatchId,
+			&pool,
+			&veto.MapsNeeded,
+			&veto.BansPerPlayer,
+			&bans,
+			&veto.Version,
+			&veto.CreatedAt,
+			&veto.UpdatedAt,
+			&veto.ExpiresAt,
+			&resolvedAt)
+		if err != nil {
+			panic(err)
+		}
+		if err := json.Unmarshal(pool, &veto.Pool); err != nil {
+			panic(err)
+		}
+		if err := json.Unmarshal(bans, &veto.Bans); err != nil {
+			panic(err)
+		}
+		veto.ResolvedAt = resolvedAt.Time
+		vetoes = append(vetoes, veto)
+	}
+	return vetoes
+}
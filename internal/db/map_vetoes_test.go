@@ -0,0 +1,63 @@
+package db
+
+import (
+	"fmt"
+	"github.com/go-playground/assert/v2"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestMapVetoTurns(t *testing.T) {
+	veto := MapVeto{Pool: []string{"a", "b", "c", "d", "e"}, MapsNeeded: 1, BansPerPlayer: 2}
+	var turns []bool
+	for !veto.IsComplete() {
+		turns = append(turns, veto.P1BansNext())
+		veto.Bans = append(veto.Bans, veto.RemainingMaps()[len(veto.RemainingMaps())-1])
+	}
+	assert.Equal(t, turns, []bool{true, false, true, false})
+	assert.Equal(t, veto.RemainingMaps(), []string{"a"})
+	assert.Equal(t, veto.IsBanned("e"), true)
+	assert.Equal(t, veto.IsBanned("a"), false)
+}
+
+func TestMapVetoes(t *testing.T) {
+	conn := GetGorm(GetTestMysSQLConnStr())
+	rand.Seed(time.Now().UnixNano())
+
+	p1 := createRatedUser(conn, fmt.Sprintf("somediscordId%d", rand.Intn(1000000)), fmt.Sprintf("coolsk8r1990%d", rand.Intn(1000000)), 1000)
+	p2 := createRatedUser(conn, fmt.Sprintf("somediscordId%d", rand.Intn(1000000)), fmt.Sprintf("coolsk8r1990%d", rand.Intn(1000000)), 1000)
+	now := time.Now().Truncate(time.Second)
+	assert.Equal(t, CreateMatch(conn, Match{CreatedAt: now, UpdatedAt: now, MatchState: Matched, GameMode: Bo1, P1UserId: p1.UserId, P2UserId: p2.UserId, Winner: Undefined}), true)
+	_, match := GetCurrentMatch(conn, p1.UserId)
+
+	veto := MapVeto{MatchId: match.MatchId, Pool: []string{"a", "b", "c"}, MapsNeeded: 1, BansPerPlayer: 1, CreatedAt: now, UpdatedAt: now, ExpiresAt: now.Add(5 * time.Minute)}
+	assert.Equal(t, CreateMapVeto(conn, veto), true)
+	assert.Equal(t, CreateMapVeto(conn, veto), false)
+	found, veto := GetMapVeto(conn, match.MatchId)
+	assert.Equal(t, found, true)
+	assert.Equal(t, veto.Pool, []string{"a", "b", "c"})
+	assert.Equal(t, len(veto.Bans), 0)
+
+	veto.Bans = append(veto.Bans, "b")
+	veto.ExpiresAt = now.Add(10 * time.Minute)
+	assert.Equal(t, AddMapVetoBan(conn, veto, now), true)
+	// A second ban made from the same read loses.
+	assert.Equal(t, AddMapVetoBan(conn, veto, now), false)
+	_, saved := GetMapVeto(conn, match.MatchId)
+	assert.Equal(t, saved.Bans, []string{"b"})
+	assert.Equal(t, saved.ExpiresAt.Unix(), now.Add(10*time.Minute).Unix())
+
+	expired := false
+	for _, v := range FindExpiredMapVetoes(conn, now.Add(10*time.Minute)) {
+		expired = expired || v.MatchId == match.MatchId
+	}
+	assert.Equal(t, expired, true)
+
+	assert.Equal(t, ResolveMapVeto(conn, match.MatchId, now), true)
+	assert.Equal(t, ResolveMapVeto(conn, match.MatchId, now), false)
+	saved.Bans = append(saved.Bans, "c")
+	assert.Equal(t, AddMapVetoBan(conn, saved, now), false)
+	_, saved = GetMapVeto(conn, match.MatchId)
+	assert.Equal(t, saved.IsResolved(), true)
+}
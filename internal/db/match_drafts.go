@@ -0,0 +1,219 @@
+package db
+
+import (
+	"encoding/json"
+	"gorm.io/gorm"
+	"log"
+	"time"
+)
+
+// DraftPicks is how many factions each player blind picks, giving DraftPicks * DraftPicks matchups to ban from.
+const DraftPicks = 3
+
+// draftBanOrder says for each ban whether the player banning first makes it - 1-2-2-2-1 leaves one of nine matchups.
+var draftBanOrder = []bool{true, false, false, true, true, false, false, true}
+
+/*
+	MatchDraft
+	Picks and bans for one game of a match. Both players blind pick DraftPicks factions, then take turns banning matchups
+	of one player's pick against the other's until only the game's matchup is left.
+*/
+type MatchDraft struct {
+	MatchDraftId int
+	MatchId      int
+	GameNumber   int
+	P1Picks      []string
+	P2Picks      []string
+	// Bans are in the order they were made.
+	Bans        []Matchup
+	P1BansFirst bool
+	// Winner is Undefined until a player says who won the drafted game.
+	Winner    WhoWon
+	Version   int
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+/*
+	PicksDone whether both players have blind picked, so the picks can be shown and banning can start.
+*/
+func (d MatchDraft) PicksDone() bool {
+	return len(d.P1Picks) == DraftPicks && len(d.P2Picks) == DraftPicks
+}
+
+/*
+	IsComplete whether only one matchup is left.
+*/
+func (d MatchDraft) IsComplete() bool {
+	return d.PicksDone() && len(d.Bans) == len(draftBanOrder)
+}
+
+/*
+	P1BansNext whether the next ban is P1's. Only meaningful while the draft is banning.
+*/
+func (d MatchDraft) P1BansNext() bool {
+	if len(d.Bans) >= len(draftBanOrder) {
+		return false
+	}
+	return draftBanOrder[len(d.Bans)] == d.P1BansFirst
+}
+
+/*
+	BansLeftInTurn how many bans the player banning now makes before it's their opponent's turn.
+*/
+func (d MatchDraft) BansLeftInTurn() (bans int) {
+	for i := len(d.Bans); i < len(draftBanOrder) && draftBanOrder[i] == draftBanOrder[len(d.Bans)]; i++ {
+		bans++
+	}
+	return bans
+}
+
+/*
+	RemainingMatchups every pairing of P1's picks against P2's that hasn't been banned, P1's picks in order.
+*/
+func (d MatchDraft) RemainingMatchups() (matchups []Matchup) {
+	for _, p1Faction := range d.P1Picks {
+		for _, p2Faction := range d.P2Picks {
+			matchup := Matchup{P1Faction: p1Faction, P2Faction: p2Faction}
+			if !d.IsBanned(matchup) {
+				matchups = append(matchups, matchup)
+			}
+		}
+	}
+	return matchups
+}
+
+func (d MatchDraft) IsBanned(matchup Matchup) bool {
+	for _, v := range d.Bans {
+		if v == matchup {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+	CreateMatchDraft starts the draft for a game. Returns false if that game already has one.
+*/
+func CreateMatchDraft(conn *gorm.DB, draft MatchDraft) (success bool) {
+	result := conn.Exec(
+		"INSERT INTO match_drafts (match_id, game_number, p1_picks, p2_picks, bans, p1_bans_first, winner, created_at, updated_at) values (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		draft.MatchId,
+		draft.GameNumber,
+		serializeList(draft.P1Picks),
+		serializeList(draft.P2Picks),
+		serializeList(draft.Bans),
+		draft.P1BansFirst,
+		draft.Winner,
+		draft.CreatedAt,
+		draft.UpdatedAt)
+	if result.Error != nil {
+		log.Println(result.Error)
+		return false
+	}
+	return true
+}
+
+func GetMatchDraft(conn *gorm.DB, matchDraftId int) (foundDraft bool, draft MatchDraft) {
+	drafts := getMatchDrafts(conn, "WHERE id = ?", matchDraftId)
+	if len(drafts) == 0 {
+		return false, draft
+	}
+	return true, drafts[0]
+}
+
+/*
+	GetMatchDrafts every draft for a match so far, in game order.
+*/
+func GetMatchDrafts(conn *gorm.DB, matchId int) (drafts []MatchDraft) {
+	return getMatchDrafts(conn, "WHERE match_id = ? ORDER BY game_number ASC", matchId)
+}
+
+/*
+	UpdateMatchDraft saves the draft's picks, bans and winner, provided nobody else has changed it since it was read.
+	Returns false if they have, in which case the caller should read it again and retry.
+*/
+func UpdateMatchDraft(conn *gorm.DB, draft MatchDraft, now time.Time) (updated bool) {
+	result := conn.Exec(
+		"UPDATE match_drafts SET p1_picks = ?, p2_picks = ?, bans = ?, winner = ?, version = version + 1, updated_at = ? WHERE id = ? AND version = ?",
+		serializeList(draft.P1Picks),
+		serializeList(draft.P2Picks),
+		serializeList(draft.Bans),
+		draft.Winner,
+		now,
+		draft.MatchDraftId,
+		draft.Version)
+	if result.Error != nil {
+		log.Println(result.Error)
+		return false
+	}
+	return result.RowsAffected > 0
+}
+
+/*
+	serializeList stores a list that starts out empty, like a draft's picks, as [] rather than null.
+*/
+func serializeList(list interface{}) (serialized []byte) {
+	serialized, err := json.Marshal(list)
+	if err != nil {
+		panic(err)
+	}
+	if string(serialized) == "null" {
+		return []byte("[]")
+	}
+	return serialized
+}
+
+func getMatchDrafts(conn *gorm.DB, clauses string, args ...interface{}) (drafts []MatchDraft) {
+	rows, err := conn.Raw(`
+		SELECT
+			id,
+			match_id,
+			game_number,
+			p1_picks,
+			p2_picks,
+			bans,
+			p1_bans_first,
+			winner,
+			version,
+			created_at,
+			updated_at
+		FROM match_drafts `+clauses, args...).Rows()
+	if err != nil {
+		panic(err)
+	}
+
+	if conn.Error != nil {
+		panic(conn.Error)
+	}
+
+	for rows.Next() {
+		draft := MatchDraft{}
+		var p1Picks, p2Picks, bans []byte
+		err := rows.Scan(
+			&draft.MatchDraftId,
+			&draft.MatchId,
+			&draft.GameNumber,
+			&p1Picks,
+			&p2Picks,
+			&bans,
+			&draft.P1BansFirst,
+			&draft.Winner,
+			&draft.Version,
+			&draft.CreatedAt,
+			&draft.UpdatedAt)
+		if err != nil {
+			panic(err)
+		}
+		for _, v := range []struct {
+			serialized []byte
+			into       interface{}
+		}{{p1Picks, &draft.P1Picks}, {p2Picks, &draft.P2Picks}, {bans, &draft.Bans}} {
+			if err := json.Unmarshal(v.serialized, v.into); err != nil {
+				panic(err)
+			}
+		}
+		drafts = append(drafts, draft)
+	}
+	return drafts
+}
@@ -0,0 +1,67 @@
+package db
+
+import (
+	"fmt"
+	"github.com/go-playground/assert/v2"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestMatchDraftBanOrder(t *testing.T) {
+	draft := MatchDraft{P1Picks: []string{"a", "b", "c"}, P2Picks: []string{"d", "e", "f"}, P1BansFirst: true}
+	assert.Equal(t, draft.PicksDone(), true)
+	assert.Equal(t, len(draft.RemainingMatchups()), 9)
+
+	var turns []bool
+	var turnLengths []int
+	for !draft.IsComplete() {
+		turns = append(turns, draft.P1BansNext())
+		turnLengths = append(turnLengths, draft.BansLeftInTurn())
+		draft.Bans = append(draft.Bans, draft.RemainingMatchups()[0])
+	}
+	assert.Equal(t, turns, []bool{true, false, false, true, true, false, false, true})
+	assert.Equal(t, turnLengths, []int{1, 2, 1, 2, 1, 2, 1, 1})
+	assert.Equal(t, draft.RemainingMatchups(), []Matchup{{P1Faction: "c", P2Faction: "f"}})
+
+	// Whoever bans first bans last too.
+	draft.P1BansFirst = false
+	draft.Bans = nil
+	assert.Equal(t, draft.P1BansNext(), false)
+	assert.Equal(t, draft.IsComplete(), false)
+}
+
+func TestMatchDrafts(t *testing.T) {
+	conn := GetGorm(GetTestMysSQLConnStr())
+	rand.Seed(time.Now().UnixNano())
+
+	p1 := createRatedUser(conn, fmt.Sprintf("somediscordId%d", rand.Intn(1000000)), fmt.Sprintf("coolsk8r1990%d", rand.Intn(1000000)), 1000)
+	p2 := createRatedUser(conn, fmt.Sprintf("somediscordId%d", rand.Intn(1000000)), fmt.Sprintf("coolsk8r1990%d", rand.Intn(1000000)), 1000)
+	now := time.Now().Truncate(time.Second)
+	assert.Equal(t, CreateMatch(conn, Match{CreatedAt: now, UpdatedAt: now, MatchState: Matched, GameMode: Bo3, P1UserId: p1.UserId, P2UserId: p2.UserId, Winner: Undefined}), true)
+	_, match := GetCurrentMatch(conn, p1.UserId)
+
+	draft := MatchDraft{MatchId: match.MatchId, GameNumber: 1, P1BansFirst: true, Winner: Undefined, CreatedAt: now, UpdatedAt: now}
+	assert.Equal(t, CreateMatchDraft(conn, draft), true)
+	assert.Equal(t, CreateMatchDraft(conn, draft), false)
+	drafts := GetMatchDrafts(conn, match.MatchId)
+	assert.Equal(t, len(drafts), 1)
+	assert.Equal(t, len(drafts[0].P1Picks), 0)
+	assert.Equal(t, drafts[0].P1BansFirst, true)
+
+	first := drafts[0]
+	first.P1Picks = []string{"a", "b", "c"}
+	first.P2Picks = []string{"d", "e", "f"}
+	first.Bans = []Matchup{{P1Faction: "a", P2Faction: "d"}}
+	assert.Equal(t, UpdateMatchDraft(conn, first, now), true)
+	// A second change made from the same read loses.
+	assert.Equal(t, UpdateMatchDraft(conn, first, now), false)
+	_, saved := GetMatchDraft(conn, first.MatchDraftId)
+	assert.Equal(t, saved.P2Picks, first.P2Picks)
+	assert.Equal(t, saved.Bans, first.Bans)
+	assert.Equal(t, saved.Version, first.Version+1)
+
+	assert.Equal(t, SetMatchMatchups(conn, match.MatchId, []Matchup{{P1Faction: "c", P2Faction: "f"}}), true)
+	_, match = GetMatchById(conn, match.MatchId)
+	assert.Equal(t, match.Matchups, []Matchup{{P1Faction: "c", P2Faction: "f"}})
+}
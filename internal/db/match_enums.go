@@ -1,6 +1,7 @@
 package db
 
 import (
+	"discordbot/internal/app/ratings"
 	"fmt"
 	"log"
 )
@@ -19,8 +20,41 @@ const (
 	Bo1 GameMode = "bo1"
 	Bo3 GameMode = "bo3"
 	All GameMode = "all"
+	// Team2v2 is played by two teams of two, queued for with /queue-2v2 rather than /queue.
+	Team2v2 GameMode = "2v2"
 )
 
+// RatedGameModes each have their own independent ladder. All is only a queue preference, never a rating.
+var RatedGameModes = []GameMode{Bo1, Bo3, Team2v2}
+
+func IsRatedGameMode(gameMode GameMode) bool {
+	for _, v := range RatedGameModes {
+		if v == gameMode {
+			return true
+		}
+	}
+	return false
+}
+
+// SoloGameModes are the 1v1 ladders, the ones a request for All can end up playing.
+var SoloGameModes = []GameMode{Bo1, Bo3}
+
+// AllVsAllGameMode is what two players who both queued for all end up playing.
+const AllVsAllGameMode = Bo3
+
+/*
+	ResolveGameMode the game mode two requests would be played in - the specific mode if either asked for one, or
+	AllVsAllGameMode if both were happy with anything. This is also the ladder whose ratings get compared when pairing.
+*/
+func ResolveGameMode(requested GameMode, opponentRequested GameMode) GameMode {
+	if requested == All && opponentRequested == All {
+		return AllVsAllGameMode
+	} else if requested == All {
+		return opponentRequested
+	}
+	return requested
+}
+
 func ToInt(gameMode GameMode) int {
 	switch gameMode {
 	case Bo1:
@@ -29,6 +63,8 @@ func ToInt(gameMode GameMode) int {
 		return 2
 	case All:
 		return 3
+	case Team2v2:
+		return 4
 	default:
 		log.Panicf("Unrecognized game mode: %v", gameMode)
 		return -1
@@ -43,6 +79,8 @@ func FromInt(intMode int) GameMode {
 		return Bo3
 	case 3:
 		return All
+	case 4:
+		return Team2v2
 	default:
 		panic(fmt.Sprintf("Unrecognized game mode int: %d", intMode))
 	}
@@ -53,5 +91,20 @@ type WhoWon string
 const (
 	P1        WhoWon = "p1"
 	P2        WhoWon = "p2"
+	Draw      WhoWon = "dr"
 	Undefined WhoWon = ""
 )
+
+/*
+	P1Score the rating score p1 earned from a completed match's result.
+*/
+func P1Score(winner WhoWon) float64 {
+	switch winner {
+	case P1:
+		return ratings.WinScore
+	case Draw:
+		return ratings.DrawScore
+	default:
+		return ratings.LossScore
+	}
+}
@@ -0,0 +1,134 @@
+package db
+
+import (
+	"gorm.io/gorm"
+	"log"
+	"time"
+)
+
+/*
+	MatchGame one game inside a match. Only recorded when players report a series score, so most bo1 matches and any
+	bo3 reported without a score have none.
+*/
+type MatchGame struct {
+	MatchGameId int
+	MatchId     int
+	GameNumber  int
+	Winner      WhoWon
+	MapName     string
+	CreatedAt   time.Time
+}
+
+/*
+	ReplaceMatchGames swaps out the recorded games for a match, since re-reporting a match overwrites the old result.
+	Passing no games just clears them.
+*/
+func ReplaceMatchGames(conn *gorm.DB, matchId int, games []MatchGame) (success bool) {
+	err := conn.Transaction(func(tx *gorm.DB) error {
+		tx.Exec("DELETE FROM match_games WHERE match_id = ?", matchId)
+		if tx.Error != nil {
+			log.Println(tx.Error)
+			success = false
+			return nil
+		}
+		createdAt := time.Now()
+		for _, v := range games {
+			tx.Exec(
+				"INSERT INTO match_games (match_id, game_number, winner, map_name, created_at) values (?, ?, ?, ?, ?)",
+				matchId,
+				v.GameNumber,
+				v.Winner,
+				v.MapName,
+				createdAt)
+			if tx.Error != nil {
+				log.Println(tx.Error)
+				success = false
+				return nil
+			}
+		}
+		success = true
+		return nil
+	})
+	if err != nil {
+		log.Println(err)
+		return false
+	}
+	return success
+}
+
+func GetMatchGames(conn *gorm.DB, matchId int) (games []MatchGame) {
+	return getMatchGames(conn, "WHERE match_id = ?", matchId)
+}
+
+/*
+	GetAllMatchGames every recorded game keyed by match id, for bulk work like replaying ratings.
+*/
+func GetAllMatchGames(conn *gorm.DB) (gamesByMatch map[int][]MatchGame) {
+	gamesByMatch = map[int][]MatchGame{}
+	for _, v := range getMatchGames(conn, "") {
+		gamesByMatch[v.MatchId] = append(gamesByMatch[v.MatchId], v)
+	}
+	return gamesByMatch
+}
+
+func getMatchGames(conn *gorm.DB, where string, args ...interface{}) (games []MatchGame) {
+	rows, err := conn.Raw(`
+		SELECT
+			id,
+			match_id,
+			game_number,
+			winner,
+			COALESCE(map_name, ''),
+			created_at
+		FROM match_games
+		`+where+`
+		ORDER BY match_id ASC, game_number ASC`, args...).Rows()
+	if err != nil {
+		panic(err)
+	}
+
+	if conn.Error != nil {
+		panic(conn.Error)
+	}
+
+	for rows.Next() {
+		game := MatchGame{}
+		err := rows.Scan(
+			&game.MatchGameId,
+			&game.MatchId,
+			&game.GameNumber,
+			&game.Winner,
+			&game.MapName,
+			&game.CreatedAt)
+		if err != nil {
+			panic(err)
+		}
+		games = append(games, game)
+	}
+	return games
+}
+
+/*
+	CountGameWins tallies how many games each player won in a series.
+*/
+func CountGameWins(games []MatchGame) (p1Wins int, p2Wins int) {
+	for _, v := range games {
+		if v.Winner == P1 {
+			p1Wins++
+		} else if v.Winner == P2 {
+			p2Wins++
+		}
+	}
+	return p1Wins, p2Wins
+}
+
+/*
+	SeriesScoreFor the games won by each side of a series from the series winner's point of view.
+*/
+func SeriesScoreFor(games []MatchGame, p1Won bool) (winnerGames int, loserGames int) {
+	p1Wins, p2Wins := CountGameWins(games)
+	if p1Won {
+		return p1Wins, p2Wins
+	}
+	return p2Wins, p1Wins
+}
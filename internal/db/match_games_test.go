@@ -0,0 +1,58 @@
+package db
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestReplaceMatchGames(t *testing.T) {
+	conn := GetGorm(GetTestMysSQLConnStr())
+
+	rand.Seed(time.Now().UnixNano())
+
+	user1 := createRatedUser(conn, fmt.Sprintf("somediscordId%d", rand.Intn(1000000)), fmt.Sprintf("coolsk8r1990%d", rand.Intn(1000000)), DEFAULT_RATING)
+	user2 := createRatedUser(conn, fmt.Sprintf("somediscordId%d", rand.Intn(1000000)), fmt.Sprintf("coolsk8r1990%d", rand.Intn(1000000)), DEFAULT_RATING)
+
+	now := time.Now()
+	CreateMatch(conn, Match{
+		CreatedAt:        now,
+		UpdatedAt:        now,
+		MatchState:       Matched,
+		GameMode:         Bo3,
+		P1UserId:         user1.UserId,
+		P2UserId:         user2.UserId,
+		P1MatchRequestId: -1,
+		P2MatchRequestId: -1,
+		Winner:           Undefined,
+		Maps:             []string{"Arnheim", "Itza", "Black Ark"},
+	})
+	_, match := GetCurrentMatch(conn, user1.UserId)
+	assert.Equal(t, []string{"Arnheim", "Itza", "Black Ark"}, match.Maps)
+
+	ReplaceMatchGames(conn, match.MatchId, []MatchGame{
+		{GameNumber: 1, Winner: P2, MapName: "Arnheim"},
+		{GameNumber: 2, Winner: P1, MapName: "Itza"},
+		{GameNumber: 3, Winner: P1, MapName: "Black Ark"},
+	})
+
+	games := GetMatchGames(conn, match.MatchId)
+	assert.Len(t, games, 3)
+	assert.Equal(t, "Itza", games[1].MapName)
+	p1Wins, p2Wins := CountGameWins(games)
+	assert.Equal(t, 2, p1Wins)
+	assert.Equal(t, 1, p2Wins)
+
+	// A re-report overwrites the old games.
+	ReplaceMatchGames(conn, match.MatchId, []MatchGame{
+		{GameNumber: 1, Winner: P2, MapName: "Arnheim"},
+		{GameNumber: 2, Winner: P2, MapName: "Itza"},
+	})
+	games = GetMatchGames(conn, match.MatchId)
+	assert.Len(t, games, 2)
+	assert.Len(t, GetAllMatchGames(conn)[match.MatchId], 2)
+
+	UpdateMatch(conn, match.MatchId, Cancelled, Undefined)
+}
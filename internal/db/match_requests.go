@@ -2,6 +2,7 @@ package db
 
 import (
 	"database/sql"
+	"discordbot/internal/app/config"
 	"gorm.io/gorm"
 	"log"
 	"time"
@@ -11,8 +12,7 @@ const MatchRequestStateQueued = "queued"
 const MatchRequestStateCancelled = "cancelled"
 const MatchRequestStateCompleted = "completed"
 
-const MaxSecondsInQueue = 30 * 60
-
+// ExpiryTimeMinutes is how long a request stays queued when the player doesn't say how long they're available for.
 const ExpiryTimeMinutes = 45
 
 type MatchRequest struct {
@@ -23,22 +23,45 @@ type MatchRequest struct {
 	RequestRange      int
 	RequestedGameMode GameMode
 	MatchRequestState string
+	// FixedRange opts the request out of widening RequestRange the longer it waits, see EffectiveRange.
+	FixedRange       bool
+	RegionPreference RegionPreference
+	// ExpiresAt is when the request is dropped from the queue if it hasn't been paired.
+	ExpiresAt time.Time
+}
+
+const matchRequestColumns = "id, requesting_user_id, created_at, updated_at, request_range, requested_game_mode, match_request_state, fixed_range, region_preference, expires_at"
+
+/*
+	QueueWindow how long the request can wait in the queue in total.
+*/
+func (r MatchRequest) QueueWindow() time.Duration {
+	if r.ExpiresAt.IsZero() {
+		return ExpiryTimeMinutes * time.Minute
+	}
+	return r.ExpiresAt.Sub(r.CreatedAt)
 }
 
 type MatchRequestHistory struct {
 }
 
 func CreateMatchRequest(conn *gorm.DB, request MatchRequest) (success bool) {
+	if request.ExpiresAt.IsZero() {
+		request.ExpiresAt = request.CreatedAt.Add(ExpiryTimeMinutes * time.Minute)
+	}
 	// Create the new match request and also its history record as one db txn
 	err := conn.Transaction(func(tx *gorm.DB) error {
 		tx.Exec(
-			"INSERT INTO match_requests (requesting_user_id, created_at, updated_at, request_range, requested_game_mode, match_request_state) values (?, ?, ?, ?, ?, ?)",
+			"INSERT INTO match_requests (requesting_user_id, created_at, updated_at, request_range, requested_game_mode, match_request_state, fixed_range, region_preference, expires_at) values (?, ?, ?, ?, ?, ?, ?, ?, ?)",
 			request.RequestingUserId,
 			request.CreatedAt,
 			request.UpdatedAt,
 			request.RequestRange,
 			request.RequestedGameMode,
 			request.MatchRequestState,
+			request.FixedRange,
+			request.RegionPreference,
+			request.ExpiresAt,
 		)
 		if tx.Error != nil {
 			log.Println(tx.Error)
@@ -61,7 +84,7 @@ func CreateMatchRequest(conn *gorm.DB, request MatchRequest) (success bool) {
 }
 
 func GetMatchRequest(conn *gorm.DB, userId int) (foundRequest bool, matchRequest MatchRequest) {
-	row := conn.Raw("SELECT id, requesting_user_id, created_at, updated_at, request_range, requested_game_mode, match_request_state FROM match_requests WHERE requesting_user_id = ?", userId).Row()
+	row := conn.Raw("SELECT "+matchRequestColumns+" FROM match_requests WHERE requesting_user_id = ?", userId).Row()
 	if conn.Error != nil {
 		panic(conn.Error)
 	}
@@ -69,14 +92,8 @@ func GetMatchRequest(conn *gorm.DB, userId int) (foundRequest bool, matchRequest
 	if row == nil {
 		return false, MatchRequest{}
 	} else {
-		err := row.Scan(
-			&matchRequest.MatchRequestId,
-			&matchRequest.RequestingUserId,
-			&matchRequest.CreatedAt,
-			&matchRequest.UpdatedAt,
-			&matchRequest.RequestRange,
-			&matchRequest.RequestedGameMode,
-			&matchRequest.MatchRequestState)
+		var err error
+		matchRequest, err = scanMatchRequest(row)
 		if err != nil {
 			if err == sql.ErrNoRows {
 				return false, MatchRequest{}
@@ -92,44 +109,150 @@ type CandidatePairing struct {
 	OpponentMatchRequest    MatchRequest
 	OpponentRating          int
 	OpponentDiscordUsername string
+	// RequesterRating is the requester's rating on the same ladder as OpponentRating, see ResolveGameMode.
+	RequesterRating int
+	// OpponentGamesPlayed and RequesterGamesPlayed count completed matches on that same ladder.
+	OpponentGamesPlayed  int
+	RequesterGamesPlayed int
+	// RecentOpponent is set when the two have played within the configured rematch cooldown.
+	RecentOpponent bool
+	// RequesterRegion and OpponentRegion are NoRegion for players who haven't set one.
+	RequesterRegion Region
+	OpponentRegion  Region
 }
 
 /*
 	FindPairing Find all legal matches for the current match request as defined by being within rating range and
 	matching the requested game mode.
 
+	Ratings are compared on the ladder the pair would actually play - for a request for all that is the opponent's mode
+	or AllVsAllGameMode if the opponent also queued for all. Opponents the requester played within the rematch cooldown,
+	in any mode, are flagged as RecentOpponent rather than left out so the caller can still pair them if the queue is
+	quiet. Players who have either of them on their avoid list are never candidates, nor are players further from the
+	requester's home region than either of their region preferences allow. Players without a home region only pair with
+	those who'll play any region.
+
 	We'll then in-code determine an optimal one so that we can write more testable/detailed pairing routines than the DB
 	query makes easy.
 */
-func FindCandidatePairings(conn *gorm.DB, request MatchRequest) (response []CandidatePairing) {
-	// TODO - decide if we should disqualify playing same person twice in a row.
+func FindCandidatePairings(conn *gorm.DB, request MatchRequest, now time.Time) (response []CandidatePairing) {
+	queueConfig := config.GetQueueConfig()
+	expansionPoints := 0
+	if queueConfig.RangeExpansionEnabled() {
+		expansionPoints = queueConfig.RangeExpansionPoints
+	}
 	rows, err := conn.Raw(
 		`SELECT
-				mr.id,
+				id,
 				requesting_user_id,
 				created_at,
 				updated_at,
 				request_range,
 				requested_game_mode,
 				match_request_state,
-				opponent.current_rating,
-				opponent.discord_username
-			FROM match_requests mr
-			INNER JOIN users opponent
-				ON mr.requesting_user_id = opponent.id
-			INNER JOIN users requester
-				ON requester.id = @requester_user_id
-			WHERE 
-				requesting_user_id != @requester_user_id AND
-				(requested_game_mode = @requested_game_mode OR requested_game_mode = @game_mode_all OR @requested_game_mode = @game_mode_all) AND
-				ABS(requester.current_rating - opponent.current_rating) <= @request_rating_range AND
-				ABS(requester.current_rating - opponent.current_rating) <= mr.request_range  
-			ORDER BY mr.created_at ASC
+				fixed_range,
+				region_preference,
+				expires_at,
+				opponent_rating,
+				discord_username,
+				requester_rating,
+				requester_region,
+				opponent_region,
+				(
+					SELECT COUNT(*) FROM matches m
+					WHERE (m.p1_user_id = candidates.requesting_user_id OR m.p2_user_id = candidates.requesting_user_id) AND m.match_state = 'completed' AND m.game_mode = candidates.resolved_game_mode
+				) AS opponent_games_played,
+				(
+					SELECT COUNT(*) FROM matches m
+					WHERE (m.p1_user_id = @requester_user_id OR m.p2_user_id = @requester_user_id) AND m.match_state = 'completed' AND m.game_mode = candidates.resolved_game_mode
+				) AS requester_games_played,
+				(
+					SELECT COUNT(*) > 0 FROM (
+						SELECT m.p1_user_id, m.p2_user_id FROM matches m
+						WHERE (m.p1_user_id = @requester_user_id OR m.p2_user_id = @requester_user_id) AND m.match_state != @cancelled
+						ORDER BY m.created_at DESC
+						LIMIT @rematch_cooldown_matches
+					) recent
+					WHERE recent.p1_user_id = candidates.requesting_user_id OR recent.p2_user_id = candidates.requesting_user_id
+				) OR (
+					@rematch_cooldown_hours > 0 AND EXISTS (
+						SELECT 1 FROM matches m
+						WHERE
+							((m.p1_user_id = @requester_user_id AND m.p2_user_id = candidates.requesting_user_id) OR
+							(m.p2_user_id = @requester_user_id AND m.p1_user_id = candidates.requesting_user_id)) AND
+							m.match_state != @cancelled AND
+							m.created_at >= @rematch_cooldown_since
+					)
+				) AS recent_opponent
+			FROM (
+				SELECT
+					mr.*,
+					opponent.discord_username,
+					COALESCE(opponent_rating.rating, @default_rating) AS opponent_rating,
+					COALESCE(requester_rating.rating, @default_rating) AS requester_rating,
+					COALESCE(requester.region, '') AS requester_region,
+					COALESCE(opponent.region, '') AS opponent_region,
+					IF(@requested_game_mode = @game_mode_all, IF(mr.requested_game_mode = @game_mode_all, @all_vs_all_game_mode, mr.requested_game_mode), @requested_game_mode) AS resolved_game_mode,
+					IF(
+						mr.fixed_range OR @expansion_points = 0,
+						mr.request_range,
+						GREATEST(mr.request_range, LEAST(@expansion_cap, mr.request_range + @expansion_points * FLOOR(TIMESTAMPDIFF(MINUTE, mr.created_at, @now) / @expansion_minutes)))
+					) AS effective_range
+				FROM match_requests mr
+				INNER JOIN users opponent
+					ON mr.requesting_user_id = opponent.id
+				INNER JOIN users requester
+					ON requester.id = @requester_user_id
+				LEFT JOIN user_ratings opponent_rating
+					ON opponent_rating.user_id = opponent.id AND
+					opponent_rating.game_mode = IF(@requested_game_mode = @game_mode_all, IF(mr.requested_game_mode = @game_mode_all, @all_vs_all_game_mode, mr.requested_game_mode), @requested_game_mode)
+				LEFT JOIN user_ratings requester_rating
+					ON requester_rating.user_id = @requester_user_id AND
+					requester_rating.game_mode = IF(@requested_game_mode = @game_mode_all, IF(mr.requested_game_mode = @game_mode_all, @all_vs_all_game_mode, mr.requested_game_mode), @requested_game_mode)
+				WHERE 
+					requesting_user_id != @requester_user_id AND
+					(requested_game_mode = @requested_game_mode OR requested_game_mode = @game_mode_all OR @requested_game_mode = @game_mode_all) AND
+					NOT EXISTS (
+						SELECT 1 FROM user_avoids ua
+						WHERE
+							(ua.user_id = @requester_user_id AND ua.avoided_user_id = mr.requesting_user_id) OR
+							(ua.user_id = mr.requesting_user_id AND ua.avoided_user_id = @requester_user_id)
+					)
+			) candidates
+			WHERE
+				ABS(requester_rating - opponent_rating) <= @request_rating_range AND
+				ABS(requester_rating - opponent_rating) <= effective_range AND
+				IF(
+					requester_region = '' OR opponent_region = '',
+					@any_region_distance,
+					ABS(FIELD(requester_region, @region_eu, @region_na, @region_oce) - FIELD(opponent_region, @region_eu, @region_na, @region_oce))
+				) <= LEAST(
+					@requester_region_distance,
+					CASE region_preference WHEN @same_region THEN 0 WHEN @neighbouring_regions THEN 1 ELSE @any_region_distance END
+				)
+			ORDER BY created_at ASC
 			LIMIT 100`,
 		sql.Named("requester_user_id", request.RequestingUserId),
 		sql.Named("requested_game_mode", request.RequestedGameMode),
 		sql.Named("game_mode_all", All),
-		sql.Named("request_rating_range", request.RequestRange),
+		sql.Named("all_vs_all_game_mode", AllVsAllGameMode),
+		sql.Named("default_rating", DEFAULT_RATING),
+		sql.Named("request_rating_range", EffectiveRange(request, now)),
+		sql.Named("expansion_points", expansionPoints),
+		sql.Named("expansion_minutes", queueConfig.RangeExpansionMinutes),
+		sql.Named("expansion_cap", queueConfig.RangeExpansionCap),
+		sql.Named("now", now),
+		sql.Named("cancelled", Cancelled),
+		sql.Named("rematch_cooldown_matches", queueConfig.RematchCooldownMatches),
+		sql.Named("rematch_cooldown_hours", queueConfig.RematchCooldownHours),
+		sql.Named("rematch_cooldown_since", now.Add(-time.Duration(queueConfig.RematchCooldownHours)*time.Hour)),
+		sql.Named("region_eu", EU),
+		sql.Named("region_na", NA),
+		sql.Named("region_oce", OCE),
+		sql.Named("requester_region_distance", request.RegionPreference.MaxDistance()),
+		sql.Named("same_region", SameRegion),
+		sql.Named("neighbouring_regions", NeighbouringRegions),
+		sql.Named("any_region_distance", AnyRegion.MaxDistance()),
 	).Rows()
 
 	if err != nil {
@@ -151,8 +274,17 @@ func FindCandidatePairings(conn *gorm.DB, request MatchRequest) (response []Cand
 			&matchRequest.RequestRange,
 			&matchRequest.RequestedGameMode,
 			&matchRequest.MatchRequestState,
+			&matchRequest.FixedRange,
+			&matchRequest.RegionPreference,
+			&matchRequest.ExpiresAt,
 			&candidatePairing.OpponentRating,
-			&candidatePairing.OpponentDiscordUsername)
+			&candidatePairing.OpponentDiscordUsername,
+			&candidatePairing.RequesterRating,
+			&candidatePairing.RequesterRegion,
+			&candidatePairing.OpponentRegion,
+			&candidatePairing.OpponentGamesPlayed,
+			&candidatePairing.RequesterGamesPlayed,
+			&candidatePairing.RecentOpponent)
 		candidatePairing.OpponentMatchRequest = matchRequest
 		if err != nil {
 			log.Printf("Unable to read history row for matchRequest %d: %v", request.MatchRequestId, err)
@@ -162,18 +294,43 @@ func FindCandidatePairings(conn *gorm.DB, request MatchRequest) (response []Cand
 	return response
 }
 
+func CountQueuedMatchRequests(conn *gorm.DB) (count int) {
+	conn.Raw("SELECT COUNT(*) FROM match_requests WHERE match_request_state = ?", MatchRequestStateQueued).Scan(&count)
+	if conn.Error != nil {
+		panic(conn.Error)
+	}
+	return count
+}
+
+/*
+	EffectiveRange the rating range a request matches into right now. Unless the player fixed their range, it widens by
+	the configured points for every interval spent waiting in the queue, up to the cap. FindCandidatePairings applies the
+	same schedule to waiting opponents in SQL.
+*/
+func EffectiveRange(request MatchRequest, now time.Time) int {
+	queueConfig := config.GetQueueConfig()
+	if request.FixedRange || !queueConfig.RangeExpansionEnabled() {
+		return request.RequestRange
+	}
+	intervals := int(now.Sub(request.CreatedAt).Minutes()) / queueConfig.RangeExpansionMinutes
+	if intervals <= 0 {
+		return request.RequestRange
+	}
+	expanded := request.RequestRange + queueConfig.RangeExpansionPoints*intervals
+	if expanded > queueConfig.RangeExpansionCap {
+		expanded = queueConfig.RangeExpansionCap
+	}
+	if expanded < request.RequestRange {
+		return request.RequestRange
+	}
+	return expanded
+}
+
 func FindExpiredRequests(conn *gorm.DB, now time.Time) (result []MatchRequest) {
 	rows, err := conn.Raw(
-		`SELECT
-		id,
-		requesting_user_id,
-		created_at,
-		updated_at,
-		request_range,
-		requested_game_mode,
-		match_request_state
+		`SELECT `+matchRequestColumns+`
 	FROM match_requests 
-	WHERE (TIMESTAMPDIFF(MINUTE, created_at, ?) > 45) AND match_request_state = ?`, now, MatchRequestStateQueued).Rows()
+	WHERE expires_at <= ? AND match_request_state = ?`, now, MatchRequestStateQueued).Rows()
 
 	if err != nil {
 		panic(err)
@@ -184,15 +341,7 @@ func FindExpiredRequests(conn *gorm.DB, now time.Time) (result []MatchRequest) {
 	}
 
 	for rows.Next() {
-		matchRequest := MatchRequest{}
-		err := rows.Scan(
-			&matchRequest.MatchRequestId,
-			&matchRequest.RequestingUserId,
-			&matchRequest.CreatedAt,
-			&matchRequest.UpdatedAt,
-			&matchRequest.RequestRange,
-			&matchRequest.RequestedGameMode,
-			&matchRequest.MatchRequestState)
+		matchRequest, err := scanMatchRequest(rows)
 		if err != nil {
 			panic(err)
 		}
@@ -204,6 +353,34 @@ func FindExpiredRequests(conn *gorm.DB, now time.Time) (result []MatchRequest) {
 	return result
 }
 
+/*
+	GetQueuedMatchRequests every request still waiting in the queue, longest waiting first.
+*/
+func GetQueuedMatchRequests(conn *gorm.DB) (result []MatchRequest) {
+	rows, err := conn.Raw(
+		`SELECT `+matchRequestColumns+`
+	FROM match_requests
+	WHERE match_request_state = ?
+	ORDER BY created_at ASC, id ASC`, MatchRequestStateQueued).Rows()
+
+	if err != nil {
+		panic(err)
+	}
+
+	if conn.Error != nil {
+		panic(conn.Error)
+	}
+
+	for rows.Next() {
+		matchRequest, err := scanMatchRequest(rows)
+		if err != nil {
+			panic(err)
+		}
+		result = append(result, matchRequest)
+	}
+	return result
+}
+
 /*
 CancelMatchRequest remove the match request from queue.
 */
@@ -230,6 +407,66 @@ func CancelMatchRequest(conn *gorm.DB, userId int) (success bool) {
 	return success
 }
 
+/*
+	RestoreMatchRequest puts a request that was paired back in the queue as it was first made, keeping its id and its
+	place in the queue. Its deadline is the one it last had while queued, moved back by however long it spent paired, so
+	a request restored before keeps that time too. Nothing is restored if the player has queued again since.
+*/
+func RestoreMatchRequest(conn *gorm.DB, matchRequestId int, now time.Time) (success bool) {
+	err := conn.Transaction(func(tx *gorm.DB) error {
+		history := GetMatchRequestHistory(tx, matchRequestId)
+		if len(history) == 0 {
+			log.Printf("Unable to find history for match request: %d", matchRequestId)
+			success = false
+			return nil
+		}
+		// The first row is the request as queued, before pairing resolved its game mode.
+		request := history[0]
+		pairedAt := history[len(history)-1].UpdatedAt
+		for _, v := range history {
+			if v.MatchRequestState == MatchRequestStateQueued {
+				request.ExpiresAt = v.ExpiresAt
+			}
+		}
+
+		if foundRequest, _ := GetMatchRequest(tx, request.RequestingUserId); foundRequest {
+			success = false
+			return nil
+		}
+
+		request.MatchRequestState = MatchRequestStateQueued
+		request.UpdatedAt = now
+		if now.After(pairedAt) {
+			request.ExpiresAt = request.ExpiresAt.Add(now.Sub(pairedAt))
+		}
+		tx.Exec(
+			"INSERT INTO match_requests (id, requesting_user_id, created_at, updated_at, request_range, requested_game_mode, match_request_state, fixed_range, region_preference, expires_at) values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+			request.MatchRequestId,
+			request.RequestingUserId,
+			request.CreatedAt,
+			request.UpdatedAt,
+			request.RequestRange,
+			request.RequestedGameMode,
+			request.MatchRequestState,
+			request.FixedRange,
+			request.RegionPreference,
+			request.ExpiresAt,
+		)
+		if tx.Error != nil {
+			log.Println(tx.Error)
+			success = false
+			return nil
+		}
+		createMatchRequestHistory(tx, request)
+		success = true
+		return nil
+	})
+	if err != nil {
+		return false
+	}
+	return success
+}
+
 // create completed request history record and delete the match request as one txn.
 func completeMatchRequest(conn *gorm.DB, request MatchRequest) (success bool) {
 	err := conn.Transaction(func(tx *gorm.DB) error {
@@ -255,7 +492,10 @@ func GetMatchRequestHistory(conn *gorm.DB, matchRequestId int) (matchRequests []
 			updated_at,
 			request_range,
 			requested_game_mode,
-			match_request_state
+			match_request_state,
+			fixed_range,
+			region_preference,
+			expires_at
 		FROM match_requests_history
 		WHERE
 			match_request_id = ?
@@ -272,16 +512,7 @@ func GetMatchRequestHistory(conn *gorm.DB, matchRequestId int) (matchRequests []
 	}
 
 	for rows.Next() {
-		matchRequest := MatchRequest{}
-		err := rows.Scan(
-			&matchRequest.MatchRequestId,
-			&matchRequest.RequestingUserId,
-			&matchRequest.CreatedAt,
-			&matchRequest.UpdatedAt,
-			&matchRequest.RequestRange,
-			&matchRequest.RequestedGameMode,
-			&matchRequest.MatchRequestState)
-
+		matchRequest, err := scanMatchRequest(rows)
 		if err != nil {
 			log.Printf("Unable to read history row for matchRequest %d: %v", matchRequestId, err)
 		}
@@ -293,6 +524,96 @@ func GetMatchRequestHistory(conn *gorm.DB, matchRequestId int) (matchRequests []
 	return matchRequests
 }
 
+/*
+	QueueArrival a request as it was when the player joined the queue, with their bo1 and bo3 ratings. Which one counts
+	depends on who they're paired with, see ResolveGameMode.
+*/
+type QueueArrival struct {
+	Request MatchRequest
+	Ratings map[GameMode]int
+}
+
+/*
+	GetQueueArrivals every request that joined the queue since, oldest first, as first recorded in match request history.
+	Ratings are the players' current ones, since history doesn't keep what they were at the time.
+*/
+func GetQueueArrivals(conn *gorm.DB, since time.Time) (arrivals []QueueArrival) {
+	rows, err := conn.Raw(`
+		SELECT
+			h.match_request_id,
+			h.requesting_user_id,
+			h.created_at,
+			h.updated_at,
+			h.request_range,
+			h.requested_game_mode,
+			h.match_request_state,
+			h.fixed_range,
+			h.region_preference,
+			h.expires_at,
+			COALESCE(bo1.rating, ?),
+			COALESCE(bo3.rating, ?)
+		FROM match_requests_history h
+		LEFT JOIN user_ratings bo1 ON bo1.user_id = h.requesting_user_id AND bo1.game_mode = ?
+		LEFT JOIN user_ratings bo3 ON bo3.user_id = h.requesting_user_id AND bo3.game_mode = ?
+		WHERE
+			h.id = (SELECT MIN(first.id) FROM match_requests_history first WHERE first.match_request_id = h.match_request_id) AND
+			h.created_at >= ?
+		ORDER BY
+			h.created_at ASC, h.match_request_id ASC`,
+		DEFAULT_RATING,
+		DEFAULT_RATING,
+		Bo1,
+		Bo3,
+		since).Rows()
+
+	if err != nil {
+		panic(err)
+	}
+
+	if conn.Error != nil {
+		panic(conn.Error)
+	}
+
+	for rows.Next() {
+		arrival := QueueArrival{}
+		var bo1Rating, bo3Rating int
+		err := rows.Scan(
+			&arrival.Request.MatchRequestId,
+			&arrival.Request.RequestingUserId,
+			&arrival.Request.CreatedAt,
+			&arrival.Request.UpdatedAt,
+			&arrival.Request.RequestRange,
+			&arrival.Request.RequestedGameMode,
+			&arrival.Request.MatchRequestState,
+			&arrival.Request.FixedRange,
+			&arrival.Request.RegionPreference,
+			&arrival.Request.ExpiresAt,
+			&bo1Rating,
+			&bo3Rating)
+		if err != nil {
+			panic(err)
+		}
+		arrival.Ratings = map[GameMode]int{Bo1: bo1Rating, Bo3: bo3Rating}
+		arrivals = append(arrivals, arrival)
+	}
+	return arrivals
+}
+
+func scanMatchRequest(row rowScanner) (matchRequest MatchRequest, err error) {
+	err = row.Scan(
+		&matchRequest.MatchRequestId,
+		&matchRequest.RequestingUserId,
+		&matchRequest.CreatedAt,
+		&matchRequest.UpdatedAt,
+		&matchRequest.RequestRange,
+		&matchRequest.RequestedGameMode,
+		&matchRequest.MatchRequestState,
+		&matchRequest.FixedRange,
+		&matchRequest.RegionPreference,
+		&matchRequest.ExpiresAt)
+	return matchRequest, err
+}
+
 func deleteMatchRequest(conn *gorm.DB, matchRequestId int) (success bool) {
 	conn.Exec("DELETE FROM match_requests WHERE id = ?", matchRequestId)
 	if conn.Error != nil {
@@ -304,14 +625,17 @@ func deleteMatchRequest(conn *gorm.DB, matchRequestId int) (success bool) {
 
 func createMatchRequestHistory(conn *gorm.DB, request MatchRequest) (success bool) {
 	conn.Exec(
-		"INSERT INTO match_requests_history (match_request_id, requesting_user_id, created_at, updated_at, request_range, requested_game_mode, match_request_state) values (?, ?, ?, ?, ?, ?, ?)",
+		"INSERT INTO match_requests_history (match_request_id, requesting_user_id, created_at, updated_at, request_range, requested_game_mode, match_request_state, fixed_range, region_preference, expires_at) values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
 		request.MatchRequestId,
 		request.RequestingUserId,
 		request.CreatedAt,
 		request.UpdatedAt,
 		request.RequestRange,
 		request.RequestedGameMode,
-		request.MatchRequestState)
+		request.MatchRequestState,
+		request.FixedRange,
+		request.RegionPreference,
+		request.ExpiresAt)
 
 	if conn.Error != nil {
 		log.Println(conn.Error)
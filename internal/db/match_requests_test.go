@@ -1,6 +1,7 @@
 package db
 
 import (
+	"discordbot/internal/app/ratings"
 	"fmt"
 	"github.com/go-playground/assert/v2"
 	"math/rand"
@@ -15,7 +16,7 @@ func TestCreateMatchRequest(t *testing.T) {
 	testDiscordUsername := fmt.Sprintf("coolsk8r1990%d", rand.Intn(1000000))
 	testDiscordId := fmt.Sprintf("somediscordId%d", rand.Intn(1000000))
 
-	CreateUser(conn, User{0, testDiscordId, testDiscordUsername, DEFAULT_RATING})
+	CreateUser(conn, User{DiscordId: testDiscordId, DiscordUserName: testDiscordUsername})
 	_, user := GetUserByDiscordId(conn, testDiscordId)
 
 	matchRequest := MatchRequest{
@@ -26,6 +27,9 @@ func TestCreateMatchRequest(t *testing.T) {
 		200,
 		All,
 		MatchRequestStateQueued,
+		false,
+		AnyRegion,
+		time.Time{},
 	}
 
 	success := CreateMatchRequest(conn, matchRequest)
@@ -62,7 +66,7 @@ func TestCancelMatchRequest(t *testing.T) {
 	testDiscordUsername := fmt.Sprintf("coolsk8r1990%d", rand.Intn(1000000))
 	testDiscordId := fmt.Sprintf("somediscordId%d", rand.Intn(1000000))
 
-	CreateUser(conn, User{0, testDiscordId, testDiscordUsername, DEFAULT_RATING})
+	CreateUser(conn, User{DiscordId: testDiscordId, DiscordUserName: testDiscordUsername})
 	_, user := GetUserByDiscordId(conn, testDiscordId)
 
 	matchRequest := MatchRequest{
@@ -73,6 +77,9 @@ func TestCancelMatchRequest(t *testing.T) {
 		200,
 		All,
 		MatchRequestStateQueued,
+		false,
+		AnyRegion,
+		time.Time{},
 	}
 
 	CreateMatchRequest(conn, matchRequest)
@@ -131,10 +138,10 @@ func TestFindCandidatePairings(t *testing.T) {
 	testDiscordUsername4 := fmt.Sprintf("coolsk8r1990%d", rand.Intn(1000000))
 	testDiscordId4 := fmt.Sprintf("somediscordId%d", rand.Intn(1000000))
 
-	CreateUser(conn, User{0, testDiscordId1, testDiscordUsername1, 750})
-	CreateUser(conn, User{0, testDiscordId2, testDiscordUsername2, 800})
-	CreateUser(conn, User{0, testDiscordId3, testDiscordUsername3, 900})
-	CreateUser(conn, User{0, testDiscordId4, testDiscordUsername4, 1000})
+	createRatedUser(conn, testDiscordId1, testDiscordUsername1, 750)
+	createRatedUser(conn, testDiscordId2, testDiscordUsername2, 800)
+	createRatedUser(conn, testDiscordId3, testDiscordUsername3, 900)
+	createRatedUser(conn, testDiscordId4, testDiscordUsername4, 1000)
 
 	_, user1 := GetUserByDiscordId(conn, testDiscordId1)
 	_, user2 := GetUserByDiscordId(conn, testDiscordId2)
@@ -149,6 +156,9 @@ func TestFindCandidatePairings(t *testing.T) {
 		49,
 		Bo1,
 		MatchRequestStateQueued,
+		false,
+		AnyRegion,
+		time.Time{},
 	}
 
 	matchRequest2 := MatchRequest{
@@ -159,6 +169,9 @@ func TestFindCandidatePairings(t *testing.T) {
 		150,
 		Bo1,
 		MatchRequestStateQueued,
+		false,
+		AnyRegion,
+		time.Time{},
 	}
 
 	matchRequest3 := MatchRequest{
@@ -169,6 +182,9 @@ func TestFindCandidatePairings(t *testing.T) {
 		300,
 		All,
 		MatchRequestStateQueued,
+		false,
+		AnyRegion,
+		time.Time{},
 	}
 
 	matchRequest4 := MatchRequest{
@@ -179,6 +195,9 @@ func TestFindCandidatePairings(t *testing.T) {
 		500,
 		Bo3,
 		MatchRequestStateQueued,
+		false,
+		AnyRegion,
+		time.Time{},
 	}
 
 	CreateMatchRequest(conn, matchRequest)
@@ -186,10 +205,10 @@ func TestFindCandidatePairings(t *testing.T) {
 	CreateMatchRequest(conn, matchRequest3)
 	CreateMatchRequest(conn, matchRequest4)
 
-	pairings1 := FindCandidatePairings(conn, matchRequest)
-	pairings2 := FindCandidatePairings(conn, matchRequest2)
-	pairings3 := FindCandidatePairings(conn, matchRequest3)
-	pairings4 := FindCandidatePairings(conn, matchRequest4)
+	pairings1 := FindCandidatePairings(conn, matchRequest, time.Now())
+	pairings2 := FindCandidatePairings(conn, matchRequest2, time.Now())
+	pairings3 := FindCandidatePairings(conn, matchRequest3, time.Now())
+	pairings4 := FindCandidatePairings(conn, matchRequest4, time.Now())
 
 	// Request 1 has too low a range and should match with nothing despite others being open to matching with it.
 	assert.Equal(t, len(pairings1), 0)
@@ -197,25 +216,58 @@ func TestFindCandidatePairings(t *testing.T) {
 	// Request 2 allows bo1 and enough range to match with 3, but should not match with 1 because of 1s range or 4 because 4 is outside of 2s range.
 	assert.Equal(t, len(pairings2), 1)
 	assert.Equal(t, pairings2[0].OpponentMatchRequest.RequestingUserId, user3.UserId)
-	assert.Equal(t, pairings2[0].OpponentRating, user3.CurrentRating)
+	assert.Equal(t, pairings2[0].OpponentRating, 900)
 	assert.Equal(t, pairings2[0].OpponentDiscordUsername, user3.DiscordUserName)
 
 	// Request 3 has enough range to match with all others but so should match with 2 and 4 who don't preclude it, but not 1 who does.
 	assert.Equal(t, len(pairings3), 2)
 	assert.Equal(t, pairings3[0].OpponentMatchRequest.RequestingUserId, user2.UserId)
-	assert.Equal(t, pairings3[0].OpponentRating, user2.CurrentRating)
+	assert.Equal(t, pairings3[0].OpponentRating, 800)
 	assert.Equal(t, pairings3[0].OpponentDiscordUsername, user2.DiscordUserName)
 	assert.Equal(t, pairings3[1].OpponentMatchRequest.RequestingUserId, user4.UserId)
-	assert.Equal(t, pairings3[1].OpponentRating, user4.CurrentRating)
+	assert.Equal(t, pairings3[1].OpponentRating, 1000)
 	assert.Equal(t, pairings3[1].OpponentDiscordUsername, user4.DiscordUserName)
 
 	// Request 4 has enough range to match with all others but is only for bo3 so should only match with 3.
 	assert.Equal(t, len(pairings4), 1)
 	assert.Equal(t, pairings4[0].OpponentMatchRequest.RequestingUserId, user3.UserId)
-	assert.Equal(t, pairings4[0].OpponentRating, user3.CurrentRating)
+	assert.Equal(t, pairings4[0].OpponentRating, 900)
 	assert.Equal(t, pairings4[0].OpponentDiscordUsername, user3.DiscordUserName)
 }
 
+func TestFindCandidatePairingsComparesModeRatings(t *testing.T) {
+	conn := GetGorm(GetTestMysSQLConnStr())
+	conn.Exec("TRUNCATE TABLE match_requests")
+
+	rand.Seed(time.Now().UnixNano())
+
+	requester := createRatedUser(conn, fmt.Sprintf("somediscordId%d", rand.Intn(1000000)), fmt.Sprintf("coolsk8r1990%d", rand.Intn(1000000)), 1000)
+	opponent := createRatedUser(conn, fmt.Sprintf("somediscordId%d", rand.Intn(1000000)), fmt.Sprintf("coolsk8r1990%d", rand.Intn(1000000)), 1000)
+	// The opponent is a much stronger bo3 player than bo1 player.
+	UpdateUserRating(conn, opponent.UserId, Bo3, ratings.PlayerRating{Rating: 1500}, -1)
+
+	requesterRequest := MatchRequest{RequestingUserId: requester.UserId, CreatedAt: time.Now(), UpdatedAt: time.Now(), RequestRange: 100, RequestedGameMode: All, MatchRequestState: MatchRequestStateQueued}
+	opponentRequest := MatchRequest{RequestingUserId: opponent.UserId, CreatedAt: time.Now(), UpdatedAt: time.Now(), RequestRange: 100, RequestedGameMode: Bo1, MatchRequestState: MatchRequestStateQueued}
+	CreateMatchRequest(conn, requesterRequest)
+	CreateMatchRequest(conn, opponentRequest)
+
+	// All vs bo1 is played as bo1 so bo1 ratings are compared.
+	pairings := FindCandidatePairings(conn, requesterRequest, time.Now())
+	assert.Equal(t, 1, len(pairings))
+	assert.Equal(t, 1000, pairings[0].OpponentRating)
+	assert.Equal(t, 1000, pairings[0].RequesterRating)
+
+	// All vs all is played as bo3 where the two are 500 apart.
+	CancelMatchRequest(conn, opponent.UserId)
+	opponentRequest.RequestedGameMode = All
+	CreateMatchRequest(conn, opponentRequest)
+	pairings = FindCandidatePairings(conn, requesterRequest, time.Now())
+	assert.Equal(t, 0, len(pairings))
+
+	CancelMatchRequest(conn, requester.UserId)
+	CancelMatchRequest(conn, opponent.UserId)
+}
+
 func TestFindExpiredMatches(t *testing.T) {
 	conn := GetGorm(GetTestMysSQLConnStr())
 
@@ -232,7 +284,7 @@ func TestFindExpiredMatches(t *testing.T) {
 	for i := 0; i < 2; i++ {
 		testDiscordUsername := fmt.Sprintf("coolsk8r1990%d", rand.Intn(1000000))
 		testDiscordId := fmt.Sprintf("somediscordId%d", rand.Intn(1000000))
-		CreateUser(conn, User{0, testDiscordId, testDiscordUsername, DEFAULT_RATING})
+		CreateUser(conn, User{DiscordId: testDiscordId, DiscordUserName: testDiscordUsername})
 		_, user := GetUserByDiscordId(conn, testDiscordId)
 		users = append(users, user)
 	}
@@ -245,6 +297,9 @@ func TestFindExpiredMatches(t *testing.T) {
 		200,
 		All,
 		MatchRequestStateQueued,
+		false,
+		AnyRegion,
+		time.Time{},
 	}
 	CreateMatchRequest(conn, expiredRequest)
 	_, persistedExpiredRequest := GetMatchRequest(conn, users[0].UserId)
@@ -257,6 +312,9 @@ func TestFindExpiredMatches(t *testing.T) {
 		200,
 		All,
 		MatchRequestStateQueued,
+		false,
+		AnyRegion,
+		time.Time{},
 	}
 	CreateMatchRequest(conn, notExpiredRequest)
 	GetMatchRequest(conn, users[1].UserId)
@@ -281,3 +339,188 @@ func TestFindExpiredMatches(t *testing.T) {
 	CancelMatchRequest(conn, users[0].UserId)
 	CancelMatchRequest(conn, users[1].UserId)
 }
+
+func TestEffectiveRange(t *testing.T) {
+	now := time.Now()
+	request := MatchRequest{RequestRange: 100, CreatedAt: now.Add(-12 * time.Minute)}
+
+	// Expansion is off unless configured.
+	assert.Equal(t, 100, EffectiveRange(request, now))
+
+	t.Setenv("QUEUE_RANGE_EXPANSION_POINTS", "50")
+	t.Setenv("QUEUE_RANGE_EXPANSION_MINUTES", "5")
+	t.Setenv("QUEUE_RANGE_EXPANSION_CAP", "300")
+
+	// Two full 5m intervals waited.
+	assert.Equal(t, 200, EffectiveRange(request, now))
+	assert.Equal(t, 100, EffectiveRange(request, request.CreatedAt.Add(4*time.Minute)))
+
+	request.CreatedAt = now.Add(-40 * time.Minute)
+	assert.Equal(t, 300, EffectiveRange(request, now))
+
+	// Ranges already past the cap are left alone.
+	request.RequestRange = 400
+	assert.Equal(t, 400, EffectiveRange(request, now))
+
+	request.RequestRange = 100
+	request.FixedRange = true
+	assert.Equal(t, 100, EffectiveRange(request, now))
+}
+
+func TestFindCandidatePairingsExpandsRange(t *testing.T) {
+	conn := GetGorm(GetTestMysSQLConnStr())
+	conn.Exec("TRUNCATE TABLE match_requests")
+	t.Setenv("QUEUE_RANGE_EXPANSION_POINTS", "50")
+	t.Setenv("QUEUE_RANGE_EXPANSION_MINUTES", "5")
+	t.Setenv("QUEUE_RANGE_EXPANSION_CAP", "600")
+
+	rand.Seed(time.Now().UnixNano())
+
+	requester := createRatedUser(conn, fmt.Sprintf("somediscordId%d", rand.Intn(1000000)), fmt.Sprintf("coolsk8r1990%d", rand.Intn(1000000)), 1000)
+	opponent := createRatedUser(conn, fmt.Sprintf("somediscordId%d", rand.Intn(1000000)), fmt.Sprintf("coolsk8r1990%d", rand.Intn(1000000)), 1200)
+
+	now := time.Now()
+	requesterRequest := MatchRequest{RequestingUserId: requester.UserId, CreatedAt: now, UpdatedAt: now, RequestRange: 300, RequestedGameMode: Bo1, MatchRequestState: MatchRequestStateQueued}
+	// The opponent only wants players within 100 but has waited long enough for that to reach 200.
+	opponentRequest := MatchRequest{RequestingUserId: opponent.UserId, CreatedAt: now.Add(-10 * time.Minute), UpdatedAt: now, RequestRange: 100, RequestedGameMode: Bo1, MatchRequestState: MatchRequestStateQueued}
+	CreateMatchRequest(conn, requesterRequest)
+	CreateMatchRequest(conn, opponentRequest)
+
+	pairings := FindCandidatePairings(conn, requesterRequest, now)
+	assert.Equal(t, 1, len(pairings))
+
+	// Opting out keeps the opponent at 100.
+	CancelMatchRequest(conn, opponent.UserId)
+	opponentRequest.FixedRange = true
+	CreateMatchRequest(conn, opponentRequest)
+	pairings = FindCandidatePairings(conn, requesterRequest, now)
+	assert.Equal(t, 0, len(pairings))
+
+	CancelMatchRequest(conn, requester.UserId)
+	CancelMatchRequest(conn, opponent.UserId)
+}
+
+func TestFindCandidatePairingsFlagsRecentOpponents(t *testing.T) {
+	conn := GetGorm(GetTestMysSQLConnStr())
+	conn.Exec("TRUNCATE TABLE match_requests")
+
+	rand.Seed(time.Now().UnixNano())
+
+	requester := createRatedUser(conn, fmt.Sprintf("somediscordId%d", rand.Intn(1000000)), fmt.Sprintf("coolsk8r1990%d", rand.Intn(1000000)), 1000)
+	opponent := createRatedUser(conn, fmt.Sprintf("somediscordId%d", rand.Intn(1000000)), fmt.Sprintf("coolsk8r1990%d", rand.Intn(1000000)), 1000)
+
+	now := time.Now()
+	requesterRequest := MatchRequest{RequestingUserId: requester.UserId, CreatedAt: now, UpdatedAt: now, RequestRange: 300, RequestedGameMode: Bo1, MatchRequestState: MatchRequestStateQueued}
+	opponentRequest := MatchRequest{RequestingUserId: opponent.UserId, CreatedAt: now, UpdatedAt: now, RequestRange: 300, RequestedGameMode: Bo1, MatchRequestState: MatchRequestStateQueued}
+	CreateMatchRequest(conn, requesterRequest)
+	CreateMatchRequest(conn, opponentRequest)
+
+	pairings := FindCandidatePairings(conn, requesterRequest, now)
+	assert.Equal(t, 1, len(pairings))
+	assert.Equal(t, pairings[0].RecentOpponent, false)
+
+	// Play them against each other, then queue them both again.
+	_, persistedRequester := GetMatchRequest(conn, requester.UserId)
+	_, persistedOpponent := GetMatchRequest(conn, opponent.UserId)
+	CreateMatchFromRequests(conn, persistedOpponent, persistedRequester, 0)
+	_, match := GetCurrentMatch(conn, requester.UserId)
+	UpdateMatch(conn, match.MatchId, Completed, P1)
+	CreateMatchRequest(conn, requesterRequest)
+	CreateMatchRequest(conn, opponentRequest)
+
+	// Off by default.
+	pairings = FindCandidatePairings(conn, requesterRequest, now)
+	assert.Equal(t, pairings[0].RecentOpponent, false)
+
+	t.Setenv("QUEUE_REMATCH_COOLDOWN_MATCHES", "1")
+	pairings = FindCandidatePairings(conn, requesterRequest, now)
+	assert.Equal(t, pairings[0].RecentOpponent, true)
+
+	t.Setenv("QUEUE_REMATCH_COOLDOWN_MATCHES", "0")
+	t.Setenv("QUEUE_REMATCH_COOLDOWN_HOURS", "2")
+	pairings = FindCandidatePairings(conn, requesterRequest, now)
+	assert.Equal(t, pairings[0].RecentOpponent, true)
+	pairings = FindCandidatePairings(conn, requesterRequest, now.Add(3*time.Hour))
+	assert.Equal(t, pairings[0].RecentOpponent, false)
+
+	CancelMatchRequest(conn, requester.UserId)
+	CancelMatchRequest(conn, opponent.UserId)
+}
+
+func TestFindCandidatePairingsRespectsRegions(t *testing.T) {
+	conn := GetGorm(GetTestMysSQLConnStr())
+	conn.Exec("TRUNCATE TABLE match_requests")
+
+	rand.Seed(time.Now().UnixNano())
+
+	requester := createRatedUser(conn, fmt.Sprintf("somediscordId%d", rand.Intn(1000000)), fmt.Sprintf("coolsk8r1990%d", rand.Intn(1000000)), 1000)
+	naOpponent := createRatedUser(conn, fmt.Sprintf("somediscordId%d", rand.Intn(1000000)), fmt.Sprintf("coolsk8r1990%d", rand.Intn(1000000)), 1000)
+	oceOpponent := createRatedUser(conn, fmt.Sprintf("somediscordId%d", rand.Intn(1000000)), fmt.Sprintf("coolsk8r1990%d", rand.Intn(1000000)), 1000)
+	SetUserRegion(conn, requester.UserId, EU)
+	SetUserRegion(conn, naOpponent.UserId, NA)
+	SetUserRegion(conn, oceOpponent.UserId, OCE)
+
+	now := time.Now()
+	requesterRequest := MatchRequest{RequestingUserId: requester.UserId, CreatedAt: now, UpdatedAt: now, RequestRange: 300, RequestedGameMode: Bo1, MatchRequestState: MatchRequestStateQueued, RegionPreference: NeighbouringRegions}
+	CreateMatchRequest(conn, requesterRequest)
+	CreateMatchRequest(conn, MatchRequest{RequestingUserId: naOpponent.UserId, CreatedAt: now, UpdatedAt: now, RequestRange: 300, RequestedGameMode: Bo1, MatchRequestState: MatchRequestStateQueued, RegionPreference: AnyRegion})
+	CreateMatchRequest(conn, MatchRequest{RequestingUserId: oceOpponent.UserId, CreatedAt: now, UpdatedAt: now, RequestRange: 300, RequestedGameMode: Bo1, MatchRequestState: MatchRequestStateQueued, RegionPreference: AnyRegion})
+
+	// EU and OCE aren't neighbours.
+	pairings := FindCandidatePairings(conn, requesterRequest, now)
+	assert.Equal(t, len(pairings), 1)
+	assert.Equal(t, pairings[0].OpponentMatchRequest.RequestingUserId, naOpponent.UserId)
+	assert.Equal(t, pairings[0].RequesterRegion, EU)
+	assert.Equal(t, pairings[0].OpponentRegion, NA)
+
+	// The opponent's preference counts too.
+	CancelMatchRequest(conn, naOpponent.UserId)
+	CreateMatchRequest(conn, MatchRequest{RequestingUserId: naOpponent.UserId, CreatedAt: now, UpdatedAt: now, RequestRange: 300, RequestedGameMode: Bo1, MatchRequestState: MatchRequestStateQueued, RegionPreference: SameRegion})
+	requesterRequest.RegionPreference = AnyRegion
+	pairings = FindCandidatePairings(conn, requesterRequest, now)
+	assert.Equal(t, len(pairings), 1)
+	assert.Equal(t, pairings[0].OpponentMatchRequest.RequestingUserId, oceOpponent.UserId)
+
+	// Nobody knows where a player without a home region is, so only players happy with any region get them.
+	CancelMatchRequest(conn, naOpponent.UserId)
+	CancelMatchRequest(conn, oceOpponent.UserId)
+	noRegionOpponent := createRatedUser(conn, fmt.Sprintf("somediscordId%d", rand.Intn(1000000)), fmt.Sprintf("coolsk8r1990%d", rand.Intn(1000000)), 1000)
+	CreateMatchRequest(conn, MatchRequest{RequestingUserId: noRegionOpponent.UserId, CreatedAt: now, UpdatedAt: now, RequestRange: 300, RequestedGameMode: Bo1, MatchRequestState: MatchRequestStateQueued, RegionPreference: AnyRegion})
+	pairings = FindCandidatePairings(conn, requesterRequest, now)
+	assert.Equal(t, len(pairings), 1)
+	assert.Equal(t, pairings[0].OpponentRegion, NoRegion)
+	requesterRequest.RegionPreference = SameRegion
+	pairings = FindCandidatePairings(conn, requesterRequest, now)
+	assert.Equal(t, len(pairings), 0)
+
+	CancelMatchRequest(conn, requester.UserId)
+	CancelMatchRequest(conn, noRegionOpponent.UserId)
+}
+
+func TestQueueWindow(t *testing.T) {
+	now := time.Now()
+	assert.Equal(t, MatchRequest{CreatedAt: now}.QueueWindow(), ExpiryTimeMinutes*time.Minute)
+	assert.Equal(t, MatchRequest{CreatedAt: now, ExpiresAt: now.Add(2 * time.Hour)}.QueueWindow(), 2*time.Hour)
+}
+
+func TestFindExpiredRequestsHonoursDeadline(t *testing.T) {
+	conn := GetGorm(GetTestMysSQLConnStr())
+	conn.Exec("TRUNCATE TABLE match_requests")
+
+	rand.Seed(time.Now().UnixNano())
+
+	shortUser := createRatedUser(conn, fmt.Sprintf("somediscordId%d", rand.Intn(1000000)), fmt.Sprintf("coolsk8r1990%d", rand.Intn(1000000)), 1000)
+	longUser := createRatedUser(conn, fmt.Sprintf("somediscordId%d", rand.Intn(1000000)), fmt.Sprintf("coolsk8r1990%d", rand.Intn(1000000)), 1000)
+
+	queuedAt := time.Now().Add(-time.Hour)
+	CreateMatchRequest(conn, MatchRequest{RequestingUserId: shortUser.UserId, CreatedAt: queuedAt, UpdatedAt: queuedAt, RequestRange: 300, RequestedGameMode: Bo1, MatchRequestState: MatchRequestStateQueued, ExpiresAt: queuedAt.Add(15 * time.Minute)})
+	CreateMatchRequest(conn, MatchRequest{RequestingUserId: longUser.UserId, CreatedAt: queuedAt, UpdatedAt: queuedAt, RequestRange: 300, RequestedGameMode: Bo1, MatchRequestState: MatchRequestStateQueued, ExpiresAt: queuedAt.Add(3 * time.Hour)})
+
+	// Both have waited an hour, past the default, but only one said they had to go.
+	expired := FindExpiredRequests(conn, time.Now())
+	assert.Equal(t, len(expired), 1)
+	assert.Equal(t, expired[0].RequestingUserId, shortUser.UserId)
+
+	CancelMatchRequest(conn, shortUser.UserId)
+	CancelMatchRequest(conn, longUser.UserId)
+}
@@ -2,7 +2,8 @@ package db
 
 import (
 	"database/sql"
-	"discordbot/internal/app/ratings"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"gorm.io/gorm"
 	"log"
@@ -20,45 +21,94 @@ type Match struct {
 	P1MatchRequestId int
 	P2MatchRequestId int
 	Winner           WhoWon
+	Maps             []string
+	// MatchmakingPolicyId is the policy version that paired the players, 0 if the queue didn't pair them.
+	MatchmakingPolicyId int
+	// P1PartnerUserId and P2PartnerUserId are the teammates of P1 and P2 in a 2v2 match, 0 in a 1v1 match.
+	P1PartnerUserId int
+	P2PartnerUserId int
+	// Matchups are the factions drafted for each game in the order they were played, see MatchDraft.
+	Matchups []Matchup
 }
 
+/*
+	Matchup the faction each player plays in one game.
+*/
+type Matchup struct {
+	P1Faction string `json:"p1"`
+	P2Faction string `json:"p2"`
+}
+
+/*
+	IsTeamMatch whether the match is 2v2, with a partner on each side.
+*/
+func (m Match) IsTeamMatch() bool {
+	return m.P1PartnerUserId != 0
+}
+
+/*
+	PlayerIds everyone playing in the match, P1's side first.
+*/
+func (m Match) PlayerIds() (userIds []int) {
+	if m.IsTeamMatch() {
+		return []int{m.P1UserId, m.P1PartnerUserId, m.P2UserId, m.P2PartnerUserId}
+	}
+	return []int{m.P1UserId, m.P2UserId}
+}
+
+/*
+	OnP1Side whether the user is P1 or P1's partner, so the match's results for P1 are theirs.
+*/
+func (m Match) OnP1Side(userId int) bool {
+	return userId == m.P1UserId || (m.IsTeamMatch() && userId == m.P1PartnerUserId)
+}
+
+// errPairingFailed rolls back a pairing that couldn't be completed, releasing any requests it had claimed.
+var errPairingFailed = errors.New("pairing failed")
+
 /*
 CreateMatchFromRequests
 
 Translate two match requests to completed history records and indicate this in their states and create a Match from
 them.
+
+Both requests are claimed first, so when two pairings race for the same waiting request only one of them gets it and
+the other fails without writing anything. The match records the matchmaking policy that paired them.
 */
-func CreateMatchFromRequests(conn *gorm.DB, matchRequest1 MatchRequest, matchRequest2 MatchRequest) (success bool) {
+func CreateMatchFromRequests(conn *gorm.DB, matchRequest1 MatchRequest, matchRequest2 MatchRequest, matchmakingPolicyId int) (success bool) {
 	err := conn.Transaction(func(tx *gorm.DB) error {
+		if !claimMatchRequests(tx, matchRequest1.MatchRequestId, matchRequest2.MatchRequestId) {
+			log.Printf("Match requests %d and %d were no longer both queued, not pairing them.", matchRequest1.MatchRequestId, matchRequest2.MatchRequestId)
+			return errPairingFailed
+		}
+
 		// Create a match w/MR1 and 2 - need
 		persisted := CreateMatch(
 			tx,
 			Match{
-				CreatedAt:        time.Now(),
-				UpdatedAt:        time.Now(),
-				MatchState:       Matched,
-				GameMode:         matchRequest1.RequestedGameMode,
-				P1UserId:         matchRequest1.RequestingUserId,
-				P2UserId:         matchRequest2.RequestingUserId,
-				P1MatchRequestId: matchRequest1.MatchRequestId,
-				P2MatchRequestId: matchRequest2.MatchRequestId,
-				Winner:           Undefined,
+				CreatedAt:           time.Now(),
+				UpdatedAt:           time.Now(),
+				MatchState:          Matched,
+				GameMode:            matchRequest1.RequestedGameMode,
+				P1UserId:            matchRequest1.RequestingUserId,
+				P2UserId:            matchRequest2.RequestingUserId,
+				P1MatchRequestId:    matchRequest1.MatchRequestId,
+				P2MatchRequestId:    matchRequest2.MatchRequestId,
+				Winner:              Undefined,
+				MatchmakingPolicyId: matchmakingPolicyId,
 			})
 		if !persisted {
 			fmt.Printf("Failed to persist match, aborting create match from requests for match requests %v %v", matchRequest1, matchRequest2)
-			success = false
-			return nil
+			return errPairingFailed
 		}
 
 		delete1 := completeMatchRequest(tx, matchRequest1)
 		if !delete1 {
-			success = false
-			return nil
+			return errPairingFailed
 		}
 		delete2 := completeMatchRequest(tx, matchRequest2)
 		if !delete2 {
-			success = false
-			return nil
+			return errPairingFailed
 		}
 		success = true
 		return nil
@@ -70,27 +120,57 @@ func CreateMatchFromRequests(conn *gorm.DB, matchRequest1 MatchRequest, matchReq
 	return success
 }
 
+/*
+	claimMatchRequests marks both requests as taken, provided both are still queued. The updates hold row locks until the
+	transaction ends, so a concurrent claim on either request waits and then finds it gone. Requests are always locked
+	lowest id first so two claims can't deadlock on each other.
+*/
+func claimMatchRequests(tx *gorm.DB, matchRequestId1 int, matchRequestId2 int) (claimed bool) {
+	if matchRequestId1 == matchRequestId2 {
+		return false
+	}
+	if matchRequestId2 < matchRequestId1 {
+		matchRequestId1, matchRequestId2 = matchRequestId2, matchRequestId1
+	}
+	for _, v := range []int{matchRequestId1, matchRequestId2} {
+		result := tx.Exec(
+			"UPDATE match_requests SET match_request_state = ? WHERE id = ? AND match_request_state = ?",
+			MatchRequestStateCompleted,
+			v,
+			MatchRequestStateQueued)
+		if result.Error != nil {
+			log.Println(result.Error)
+			return false
+		}
+		if result.RowsAffected != 1 {
+			return false
+		}
+	}
+	return true
+}
+
 func CreateMatch(conn *gorm.DB, match Match) (success bool) {
 	// Create the new match and also its history record as one db txn
 	err := conn.Transaction(func(tx *gorm.DB) error {
+		// Lock every player so that a concurrent match for any of them waits until this one is committed, and then sees
+		// it in the check below.
+		if err := lockUsers(tx, match.PlayerIds()...); err != nil {
+			log.Printf("Unable to lock users %v to create a match: %v", match.PlayerIds(), err)
+			return err
+		}
 
 		// Enforce invariant of only one queued match per user at a time.
-		collision1, persistedCollision1 := GetCurrentMatch(tx, match.P1UserId)
-		collision2, persistedCollision2 := GetCurrentMatch(tx, match.P2UserId)
-
-		if collision1 {
-			log.Printf("Not persisting match %v because user %d already had match %d open.", match, match.P1UserId, persistedCollision1.MatchId)
-			success = false
-			return nil
-		}
-		if collision2 {
-			log.Printf("Not persisting match %v because user %d already had match %d open.", match, match.P2UserId, persistedCollision2.MatchId)
-			success = false
-			return nil
+		for _, userId := range match.PlayerIds() {
+			collision, persistedCollision := GetCurrentMatch(tx, userId)
+			if collision {
+				log.Printf("Not persisting match %v because user %d already had match %d open.", match, userId, persistedCollision.MatchId)
+				success = false
+				return nil
+			}
 		}
 
 		tx.Exec(
-			"INSERT INTO matches (created_at, updated_at, match_state, game_mode, p1_user_id, p2_user_id, p1_match_request_id, p2_match_request_id, winner) values (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+			"INSERT INTO matches (created_at, updated_at, match_state, game_mode, p1_user_id, p2_user_id, p1_match_request_id, p2_match_request_id, winner, maps, matchmaking_policy_id, p1_partner_user_id, p2_partner_user_id) values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
 			match.CreatedAt,
 			match.UpdatedAt,
 			match.MatchState,
@@ -100,6 +180,10 @@ func CreateMatch(conn *gorm.DB, match Match) (success bool) {
 			match.P1MatchRequestId,
 			match.P2MatchRequestId,
 			match.Winner,
+			serializeMaps(match.Maps),
+			nullableId(match.MatchmakingPolicyId),
+			nullableId(match.P1PartnerUserId),
+			nullableId(match.P2PartnerUserId),
 		)
 		if tx.Error != nil {
 			log.Println(tx.Error)
@@ -124,33 +208,29 @@ func CreateMatch(conn *gorm.DB, match Match) (success bool) {
 	return success
 }
 
-func GetPlayerKValue(conn *gorm.DB, userId int, mode GameMode) (kValue float64) {
-	row := conn.Raw(`SELECT COUNT(*) FROM matches WHERE (p1_user_id = ? OR p2_user_id = ?) AND match_state = 'completed'`, userId, userId).Row()
+/*
+	lockUsers takes a row lock on every user until the transaction ends. A lock wait timeout or deadlock comes back as
+	an error, which should fail the transaction rather than carry on unlocked.
+*/
+func lockUsers(tx *gorm.DB, userIds ...int) error {
+	var lockedIds []int
+	return tx.Raw("SELECT id FROM users WHERE id IN ? ORDER BY id FOR UPDATE", userIds).Scan(&lockedIds).Error
+}
+
+func GetCompletedMatchCount(conn *gorm.DB, userId int, mode GameMode) (totalMatches int) {
+	row := conn.Raw(`SELECT COUNT(*) FROM matches WHERE ? IN (p1_user_id, p2_user_id, p1_partner_user_id, p2_partner_user_id) AND game_mode = ? AND match_state = 'completed'`, userId, mode).Row()
 	if conn.Error != nil {
 		log.Println(conn.Error)
-		return ratings.K
+		return 0
 	}
-	var totalMatches int
 	err := row.Scan(&totalMatches)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return ratings.ProvisionalK
-		} else {
+		if err != sql.ErrNoRows {
 			log.Println(err)
-			return ratings.K
 		}
+		return 0
 	}
-
-	if totalMatches <= 9 {
-		kValue = ratings.ProvisionalK
-	} else {
-		kValue = ratings.K
-	}
-
-	if mode == Bo1 {
-		kValue = kValue / ratings.Bo1DiscountFactor
-	}
-	return kValue
+	return totalMatches
 }
 
 /*
@@ -168,13 +248,17 @@ func GetCurrentMatch(conn *gorm.DB, userId int) (foundMatch bool, result Match)
 				p2_user_id,
 				p1_match_request_id,
 				p2_match_request_id,
-				winner
+				winner,
+				maps,
+				matchmaking_policy_id,
+				p1_partner_user_id,
+				p2_partner_user_id,
+				matchups
 			FROM matches
 			WHERE
-				(p1_user_id = ? OR p2_user_id = ?) AND
+				? IN (p1_user_id, p2_user_id, p1_partner_user_id, p2_partner_user_id) AND
 				match_state = ?`,
 		userId,
-		userId,
 		Matched,
 	).Row()
 	if conn.Error != nil {
@@ -200,14 +284,18 @@ func GetMostRecentMatch(conn *gorm.DB, userId int) (foundMatch bool, result Matc
 				p2_user_id,
 				p1_match_request_id,
 				p2_match_request_id,
-				winner
+				winner,
+				maps,
+				matchmaking_policy_id,
+				p1_partner_user_id,
+				p2_partner_user_id,
+				matchups
 			FROM matches
 			WHERE
-				(p1_user_id = ? OR p2_user_id = ?) 
+				? IN (p1_user_id, p2_user_id, p1_partner_user_id, p2_partner_user_id)
 			ORDER BY created_at DESC
 			LIMIT 1`,
 		userId,
-		userId,
 	).Row()
 	if conn.Error != nil {
 		log.Println(conn.Error)
@@ -228,7 +316,12 @@ func GetMatchById(conn *gorm.DB, matchId int) (foundMatch bool, match Match) {
 				p2_user_id,
 				p1_match_request_id,
 				p2_match_request_id,
-				winner
+				winner,
+				maps,
+				matchmaking_policy_id,
+				p1_partner_user_id,
+				p2_partner_user_id,
+				matchups
 			FROM matches
 			WHERE
 				id = ?`, matchId).Row()
@@ -239,8 +332,70 @@ func GetMatchById(conn *gorm.DB, matchId int) (foundMatch bool, match Match) {
 	return parseMatchRow(row)
 }
 
+/*
+	GetCompletedMatches every completed match in the order it was played, used to replay ratings from scratch.
+*/
+func GetCompletedMatches(conn *gorm.DB) (result []Match) {
+	rows, err := conn.Raw(`
+			SELECT 
+				id,
+				created_at,
+				updated_at,
+				match_state,
+				game_mode,
+				p1_user_id,
+				p2_user_id,
+				p1_match_request_id,
+				p2_match_request_id,
+				winner,
+				maps,
+				matchmaking_policy_id,
+				p1_partner_user_id,
+				p2_partner_user_id,
+				matchups
+			FROM matches
+			WHERE
+				match_state = ?
+			ORDER BY created_at ASC, id ASC`, Completed).Rows()
+	if err != nil {
+		panic(err)
+	}
+
+	if conn.Error != nil {
+		panic(conn.Error)
+	}
+
+	for rows.Next() {
+		match, err := scanMatch(rows)
+		if err != nil {
+			panic(err)
+		}
+		result = append(result, match)
+	}
+	return result
+}
+
 func parseMatchRow(row *sql.Row) (success bool, result Match) {
-	err := row.Scan(
+	result, err := scanMatch(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return false, Match{}
+		} else {
+			log.Println(err)
+			return false, Match{}
+		}
+	}
+	return true, result
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanMatch(row rowScanner) (result Match, err error) {
+	var serializedMaps, serializedMatchups []byte
+	var matchmakingPolicyId, p1PartnerUserId, p2PartnerUserId sql.NullInt64
+	err = row.Scan(
 		&result.MatchId,
 		&result.CreatedAt,
 		&result.UpdatedAt,
@@ -250,16 +405,91 @@ func parseMatchRow(row *sql.Row) (success bool, result Match) {
 		&result.P2UserId,
 		&result.P1MatchRequestId,
 		&result.P2MatchRequestId,
-		&result.Winner)
+		&result.Winner,
+		&serializedMaps,
+		&matchmakingPolicyId,
+		&p1PartnerUserId,
+		&p2PartnerUserId,
+		&serializedMatchups)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return false, Match{}
-		} else {
-			log.Println(err)
-			return false, Match{}
+		return Match{}, err
+	}
+	result.MatchmakingPolicyId = int(matchmakingPolicyId.Int64)
+	result.P1PartnerUserId = int(p1PartnerUserId.Int64)
+	result.P2PartnerUserId = int(p2PartnerUserId.Int64)
+	// Matches from before we stored maps have none.
+	if serializedMaps != nil {
+		err = json.Unmarshal(serializedMaps, &result.Maps)
+		if err != nil {
+			return result, err
 		}
 	}
-	return true, result
+	if serializedMatchups != nil {
+		err = json.Unmarshal(serializedMatchups, &result.Matchups)
+	}
+	return result, err
+}
+
+/*
+	nullableId stores an id that's 0 when there isn't one as NULL.
+*/
+func nullableId(id int) interface{} {
+	if id == 0 {
+		return nil
+	}
+	return id
+}
+
+func serializeMaps(maps []string) (serialized []byte) {
+	if maps == nil {
+		return nil
+	}
+	serialized, err := json.Marshal(maps)
+	if err != nil {
+		panic(err)
+	}
+	return serialized
+}
+
+/*
+	SetMatchMaps records the maps that were handed out for a match in the order they should be played.
+*/
+func SetMatchMaps(conn *gorm.DB, matchId int, maps []string) (success bool) {
+	now := time.Now()
+	conn.Exec("UPDATE matches SET maps = ?, updated_at = ? WHERE id = ?", serializeMaps(maps), now, matchId)
+	if conn.Error != nil {
+		log.Println(conn.Error)
+		return false
+	}
+	_, match := GetMatchById(conn, matchId)
+	CreateMatchHistory(conn, match)
+	return true
+}
+
+func serializeMatchups(matchups []Matchup) (serialized []byte) {
+	if matchups == nil {
+		return nil
+	}
+	serialized, err := json.Marshal(matchups)
+	if err != nil {
+		panic(err)
+	}
+	return serialized
+}
+
+/*
+	SetMatchMatchups records the factions drafted for each game of a match so far.
+*/
+func SetMatchMatchups(conn *gorm.DB, matchId int, matchups []Matchup) (success bool) {
+	now := time.Now()
+	conn.Exec("UPDATE matches SET matchups = ?, updated_at = ? WHERE id = ?", serializeMatchups(matchups), now, matchId)
+	if conn.Error != nil {
+		log.Println(conn.Error)
+		return false
+	}
+	_, match := GetMatchById(conn, matchId)
+	CreateMatchHistory(conn, match)
+	return true
 }
 
 func UpdateMatch(conn *gorm.DB, matchId int, state MatchState, winner WhoWon) (success bool) {
@@ -276,7 +506,7 @@ func UpdateMatch(conn *gorm.DB, matchId int, state MatchState, winner WhoWon) (s
 
 func CreateMatchHistory(conn *gorm.DB, match Match) (success bool) {
 	conn.Exec(
-		"INSERT INTO matches_history (match_id, created_at, updated_at, match_state, game_mode, p1_user_id, p2_user_id, p1_match_request_id, p2_match_request_id, winner) values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		"INSERT INTO matches_history (match_id, created_at, updated_at, match_state, game_mode, p1_user_id, p2_user_id, p1_match_request_id, p2_match_request_id, winner, maps, matchmaking_policy_id, p1_partner_user_id, p2_partner_user_id, matchups) values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
 		match.MatchId,
 		match.CreatedAt,
 		match.UpdatedAt,
@@ -287,6 +517,11 @@ func CreateMatchHistory(conn *gorm.DB, match Match) (success bool) {
 		match.P1MatchRequestId,
 		match.P2MatchRequestId,
 		match.Winner,
+		serializeMaps(match.Maps),
+		nullableId(match.MatchmakingPolicyId),
+		nullableId(match.P1PartnerUserId),
+		nullableId(match.P2PartnerUserId),
+		serializeMatchups(match.Matchups),
 	)
 	if conn.Error != nil {
 		log.Println(conn.Error)
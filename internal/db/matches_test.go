@@ -19,8 +19,8 @@ func TestCreateMatchFromRequests(t *testing.T) {
 	testDiscordUsername2 := fmt.Sprintf("coolsk8r1990%d", rand.Intn(1000000))
 	testDiscordId2 := fmt.Sprintf("somediscordId%d", rand.Intn(1000000))
 
-	CreateUser(conn, User{0, testDiscordId1, testDiscordUsername1, 750})
-	CreateUser(conn, User{0, testDiscordId2, testDiscordUsername2, 800})
+	createRatedUser(conn, testDiscordId1, testDiscordUsername1, 750)
+	createRatedUser(conn, testDiscordId2, testDiscordUsername2, 800)
 
 	_, user1 := GetUserByDiscordId(conn, testDiscordId1)
 	_, user2 := GetUserByDiscordId(conn, testDiscordId2)
@@ -33,6 +33,9 @@ func TestCreateMatchFromRequests(t *testing.T) {
 		100,
 		Bo1,
 		MatchRequestStateQueued,
+		false,
+		AnyRegion,
+		time.Time{},
 	}
 
 	matchRequest2 := MatchRequest{
@@ -43,6 +46,9 @@ func TestCreateMatchFromRequests(t *testing.T) {
 		100,
 		All,
 		MatchRequestStateQueued,
+		false,
+		AnyRegion,
+		time.Time{},
 	}
 
 	CreateMatchRequest(conn, matchRequest)
@@ -51,7 +57,8 @@ func TestCreateMatchFromRequests(t *testing.T) {
 	_, r1 := GetMatchRequest(conn, user1.UserId)
 	_, r2 := GetMatchRequest(conn, user2.UserId)
 
-	success := CreateMatchFromRequests(conn, r1, r2)
+	policy := GetMatchmakingPolicy(conn, All)
+	success := CreateMatchFromRequests(conn, r1, r2, policy.PolicyId)
 
 	assert.True(t, success, "Failed to create match from requests.")
 
@@ -66,4 +73,5 @@ func TestCreateMatchFromRequests(t *testing.T) {
 
 	assert.Equal(t, matchForP1.MatchId, matchForP2.MatchId)
 	assert.Equal(t, matchForP1.MatchState, Matched)
+	assert.Equal(t, matchForP1.MatchmakingPolicyId, policy.PolicyId)
 }
@@ -0,0 +1,163 @@
+package db
+
+import (
+	"gorm.io/gorm"
+	"log"
+	"time"
+)
+
+// DefaultRatingRange is how far either side of their rating players match into unless they pick a range.
+const DefaultRatingRange = 300
+
+// DefaultRatingDeltaFloor is how many points apart two players are for rating closeness to count for nothing.
+const DefaultRatingDeltaFloor = 600
+
+/*
+	MatchmakingPolicy
+	How requests queued for one game mode are paired. Policies are never edited in place, saving one adds the next
+	version for its mode, and every match the queue starts records the version that paired it.
+*/
+type MatchmakingPolicy struct {
+	// PolicyId is 0 for a policy that hasn't been saved, see DefaultMatchmakingPolicy.
+	PolicyId int
+	GameMode GameMode
+	Version  int
+	// RatingWeight and WaitWeight weigh rating closeness and time already waited, each scaled from 0 to 1, when choosing
+	// between candidates.
+	RatingWeight       float64
+	WaitWeight         float64
+	RatingDeltaFloor   int
+	DefaultRange       int
+	QueueWindowMinutes int
+	CreatedAt          time.Time
+}
+
+/*
+	DefaultMatchmakingPolicy what a mode is paired with if no policy has been saved for it, the same as the first version
+	the migration saves for every mode.
+*/
+func DefaultMatchmakingPolicy(mode GameMode) MatchmakingPolicy {
+	return MatchmakingPolicy{
+		GameMode:           mode,
+		RatingWeight:       .3,
+		WaitWeight:         .7,
+		RatingDeltaFloor:   DefaultRatingDeltaFloor,
+		DefaultRange:       DefaultRatingRange,
+		QueueWindowMinutes: ExpiryTimeMinutes,
+	}
+}
+
+/*
+	Validate whether the policy could be used to pair anyone, with a message saying what's wrong if not.
+*/
+func (p MatchmakingPolicy) Validate() (valid bool, message string) {
+	if p.GameMode != Bo1 && p.GameMode != Bo3 && p.GameMode != All && p.GameMode != Team2v2 {
+		return false, "Game mode must be bo1, bo3, all or 2v2."
+	}
+	if p.RatingWeight < 0 || p.WaitWeight < 0 || p.RatingWeight+p.WaitWeight <= 0 {
+		return false, "Weights can't be negative and at least one has to be more than 0."
+	}
+	if p.RatingDeltaFloor <= 0 || p.DefaultRange <= 0 || p.QueueWindowMinutes <= 0 {
+		return false, "Rating delta floor, default range and queue window have to be more than 0."
+	}
+	return true, ""
+}
+
+/*
+	GetMatchmakingPolicy the latest version of the policy for the mode, or DefaultMatchmakingPolicy if none was saved.
+*/
+func GetMatchmakingPolicy(conn *gorm.DB, mode GameMode) (policy MatchmakingPolicy) {
+	policies := getMatchmakingPolicies(conn, "WHERE game_mode = ? ORDER BY version DESC LIMIT 1", mode)
+	if len(policies) == 0 {
+		return DefaultMatchmakingPolicy(mode)
+	}
+	return policies[0]
+}
+
+/*
+	GetMatchmakingPolicyHistory every version of the policy for the mode, newest first.
+*/
+func GetMatchmakingPolicyHistory(conn *gorm.DB, mode GameMode) (policies []MatchmakingPolicy) {
+	return getMatchmakingPolicies(conn, "WHERE game_mode = ? ORDER BY version DESC", mode)
+}
+
+/*
+	CreateMatchmakingPolicy saves the policy as the next version for its mode, which is used from then on. Returns it as
+	persisted, with its id and version.
+*/
+func CreateMatchmakingPolicy(conn *gorm.DB, policy MatchmakingPolicy) (success bool, persisted MatchmakingPolicy) {
+	err := conn.Transaction(func(tx *gorm.DB) error {
+		var latestVersion int
+		result := tx.Raw("SELECT COALESCE(MAX(version), 0) FROM matchmaking_policies WHERE game_mode = ? FOR UPDATE", policy.GameMode).Scan(&latestVersion)
+		if result.Error != nil {
+			log.Println(result.Error)
+			success = false
+			return nil
+		}
+		// A concurrent save of the same version fails on the unique key here, rather than being read back as ours.
+		result = tx.Exec(
+			"INSERT INTO matchmaking_policies (game_mode, version, rating_weight, wait_weight, rating_delta_floor, default_range, queue_window_minutes, created_at) values (?, ?, ?, ?, ?, ?, ?, ?)",
+			policy.GameMode,
+			latestVersion+1,
+			policy.RatingWeight,
+			policy.WaitWeight,
+			policy.RatingDeltaFloor,
+			policy.DefaultRange,
+			policy.QueueWindowMinutes,
+			policy.CreatedAt)
+		if result.Error != nil {
+			log.Println(result.Error)
+			success = false
+			return nil
+		}
+		persisted = GetMatchmakingPolicy(tx, policy.GameMode)
+		success = persisted.Version == latestVersion+1
+		return nil
+	})
+	if err != nil {
+		log.Println(err)
+		return false, MatchmakingPolicy{}
+	}
+	return success, persisted
+}
+
+func getMatchmakingPolicies(conn *gorm.DB, clauses string, args ...interface{}) (policies []MatchmakingPolicy) {
+	rows, err := conn.Raw(`
+		SELECT
+			id,
+			game_mode,
+			version,
+			rating_weight,
+			wait_weight,
+			rating_delta_floor,
+			default_range,
+			queue_window_minutes,
+			created_at
+		FROM matchmaking_policies `+clauses, args...).Rows()
+	if err != nil {
+		panic(err)
+	}
+
+	if conn.Error != nil {
+		panic(conn.Error)
+	}
+
+	for rows.Next() {
+		policy := MatchmakingPolicy{}
+		err := rows.Scan(
+			&policy.PolicyId,
+			&policy.GameMode,
+			&policy.Version,
+			&policy.RatingWeight,
+			&policy.WaitWeight,
+			&policy.RatingDeltaFloor,
+			&policy.DefaultRange,
+			&policy.QueueWindowMinutes,
+			&policy.CreatedAt)
+		if err != nil {
+			panic(err)
+		}
+		policies = append(policies, policy)
+	}
+	return policies
+}
@@ -0,0 +1,60 @@
+package db
+
+import (
+	"fmt"
+	"github.com/go-playground/assert/v2"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestMatchmakingPolicyVersions(t *testing.T) {
+	conn := GetGorm(GetTestMysSQLConnStr())
+	rand.Seed(time.Now().UnixNano())
+	// A mode of its own, so saving policies here doesn't change how other tests are paired.
+	mode := GameMode(fmt.Sprintf("test%d", rand.Intn(1000000)))
+
+	assert.Equal(t, GetMatchmakingPolicy(conn, mode), DefaultMatchmakingPolicy(mode))
+
+	policy := DefaultMatchmakingPolicy(mode)
+	policy.CreatedAt = time.Now().Truncate(time.Second)
+	success, first := CreateMatchmakingPolicy(conn, policy)
+	assert.Equal(t, success, true)
+	assert.Equal(t, first.Version, 1)
+	assert.NotEqual(t, first.PolicyId, 0)
+
+	policy.DefaultRange = 450
+	policy.RatingWeight, policy.WaitWeight = .5, .5
+	success, second := CreateMatchmakingPolicy(conn, policy)
+	assert.Equal(t, success, true)
+	assert.Equal(t, second.Version, 2)
+
+	current := GetMatchmakingPolicy(conn, mode)
+	assert.Equal(t, current.PolicyId, second.PolicyId)
+	assert.Equal(t, current.DefaultRange, 450)
+	assert.Equal(t, current.RatingWeight, .5)
+
+	history := GetMatchmakingPolicyHistory(conn, mode)
+	assert.Equal(t, len(history), 2)
+	assert.Equal(t, history[1].PolicyId, first.PolicyId)
+	assert.Equal(t, history[1].DefaultRange, DefaultRatingRange)
+}
+
+func TestValidateMatchmakingPolicy(t *testing.T) {
+	valid, _ := DefaultMatchmakingPolicy(Bo1).Validate()
+	assert.Equal(t, valid, true)
+
+	invalid := []MatchmakingPolicy{
+		DefaultMatchmakingPolicy("bo5"),
+		{GameMode: Bo1, RatingWeight: 0, WaitWeight: 0, RatingDeltaFloor: 600, DefaultRange: 300, QueueWindowMinutes: 45},
+		{GameMode: Bo1, RatingWeight: -.3, WaitWeight: 1.3, RatingDeltaFloor: 600, DefaultRange: 300, QueueWindowMinutes: 45},
+		{GameMode: Bo3, RatingWeight: .3, WaitWeight: .7, RatingDeltaFloor: 0, DefaultRange: 300, QueueWindowMinutes: 45},
+		{GameMode: All, RatingWeight: .3, WaitWeight: .7, RatingDeltaFloor: 600, DefaultRange: 0, QueueWindowMinutes: 45},
+		{GameMode: All, RatingWeight: .3, WaitWeight: .7, RatingDeltaFloor: 600, DefaultRange: 300, QueueWindowMinutes: 0},
+	}
+	for _, v := range invalid {
+		valid, message := v.Validate()
+		assert.Equal(t, valid, false)
+		assert.NotEqual(t, message, "")
+	}
+}
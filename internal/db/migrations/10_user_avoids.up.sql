@@ -0,0 +1,10 @@
+create table if not exists user_avoids (
+    id INT PRIMARY KEY AUTO_INCREMENT,
+    user_id int NOT NULL,
+    avoided_user_id int NOT NULL COMMENT 'Never paired with user_id, whichever of the two queues first.',
+    created_at timestamp NOT NULL,
+    UNIQUE KEY USER_AVOIDED_USER (user_id, avoided_user_id),
+    INDEX (avoided_user_id),
+    CONSTRAINT FK_USER_AVOIDS_USER FOREIGN KEY (user_id) REFERENCES users(id),
+    CONSTRAINT FK_USER_AVOIDS_AVOIDED_USER FOREIGN KEY (avoided_user_id) REFERENCES users(id)
+);
@@ -0,0 +1,8 @@
+alter table match_requests_history
+    drop column region_preference;
+
+alter table match_requests
+    drop column region_preference;
+
+alter table users
+    drop column region;
@@ -0,0 +1,8 @@
+alter table users
+    add column region varchar(8) NULL COMMENT 'Home region - EU | NA | OCE, null until the player sets one.';
+
+alter table match_requests
+    add column region_preference varchar(12) NOT NULL DEFAULT 'any' COMMENT 'How far from their home region the player will be paired - SAME | NEIGHBOURS | ANY.';
+
+alter table match_requests_history
+    add column region_preference varchar(12) NOT NULL DEFAULT 'any' COMMENT 'How far from their home region the player will be paired - SAME | NEIGHBOURS | ANY.';
@@ -0,0 +1,5 @@
+alter table match_requests_history
+    drop column expires_at;
+
+alter table match_requests
+    drop column expires_at;
@@ -0,0 +1,12 @@
+alter table match_requests
+    add column expires_at timestamp NULL COMMENT 'When the request leaves the queue if it has not been paired.';
+
+update match_requests set expires_at = TIMESTAMPADD(MINUTE, 45, created_at);
+
+alter table match_requests
+    modify column expires_at timestamp NOT NULL COMMENT 'When the request leaves the queue if it has not been paired.';
+
+alter table match_requests_history
+    add column expires_at timestamp NULL COMMENT 'When the request leaves the queue if it has not been paired.';
+
+update match_requests_history set expires_at = TIMESTAMPADD(MINUTE, 45, created_at);
@@ -0,0 +1,2 @@
+drop table if exists user_strikes;
+drop table if exists ready_checks;
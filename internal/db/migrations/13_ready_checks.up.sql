@@ -0,0 +1,23 @@
+create table if not exists ready_checks (
+    id INT PRIMARY KEY AUTO_INCREMENT,
+    match_id int NOT NULL,
+    created_at timestamp NOT NULL,
+    expires_at timestamp NOT NULL COMMENT 'The match is cancelled if both players have not accepted by then.',
+    p1_response varchar(16) NOT NULL DEFAULT '',
+    p2_response varchar(16) NOT NULL DEFAULT '',
+    resolved_at timestamp NULL COMMENT 'Set once both players accept or the check fails.',
+    UNIQUE KEY READY_CHECK_MATCH (match_id),
+    INDEX (resolved_at, expires_at),
+    CONSTRAINT FK_READY_CHECKS_MATCH FOREIGN KEY (match_id) REFERENCES matches(id)
+);
+
+create table if not exists user_strikes (
+    id INT PRIMARY KEY AUTO_INCREMENT,
+    user_id int NOT NULL,
+    match_id int NOT NULL,
+    reason varchar(32) NOT NULL,
+    created_at timestamp NOT NULL,
+    INDEX (user_id),
+    CONSTRAINT FK_USER_STRIKES_USER FOREIGN KEY (user_id) REFERENCES users(id),
+    CONSTRAINT FK_USER_STRIKES_MATCH FOREIGN KEY (match_id) REFERENCES matches(id)
+);
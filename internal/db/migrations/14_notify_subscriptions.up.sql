@@ -0,0 +1,14 @@
+create table if not exists notify_subscriptions (
+    id INT PRIMARY KEY AUTO_INCREMENT,
+    user_id int NOT NULL,
+    game_mode varchar(16) NOT NULL,
+    rating_range int NOT NULL,
+    window_start_hour int NOT NULL DEFAULT 0 COMMENT 'UTC hour notifications start each day, equal to window_end_hour for all day.',
+    window_end_hour int NOT NULL DEFAULT 0 COMMENT 'UTC hour notifications stop each day.',
+    created_at timestamp NOT NULL,
+    expires_at timestamp NOT NULL,
+    last_notified_at timestamp NULL,
+    UNIQUE KEY NOTIFY_SUBSCRIPTION_USER (user_id),
+    INDEX (expires_at),
+    CONSTRAINT FK_NOTIFY_SUBSCRIPTIONS_USER FOREIGN KEY (user_id) REFERENCES users(id)
+);
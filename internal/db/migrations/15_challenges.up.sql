@@ -0,0 +1,17 @@
+create table if not exists challenges (
+    id INT PRIMARY KEY AUTO_INCREMENT,
+    challenger_user_id int NOT NULL,
+    challenged_user_id int NOT NULL,
+    game_mode varchar(16) NOT NULL,
+    challenge_state varchar(12) NOT NULL COMMENT 'PENDING | ACCEPTED | DECLINED | EXPIRED | LIMITED',
+    created_at timestamp NOT NULL,
+    updated_at timestamp NOT NULL,
+    expires_at timestamp NOT NULL,
+    match_id int NULL COMMENT 'The match started when the challenge was accepted.',
+    INDEX (challenger_user_id, challenged_user_id),
+    INDEX (challenged_user_id),
+    INDEX (challenge_state, expires_at),
+    CONSTRAINT FK_CHALLENGES_CHALLENGER FOREIGN KEY (challenger_user_id) REFERENCES users(id),
+    CONSTRAINT FK_CHALLENGES_CHALLENGED FOREIGN KEY (challenged_user_id) REFERENCES users(id),
+    CONSTRAINT FK_CHALLENGES_MATCH FOREIGN KEY (match_id) REFERENCES matches(id)
+);
@@ -0,0 +1,7 @@
+alter table matches_history
+    drop column matchmaking_policy_id;
+
+alter table matches
+    drop column matchmaking_policy_id;
+
+drop table if exists matchmaking_policies;
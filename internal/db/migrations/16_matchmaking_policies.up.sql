@@ -0,0 +1,23 @@
+create table if not exists matchmaking_policies (
+    id INT PRIMARY KEY AUTO_INCREMENT,
+    game_mode varchar(16) NOT NULL COMMENT 'The mode requests are queued for, including all.',
+    version int NOT NULL COMMENT 'Counts up from 1 for each game mode, the highest is the one in use.',
+    rating_weight double NOT NULL COMMENT 'How much rating closeness counts when choosing between candidates.',
+    wait_weight double NOT NULL COMMENT 'How much time already waited counts when choosing between candidates.',
+    rating_delta_floor int NOT NULL COMMENT 'How many points apart two players are for rating closeness to count for nothing.',
+    default_range int NOT NULL COMMENT 'The rating range of players who do not pick one.',
+    queue_window_minutes int NOT NULL COMMENT 'How long players who do not say how long they are available stay queued.',
+    created_at timestamp NOT NULL,
+    UNIQUE KEY MATCHMAKING_POLICY_VERSION (game_mode, version)
+);
+
+insert into matchmaking_policies (game_mode, version, rating_weight, wait_weight, rating_delta_floor, default_range, queue_window_minutes, created_at) values
+    ('bo1', 1, 0.3, 0.7, 600, 300, 45, CURRENT_TIMESTAMP),
+    ('bo3', 1, 0.3, 0.7, 600, 300, 45, CURRENT_TIMESTAMP),
+    ('all', 1, 0.3, 0.7, 600, 300, 45, CURRENT_TIMESTAMP);
+
+alter table matches
+    add column matchmaking_policy_id int NULL COMMENT 'The matchmaking policy version that paired the players, NULL when the queue did not pair them.';
+
+alter table matches_history
+    add column matchmaking_policy_id int NULL;
@@ -0,0 +1,17 @@
+delete from user_ratings_history where game_mode = '2v2';
+delete from user_ratings where game_mode = '2v2';
+delete from matchmaking_policies where game_mode = '2v2';
+
+drop table if exists team_queue_entries;
+
+alter table matches_history
+    drop column p2_partner_user_id,
+    drop column p1_partner_user_id;
+
+alter table matches
+    drop foreign key FK_P2_PARTNER_USER,
+    drop foreign key FK_P1_PARTNER_USER;
+
+alter table matches
+    drop column p2_partner_user_id,
+    drop column p1_partner_user_id;
@@ -0,0 +1,35 @@
+alter table matches
+    add column p1_partner_user_id int NULL COMMENT 'P1''s teammate in a 2v2 match, NULL for 1v1 matches.',
+    add column p2_partner_user_id int NULL COMMENT 'P2''s teammate in a 2v2 match, NULL for 1v1 matches.',
+    add INDEX (p1_partner_user_id),
+    add INDEX (p2_partner_user_id),
+    add CONSTRAINT FK_P1_PARTNER_USER FOREIGN KEY (p1_partner_user_id) REFERENCES users(id),
+    add CONSTRAINT FK_P2_PARTNER_USER FOREIGN KEY (p2_partner_user_id) REFERENCES users(id);
+
+alter table matches_history
+    add column p1_partner_user_id int NULL,
+    add column p2_partner_user_id int NULL;
+
+create table if not exists team_queue_entries (
+    id INT PRIMARY KEY AUTO_INCREMENT,
+    user_id int UNIQUE NOT NULL,
+    partner_user_id int NULL COMMENT 'The teammate the player queued with, NULL to be teamed up with another solo player.',
+    created_at timestamp NOT NULL,
+    expires_at timestamp NOT NULL,
+    INDEX (expires_at),
+    CONSTRAINT FK_TEAM_QUEUE_USER FOREIGN KEY (user_id) REFERENCES users(id),
+    CONSTRAINT FK_TEAM_QUEUE_PARTNER FOREIGN KEY (partner_user_id) REFERENCES users(id)
+);
+
+insert into matchmaking_policies (game_mode, version, rating_weight, wait_weight, rating_delta_floor, default_range, queue_window_minutes, created_at) values
+    ('2v2', 1, 0.3, 0.7, 600, 300, 45, CURRENT_TIMESTAMP);
+
+-- Everyone already registered starts the 2v2 ladder at the default rating, with the initial history entry reverts
+-- unwind to.
+insert into user_ratings (user_id, game_mode, rating)
+    select u.id, '2v2', 1200 from users u
+    where not exists (select 1 from user_ratings ur where ur.user_id = u.id and ur.game_mode = '2v2');
+insert into user_ratings_history (user_id, game_mode, rating, deviation, volatility, match_id, reason, is_tombstoned, created_at)
+    select ur.user_id, '2v2', ur.rating, ur.deviation, ur.volatility, -1, 'initial', false, CURRENT_TIMESTAMP from user_ratings ur
+    where ur.game_mode = '2v2' and not exists (
+        select 1 from user_ratings_history h where h.user_id = ur.user_id and h.game_mode = '2v2');
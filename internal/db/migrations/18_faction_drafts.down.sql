@@ -0,0 +1,7 @@
+drop table if exists match_drafts;
+
+alter table matches_history
+    drop column matchups;
+
+alter table matches
+    drop column matchups;
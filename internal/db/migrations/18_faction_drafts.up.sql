@@ -0,0 +1,21 @@
+alter table matches
+    add column matchups json COMMENT 'Factions drafted for each game in the order they were played.';
+
+alter table matches_history
+    add column matchups json;
+
+create table if not exists match_drafts (
+    id INT PRIMARY KEY AUTO_INCREMENT,
+    match_id int NOT NULL,
+    game_number int NOT NULL COMMENT 'Which game of the series the draft is for, starting at 1.',
+    p1_picks json NOT NULL COMMENT 'Factions P1 blind picked, hidden from P2 until both have picked.',
+    p2_picks json NOT NULL,
+    bans json NOT NULL COMMENT 'Matchups banned so far in the order they were banned.',
+    p1_bans_first bool NOT NULL,
+    winner char(2) NOT NULL DEFAULT '' COMMENT 'Who won the game once a player says - P1 | P2, used to draft the next game.',
+    version int NOT NULL DEFAULT 0 COMMENT 'Bumped on every change so two button presses at once cannot overwrite each other.',
+    created_at timestamp NOT NULL,
+    updated_at timestamp NOT NULL,
+    UNIQUE KEY MATCH_DRAFT_GAME_NUMBER (match_id, game_number),
+    CONSTRAINT FK_MATCH_DRAFTS_MATCH FOREIGN KEY (match_id) REFERENCES matches(id)
+);
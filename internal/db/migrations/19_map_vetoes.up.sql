@@ -0,0 +1,16 @@
+create table if not exists map_vetoes (
+    id INT PRIMARY KEY AUTO_INCREMENT,
+    match_id int NOT NULL,
+    pool json NOT NULL COMMENT 'Maps the veto bans from, in the order any left are played.',
+    maps_needed int NOT NULL COMMENT 'How many maps the match is played on.',
+    bans_per_player int NOT NULL,
+    bans json NOT NULL COMMENT 'Maps banned so far in the order they were banned, P1 first.',
+    version int NOT NULL DEFAULT 0 COMMENT 'Bumped on every ban so two button presses at once cannot overwrite each other.',
+    created_at timestamp NOT NULL,
+    updated_at timestamp NOT NULL,
+    expires_at timestamp NOT NULL COMMENT 'Maps are assigned at random if the player whose turn it is has not banned by then.',
+    resolved_at timestamp NULL COMMENT 'Set once the maps are decided, by the veto or at random.',
+    UNIQUE KEY MAP_VETO_MATCH (match_id),
+    INDEX (resolved_at, expires_at),
+    CONSTRAINT FK_MAP_VETOES_MATCH FOREIGN KEY (match_id) REFERENCES matches(id)
+);
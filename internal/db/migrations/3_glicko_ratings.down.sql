@@ -0,0 +1,7 @@
+alter table user_ratings_history
+    drop column deviation,
+    drop column volatility;
+
+alter table users
+    drop column current_deviation,
+    drop column current_volatility;
@@ -0,0 +1,7 @@
+alter table users
+    add column current_deviation double NOT NULL DEFAULT 350 COMMENT 'Glicko-2 rating deviation, unused by Elo.',
+    add column current_volatility double NOT NULL DEFAULT 0.06 COMMENT 'Glicko-2 rating volatility, unused by Elo.';
+
+alter table user_ratings_history
+    add column deviation double NOT NULL DEFAULT 350,
+    add column volatility double NOT NULL DEFAULT 0.06;
@@ -0,0 +1,16 @@
+alter table users
+    add column current_rating int,
+    add column current_deviation double NOT NULL DEFAULT 350,
+    add column current_volatility double NOT NULL DEFAULT 0.06;
+
+update users u
+    inner join user_ratings ur ON ur.user_id = u.id AND ur.game_mode = 'bo3'
+    set u.current_rating = ur.rating, u.current_deviation = ur.deviation, u.current_volatility = ur.volatility;
+
+delete from user_ratings_history where game_mode != 'bo3';
+
+alter table user_ratings_history
+    drop index USER_RATING_HISTORY_MODE,
+    drop column game_mode;
+
+drop table if exists user_ratings;
@@ -0,0 +1,30 @@
+create table if not exists user_ratings (
+    id INT PRIMARY KEY AUTO_INCREMENT,
+    user_id int NOT NULL,
+    game_mode varchar(12) NOT NULL COMMENT 'Each rated game mode is its own ladder - bo1 | bo3.',
+    rating int NOT NULL,
+    deviation double NOT NULL DEFAULT 350 COMMENT 'Glicko-2 rating deviation, unused by Elo.',
+    volatility double NOT NULL DEFAULT 0.06 COMMENT 'Glicko-2 rating volatility, unused by Elo.',
+    UNIQUE KEY USER_RATING_MODE (user_id, game_mode),
+    CONSTRAINT FK_USER_RATINGS_USER FOREIGN KEY (user_id) REFERENCES users(id),
+    INDEX (game_mode, rating)
+);
+
+-- Both ladders start from the rating players had earned when bo1 and bo3 shared one.
+insert into user_ratings (user_id, game_mode, rating, deviation, volatility)
+    select id, 'bo1', current_rating, current_deviation, current_volatility from users;
+insert into user_ratings (user_id, game_mode, rating, deviation, volatility)
+    select id, 'bo3', current_rating, current_deviation, current_volatility from users;
+
+alter table user_ratings_history
+    add column game_mode varchar(12) NOT NULL DEFAULT 'bo3',
+    add index USER_RATING_HISTORY_MODE (user_id, game_mode);
+
+-- Give the bo1 ladder the same lineage so reverts work in either mode.
+insert into user_ratings_history (user_id, rating, deviation, volatility, match_id, is_tombstoned, created_at, game_mode)
+    select user_id, rating, deviation, volatility, match_id, is_tombstoned, created_at, 'bo1' from user_ratings_history;
+
+alter table users
+    drop column current_rating,
+    drop column current_deviation,
+    drop column current_volatility;
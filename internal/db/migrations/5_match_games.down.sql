@@ -0,0 +1,7 @@
+drop table if exists match_games;
+
+alter table matches_history
+    drop column maps;
+
+alter table matches
+    drop column maps;
@@ -0,0 +1,16 @@
+alter table matches
+    add column maps json COMMENT 'Maps assigned to the match in the order they should be played.';
+
+alter table matches_history
+    add column maps json;
+
+create table if not exists match_games (
+    id INT PRIMARY KEY AUTO_INCREMENT,
+    match_id int NOT NULL,
+    game_number int NOT NULL COMMENT 'Order the game was played in the series, starting at 1.',
+    winner char(2) NOT NULL COMMENT 'Who won this game - P1 | P2.',
+    map_name varchar(255) COMMENT 'Map the game was played on if we had one assigned.',
+    created_at timestamp NOT NULL,
+    UNIQUE KEY MATCH_GAME_NUMBER (match_id, game_number),
+    CONSTRAINT FK_MATCH_GAMES_MATCH FOREIGN KEY (match_id) REFERENCES matches(id)
+);
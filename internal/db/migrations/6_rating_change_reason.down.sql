@@ -0,0 +1,4 @@
+delete from user_ratings_history where reason = 'decay';
+
+alter table user_ratings_history
+    drop column reason;
@@ -0,0 +1,4 @@
+alter table user_ratings_history
+    add column reason varchar(16) NOT NULL DEFAULT 'match' COMMENT 'Why the rating changed - initial | match | decay.';
+
+update user_ratings_history set reason = 'initial' where match_id = -1;
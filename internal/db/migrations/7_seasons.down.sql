@@ -0,0 +1,5 @@
+delete from user_ratings_history where reason = 'season_reset';
+
+drop table if exists season_standings;
+
+drop table if exists seasons;
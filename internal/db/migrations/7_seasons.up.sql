@@ -0,0 +1,22 @@
+create table if not exists seasons (
+    id INT PRIMARY KEY AUTO_INCREMENT,
+    name varchar(255) NOT NULL,
+    started_at timestamp NOT NULL,
+    ended_at timestamp NULL COMMENT 'Null while the season is still running.',
+    soft_reset_factor double NOT NULL COMMENT 'How far ratings were pulled back toward the default at season start, 0 - 1.'
+);
+
+create table if not exists season_standings (
+    id INT PRIMARY KEY AUTO_INCREMENT,
+    season_id int NOT NULL,
+    user_id int NOT NULL,
+    game_mode varchar(12) NOT NULL,
+    final_rank int NOT NULL,
+    rating int NOT NULL,
+    wins int NOT NULL,
+    losses int NOT NULL,
+    created_at timestamp NOT NULL,
+    UNIQUE KEY SEASON_USER_MODE (season_id, user_id, game_mode),
+    CONSTRAINT FK_SEASON_STANDINGS_SEASON FOREIGN KEY (season_id) REFERENCES seasons(id),
+    CONSTRAINT FK_SEASON_STANDINGS_USER FOREIGN KEY (user_id) REFERENCES users(id)
+);
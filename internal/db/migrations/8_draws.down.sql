@@ -0,0 +1,8 @@
+alter table season_standings
+    drop column draws;
+
+alter table matches_history
+    modify column winner char(2) COMMENT 'Who won - P1 | P2.';
+
+alter table matches
+    modify column winner char(2) COMMENT 'Who won - P1 | P2.';
@@ -0,0 +1,8 @@
+alter table matches
+    modify column winner char(2) COMMENT 'Who won - P1 | P2, or DR for a draw.';
+
+alter table matches_history
+    modify column winner char(2) COMMENT 'Who won - P1 | P2, or DR for a draw.';
+
+alter table season_standings
+    add column draws int NOT NULL DEFAULT 0;
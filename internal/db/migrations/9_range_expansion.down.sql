@@ -0,0 +1,5 @@
+alter table match_requests_history
+    drop column fixed_range;
+
+alter table match_requests
+    drop column fixed_range;
@@ -0,0 +1,5 @@
+alter table match_requests
+    add column fixed_range boolean NOT NULL DEFAULT false COMMENT 'Whether the player opted out of their range widening the longer they wait.';
+
+alter table match_requests_history
+    add column fixed_range boolean NOT NULL DEFAULT false COMMENT 'Whether the player opted out of their range widening the longer they wait.';
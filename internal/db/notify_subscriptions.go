@@ -0,0 +1,191 @@
+package db
+
+import (
+	"database/sql"
+	"gorm.io/gorm"
+	"log"
+	"time"
+)
+
+/*
+	NotifySubscription a player asking to be DMed when someone they could play joins the queue, instead of waiting in it
+	themselves. Each player has at most one.
+*/
+type NotifySubscription struct {
+	UserId      int
+	GameMode    GameMode
+	RatingRange int
+	// WindowStartHour and WindowEndHour are the UTC hours of the day to notify in, equal for any time of day.
+	WindowStartHour int
+	WindowEndHour   int
+	CreatedAt       time.Time
+	ExpiresAt       time.Time
+	// LastNotifiedAt is zero until the first notification.
+	LastNotifiedAt time.Time
+}
+
+/*
+	InWindow whether now falls in the subscription's hours of the day. Windows can run past midnight, e.g. 22 to 2.
+*/
+func (s NotifySubscription) InWindow(now time.Time) bool {
+	if s.WindowStartHour == s.WindowEndHour {
+		return true
+	}
+	hour := now.UTC().Hour()
+	if s.WindowStartHour < s.WindowEndHour {
+		return hour >= s.WindowStartHour && hour < s.WindowEndHour
+	}
+	return hour >= s.WindowStartHour || hour < s.WindowEndHour
+}
+
+/*
+	UpsertNotifySubscription replaces any subscription the user already has.
+*/
+func UpsertNotifySubscription(conn *gorm.DB, subscription NotifySubscription) (success bool) {
+	conn.Exec(`
+		INSERT INTO notify_subscriptions (user_id, game_mode, rating_range, window_start_hour, window_end_hour, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE
+			game_mode = VALUES(game_mode),
+			rating_range = VALUES(rating_range),
+			window_start_hour = VALUES(window_start_hour),
+			window_end_hour = VALUES(window_end_hour),
+			created_at = VALUES(created_at),
+			expires_at = VALUES(expires_at)`,
+		subscription.UserId,
+		subscription.GameMode,
+		subscription.RatingRange,
+		subscription.WindowStartHour,
+		subscription.WindowEndHour,
+		subscription.CreatedAt,
+		subscription.ExpiresAt)
+	if conn.Error != nil {
+		log.Println(conn.Error)
+		return false
+	}
+	return true
+}
+
+func DeleteNotifySubscription(conn *gorm.DB, userId int) (removed bool) {
+	result := conn.Exec("DELETE FROM notify_subscriptions WHERE user_id = ?", userId)
+	if result.Error != nil {
+		log.Println(result.Error)
+		return false
+	}
+	return result.RowsAffected > 0
+}
+
+func DeleteExpiredNotifySubscriptions(conn *gorm.DB, now time.Time) (deleted int) {
+	result := conn.Exec("DELETE FROM notify_subscriptions WHERE expires_at <= ?", now)
+	if result.Error != nil {
+		log.Println(result.Error)
+		return 0
+	}
+	return int(result.RowsAffected)
+}
+
+func GetNotifySubscription(conn *gorm.DB, userId int) (foundSubscription bool, subscription NotifySubscription) {
+	subscriptions := getNotifySubscriptions(conn, "WHERE ns.user_id = ?", userId)
+	if len(subscriptions) == 0 {
+		return false, subscription
+	}
+	return true, subscriptions[0]
+}
+
+/*
+	FindNotifySubscribers the live subscriptions a newly queued request fits. The request has to suit the subscription's
+	mode and range, and the subscriber has to be within the request's range, on the ladder the two would play. Players
+	who are queued or mid match themselves, either of whom avoids the other, or who were notified within cooldown are
+	left out. The time of day window is left to the caller, see InWindow.
+*/
+func FindNotifySubscribers(conn *gorm.DB, request MatchRequest, now time.Time, cooldown time.Duration) (subscriptions []NotifySubscription) {
+	return getNotifySubscriptions(conn, `
+		LEFT JOIN user_ratings subscriber_rating
+			ON subscriber_rating.user_id = ns.user_id AND
+			subscriber_rating.game_mode = IF(ns.game_mode = @game_mode_all, IF(@requested_game_mode = @game_mode_all, @all_vs_all_game_mode, @requested_game_mode), ns.game_mode)
+		LEFT JOIN user_ratings requester_rating
+			ON requester_rating.user_id = @requester_user_id AND
+			requester_rating.game_mode = IF(ns.game_mode = @game_mode_all, IF(@requested_game_mode = @game_mode_all, @all_vs_all_game_mode, @requested_game_mode), ns.game_mode)
+		WHERE
+			ns.user_id != @requester_user_id AND
+			ns.expires_at > @now AND
+			(ns.last_notified_at IS NULL OR ns.last_notified_at <= @notified_before) AND
+			(ns.game_mode = @requested_game_mode OR ns.game_mode = @game_mode_all OR @requested_game_mode = @game_mode_all) AND
+			ABS(COALESCE(subscriber_rating.rating, @default_rating) - COALESCE(requester_rating.rating, @default_rating)) <= LEAST(ns.rating_range, @request_range) AND
+			NOT EXISTS (SELECT 1 FROM match_requests mr WHERE mr.requesting_user_id = ns.user_id) AND
+			NOT EXISTS (SELECT 1 FROM matches m WHERE ns.user_id IN (m.p1_user_id, m.p2_user_id, m.p1_partner_user_id, m.p2_partner_user_id) AND m.match_state = @matched) AND
+			NOT EXISTS (
+				SELECT 1 FROM user_avoids ua
+				WHERE
+					(ua.user_id = @requester_user_id AND ua.avoided_user_id = ns.user_id) OR
+					(ua.user_id = ns.user_id AND ua.avoided_user_id = @requester_user_id)
+			)
+		ORDER BY ns.created_at ASC`,
+		sql.Named("requester_user_id", request.RequestingUserId),
+		sql.Named("requested_game_mode", request.RequestedGameMode),
+		sql.Named("game_mode_all", All),
+		sql.Named("all_vs_all_game_mode", AllVsAllGameMode),
+		sql.Named("default_rating", DEFAULT_RATING),
+		sql.Named("request_range", EffectiveRange(request, now)),
+		sql.Named("now", now),
+		sql.Named("matched", Matched),
+		sql.Named("notified_before", now.Add(-cooldown)))
+}
+
+/*
+	MarkNotified records a notification, unless the subscriber was already notified within cooldown. Returns whether to
+	go ahead and notify them.
+*/
+func MarkNotified(conn *gorm.DB, userId int, now time.Time, cooldown time.Duration) (marked bool) {
+	result := conn.Exec(
+		"UPDATE notify_subscriptions SET last_notified_at = ? WHERE user_id = ? AND (last_notified_at IS NULL OR last_notified_at <= ?)",
+		now,
+		userId,
+		now.Add(-cooldown))
+	if result.Error != nil {
+		log.Println(result.Error)
+		return false
+	}
+	return result.RowsAffected > 0
+}
+
+func getNotifySubscriptions(conn *gorm.DB, clauses string, args ...interface{}) (subscriptions []NotifySubscription) {
+	rows, err := conn.Raw(`
+		SELECT
+			ns.user_id,
+			ns.game_mode,
+			ns.rating_range,
+			ns.window_start_hour,
+			ns.window_end_hour,
+			ns.created_at,
+			ns.expires_at,
+			ns.last_notified_at
+		FROM notify_subscriptions ns `+clauses, args...).Rows()
+	if err != nil {
+		panic(err)
+	}
+
+	if conn.Error != nil {
+		panic(conn.Error)
+	}
+
+	for rows.Next() {
+		subscription := NotifySubscription{}
+		var lastNotifiedAt sql.NullTime
+		err := rows.Scan(
+			&subscription.UserId,
+			&subscription.GameMode,
+			&subscription.RatingRange,
+			&subscription.WindowStartHour,
+			&subscription.WindowEndHour,
+			&subscription.CreatedAt,
+			&subscription.ExpiresAt,
+			&lastNotifiedAt)
+		if err != nil {
+			panic(err)
+		}
+		subscription.LastNotifiedAt = lastNotifiedAt.Time
+		subscriptions = append(subscriptions, subscription)
+	}
+	return subscriptions
+}
@@ -0,0 +1,69 @@
+package db
+
+import (
+	"fmt"
+	"github.com/go-playground/assert/v2"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestNotifySubscriptionInWindow(t *testing.T) {
+	at := func(hour int) time.Time {
+		return time.Date(2023, 1, 1, hour, 30, 0, 0, time.UTC)
+	}
+	allDay := NotifySubscription{}
+	assert.Equal(t, allDay.InWindow(at(3)), true)
+
+	evenings := NotifySubscription{WindowStartHour: 18, WindowEndHour: 23}
+	assert.Equal(t, evenings.InWindow(at(18)), true)
+	assert.Equal(t, evenings.InWindow(at(23)), false)
+	assert.Equal(t, evenings.InWindow(at(12)), false)
+
+	overnight := NotifySubscription{WindowStartHour: 22, WindowEndHour: 2}
+	assert.Equal(t, overnight.InWindow(at(23)), true)
+	assert.Equal(t, overnight.InWindow(at(1)), true)
+	assert.Equal(t, overnight.InWindow(at(2)), false)
+}
+
+func TestFindNotifySubscribers(t *testing.T) {
+	conn := GetGorm(GetTestMysSQLConnStr())
+	conn.Exec("TRUNCATE TABLE match_requests")
+	conn.Exec("DELETE FROM notify_subscriptions")
+
+	rand.Seed(time.Now().UnixNano())
+	requester := createRatedUser(conn, fmt.Sprintf("somediscordId%d", rand.Intn(1000000)), fmt.Sprintf("coolsk8r1990%d", rand.Intn(1000000)), 1000)
+	nearby := createRatedUser(conn, fmt.Sprintf("somediscordId%d", rand.Intn(1000000)), fmt.Sprintf("coolsk8r1990%d", rand.Intn(1000000)), 1100)
+	farAway := createRatedUser(conn, fmt.Sprintf("somediscordId%d", rand.Intn(1000000)), fmt.Sprintf("coolsk8r1990%d", rand.Intn(1000000)), 1600)
+	bo3Only := createRatedUser(conn, fmt.Sprintf("somediscordId%d", rand.Intn(1000000)), fmt.Sprintf("coolsk8r1990%d", rand.Intn(1000000)), 1000)
+
+	now := time.Now()
+	for _, v := range []NotifySubscription{
+		{UserId: nearby.UserId, GameMode: All, RatingRange: 300},
+		{UserId: farAway.UserId, GameMode: Bo1, RatingRange: 1000},
+		{UserId: bo3Only.UserId, GameMode: Bo3, RatingRange: 300},
+	} {
+		v.CreatedAt = now
+		v.ExpiresAt = now.Add(time.Hour)
+		assert.Equal(t, UpsertNotifySubscription(conn, v), true)
+	}
+
+	request := MatchRequest{RequestingUserId: requester.UserId, CreatedAt: now, UpdatedAt: now, RequestRange: 300, RequestedGameMode: Bo1, MatchRequestState: MatchRequestStateQueued}
+	CreateMatchRequest(conn, request)
+
+	// Only nearby fits - farAway is outside the requester's range and bo3Only wants another mode.
+	subscribers := FindNotifySubscribers(conn, request, now, 30*time.Minute)
+	assert.Equal(t, len(subscribers), 1)
+	assert.Equal(t, subscribers[0].UserId, nearby.UserId)
+
+	assert.Equal(t, MarkNotified(conn, nearby.UserId, now, 30*time.Minute), true)
+	assert.Equal(t, MarkNotified(conn, nearby.UserId, now, 30*time.Minute), false)
+	assert.Equal(t, len(FindNotifySubscribers(conn, request, now, 30*time.Minute)), 0)
+	assert.Equal(t, len(FindNotifySubscribers(conn, request, now.Add(31*time.Minute), 30*time.Minute)), 1)
+
+	assert.Equal(t, DeleteExpiredNotifySubscriptions(conn, now.Add(2*time.Hour)), 3)
+	found, _ := GetNotifySubscription(conn, nearby.UserId)
+	assert.Equal(t, found, false)
+
+	CancelMatchRequest(conn, requester.UserId)
+}
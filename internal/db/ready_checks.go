@@ -0,0 +1,126 @@
+package db
+
+import (
+	"database/sql"
+	"gorm.io/gorm"
+	"log"
+	"time"
+)
+
+type ReadyResponse string
+
+const (
+	ReadyPending  ReadyResponse = ""
+	ReadyAccepted ReadyResponse = "accepted"
+	ReadyDeclined ReadyResponse = "declined"
+)
+
+/*
+	ReadyCheck both players confirming they are still there after being paired, before the match can be played.
+*/
+type ReadyCheck struct {
+	MatchId    int
+	CreatedAt  time.Time
+	ExpiresAt  time.Time
+	P1Response ReadyResponse
+	P2Response ReadyResponse
+	// ResolvedAt is zero until both players accept or the check fails.
+	ResolvedAt time.Time
+}
+
+func (r ReadyCheck) IsResolved() bool {
+	return !r.ResolvedAt.IsZero()
+}
+
+func (r ReadyCheck) BothAccepted() bool {
+	return r.P1Response == ReadyAccepted && r.P2Response == ReadyAccepted
+}
+
+func (r ReadyCheck) AnyDeclined() bool {
+	return r.P1Response == ReadyDeclined || r.P2Response == ReadyDeclined
+}
+
+func CreateReadyCheck(conn *gorm.DB, check ReadyCheck) (success bool) {
+	conn.Exec(
+		"INSERT INTO ready_checks (match_id, created_at, expires_at) values (?, ?, ?)",
+		check.MatchId,
+		check.CreatedAt,
+		check.ExpiresAt)
+	if conn.Error != nil {
+		log.Println(conn.Error)
+		return false
+	}
+	return true
+}
+
+func GetReadyCheck(conn *gorm.DB, matchId int) (foundCheck bool, check ReadyCheck) {
+	checks := getReadyChecks(conn, "WHERE match_id = ?", matchId)
+	if len(checks) == 0 {
+		return false, check
+	}
+	return true, checks[0]
+}
+
+/*
+	SetReadyResponse records one player's answer. Only unanswered checks that are still open and haven't run out are
+	changed, so a late or repeated button press can't overturn the outcome.
+*/
+func SetReadyResponse(conn *gorm.DB, matchId int, isP1 bool, response ReadyResponse, now time.Time) (updated bool) {
+	column := "p2_response"
+	if isP1 {
+		column = "p1_response"
+	}
+	result := conn.Exec(
+		"UPDATE ready_checks SET "+column+" = ? WHERE match_id = ? AND "+column+" = ? AND resolved_at IS NULL AND expires_at > ?",
+		response,
+		matchId,
+		ReadyPending,
+		now)
+	if result.Error != nil {
+		log.Println(result.Error)
+		return false
+	}
+	return result.RowsAffected > 0
+}
+
+/*
+	ResolveReadyCheck closes the check. Returns false if it was already closed, so only one caller acts on the outcome.
+*/
+func ResolveReadyCheck(conn *gorm.DB, matchId int, resolvedAt time.Time) (resolved bool) {
+	result := conn.Exec("UPDATE ready_checks SET resolved_at = ? WHERE match_id = ? AND resolved_at IS NULL", resolvedAt, matchId)
+	if result.Error != nil {
+		log.Println(result.Error)
+		return false
+	}
+	return result.RowsAffected > 0
+}
+
+/*
+	FindExpiredReadyChecks open checks whose players ran out of time to accept.
+*/
+func FindExpiredReadyChecks(conn *gorm.DB, now time.Time) (checks []ReadyCheck) {
+	return getReadyChecks(conn, "WHERE resolved_at IS NULL AND expires_at <= ? ORDER BY expires_at ASC", now)
+}
+
+func getReadyChecks(conn *gorm.DB, clauses string, args ...interface{}) (checks []ReadyCheck) {
+	rows, err := conn.Raw("SELECT match_id, created_at, expires_at, p1_response, p2_response, resolved_at FROM ready_checks "+clauses, args...).Rows()
+	if err != nil {
+		panic(err)
+	}
+
+	if conn.Error != nil {
+		panic(conn.Error)
+	}
+
+	for rows.Next() {
+		check := ReadyCheck{}
+		var resolvedAt sql.NullTime
+		err := rows.Scan(&check.MatchId, &check.CreatedAt, &check.ExpiresAt, &check.P1Response, &check.P2Response, &resolvedAt)
+		if err != nil {
+			panic(err)
+		}
+		check.ResolvedAt = resolvedAt.Time
+		checks = append(checks, check)
+	}
+	return checks
+}
@@ -0,0 +1,74 @@
+package db
+
+import (
+	"fmt"
+	"github.com/go-playground/assert/v2"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestReadyChecks(t *testing.T) {
+	conn := GetGorm(GetTestMysSQLConnStr())
+	rand.Seed(time.Now().UnixNano())
+
+	p1 := createRatedUser(conn, fmt.Sprintf("somediscordId%d", rand.Intn(1000000)), fmt.Sprintf("coolsk8r1990%d", rand.Intn(1000000)), 1000)
+	p2 := createRatedUser(conn, fmt.Sprintf("somediscordId%d", rand.Intn(1000000)), fmt.Sprintf("coolsk8r1990%d", rand.Intn(1000000)), 1000)
+
+	queuedAt := time.Now().Add(-10 * time.Minute).Truncate(time.Second)
+	for _, v := range []User{p1, p2} {
+		CreateMatchRequest(conn, MatchRequest{RequestingUserId: v.UserId, CreatedAt: queuedAt, UpdatedAt: queuedAt, RequestRange: 300, RequestedGameMode: Bo1, MatchRequestState: MatchRequestStateQueued})
+	}
+	_, p1Request := GetMatchRequest(conn, p1.UserId)
+	_, p2Request := GetMatchRequest(conn, p2.UserId)
+	assert.Equal(t, CreateMatchFromRequests(conn, p1Request, p2Request, 0), true)
+	_, match := GetCurrentMatch(conn, p1.UserId)
+
+	now := time.Now().Truncate(time.Second)
+	assert.Equal(t, CreateReadyCheck(conn, ReadyCheck{MatchId: match.MatchId, CreatedAt: now, ExpiresAt: now.Add(5 * time.Minute)}), true)
+	assert.Equal(t, SetReadyResponse(conn, match.MatchId, true, ReadyAccepted, now), true)
+	// A second answer from the same player is ignored.
+	assert.Equal(t, SetReadyResponse(conn, match.MatchId, true, ReadyDeclined, now), false)
+
+	_, check := GetReadyCheck(conn, match.MatchId)
+	assert.Equal(t, check.P1Response, ReadyAccepted)
+	assert.Equal(t, check.P2Response, ReadyPending)
+	assert.Equal(t, check.IsResolved(), false)
+
+	expired := FindExpiredReadyChecks(conn, now.Add(5*time.Minute))
+	found := false
+	for _, v := range expired {
+		found = found || v.MatchId == match.MatchId
+	}
+	assert.Equal(t, found, true)
+	// So is an answer after the check ran out, even before it's resolved.
+	assert.Equal(t, SetReadyResponse(conn, match.MatchId, false, ReadyAccepted, now.Add(5*time.Minute)), false)
+
+	assert.Equal(t, ResolveReadyCheck(conn, match.MatchId, now), true)
+	assert.Equal(t, ResolveReadyCheck(conn, match.MatchId, now), false)
+	assert.Equal(t, SetReadyResponse(conn, match.MatchId, false, ReadyAccepted, now), false)
+
+	// Restoring puts the request back where it was with its deadline pushed back by the time spent paired.
+	assert.Equal(t, RestoreMatchRequest(conn, p1Request.MatchRequestId, now.Add(time.Hour)), true)
+	foundRequest, restored := GetMatchRequest(conn, p1.UserId)
+	assert.Equal(t, foundRequest, true)
+	assert.Equal(t, restored.MatchRequestId, p1Request.MatchRequestId)
+	assert.Equal(t, restored.CreatedAt.Unix(), queuedAt.Unix())
+	assert.Equal(t, restored.ExpiresAt.After(p1Request.ExpiresAt.Add(50*time.Minute)), true)
+	assert.Equal(t, RestoreMatchRequest(conn, p1Request.MatchRequestId, now.Add(time.Hour)), false)
+
+	// Failing a second ready check keeps the time the first one gave back.
+	p3 := createRatedUser(conn, fmt.Sprintf("somediscordId%d", rand.Intn(1000000)), fmt.Sprintf("coolsk8r1990%d", rand.Intn(1000000)), 1000)
+	CreateMatchRequest(conn, MatchRequest{RequestingUserId: p3.UserId, CreatedAt: queuedAt, UpdatedAt: queuedAt, RequestRange: 300, RequestedGameMode: Bo1, MatchRequestState: MatchRequestStateQueued})
+	_, p3Request := GetMatchRequest(conn, p3.UserId)
+	assert.Equal(t, CreateMatchFromRequests(conn, restored, p3Request, 0), true)
+	assert.Equal(t, RestoreMatchRequest(conn, p1Request.MatchRequestId, now.Add(2*time.Hour)), true)
+	_, restoredAgain := GetMatchRequest(conn, p1.UserId)
+	assert.Equal(t, restoredAgain.ExpiresAt.After(restored.ExpiresAt.Add(50*time.Minute)), true)
+
+	assert.Equal(t, AddUserStrike(conn, p2.UserId, match.MatchId, StrikeMissedReadyCheck, now), true)
+	assert.Equal(t, CountUserStrikes(conn, p2.UserId), 1)
+	assert.Equal(t, CountUserStrikes(conn, p1.UserId), 0)
+
+	CancelMatchRequest(conn, p1.UserId)
+}
@@ -0,0 +1,94 @@
+package db
+
+import (
+	"fmt"
+	"strings"
+)
+
+/*
+	Region where a player plays from. Regions are ordered so that neighbours are next to each other, which is how
+	pairing measures how far apart two players are.
+*/
+type Region string
+
+const (
+	EU       Region = "eu"
+	NA       Region = "na"
+	OCE      Region = "oce"
+	NoRegion Region = ""
+)
+
+var Regions = []Region{EU, NA, OCE}
+
+func (r Region) String() string {
+	return strings.ToUpper(string(r))
+}
+
+func regionIndex(region Region) int {
+	for i, v := range Regions {
+		if v == region {
+			return i
+		}
+	}
+	panic(fmt.Sprintf("Unrecognized region: %v", region))
+}
+
+func RegionToInt(region Region) int {
+	return regionIndex(region) + 1
+}
+
+func RegionFromInt(intRegion int) Region {
+	if intRegion < 1 || intRegion > len(Regions) {
+		panic(fmt.Sprintf("Unrecognized region int: %d", intRegion))
+	}
+	return Regions[intRegion-1]
+}
+
+/*
+	RegionPreference how far from their home region a player is willing to be paired, as a number of regions apart.
+	Players who haven't set a home region can only pick AnyRegion, and are only paired with others who did too.
+*/
+type RegionPreference string
+
+const (
+	SameRegion          RegionPreference = "same"
+	NeighbouringRegions RegionPreference = "neighbours"
+	AnyRegion           RegionPreference = "any"
+)
+
+func (p RegionPreference) MaxDistance() int {
+	switch p {
+	case SameRegion:
+		return 0
+	case NeighbouringRegions:
+		return 1
+	default:
+		return len(Regions) - 1
+	}
+}
+
+func RegionPreferenceToInt(preference RegionPreference) int {
+	switch preference {
+	case SameRegion:
+		return 1
+	case NeighbouringRegions:
+		return 2
+	case AnyRegion:
+		return 3
+	default:
+		panic(fmt.Sprintf("Unrecognized region preference: %v", preference))
+	}
+}
+
+func RegionPreferenceFromInt(intPreference int) RegionPreference {
+	switch intPreference {
+	case 1:
+		return SameRegion
+	case 2:
+		return NeighbouringRegions
+	case 3:
+		return AnyRegion
+	default:
+		panic(fmt.Sprintf("Unrecognized region preference int: %d", intPreference))
+	}
+}
@@ -0,0 +1,23 @@
+package db
+
+import (
+	"github.com/go-playground/assert/v2"
+	"testing"
+)
+
+func TestRegionPreferenceMaxDistance(t *testing.T) {
+	assert.Equal(t, SameRegion.MaxDistance(), 0)
+	assert.Equal(t, NeighbouringRegions.MaxDistance(), 1)
+	assert.Equal(t, AnyRegion.MaxDistance(), 2)
+	// Requests from before region preferences existed are happy with anyone.
+	assert.Equal(t, RegionPreference("").MaxDistance(), 2)
+}
+
+func TestRegionInts(t *testing.T) {
+	for _, v := range Regions {
+		assert.Equal(t, RegionFromInt(RegionToInt(v)), v)
+	}
+	for _, v := range []RegionPreference{SameRegion, NeighbouringRegions, AnyRegion} {
+		assert.Equal(t, RegionPreferenceFromInt(RegionPreferenceToInt(v)), v)
+	}
+}
@@ -0,0 +1,221 @@
+package db
+
+import (
+	"database/sql"
+	"gorm.io/gorm"
+	"log"
+	"time"
+)
+
+type Season struct {
+	SeasonId  int
+	Name      string
+	StartedAt time.Time
+	// EndedAt is zero while the season is still running.
+	EndedAt         time.Time
+	SoftResetFactor float64
+}
+
+/*
+	SeasonStanding a player's frozen final position on one ladder at the end of a season.
+*/
+type SeasonStanding struct {
+	SeasonId        int
+	UserId          int
+	DiscordUserName string
+	GameMode        GameMode
+	FinalRank       int
+	Rating          int
+	Wins            int
+	Losses          int
+	Draws           int
+}
+
+/*
+	AllTime stands in for a season when stats should cover every match ever played.
+*/
+var AllTime = Season{Name: "All time"}
+
+func (s Season) IsOpen() bool {
+	return s.EndedAt.IsZero()
+}
+
+/*
+	Window the time range a season's matches fall in. Open seasons, and AllTime, run until the far future.
+*/
+func (s Season) Window() (start time.Time, end time.Time) {
+	end = s.EndedAt
+	if s.IsOpen() {
+		end = time.Date(9999, 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+	return s.StartedAt, end
+}
+
+func CreateSeason(conn *gorm.DB, season Season) (success bool) {
+	result := conn.Exec(
+		"INSERT INTO seasons (name, started_at, soft_reset_factor) values (?, ?, ?)",
+		season.Name,
+		season.StartedAt,
+		season.SoftResetFactor)
+	if result.Error != nil {
+		log.Println(result.Error)
+		return false
+	}
+	return true
+}
+
+func EndSeason(conn *gorm.DB, seasonId int, endedAt time.Time) (success bool) {
+	conn.Exec("UPDATE seasons SET ended_at = ? WHERE id = ? AND ended_at IS NULL", endedAt, seasonId)
+	if conn.Error != nil {
+		log.Println(conn.Error)
+		return false
+	}
+	return true
+}
+
+/*
+	GetCurrentSeason the season that is still running, if any. Only one season is ever open at a time.
+*/
+func GetCurrentSeason(conn *gorm.DB) (foundSeason bool, result Season) {
+	seasons := getSeasons(conn, "WHERE ended_at IS NULL ORDER BY id DESC LIMIT 1")
+	if len(seasons) == 0 {
+		return false, result
+	}
+	return true, seasons[0]
+}
+
+/*
+	LockCurrentSeason GetCurrentSeason as a locking read, so a transaction that goes on to open a season holds off any
+	other until it commits.
+*/
+func LockCurrentSeason(tx *gorm.DB) (foundSeason bool, result Season) {
+	seasons := getSeasons(tx, "WHERE ended_at IS NULL ORDER BY id DESC LIMIT 1 FOR UPDATE")
+	if len(seasons) == 0 {
+		return false, result
+	}
+	return true, seasons[0]
+}
+
+func GetSeason(conn *gorm.DB, seasonId int) (foundSeason bool, result Season) {
+	seasons := getSeasons(conn, "WHERE id = ?", seasonId)
+	if len(seasons) == 0 {
+		return false, result
+	}
+	return true, seasons[0]
+}
+
+/*
+	GetSeasons every season in the order they started.
+*/
+func GetSeasons(conn *gorm.DB) (seasons []Season) {
+	return getSeasons(conn, "ORDER BY started_at ASC, id ASC")
+}
+
+func getSeasons(conn *gorm.DB, clauses string, args ...interface{}) (seasons []Season) {
+	rows, err := conn.Raw("SELECT id, name, started_at, ended_at, soft_reset_factor FROM seasons "+clauses, args...).Rows()
+	if err != nil {
+		panic(err)
+	}
+
+	if conn.Error != nil {
+		panic(conn.Error)
+	}
+
+	for rows.Next() {
+		season := Season{}
+		var endedAt sql.NullTime
+		err := rows.Scan(&season.SeasonId, &season.Name, &season.StartedAt, &endedAt, &season.SoftResetFactor)
+		if err != nil {
+			panic(err)
+		}
+		season.EndedAt = endedAt.Time
+		seasons = append(seasons, season)
+	}
+	return seasons
+}
+
+/*
+	ArchiveSeasonStandings freezes the final standings for a season. Archiving again replaces what was there.
+*/
+func ArchiveSeasonStandings(conn *gorm.DB, seasonId int, standings []SeasonStanding) (success bool) {
+	err := conn.Transaction(func(tx *gorm.DB) error {
+		tx.Exec("DELETE FROM season_standings WHERE season_id = ?", seasonId)
+		if tx.Error != nil {
+			log.Println(tx.Error)
+			success = false
+			return nil
+		}
+		createdAt := time.Now()
+		for _, v := range standings {
+			tx.Exec(
+				"INSERT INTO season_standings (season_id, user_id, game_mode, final_rank, rating, wins, losses, draws, created_at) values (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+				seasonId,
+				v.UserId,
+				v.GameMode,
+				v.FinalRank,
+				v.Rating,
+				v.Wins,
+				v.Losses,
+				v.Draws,
+				createdAt)
+			if tx.Error != nil {
+				log.Println(tx.Error)
+				success = false
+				return nil
+			}
+		}
+		success = true
+		return nil
+	})
+	if err != nil {
+		log.Println(err)
+		return false
+	}
+	return success
+}
+
+func GetSeasonStandings(conn *gorm.DB, seasonId int, mode GameMode) (standings []SeasonStanding) {
+	rows, err := conn.Raw(`
+		SELECT
+			ss.season_id,
+			ss.user_id,
+			u.discord_username,
+			ss.game_mode,
+			ss.final_rank,
+			ss.rating,
+			ss.wins,
+			ss.losses,
+			ss.draws
+		FROM season_standings ss
+		INNER JOIN users u ON u.id = ss.user_id
+		WHERE ss.season_id = ? AND ss.game_mode = ?
+		ORDER BY ss.final_rank ASC`,
+		seasonId,
+		mode).Rows()
+	if err != nil {
+		panic(err)
+	}
+
+	if conn.Error != nil {
+		panic(conn.Error)
+	}
+
+	for rows.Next() {
+		standing := SeasonStanding{}
+		err := rows.Scan(
+			&standing.SeasonId,
+			&standing.UserId,
+			&standing.DiscordUserName,
+			&standing.GameMode,
+			&standing.FinalRank,
+			&standing.Rating,
+			&standing.Wins,
+			&standing.Losses,
+			&standing.Draws)
+		if err != nil {
+			panic(err)
+		}
+		standings = append(standings, standing)
+	}
+	return standings
+}
@@ -0,0 +1,66 @@
+package db
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestSeasonStandings(t *testing.T) {
+	conn := GetGorm(GetTestMysSQLConnStr())
+	rand.Seed(time.Now().UnixNano())
+
+	winner := createRatedUser(conn, fmt.Sprintf("somediscordId%d", rand.Intn(1000000)), fmt.Sprintf("coolsk8r1990%d", rand.Intn(1000000)), 1300)
+	loser := createRatedUser(conn, fmt.Sprintf("somediscordId%d", rand.Intn(1000000)), fmt.Sprintf("coolsk8r1990%d", rand.Intn(1000000)), 1100)
+
+	seasonStart := time.Now().AddDate(0, 0, -1)
+	for _, createdAt := range []time.Time{seasonStart.AddDate(0, 0, -10), time.Now()} {
+		CreateMatch(conn, Match{
+			CreatedAt:        createdAt,
+			UpdatedAt:        createdAt,
+			MatchState:       Completed,
+			GameMode:         Bo3,
+			P1UserId:         winner.UserId,
+			P2UserId:         loser.UserId,
+			P1MatchRequestId: -1,
+			P2MatchRequestId: -1,
+			Winner:           P1,
+		})
+	}
+
+	seasonName := fmt.Sprintf("Season %d", rand.Intn(1000000))
+	assert.True(t, CreateSeason(conn, Season{Name: seasonName, StartedAt: seasonStart, SoftResetFactor: 0.5}))
+	foundSeason, season := GetCurrentSeason(conn)
+	assert.True(t, foundSeason)
+	assert.Equal(t, seasonName, season.Name)
+	assert.True(t, season.IsOpen())
+
+	// Only the match played since the season started counts towards it.
+	findWinner := func(usersWithStats []UserWithStats) (found UserWithStats) {
+		for _, v := range usersWithStats {
+			if v.User.UserId == winner.UserId {
+				return v
+			}
+		}
+		return found
+	}
+	assert.Equal(t, 1, findWinner(GetEloLeaderboard(conn, Bo3, season)).Wins)
+	assert.Equal(t, 2, findWinner(GetEloLeaderboard(conn, Bo3, AllTime)).Wins)
+	assert.Equal(t, 1, findWinner(GetSeasonWinLeaderboard(conn, season)).Wins)
+
+	assert.True(t, ArchiveSeasonStandings(conn, season.SeasonId, []SeasonStanding{
+		{UserId: winner.UserId, GameMode: Bo3, FinalRank: 1, Rating: 1300, Wins: 1},
+		{UserId: loser.UserId, GameMode: Bo3, FinalRank: 2, Rating: 1100, Losses: 1},
+	}))
+	assert.True(t, EndSeason(conn, season.SeasonId, time.Now()))
+
+	_, season = GetSeason(conn, season.SeasonId)
+	assert.False(t, season.IsOpen())
+	standings := GetSeasonStandings(conn, season.SeasonId, Bo3)
+	assert.Len(t, standings, 2)
+	assert.Equal(t, winner.DiscordUserName, standings[0].DiscordUserName)
+	assert.Equal(t, 1, standings[1].Losses)
+	assert.Len(t, GetSeasonStandings(conn, season.SeasonId, Bo1), 0)
+}
@@ -0,0 +1,129 @@
+package db
+
+import (
+	"gorm.io/gorm"
+	"log"
+	"time"
+)
+
+/*
+	TeamQueueEntry
+	One player waiting in the 2v2 queue, either with the partner they named or on their own to be teamed up with another
+	solo player. A named partner only counts once they have queued naming this player back.
+*/
+type TeamQueueEntry struct {
+	TeamQueueEntryId int
+	UserId           int
+	// PartnerUserId is 0 for players happy to be teamed up with anyone.
+	PartnerUserId int
+	CreatedAt     time.Time
+	ExpiresAt     time.Time
+}
+
+func CreateTeamQueueEntry(conn *gorm.DB, entry TeamQueueEntry) (success bool) {
+	conn.Exec(
+		"INSERT INTO team_queue_entries (user_id, partner_user_id, created_at, expires_at) values (?, ?, ?, ?)",
+		entry.UserId,
+		nullableId(entry.PartnerUserId),
+		entry.CreatedAt,
+		entry.ExpiresAt)
+	if conn.Error != nil {
+		log.Println(conn.Error)
+		return false
+	}
+	return true
+}
+
+func GetTeamQueueEntry(conn *gorm.DB, userId int) (foundEntry bool, entry TeamQueueEntry) {
+	entries := getTeamQueueEntries(conn, "WHERE user_id = ?", userId)
+	if len(entries) == 0 {
+		return false, entry
+	}
+	return true, entries[0]
+}
+
+/*
+	GetQueuedTeamEntries everyone still in the 2v2 queue, longest waiting first.
+*/
+func GetQueuedTeamEntries(conn *gorm.DB, now time.Time) (entries []TeamQueueEntry) {
+	return getTeamQueueEntries(conn, "WHERE expires_at > ? ORDER BY created_at ASC, id ASC", now)
+}
+
+func FindExpiredTeamQueueEntries(conn *gorm.DB, now time.Time) (entries []TeamQueueEntry) {
+	return getTeamQueueEntries(conn, "WHERE expires_at <= ? ORDER BY created_at ASC, id ASC", now)
+}
+
+/*
+	DeleteTeamQueueEntry takes the player out of the 2v2 queue. Returns false if they weren't in it.
+*/
+func DeleteTeamQueueEntry(conn *gorm.DB, userId int) (deleted bool) {
+	result := conn.Exec("DELETE FROM team_queue_entries WHERE user_id = ?", userId)
+	if result.Error != nil {
+		log.Println(result.Error)
+		return false
+	}
+	return result.RowsAffected > 0
+}
+
+/*
+	CreateTeamMatchFromEntries
+	Takes all four players of a 2v2 match out of the queue and creates the match. If any of them has already left the
+	queue, or been paired by someone else queuing at the same moment, nothing is written.
+*/
+func CreateTeamMatchFromEntries(conn *gorm.DB, match Match) (success bool) {
+	err := conn.Transaction(func(tx *gorm.DB) error {
+		userIds := match.PlayerIds()
+		result := tx.Exec("DELETE FROM team_queue_entries WHERE user_id IN ?", userIds)
+		if result.Error != nil {
+			log.Println(result.Error)
+			return errPairingFailed
+		}
+		if result.RowsAffected != int64(len(userIds)) {
+			log.Printf("Players %v were no longer all in the 2v2 queue, not pairing them.", userIds)
+			return errPairingFailed
+		}
+		if !CreateMatch(tx, match) {
+			return errPairingFailed
+		}
+		success = true
+		return nil
+	})
+	if err != nil {
+		log.Println(err)
+		return false
+	}
+	return success
+}
+
+func getTeamQueueEntries(conn *gorm.DB, clauses string, args ...interface{}) (entries []TeamQueueEntry) {
+	rows, err := conn.Raw(`
+		SELECT
+			id,
+			user_id,
+			COALESCE(partner_user_id, 0),
+			created_at,
+			expires_at
+		FROM team_queue_entries `+clauses, args...).Rows()
+	if err != nil {
+		panic(err)
+	}
+
+	if conn.Error != nil {
+		panic(conn.Error)
+	}
+
+	for rows.Next() {
+		entry := TeamQueueEntry{}
+		err := rows.Scan(
+			&entry.TeamQueueEntryId,
+			&entry.UserId,
+			&entry.PartnerUserId,
+			&entry.CreatedAt,
+			&entry.ExpiresAt)
+		if err != nil {
+			panic(err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
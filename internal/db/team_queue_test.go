@@ -0,0 +1,64 @@
+package db
+
+import (
+	"fmt"
+	"github.com/go-playground/assert/v2"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestTeamQueue(t *testing.T) {
+	conn := GetGorm(GetTestMysSQLConnStr())
+	rand.Seed(time.Now().UnixNano())
+
+	var players []User
+	for i := 0; i < 4; i++ {
+		players = append(players, createRatedUser(conn, fmt.Sprintf("somediscordId%d", rand.Intn(1000000)), fmt.Sprintf("coolsk8r1990%d", rand.Intn(1000000)), 1000))
+	}
+	now := time.Now().Truncate(time.Second)
+	assert.Equal(t, CreateTeamQueueEntry(conn, TeamQueueEntry{UserId: players[0].UserId, PartnerUserId: players[1].UserId, CreatedAt: now, ExpiresAt: now.Add(time.Hour)}), true)
+	assert.Equal(t, CreateTeamQueueEntry(conn, TeamQueueEntry{UserId: players[0].UserId, CreatedAt: now, ExpiresAt: now.Add(time.Hour)}), false)
+	for _, v := range players[1:] {
+		assert.Equal(t, CreateTeamQueueEntry(conn, TeamQueueEntry{UserId: v.UserId, CreatedAt: now, ExpiresAt: now.Add(time.Hour)}), true)
+	}
+
+	found, entry := GetTeamQueueEntry(conn, players[0].UserId)
+	assert.Equal(t, found, true)
+	assert.Equal(t, entry.PartnerUserId, players[1].UserId)
+	_, entry = GetTeamQueueEntry(conn, players[2].UserId)
+	assert.Equal(t, entry.PartnerUserId, 0)
+
+	match := Match{
+		P1UserId:        players[0].UserId,
+		P1PartnerUserId: players[1].UserId,
+		P2UserId:        players[2].UserId,
+		P2PartnerUserId: players[3].UserId,
+		GameMode:        Team2v2,
+		MatchState:      Matched,
+		CreatedAt:       now,
+		UpdatedAt:       now,
+	}
+
+	// Someone having left the queue in the meantime stops the whole match.
+	assert.Equal(t, DeleteTeamQueueEntry(conn, players[3].UserId), true)
+	assert.Equal(t, DeleteTeamQueueEntry(conn, players[3].UserId), false)
+	assert.Equal(t, CreateTeamMatchFromEntries(conn, match), false)
+	found, _ = GetTeamQueueEntry(conn, players[0].UserId)
+	assert.Equal(t, found, true)
+
+	CreateTeamQueueEntry(conn, TeamQueueEntry{UserId: players[3].UserId, CreatedAt: now, ExpiresAt: now.Add(time.Hour)})
+	assert.Equal(t, CreateTeamMatchFromEntries(conn, match), true)
+	for _, v := range players {
+		found, _ = GetTeamQueueEntry(conn, v.UserId)
+		assert.Equal(t, found, false)
+		// Partners are in the match as much as the players named on each side.
+		foundMatch, current := GetCurrentMatch(conn, v.UserId)
+		assert.Equal(t, foundMatch, true)
+		assert.Equal(t, current.PlayerIds(), match.PlayerIds())
+	}
+	_, current := GetCurrentMatch(conn, players[3].UserId)
+	assert.Equal(t, current.IsTeamMatch(), true)
+	assert.Equal(t, current.OnP1Side(players[1].UserId), true)
+	assert.Equal(t, current.OnP1Side(players[3].UserId), false)
+}
@@ -0,0 +1,85 @@
+package db
+
+import (
+	"gorm.io/gorm"
+	"log"
+	"time"
+)
+
+/*
+	UserAvoid one player's request never to be paired with another. It applies both ways, see FindCandidatePairings.
+*/
+type UserAvoid struct {
+	UserId                 int
+	DiscordUserName        string
+	AvoidedUserId          int
+	AvoidedDiscordUserName string
+	CreatedAt              time.Time
+}
+
+func AddUserAvoid(conn *gorm.DB, userId int, avoidedUserId int, createdAt time.Time) (success bool) {
+	conn.Exec(
+		"INSERT INTO user_avoids (user_id, avoided_user_id, created_at) values (?, ?, ?)",
+		userId,
+		avoidedUserId,
+		createdAt)
+	if conn.Error != nil {
+		log.Println(conn.Error)
+		return false
+	}
+	return true
+}
+
+func RemoveUserAvoid(conn *gorm.DB, userId int, avoidedUserId int) (removed bool) {
+	result := conn.Exec("DELETE FROM user_avoids WHERE user_id = ? AND avoided_user_id = ?", userId, avoidedUserId)
+	if result.Error != nil {
+		log.Println(result.Error)
+		return false
+	}
+	return result.RowsAffected > 0
+}
+
+/*
+	GetUserAvoids everyone the user has asked not to be paired with, oldest first.
+*/
+func GetUserAvoids(conn *gorm.DB, userId int) (avoids []UserAvoid) {
+	return getUserAvoids(conn, "WHERE ua.user_id = ? ORDER BY ua.created_at ASC, ua.id ASC", userId)
+}
+
+/*
+	GetAllUserAvoids every avoid list on the ladder, for admins to review.
+*/
+func GetAllUserAvoids(conn *gorm.DB) (avoids []UserAvoid) {
+	return getUserAvoids(conn, "ORDER BY ua.user_id ASC, ua.created_at ASC, ua.id ASC")
+}
+
+func getUserAvoids(conn *gorm.DB, clauses string, args ...interface{}) (avoids []UserAvoid) {
+	rows, err := conn.Raw(`
+		SELECT
+			ua.user_id,
+			u.discord_username,
+			ua.avoided_user_id,
+			avoided.discord_username,
+			ua.created_at
+		FROM user_avoids ua
+		INNER JOIN users u ON u.id = ua.user_id
+		INNER JOIN users avoided ON avoided.id = ua.avoided_user_id
+		`+clauses, args...).Rows()
+	if err != nil {
+		panic(err)
+	}
+
+	if conn.Error != nil {
+		panic(conn.Error)
+	}
+
+	for rows.Next() {
+		avoid := UserAvoid{}
+		err := rows.Scan(&avoid.UserId, &avoid.DiscordUserName, &avoid.AvoidedUserId, &avoid.AvoidedDiscordUserName, &avoid.CreatedAt)
+		if err != nil {
+			panic(err)
+		}
+		avoids = append(avoids, avoid)
+	}
+	return avoids
+}
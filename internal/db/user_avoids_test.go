@@ -0,0 +1,44 @@
+package db
+
+import (
+	"fmt"
+	"github.com/go-playground/assert/v2"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestUserAvoids(t *testing.T) {
+	conn := GetGorm(GetTestMysSQLConnStr())
+	conn.Exec("TRUNCATE TABLE match_requests")
+
+	rand.Seed(time.Now().UnixNano())
+
+	requester := createRatedUser(conn, fmt.Sprintf("somediscordId%d", rand.Intn(1000000)), fmt.Sprintf("coolsk8r1990%d", rand.Intn(1000000)), 1000)
+	opponent := createRatedUser(conn, fmt.Sprintf("somediscordId%d", rand.Intn(1000000)), fmt.Sprintf("coolsk8r1990%d", rand.Intn(1000000)), 1000)
+
+	now := time.Now()
+	requesterRequest := MatchRequest{RequestingUserId: requester.UserId, CreatedAt: now, UpdatedAt: now, RequestRange: 300, RequestedGameMode: Bo1, MatchRequestState: MatchRequestStateQueued}
+	opponentRequest := MatchRequest{RequestingUserId: opponent.UserId, CreatedAt: now, UpdatedAt: now, RequestRange: 300, RequestedGameMode: Bo1, MatchRequestState: MatchRequestStateQueued}
+	CreateMatchRequest(conn, requesterRequest)
+	CreateMatchRequest(conn, opponentRequest)
+	assert.Equal(t, len(FindCandidatePairings(conn, requesterRequest, now)), 1)
+
+	assert.Equal(t, AddUserAvoid(conn, opponent.UserId, requester.UserId, now), true)
+	avoids := GetUserAvoids(conn, opponent.UserId)
+	assert.Equal(t, len(avoids), 1)
+	assert.Equal(t, avoids[0].AvoidedUserId, requester.UserId)
+	assert.Equal(t, avoids[0].AvoidedDiscordUserName, requester.DiscordUserName)
+	assert.Equal(t, len(GetUserAvoids(conn, requester.UserId)), 0)
+
+	// Avoids apply whoever is doing the queuing.
+	assert.Equal(t, len(FindCandidatePairings(conn, requesterRequest, now)), 0)
+	assert.Equal(t, len(FindCandidatePairings(conn, opponentRequest, now)), 0)
+
+	assert.Equal(t, RemoveUserAvoid(conn, opponent.UserId, requester.UserId), true)
+	assert.Equal(t, RemoveUserAvoid(conn, opponent.UserId, requester.UserId), false)
+	assert.Equal(t, len(FindCandidatePairings(conn, requesterRequest, now)), 1)
+
+	CancelMatchRequest(conn, requester.UserId)
+	CancelMatchRequest(conn, opponent.UserId)
+}
@@ -1,6 +1,8 @@
 package db
 
 import (
+	"database/sql"
+	"discordbot/internal/app/ratings"
 	"gorm.io/gorm"
 	"log"
 	"time"
@@ -8,28 +10,122 @@ import (
 
 const DEFAULT_RATING = 1200
 
+/*
+	RatingChangeReason why a rating history entry was written.
+*/
+type RatingChangeReason string
+
+const (
+	RatingChangeInitial RatingChangeReason = "initial"
+	RatingChangeMatch   RatingChangeReason = "match"
+	RatingChangeDecay   RatingChangeReason = "decay"
+	// RatingChangeSeasonReset is the soft reset applied to every rating when a new season opens.
+	RatingChangeSeasonReset RatingChangeReason = "season_reset"
+)
+
 type UserRating struct {
 	UserRatingId int
 	Rating       int
+	Deviation    float64
+	Volatility   float64
 	UserId       int
 	MatchId      int
+	GameMode     GameMode
+	Reason       RatingChangeReason
 	IsTombstoned bool
 	CreatedAt    time.Time
 }
 
-func UpdateUserRating(conn *gorm.DB, userId int, newRating int, matchId int) (success bool) {
+/*
+	InactiveRating a user's current rating on a ladder they haven't completed a match on recently.
+*/
+type InactiveRating struct {
+	UserId      int
+	GameMode    GameMode
+	Rating      ratings.PlayerRating
+	LastMatchAt time.Time
+}
+
+/*
+	RatingDecay an inactivity decay still standing in rating history, and how many points it took off.
+*/
+type RatingDecay struct {
+	UserId    int
+	GameMode  GameMode
+	Points    int
+	DecayedAt time.Time
+}
+
+/*
+	DefaultPlayerRating the rating every player starts each ladder with.
+*/
+func DefaultPlayerRating() ratings.PlayerRating {
+	return ratings.PlayerRating{
+		Rating:     DEFAULT_RATING,
+		Deviation:  ratings.DefaultDeviation,
+		Volatility: ratings.DefaultVolatility,
+	}
+}
+
+/*
+	GetUserRating gets the user's current rating on the given game mode's ladder along with how many matches they have
+	completed in that mode, which Elo uses to decide between provisional and established K. Users that have no rating
+	yet in a mode get the default rating.
+*/
+func GetUserRating(conn *gorm.DB, userId int, mode GameMode) (playerRating ratings.PlayerRating) {
+	playerRating = DefaultPlayerRating()
+	row := conn.Raw("SELECT rating, deviation, volatility FROM user_ratings WHERE user_id = ? AND game_mode = ?", userId, mode).Row()
+	if conn.Error != nil {
+		panic(conn.Error)
+	}
+	err := row.Scan(&playerRating.Rating, &playerRating.Deviation, &playerRating.Volatility)
+	if err != nil && err != sql.ErrNoRows {
+		panic(err)
+	}
+	playerRating.GamesPlayed = GetCompletedMatchCount(conn, userId, mode)
+	return playerRating
+}
+
+/*
+	UpdateUserRating sets the user's current rating and records it in their history. A matchId of -1 marks the rating
+	a user was seeded with rather than the result of a match.
+*/
+func UpdateUserRating(conn *gorm.DB, userId int, mode GameMode, newRating ratings.PlayerRating, matchId int) (success bool) {
+	reason := RatingChangeMatch
+	if matchId == -1 {
+		reason = RatingChangeInitial
+	}
+	return recordUserRating(conn, userId, mode, newRating, matchId, reason, time.Now())
+}
+
+/*
+	DecayUserRating sets the user's current rating after an inactivity decay. It lands in history like any other change
+	so it can be reverted, dated decayedAt since that's what counts as activity for the next decay.
+*/
+func DecayUserRating(conn *gorm.DB, userId int, mode GameMode, newRating ratings.PlayerRating, decayedAt time.Time) (success bool) {
+	return recordUserRating(conn, userId, mode, newRating, -1, RatingChangeDecay, decayedAt)
+}
+
+/*
+	ResetUserRating sets the user's current rating after a season's soft reset.
+*/
+func ResetUserRating(conn *gorm.DB, userId int, mode GameMode, newRating ratings.PlayerRating) (success bool) {
+	return recordUserRating(conn, userId, mode, newRating, -1, RatingChangeSeasonReset, time.Now())
+}
+
+func recordUserRating(conn *gorm.DB, userId int, mode GameMode, newRating ratings.PlayerRating, matchId int, reason RatingChangeReason, createdAt time.Time) (success bool) {
 	err := conn.Transaction(func(tx *gorm.DB) error {
-		tx.Exec("UPDATE users SET current_rating = ? WHERE id = ?", newRating, userId)
-		if conn.Error != nil {
-			panic(conn.Error)
-		}
+		setCurrentRating(tx, userId, mode, newRating.Rating, newRating.Deviation, newRating.Volatility)
 
-		createdAt := time.Now()
 		tx.Exec(
-			"INSERT INTO user_ratings_history (user_id, rating, match_id, is_tombstoned, created_at) values (?, ?, ?, ?, ?)",
+			"INSERT INTO user_ratings_history (user_id, game_mode, rating, deviation, volatility, match_id, reason, is_tombstoned, created_at) values (?, ?, ?, ?, ?, ?, ?, ?, ?)",
 			userId,
-			newRating,
+			mode,
+			newRating.Rating,
+			newRating.Deviation,
+			newRating.Volatility,
 			matchId,
+			reason,
 			false,
 			createdAt,
 		)
@@ -49,23 +145,20 @@ func UpdateUserRating(conn *gorm.DB, userId int, newRating int, matchId int) (su
 }
 
 /*
-	Tombstones the most recent rating and unwinds the user rating to one rating ago.
+	Tombstones the most recent rating in the game mode and unwinds the user rating to one rating ago.
 */
-func RevertUserRating(conn *gorm.DB, userId int) (success bool) {
+func RevertUserRating(conn *gorm.DB, userId int, mode GameMode) (success bool) {
 	err := conn.Transaction(func(tx *gorm.DB) error {
-		ratingHistory := GetUserRatingsHistory(tx, userId, 2)
+		ratingHistory := GetUserRatingsHistory(tx, userId, mode, 2)
 		if len(ratingHistory) != 2 {
-			log.Printf("Cannot tombstone rating for user: %d because they have insufficient ratings history.", userId)
+			log.Printf("Cannot tombstone %s rating for user: %d because they have insufficient ratings history.", mode, userId)
 			success = false
 			return nil
 		}
 		currentRating := ratingHistory[0]
 		priorRating := ratingHistory[1]
 		TombstoneUserRating(tx, currentRating.UserRatingId)
-		tx.Exec("UPDATE users SET current_rating = ? WHERE id = ?", priorRating.Rating, userId)
-		if conn.Error != nil {
-			panic(conn.Error)
-		}
+		setCurrentRating(tx, userId, mode, priorRating.Rating, priorRating.Deviation, priorRating.Volatility)
 		success = true
 		return nil
 	})
@@ -76,23 +169,180 @@ func RevertUserRating(conn *gorm.DB, userId int) (success bool) {
 	return success
 }
 
-func GetUserRatingsHistory(conn *gorm.DB, userId int, limit int) (ratings []UserRating) {
+/*
+	RevertMatchRating undoes the rating change a match made, but only if it's still the user's latest on the ladder. A
+	decay or season reset that landed since would be what got reverted otherwise, so that's refused.
+*/
+func RevertMatchRating(conn *gorm.DB, userId int, mode GameMode, matchId int) (success bool) {
+	if !IsLatestMatchRating(conn, userId, mode, matchId) {
+		log.Printf("Cannot revert match %d for user: %d on %s because their latest rating change was not from it.", matchId, userId, mode)
+		return false
+	}
+	return RevertUserRating(conn, userId, mode)
+}
+
+/*
+	IsLatestMatchRating whether the user's latest rating change on the ladder is the result of the match.
+*/
+func IsLatestMatchRating(conn *gorm.DB, userId int, mode GameMode, matchId int) bool {
+	ratingHistory := GetUserRatingsHistory(conn, userId, mode, 1)
+	return len(ratingHistory) == 1 && ratingHistory[0].Reason == RatingChangeMatch && ratingHistory[0].MatchId == matchId
+}
+
+/*
+	RevertLatestDecay undoes the user's most recent rating change on a ladder, but only if it was an inactivity decay.
+*/
+func RevertLatestDecay(conn *gorm.DB, userId int, mode GameMode) (success bool) {
+	ratingHistory := GetUserRatingsHistory(conn, userId, mode, 1)
+	if len(ratingHistory) != 1 || ratingHistory[0].Reason != RatingChangeDecay {
+		log.Printf("Cannot revert decay for user: %d on %s because their latest rating change was not a decay.", userId, mode)
+		return false
+	}
+	return RevertUserRating(conn, userId, mode)
+}
+
+/*
+	FindInactiveRatings ratings that are above floor and whose owner hasn't completed a match on that ladder, or been
+	decayed on it, since inactiveSince. A decay that was reverted still counts, otherwise the next run would decay the
+	player straight back again. Users who have never completed a match on a ladder are left alone.
+*/
+func FindInactiveRatings(conn *gorm.DB, inactiveSince time.Time, floor int) (result []InactiveRating) {
+	rows, err := conn.Raw(`
+		SELECT
+			user_id,
+			game_mode,
+			rating,
+			deviation,
+			volatility,
+			last_match_at
+		FROM (
+			SELECT
+				ur.user_id,
+				ur.game_mode,
+				ur.rating,
+				ur.deviation,
+				ur.volatility,
+				(
+					SELECT MAX(m.created_at) FROM matches m
+					WHERE
+						ur.user_id IN (m.p1_user_id, m.p2_user_id, m.p1_partner_user_id, m.p2_partner_user_id) AND
+						m.match_state = 'completed' AND
+						m.game_mode = ur.game_mode
+				) as last_match_at,
+				(
+					SELECT MAX(h.created_at) FROM user_ratings_history h
+					WHERE
+						h.user_id = ur.user_id AND
+						h.game_mode = ur.game_mode AND
+						h.reason = 'decay'
+				) as last_decay_at
+			FROM user_ratings ur
+			WHERE ur.rating > @floor
+		) activity
+		WHERE
+			last_match_at < @inactive_since AND
+			(last_decay_at IS NULL OR last_decay_at < @inactive_since)
+		ORDER BY user_id ASC, game_mode ASC`,
+		sql.Named("floor", floor),
+		sql.Named("inactive_since", inactiveSince)).Rows()
+	if err != nil {
+		panic(err)
+	}
+
+	if conn.Error != nil {
+		panic(conn.Error)
+	}
+
+	for rows.Next() {
+		inactiveRating := InactiveRating{}
+		err := rows.Scan(
+			&inactiveRating.UserId,
+			&inactiveRating.GameMode,
+			&inactiveRating.Rating.Rating,
+			&inactiveRating.Rating.Deviation,
+			&inactiveRating.Rating.Volatility,
+			&inactiveRating.LastMatchAt)
+		if err != nil {
+			panic(err)
+		}
+		result = append(result, inactiveRating)
+	}
+	return result
+}
+
+/*
+	GetRatingDecays every decay in rating history that hasn't been reverted, oldest first. Points are measured against
+	the rating the player had just before.
+*/
+func GetRatingDecays(conn *gorm.DB) (decays []RatingDecay) {
+	rows, err := conn.Raw(`
+		SELECT
+			h.user_id,
+			h.game_mode,
+			COALESCE((
+				SELECT prior.rating FROM user_ratings_history prior
+				WHERE
+					prior.user_id = h.user_id AND
+					prior.game_mode = h.game_mode AND
+					prior.is_tombstoned = false AND
+					prior.id < h.id
+				ORDER BY prior.id DESC
+				LIMIT 1
+			), h.rating) - h.rating,
+			h.created_at
+		FROM user_ratings_history h
+		WHERE
+			h.reason = ? AND
+			h.is_tombstoned = false
+		ORDER BY
+			h.created_at ASC, h.id ASC`,
+		RatingChangeDecay).Rows()
+	if err != nil {
+		panic(err)
+	}
+
+	if conn.Error != nil {
+		panic(conn.Error)
+	}
+
+	for rows.Next() {
+		decay := RatingDecay{}
+		err := rows.Scan(
+			&decay.UserId,
+			&decay.GameMode,
+			&decay.Points,
+			&decay.DecayedAt)
+		if err != nil {
+			panic(err)
+		}
+		decays = append(decays, decay)
+	}
+	return decays
+}
+
+func GetUserRatingsHistory(conn *gorm.DB, userId int, mode GameMode, limit int) (ratings []UserRating) {
 	rows, err := conn.Raw(`
 		SELECT
 			id,
 			rating,
+			deviation,
+			volatility,
 			user_id,
 			match_id,
+			game_mode,
+			reason,
 			is_tombstoned,
 			created_at
 		FROM user_ratings_history
 		WHERE
 			user_id = ? AND
+			game_mode = ? AND
 			is_tombstoned = false
 		ORDER BY
 			id DESC
 		LIMIT ?`,
 		userId,
+		mode,
 		limit).Rows()
 
 	if err != nil {
@@ -108,8 +358,12 @@ func GetUserRatingsHistory(conn *gorm.DB, userId int, limit int) (ratings []User
 		err := rows.Scan(
 			&userRating.UserRatingId,
 			&userRating.Rating,
+			&userRating.Deviation,
+			&userRating.Volatility,
 			&userRating.UserId,
 			&userRating.MatchId,
+			&userRating.GameMode,
+			&userRating.Reason,
 			&userRating.IsTombstoned,
 			&userRating.CreatedAt)
 
@@ -131,3 +385,27 @@ func TombstoneUserRating(conn *gorm.DB, ratingId int) {
 		panic(conn.Error)
 	}
 }
+
+/*
+	TombstoneAllUserRatings hides every rating history entry, used when ratings are being rebuilt from scratch.
+*/
+func TombstoneAllUserRatings(conn *gorm.DB) {
+	conn.Exec("UPDATE user_ratings_history SET is_tombstoned = true WHERE is_tombstoned = false")
+	if conn.Error != nil {
+		panic(conn.Error)
+	}
+}
+
+func setCurrentRating(conn *gorm.DB, userId int, mode GameMode, rating int, deviation float64, volatility float64) {
+	conn.Exec(
+		`INSERT INTO user_ratings (user_id, game_mode, rating, deviation, volatility) values (?, ?, ?, ?, ?)
+			ON DUPLICATE KEY UPDATE rating = VALUES(rating), deviation = VALUES(deviation), volatility = VALUES(volatility)`,
+		userId,
+		mode,
+		rating,
+		deviation,
+		volatility)
+	if conn.Error != nil {
+		panic(conn.Error)
+	}
+}
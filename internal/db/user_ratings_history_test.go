@@ -1,6 +1,7 @@
 package db
 
 import (
+	"discordbot/internal/app/ratings"
 	"fmt"
 	"github.com/stretchr/testify/assert"
 	"math/rand"
@@ -17,26 +18,30 @@ func TestUpdateRating(t *testing.T) {
 	testDiscordId := fmt.Sprintf("somediscordId%d", rand.Intn(1000000))
 	randomMatchId := 1000000
 
-	CreateUser(conn, User{0, testDiscordId, testDiscordUsername, DEFAULT_RATING})
+	CreateUser(conn, User{DiscordId: testDiscordId, DiscordUserName: testDiscordUsername})
 
 	_, user := GetUserByDiscordId(conn, testDiscordId)
 
 	testRating := rand.Intn(10000)
-	UpdateUserRating(conn, user.UserId, testRating, randomMatchId)
+	UpdateUserRating(conn, user.UserId, Bo3, ratings.PlayerRating{Rating: testRating, Deviation: 80.5, Volatility: 0.059}, randomMatchId)
 
-	_, updatedUser := GetUserByDiscordId(conn, testDiscordId)
-	if updatedUser.CurrentRating != testRating {
-		t.Error("Unable to create test user: " + testDiscordUsername)
+	currentRating := GetUserRating(conn, user.UserId, Bo3)
+	if currentRating.Rating != testRating {
+		t.Error("Unable to update rating for test user: " + testDiscordUsername)
 	}
 
-	updatedRating := GetUserRatingsHistory(conn, user.UserId, 1)
+	updatedRating := GetUserRatingsHistory(conn, user.UserId, Bo3, 1)
 
 	assert.Len(t, updatedRating, 1)
 	assert.Equal(t, testRating, updatedRating[0].Rating)
+	assert.Equal(t, 80.5, updatedRating[0].Deviation)
+	assert.Equal(t, 0.059, updatedRating[0].Volatility)
+	assert.Equal(t, 80.5, currentRating.Deviation)
+	assert.Equal(t, DEFAULT_RATING, GetUserRating(conn, user.UserId, Bo1).Rating, "Updating bo3 should not touch bo1.")
 
 	TombstoneUserRating(conn, updatedRating[0].UserRatingId)
 
-	tombstonedRatings := GetUserRatingsHistory(conn, user.UserId, 1)
+	tombstonedRatings := GetUserRatingsHistory(conn, user.UserId, Bo3, 1)
 	assert.Len(t, tombstonedRatings, 1)
 }
 
@@ -51,7 +56,7 @@ func TestRevertRating(t *testing.T) {
 	randomMatchId2 := 1000001
 	randomMatchId3 := 1000002
 
-	CreateUser(conn, User{0, testDiscordId, testDiscordUsername, DEFAULT_RATING})
+	CreateUser(conn, User{DiscordId: testDiscordId, DiscordUserName: testDiscordUsername})
 
 	_, user := GetUserByDiscordId(conn, testDiscordId)
 
@@ -59,36 +64,110 @@ func TestRevertRating(t *testing.T) {
 	testRating2 := rand.Intn(10000)
 	testRating3 := rand.Intn(10000)
 
-	UpdateUserRating(conn, user.UserId, testRating1, randomMatchId)
-	UpdateUserRating(conn, user.UserId, testRating2, randomMatchId2)
-	UpdateUserRating(conn, user.UserId, testRating3, randomMatchId3)
+	UpdateUserRating(conn, user.UserId, Bo3, ratings.PlayerRating{Rating: testRating1, Deviation: 10.0}, randomMatchId)
+	UpdateUserRating(conn, user.UserId, Bo3, ratings.PlayerRating{Rating: testRating2, Deviation: 20.0}, randomMatchId2)
+	UpdateUserRating(conn, user.UserId, Bo3, ratings.PlayerRating{Rating: testRating3, Deviation: 30.0}, randomMatchId3)
 
-	updatedRating := GetUserRatingsHistory(conn, user.UserId, 20)
+	updatedRating := GetUserRatingsHistory(conn, user.UserId, Bo3, 20)
 
 	assert.Len(t, updatedRating, 4)
 	assert.Equal(t, testRating3, updatedRating[0].Rating)
 	assert.Equal(t, testRating2, updatedRating[1].Rating)
 	assert.Equal(t, testRating1, updatedRating[2].Rating)
-	_, user = GetUserByDiscordId(conn, testDiscordId)
-	assert.Equal(t, testRating3, user.CurrentRating)
+	assert.Equal(t, testRating3, GetUserRating(conn, user.UserId, Bo3).Rating)
 
-	RevertUserRating(conn, user.UserId)
+	RevertUserRating(conn, user.UserId, Bo3)
 
-	updatedRating = GetUserRatingsHistory(conn, user.UserId, 20)
+	updatedRating = GetUserRatingsHistory(conn, user.UserId, Bo3, 20)
 	assert.Len(t, updatedRating, 3)
 	assert.Equal(t, testRating2, updatedRating[0].Rating)
 	assert.Equal(t, testRating1, updatedRating[1].Rating)
-	_, user = GetUserByDiscordId(conn, testDiscordId)
-	assert.Equal(t, testRating2, user.CurrentRating)
+	assert.Equal(t, testRating2, GetUserRating(conn, user.UserId, Bo3).Rating)
+	assert.Equal(t, 20.0, GetUserRating(conn, user.UserId, Bo3).Deviation)
 
-	RevertUserRating(conn, user.UserId)
-	updatedRating = GetUserRatingsHistory(conn, user.UserId, 20)
+	RevertUserRating(conn, user.UserId, Bo3)
+	updatedRating = GetUserRatingsHistory(conn, user.UserId, Bo3, 20)
 	assert.Len(t, updatedRating, 2)
 	assert.Equal(t, testRating1, updatedRating[0].Rating)
-	_, user = GetUserByDiscordId(conn, testDiscordId)
-	assert.Equal(t, testRating1, user.CurrentRating)
+	assert.Equal(t, testRating1, GetUserRating(conn, user.UserId, Bo3).Rating)
 
-	RevertUserRating(conn, user.UserId)
-	updatedRating = GetUserRatingsHistory(conn, user.UserId, 20)
+	RevertUserRating(conn, user.UserId, Bo3)
+	updatedRating = GetUserRatingsHistory(conn, user.UserId, Bo3, 20)
 	assert.Len(t, updatedRating, 1)
 }
+
+func TestDecayRating(t *testing.T) {
+	conn := GetGorm(GetTestMysSQLConnStr())
+
+	rand.Seed(time.Now().UnixNano())
+
+	user1 := createRatedUser(conn, fmt.Sprintf("somediscordId%d", rand.Intn(1000000)), fmt.Sprintf("coolsk8r1990%d", rand.Intn(1000000)), 1500)
+	user2 := createRatedUser(conn, fmt.Sprintf("somediscordId%d", rand.Intn(1000000)), fmt.Sprintf("coolsk8r1990%d", rand.Intn(1000000)), 1500)
+
+	longAgo := time.Now().AddDate(0, 0, -60)
+	CreateMatch(conn, Match{
+		CreatedAt:        longAgo,
+		UpdatedAt:        longAgo,
+		MatchState:       Completed,
+		GameMode:         Bo3,
+		P1UserId:         user1.UserId,
+		P2UserId:         user2.UserId,
+		P1MatchRequestId: -1,
+		P2MatchRequestId: -1,
+		Winner:           P1,
+	})
+
+	inactiveSince := time.Now().AddDate(0, 0, -30)
+	findUser1 := func() (found bool, inactive InactiveRating) {
+		for _, v := range FindInactiveRatings(conn, inactiveSince, 1200) {
+			if v.UserId == user1.UserId {
+				return true, v
+			}
+		}
+		return false, inactive
+	}
+
+	// Only the ladder they actually played on is inactive.
+	found, inactive := findUser1()
+	assert.True(t, found)
+	assert.Equal(t, Bo3, inactive.GameMode)
+	assert.Equal(t, 1500, inactive.Rating.Rating)
+
+	DecayUserRating(conn, user1.UserId, Bo3, ratings.PlayerRating{Rating: 1475, Deviation: ratings.DefaultDeviation, Volatility: ratings.DefaultVolatility}, time.Now())
+	assert.Equal(t, 1475, GetUserRating(conn, user1.UserId, Bo3).Rating)
+	history := GetUserRatingsHistory(conn, user1.UserId, Bo3, 1)
+	assert.Equal(t, RatingChangeDecay, history[0].Reason)
+
+	// A fresh decay counts as activity so they aren't decayed again straight away.
+	found, _ = findUser1()
+	assert.False(t, found)
+
+	assert.True(t, RevertLatestDecay(conn, user1.UserId, Bo3))
+	assert.Equal(t, 1500, GetUserRating(conn, user1.UserId, Bo3).Rating)
+	assert.False(t, RevertLatestDecay(conn, user1.UserId, Bo3), "The latest change is no longer a decay.")
+
+	// Nor straight after an admin reverted the decay.
+	found, _ = findUser1()
+	assert.False(t, found)
+}
+
+func TestRevertMatchRating(t *testing.T) {
+	conn := GetGorm(GetTestMysSQLConnStr())
+
+	rand.Seed(time.Now().UnixNano())
+
+	user := createRatedUser(conn, fmt.Sprintf("somediscordId%d", rand.Intn(1000000)), fmt.Sprintf("coolsk8r1990%d", rand.Intn(1000000)), 1500)
+	matchId := rand.Intn(1000000)
+	UpdateUserRating(conn, user.UserId, Bo3, ratings.PlayerRating{Rating: 1520, Deviation: ratings.DefaultDeviation, Volatility: ratings.DefaultVolatility}, matchId)
+	DecayUserRating(conn, user.UserId, Bo3, ratings.PlayerRating{Rating: 1495, Deviation: ratings.DefaultDeviation, Volatility: ratings.DefaultVolatility}, time.Now())
+
+	// The decay landed after the match, so reverting the match would revert the decay instead.
+	assert.False(t, RevertMatchRating(conn, user.UserId, Bo3, matchId))
+	assert.Equal(t, 1495, GetUserRating(conn, user.UserId, Bo3).Rating)
+
+	assert.True(t, RevertLatestDecay(conn, user.UserId, Bo3))
+	assert.False(t, RevertMatchRating(conn, user.UserId, Bo3, matchId+1), "Not the match that changed the rating.")
+	assert.True(t, RevertMatchRating(conn, user.UserId, Bo3, matchId))
+	assert.Equal(t, 1500, GetUserRating(conn, user.UserId, Bo3).Rating)
+	assert.False(t, RevertMatchRating(conn, user.UserId, Bo3, matchId), "The match was already reverted.")
+}
@@ -0,0 +1,36 @@
+package db
+
+import (
+	"gorm.io/gorm"
+	"log"
+	"time"
+)
+
+type StrikeReason string
+
+const (
+	// StrikeMissedReadyCheck the player let a ready check run out without accepting it.
+	StrikeMissedReadyCheck StrikeReason = "missed_ready_check"
+)
+
+func AddUserStrike(conn *gorm.DB, userId int, matchId int, reason StrikeReason, createdAt time.Time) (success bool) {
+	conn.Exec(
+		"INSERT INTO user_strikes (user_id, match_id, reason, created_at) values (?, ?, ?, ?)",
+		userId,
+		matchId,
+		reason,
+		createdAt)
+	if conn.Error != nil {
+		log.Println(conn.Error)
+		return false
+	}
+	return true
+}
+
+func CountUserStrikes(conn *gorm.DB, userId int) (count int) {
+	conn.Raw("SELECT COUNT(*) FROM user_strikes WHERE user_id = ?", userId).Scan(&count)
+	if conn.Error != nil {
+		panic(conn.Error)
+	}
+	return count
+}
@@ -11,32 +11,40 @@ type User struct {
 	UserId          int
 	DiscordId       string
 	DiscordUserName string
-	CurrentRating   int
+	Region          Region
 }
 
 type UserWithStats struct {
 	User   User
+	Rating int
 	Wins   int
 	Losses int
+	Draws  int
+	// LastMatchAt when the user last completed a match on the ladder, zero if they never have.
+	LastMatchAt time.Time
+	// GamesPlayed every match the user has completed on the ladder, regardless of season.
+	GamesPlayed int
 }
 
 func CreateUser(conn *gorm.DB, user User) {
-	conn.Exec("INSERT INTO users (discord_id, discord_username, current_rating) values (?, ?, ?)", user.DiscordId, user.DiscordUserName, user.CurrentRating)
+	conn.Exec("INSERT INTO users (discord_id, discord_username) values (?, ?)", user.DiscordId, user.DiscordUserName)
 	_, user = GetUserByDiscordId(conn, user.DiscordId)
-	// Populate initial ratings history.
-	UpdateUserRating(conn, user.UserId, user.CurrentRating, -1)
+	// Populate initial ratings and ratings history for every ladder.
+	for _, mode := range RatedGameModes {
+		UpdateUserRating(conn, user.UserId, mode, DefaultPlayerRating(), -1)
+	}
 	if conn.Error != nil {
 		panic(conn.Error)
 	}
 }
 
 func GetUserByDiscordId(conn *gorm.DB, discordId string) (foundUser bool, result User) {
-	row := conn.Raw("SELECT id, discord_id, discord_username, current_rating FROM users WHERE discord_id = ?", discordId).Row()
+	row := conn.Raw("SELECT id, discord_id, discord_username, COALESCE(region, '') FROM users WHERE discord_id = ?", discordId).Row()
 	if conn.Error != nil {
 		// TODO - How does this work with pooling and concurrency?
 		panic(conn.Error)
 	}
-	err := row.Scan(&result.UserId, &result.DiscordId, &result.DiscordUserName, &result.CurrentRating)
+	err := row.Scan(&result.UserId, &result.DiscordId, &result.DiscordUserName, &result.Region)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return false, result
@@ -48,11 +56,11 @@ func GetUserByDiscordId(conn *gorm.DB, discordId string) (foundUser bool, result
 }
 
 func GetUserById(conn *gorm.DB, userId int) (foundUser bool, result User) {
-	row := conn.Raw("SELECT id, discord_id, discord_username, current_rating FROM users WHERE id = ?", userId).Row()
+	row := conn.Raw("SELECT id, discord_id, discord_username, COALESCE(region, '') FROM users WHERE id = ?", userId).Row()
 	if conn.Error != nil {
 		panic(conn.Error)
 	}
-	err := row.Scan(&result.UserId, &result.DiscordId, &result.DiscordUserName, &result.CurrentRating)
+	err := row.Scan(&result.UserId, &result.DiscordId, &result.DiscordUserName, &result.Region)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return false, result
@@ -63,20 +71,70 @@ func GetUserById(conn *gorm.DB, userId int) (foundUser bool, result User) {
 	return true, result
 }
 
-func GetEloLeaderboard(conn *gorm.DB) (result []UserWithStats) {
+func SetUserRegion(conn *gorm.DB, userId int, region Region) (success bool) {
+	conn.Exec("UPDATE users SET region = ? WHERE id = ?", region, userId)
+	if conn.Error != nil {
+		log.Println(conn.Error)
+		return false
+	}
+	return true
+}
+
+func GetAllUsers(conn *gorm.DB) (result []User) {
+	rows, err := conn.Raw("SELECT id, discord_id, discord_username, COALESCE(region, '') FROM users ORDER BY id ASC").Rows()
+	if err != nil {
+		panic(err)
+	}
+
+	if conn.Error != nil {
+		panic(conn.Error)
+	}
+
+	for rows.Next() {
+		user := User{}
+		err := rows.Scan(&user.UserId, &user.DiscordId, &user.DiscordUserName, &user.Region)
+		if err != nil {
+			panic(err)
+		}
+		result = append(result, user)
+	}
+	return result
+}
+
+/*
+	GetEloLeaderboard ranks every user by their rating on one game mode's ladder. Wins and losses only count that mode's
+	matches played during the season, pass AllTime to count every match. In 2v2 a team's result counts for both partners.
+*/
+func GetEloLeaderboard(conn *gorm.DB, mode GameMode, season Season) (result []UserWithStats) {
+	start, end := season.Window()
 	rows, err := conn.Raw(`
 		SELECT 
 			u.id,
 			u.discord_username,
 			u.discord_id,
-			u.current_rating,
-			SUM(IF(m1.winner = 'p1' AND m1.p1_user_id = u.id, 1, 0)) + SUM(IF(m1.winner = 'p2' AND p2_user_id = u.id, 1, 0)) as total_wins,
-			SUM(IF(m1.winner = 'p1' AND m1.p2_user_id = u.id, 1, 0)) + SUM(IF(m1.winner = 'p2' AND m1.p1_user_id = u.id, 1, 0)) as total_losses
+			ur.rating,
+			SUM(IF(m1.winner = 'p1' AND u.id IN (m1.p1_user_id, m1.p1_partner_user_id), 1, 0)) + SUM(IF(m1.winner = 'p2' AND u.id IN (m1.p2_user_id, m1.p2_partner_user_id), 1, 0)) as total_wins,
+			SUM(IF(m1.winner = 'p1' AND u.id IN (m1.p2_user_id, m1.p2_partner_user_id), 1, 0)) + SUM(IF(m1.winner = 'p2' AND u.id IN (m1.p1_user_id, m1.p1_partner_user_id), 1, 0)) as total_losses,
+			SUM(IF(m1.winner = 'dr', 1, 0)) as total_draws,
+			(
+				SELECT MAX(m2.created_at) FROM matches m2
+				WHERE u.id IN (m2.p1_user_id, m2.p2_user_id, m2.p1_partner_user_id, m2.p2_partner_user_id) AND m2.match_state = 'completed' AND m2.game_mode = @game_mode
+			) as last_match_at,
+			(
+				SELECT COUNT(*) FROM matches m3
+				WHERE u.id IN (m3.p1_user_id, m3.p2_user_id, m3.p1_partner_user_id, m3.p2_partner_user_id) AND m3.match_state = 'completed' AND m3.game_mode = @game_mode
+			) as games_played
 		FROM users u
-		LEFT JOIN matches m1 ON (u.id = m1.p1_user_id OR u.id = m1.p2_user_id) AND m1.match_state = 'completed' 
-		GROUP BY u.id
-		ORDER BY current_rating DESC
-	`).Rows()
+		INNER JOIN user_ratings ur ON ur.user_id = u.id AND ur.game_mode = @game_mode
+		LEFT JOIN matches m1 ON
+			u.id IN (m1.p1_user_id, m1.p2_user_id, m1.p1_partner_user_id, m1.p2_partner_user_id) AND
+			m1.match_state = 'completed' AND
+			m1.game_mode = @game_mode AND
+			m1.created_at >= @start AND
+			m1.created_at < @end
+		GROUP BY u.id, ur.rating
+		ORDER BY ur.rating DESC
+	`, sql.Named("game_mode", mode), sql.Named("start", start), sql.Named("end", end)).Rows()
 	if err != nil {
 		panic(err)
 	}
@@ -88,13 +146,17 @@ func GetEloLeaderboard(conn *gorm.DB) (result []UserWithStats) {
 	for rows.Next() {
 		user := User{}
 		userWithStats := UserWithStats{}
+		var lastMatchAt sql.NullTime
 		err := rows.Scan(
 			&user.UserId,
 			&user.DiscordUserName,
 			&user.DiscordId,
-			&user.CurrentRating,
+			&userWithStats.Rating,
 			&userWithStats.Wins,
-			&userWithStats.Losses)
+			&userWithStats.Losses,
+			&userWithStats.Draws,
+			&lastMatchAt,
+			&userWithStats.GamesPlayed)
 
 		if err != nil {
 			log.Printf("Unable to read history row for user stats %v", err)
@@ -102,6 +164,7 @@ func GetEloLeaderboard(conn *gorm.DB) (result []UserWithStats) {
 		}
 
 		userWithStats.User = user
+		userWithStats.LastMatchAt = lastMatchAt.Time
 		result = append(result, userWithStats)
 	}
 	return result
@@ -114,20 +177,35 @@ func GetMonthlyWinLeaderboard(conn *gorm.DB) (result []UserWithStats) {
 
 	firstOfMonth := time.Date(currentYear, currentMonth, 1, 0, 0, 0, 0, currentLocation)
 
+	return getWinLeaderboard(conn, firstOfMonth, firstOfMonth.AddDate(0, 1, 0))
+}
+
+/*
+	GetSeasonWinLeaderboard ranks every user by their wins across the 1v1 modes during the season.
+*/
+func GetSeasonWinLeaderboard(conn *gorm.DB, season Season) (result []UserWithStats) {
+	start, end := season.Window()
+	return getWinLeaderboard(conn, start, end)
+}
+
+/*
+	getWinLeaderboard counts 1v1 matches only, 2v2 results are on their own ladder's board.
+*/
+func getWinLeaderboard(conn *gorm.DB, start time.Time, end time.Time) (result []UserWithStats) {
 	rows, err := conn.Raw(`
 			SELECT
 				u.id,
 				u.discord_username,
 				u.discord_id,
-				u.current_rating,
-				SUM(IF(m1.winner = 'p1' AND m1.p1_user_id = u.id, 1, 0)) + SUM(IF(m1.winner = 'p2' AND p2_user_id = u.id, 1, 0))                     as total_wins_this_month,
-				SUM(IF(m1.winner = 'p1' AND m1.p2_user_id = u.id, 1, 0)) + SUM(IF(m1.winner = 'p2' AND m1.p1_user_id = u.id, 1, 0)) as total_losses_this_month
+				SUM(IF(m1.winner = 'p1' AND m1.p1_user_id = u.id, 1, 0)) + SUM(IF(m1.winner = 'p2' AND p2_user_id = u.id, 1, 0))                     as total_wins,
+				SUM(IF(m1.winner = 'p1' AND m1.p2_user_id = u.id, 1, 0)) + SUM(IF(m1.winner = 'p2' AND m1.p1_user_id = u.id, 1, 0)) as total_losses,
+				SUM(IF(m1.winner = 'dr', 1, 0)) as total_draws
 			FROM users u
 			LEFT JOIN matches m1 ON
-				(u.id = m1.p1_user_id OR u.id = m1.p2_user_id) AND m1.match_state = 'completed' AND m1.created_at >= ?
+				(u.id = m1.p1_user_id OR u.id = m1.p2_user_id) AND m1.match_state = 'completed' AND m1.game_mode IN ? AND m1.created_at >= ? AND m1.created_at < ?
 			GROUP BY u.id
-			ORDER BY total_wins_this_month DESC
-	`, firstOfMonth).Rows()
+			ORDER BY total_wins DESC
+	`, SoloGameModes, start, end).Rows()
 	if err != nil {
 		panic(err)
 	}
@@ -143,9 +221,9 @@ func GetMonthlyWinLeaderboard(conn *gorm.DB) (result []UserWithStats) {
 			&user.UserId,
 			&user.DiscordUserName,
 			&user.DiscordId,
-			&user.CurrentRating,
 			&userWithStats.Wins,
-			&userWithStats.Losses)
+			&userWithStats.Losses,
+			&userWithStats.Draws)
 
 		if err != nil {
 			log.Printf("Unable to read history row for user stats %v", err)
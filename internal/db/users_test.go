@@ -1,7 +1,9 @@
 package db
 
 import (
+	"discordbot/internal/app/ratings"
 	"fmt"
+	"gorm.io/gorm"
 	"github.com/stretchr/testify/assert"
 	"math/rand"
 	"testing"
@@ -16,7 +18,7 @@ func TestCreateUser(t *testing.T) {
 	testDiscordUsername := fmt.Sprintf("coolsk8r1990%d", rand.Intn(1000000))
 	testDiscordId := fmt.Sprintf("somediscordId%d", rand.Intn(1000000))
 
-	CreateUser(conn, User{0, testDiscordId, testDiscordUsername, DEFAULT_RATING})
+	CreateUser(conn, User{DiscordId: testDiscordId, DiscordUserName: testDiscordUsername})
 
 	_, user := GetUserByDiscordId(conn, testDiscordId)
 
@@ -31,17 +33,17 @@ func TestGetUserStatsByRating(t *testing.T) {
 	for i := 0; i < 10; i++ {
 		testDiscordUsername := fmt.Sprintf("coolsk8r1990%d", rand.Intn(1000000))
 		testDiscordId := fmt.Sprintf("somediscordId%d", rand.Intn(1000000))
-		CreateUser(conn, User{0, testDiscordId, testDiscordUsername, rand.Intn(1500)})
+		createRatedUser(conn, testDiscordId, testDiscordUsername, rand.Intn(1500))
 	}
 	// Insert one very high elo user.
 	veryHighElo := 10000
 	testDiscordUsername := fmt.Sprintf("coolsk8r1990%d", rand.Intn(1000000))
 	testDiscordId := fmt.Sprintf("somediscordId%d", rand.Intn(1000000))
-	CreateUser(conn, User{0, testDiscordId, testDiscordUsername, veryHighElo})
+	createRatedUser(conn, testDiscordId, testDiscordUsername, veryHighElo)
 
-	usersWithStats := GetEloLeaderboard(conn)
+	usersWithStats := GetEloLeaderboard(conn, Bo3, AllTime)
 	assert.Greater(t, len(usersWithStats), 10)
-	assert.Equal(t, usersWithStats[0].User.CurrentRating, veryHighElo)
+	assert.Equal(t, usersWithStats[0].Rating, veryHighElo)
 }
 
 func TestGetMonthlyWinLeaderboard(t *testing.T) {
@@ -50,7 +52,7 @@ func TestGetMonthlyWinLeaderboard(t *testing.T) {
 
 	testDiscordUsername := fmt.Sprintf("coolsk8r1990%d", rand.Intn(1000000))
 	testDiscordId := fmt.Sprintf("somediscordId%d", rand.Intn(1000000))
-	CreateUser(conn, User{0, testDiscordId, testDiscordUsername, rand.Intn(1500)})
+	createRatedUser(conn, testDiscordId, testDiscordUsername, rand.Intn(1500))
 
 	_, thePatsy := GetUserByDiscordId(conn, testDiscordId)
 
@@ -58,7 +60,7 @@ func TestGetMonthlyWinLeaderboard(t *testing.T) {
 	for i := 0; i < 4; i++ {
 		testDiscordUsername := fmt.Sprintf("coolsk8r1990%d", rand.Intn(1000000))
 		testDiscordId := fmt.Sprintf("somediscordId%d", rand.Intn(1000000))
-		CreateUser(conn, User{0, testDiscordId, testDiscordUsername, rand.Intn(1500)})
+		createRatedUser(conn, testDiscordId, testDiscordUsername, rand.Intn(1500))
 
 		_, theLatestWinner := GetUserByDiscordId(conn, testDiscordId)
 
@@ -82,3 +84,13 @@ func TestGetMonthlyWinLeaderboard(t *testing.T) {
 	assert.GreaterOrEqual(t, usersWithStats[0].Wins, usersWithStats[1].Wins)
 	assert.GreaterOrEqual(t, usersWithStats[1].Wins, usersWithStats[2].Wins)
 }
+
+// createRatedUser creates a user whose rating on every ladder starts at the given rating.
+func createRatedUser(conn *gorm.DB, discordId string, discordUsername string, rating int) (user User) {
+	CreateUser(conn, User{DiscordId: discordId, DiscordUserName: discordUsername})
+	_, user = GetUserByDiscordId(conn, discordId)
+	for _, mode := range RatedGameModes {
+		UpdateUserRating(conn, user.UserId, mode, ratings.PlayerRating{Rating: rating, Deviation: ratings.DefaultDeviation, Volatility: ratings.DefaultVolatility}, -1)
+	}
+	return user
+}